@@ -23,6 +23,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func write(w io.Writer, content []byte) error {
@@ -51,6 +52,11 @@ func getApp(name string, u *auth.User) (app.App, error) {
 	return app, nil
 }
 
+// CloneRepositoryHandler deploys the given commit of the app. It's called by
+// the post-receive hook of the git repository of the app, which sends the
+// commit and the user that pushed it. The endpoint isn't authenticated, so
+// the user is recorded only as the unverified pusher of the deploy (see
+// app.DeployPush).
 func CloneRepositoryHandler(w http.ResponseWriter, r *http.Request) error {
 	w.Header().Set("Content-Type", "text")
 	instance := app.App{Name: r.URL.Query().Get(":name")}
@@ -63,27 +69,7 @@ func CloneRepositoryHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	err = write(&logWriter, []byte("\n ---> Replicating the application repository across units\n"))
-	if err != nil {
-		return err
-	}
-	out, err := repository.CloneOrPull(&instance) // should iterate over the machines
-	if err != nil {
-		return &errors.Http{Code: http.StatusInternalServerError, Message: string(out)}
-	}
-	err = write(&logWriter, out)
-	if err != nil {
-		return err
-	}
-	err = write(&logWriter, []byte("\n ---> Installing dependencies\n"))
-	if err != nil {
-		return err
-	}
-	err = instance.InstallDeps(&logWriter)
-	if err != nil {
-		return err
-	}
-	err = instance.Restart(&logWriter)
+	err = instance.DeployPush(r.URL.Query().Get("commit"), r.URL.Query().Get("user"), &logWriter)
 	if err != nil {
 		return err
 	}
@@ -244,7 +230,7 @@ func AddUnitsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error
 	if err != nil {
 		return err
 	}
-	return app.AddUnits(n)
+	return app.AddUnits(n, r.URL.Query().Get("process"))
 }
 
 func RemoveUnitsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -257,7 +243,7 @@ func RemoveUnitsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) er
 	if err != nil {
 		return err
 	}
-	return app.RemoveUnits(uint(n))
+	return app.RemoveUnits(uint(n), r.URL.Query().Get("process"))
 }
 
 func grantAccessToTeam(appName, teamName string, u *auth.User) error {
@@ -375,12 +361,34 @@ func RunCommand(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	if len(c) < 1 {
 		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
 	}
-	appName := r.URL.Query().Get(":name")
-	app, err := getApp(appName, u)
+	query := r.URL.Query()
+	target := app.RunTarget{Unit: query.Get("unit"), Parallel: query.Get("parallel") == "1"}
+	if n := query.Get("units"); n != "" {
+		target.Units, err = strconv.Atoi(n)
+		if err != nil || target.Units < 1 {
+			msg := `Parameter "units" must be a positive integer.`
+			return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	appName := query.Get(":name")
+	a, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
-	return app.Run(string(c), w)
+	results, err := a.RunOn(string(c), w, target)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	} else if err != nil {
+		return err
+	}
+	// The summary is parsed by the client to define its exit status.
+	if len(results) > 0 {
+		fmt.Fprintln(w)
+		for _, result := range results {
+			fmt.Fprintf(w, "Unit %s exited with status %d.\n", result.Unit, result.ExitCode)
+		}
+	}
+	return nil
 }
 
 func GetEnv(w http.ResponseWriter, r *http.Request, u *auth.User) (err error) {
@@ -497,6 +505,35 @@ func setCName(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	return err
 }
 
+// logFilter builds the log filter from the query string of the request. Dates
+// are in RFC 3339 format.
+func logFilter(r *http.Request) (app.LogFilter, error) {
+	query := r.URL.Query()
+	filter := app.LogFilter{
+		Source: query.Get("source"),
+		Unit:   query.Get("unit"),
+		Level:  query.Get("level"),
+		Grep:   query.Get("grep"),
+	}
+	for _, p := range []struct {
+		name string
+		date *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := query.Get(p.name); v != "" {
+			date, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				msg := fmt.Sprintf(`Parameter "%s" must be a date in RFC 3339 format.`, p.name)
+				return filter, &errors.Http{Code: http.StatusBadRequest, Message: msg}
+			}
+			*p.date = date
+		}
+	}
+	if err := filter.Validate(); err != nil {
+		return filter, &errors.Http{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return filter, nil
+}
+
 func appLog(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	var err error
 	var lines int
@@ -509,13 +546,17 @@ func appLog(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	} else {
 		return &errors.Http{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
+	filter, err := logFilter(r)
+	if err != nil {
+		return err
+	}
 	w.Header().Set("Content-Type", "application/json")
 	appName := r.URL.Query().Get(":name")
 	a, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
-	logs, err := a.LastLogs(lines, r.URL.Query().Get("source"))
+	logs, err := a.LastLogs(lines, filter)
 	if err != nil {
 		return err
 	}
@@ -529,6 +570,9 @@ func appLog(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 		l := app.NewLogListener(&a)
 		defer l.Close()
 		for log := range l.C {
+			if !filter.Match(log) {
+				continue
+			}
 			err := encoder.Encode([]app.Applog{log})
 			if err != nil {
 				break
@@ -538,6 +582,57 @@ func appLog(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	return nil
 }
 
+func setLogRetention(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	msg := "You must provide the log retention."
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	var v map[string]int
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	days, ok := v["retention"]
+	if !ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "The log retention must not be negative."}
+	}
+	return a.SetLogRetention(days)
+}
+
+// setDeployStrategy defines how the app is deployed. The body of the request
+// is a JSON object with the key "strategy" (default or blue-green).
+func setDeployStrategy(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	msg := "You must provide the deploy strategy."
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	var v map[string]string
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	strategy, ok := v["strategy"]
+	if !ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	err = a.SetDeployStrategy(strategy)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
 func getServiceInstace(instanceName, appName string, u *auth.User) (service.ServiceInstance, app.App, error) {
 	var app app.App
 	conn, err := db.Conn()
@@ -594,33 +689,126 @@ func UnbindHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	return instance.UnbindApp(&a)
 }
 
+// RestartHandler restarts the app. When the rolling parameter is given, the
+// units are restarted in batches of that size.
 func RestartHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	w.Header().Set("Content-Type", "text")
 	instance, err := getApp(r.URL.Query().Get(":name"), u)
 	if err != nil {
 		return err
 	}
-	return instance.Restart(w)
+	rolling := r.URL.Query().Get("rolling")
+	if rolling == "" {
+		return instance.Restart(w)
+	}
+	batch, err := strconv.Atoi(rolling)
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid batch size: " + rolling}
+	}
+	err = instance.RollingRestart(w, batch)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
 }
 
-func AddLogHandler(w http.ResponseWriter, r *http.Request) error {
-	app := app.App{Name: r.URL.Query().Get(":name")}
-	err := app.Get()
+// StopHandler stops the app, keeping its units.
+func StopHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	w.Header().Set("Content-Type", "text")
+	instance, err := getApp(r.URL.Query().Get(":name"), u)
 	if err != nil {
 		return err
 	}
-	defer r.Body.Close()
-	body, err := ioutil.ReadAll(r.Body)
+	err = instance.Stop(w)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// StartHandler starts a stopped app.
+func StartHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	w.Header().Set("Content-Type", "text")
+	instance, err := getApp(r.URL.Query().Get(":name"), u)
 	if err != nil {
 		return err
 	}
-	var logs []string
-	err = json.Unmarshal(body, &logs)
-	for _, log := range logs {
-		err := app.Log(log, "app")
-		if err != nil {
-			return err
+	err = instance.Start(w)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+const (
+	// maxLogBodySize is the maximum size, in bytes, of the body of a request
+	// to add logs.
+	maxLogBodySize = 1 << 20
+
+	// maxLogBatch is the maximum number of logs added in one request.
+	maxLogBatch = 1000
+)
+
+// logToken extracts the log ingestion token from the Authorization header.
+// Both "bearer <token>" and the bare token are accepted.
+func logToken(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(token) > 7 && strings.ToLower(token[:7]) == "bearer " {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// AddLogHandler adds logs sent by the units of the app. Requests must be
+// authenticated with the log token of the app, available to units in the
+// TSURU_LOG_TOKEN environment variable.
+//
+// The body is a JSON array, in which each entry is either a string, that is
+// the message of the log, or an object with the keys Message, Source, Unit,
+// Date and Level.
+func AddLogHandler(w http.ResponseWriter, r *http.Request) error {
+	name := r.URL.Query().Get(":name")
+	a := app.App{Name: name}
+	err := a.Get()
+	if err != nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", name)}
+	}
+	if !a.ValidLogToken(logToken(r)) {
+		return &errors.Http{Code: http.StatusUnauthorized, Message: "Invalid log token."}
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxLogBodySize))
+	if err != nil {
+		return &errors.Http{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("The request body must not be larger than %d bytes.", maxLogBodySize),
+		}
+	}
+	var entries []json.RawMessage
+	if err = json.Unmarshal(body, &entries); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	if len(entries) > maxLogBatch {
+		return &errors.Http{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("You can't send more than %d logs at once.", maxLogBatch),
+		}
+	}
+	logs := make([]app.Applog, len(entries))
+	for i, entry := range entries {
+		var message string
+		if json.Unmarshal(entry, &message) == nil {
+			logs[i] = app.Applog{Message: message}
+			continue
 		}
+		if err = json.Unmarshal(entry, &logs[i]); err != nil {
+			return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+		}
+	}
+	if err = a.AddLogs(logs); err == app.ErrInvalidLogLevel {
+		return &errors.Http{Code: http.StatusBadRequest, Message: err.Error()}
+	} else if err != nil {
+		return err
 	}
 	w.WriteHeader(http.StatusOK)
 	return nil
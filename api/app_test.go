@@ -17,6 +17,7 @@ import (
 	"github.com/globocom/tsuru/repository"
 	"github.com/globocom/tsuru/safe"
 	"github.com/globocom/tsuru/service"
+	tsuruTesting "github.com/globocom/tsuru/testing"
 	"io"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
@@ -172,6 +173,62 @@ post-restart:
 	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
 }
 
+func (s *S) TestCloneRepositoryHandlerUsesTheDeployer(c *gocheck.C) {
+	deployer := tsuruTesting.NewFakeDeployer()
+	app.Provisioner = deployer
+	defer func() {
+		app.Provisioner = s.provisioner
+	}()
+	a := app.App{
+		Name:      "someapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/repository/clone?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneRepositoryHandler(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "\n ---> Tsuru receiving push\nDeploying someapp\n\n ---> Deploy done!\n\n")
+	c.Assert(deployer.Deploys(&a), gocheck.Equals, 1)
+	c.Assert(deployer.GetCmds("", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestCloneRepositoryHandlerRecordsTheUserAsThePusher(c *gocheck.C) {
+	deployer := tsuruTesting.NewFakeDeployer()
+	app.Provisioner = deployer
+	defer func() {
+		app.Provisioner = s.provisioner
+	}()
+	a := app.App{
+		Name:      "someapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/repository/clone?:name=%s&commit=abc123&user=%s", a.Name, a.Name, s.user.Email)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneRepositoryHandler(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	deploys, err := app.ListDeploys(a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 1)
+	c.Assert(deploys[0].Commit, gocheck.Equals, "abc123")
+	c.Assert(deploys[0].User, gocheck.Equals, "")
+	c.Assert(deploys[0].Pusher, gocheck.Equals, s.user.Email)
+}
+
 func (s *S) TestCloneRepositoryRunsCloneOrPullThenPreRestartThenRestartThenPosRestartHooksInOrder(c *gocheck.C) {
 	var w safe.Buffer
 	l := stdlog.New(&w, "", stdlog.LstdFlags)
@@ -550,6 +607,27 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(a.Units, gocheck.HasLen, 3)
 }
 
+func (s *S) TestAddUnitsUndeclaredProcessType(c *gocheck.C) {
+	a := app.App{
+		Name:      "armorandsword",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.provisioner.Destroy(&a)
+	body := strings.NewReader("3")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:name=armorandsword&process=worker", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddUnitsHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.ErrorMatches, `^The app does not declare the process type "worker".$`)
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 1)
+}
+
 func (s *S) TestAddUnitsReturns404IfAppDoesNotExist(c *gocheck.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:name=armorandsword", body)
@@ -643,6 +721,36 @@ func (s *S) TestRemoveUnits(c *gocheck.C) {
 	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 2)
 }
 
+func (s *S) TestRemoveUnitsOfProcessType(c *gocheck.C) {
+	a := app.App{
+		Name:      "velha",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "velha/1"}, {Name: "velha/2", ProcessType: "worker"}, {Name: "velha/3", ProcessType: "worker"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 3)
+	body := strings.NewReader("1")
+	request, err := http.NewRequest("DELETE", "/apps/velha/units?:name=velha&process=worker", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveUnitsHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 2)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "velha/1")
+	c.Assert(a.Units[1].Name, gocheck.Equals, "velha/3")
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 3)
+}
+
 func (s *S) TestRemoveUnitsReturns404IfAppDoesNotExist(c *gocheck.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("DELETE", "/apps/fetisha/units?:name=fetisha", body)
@@ -1063,7 +1171,7 @@ func (s *S) TestRunHandlerShouldExecuteTheGivenCommandInTheGivenApp(c *gocheck.C
 	recorder := httptest.NewRecorder()
 	err = RunCommand(recorder, request, s.user)
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(recorder.Body.String(), gocheck.Equals, "lots of files")
+	c.Assert(recorder.Body.String(), gocheck.Equals, "[i-0800] lots of files\n\nUnit i-0800 exited with status 0.\n")
 	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
 	expected := "[ -f /home/application/apprc ] && source /home/application/apprc;"
 	expected += " [ -d /home/application/current ] && cd /home/application/current;"
@@ -1073,7 +1181,7 @@ func (s *S) TestRunHandlerShouldExecuteTheGivenCommandInTheGivenApp(c *gocheck.C
 }
 
 func (s *S) TestRunHandlerReturnsTheOutputOfTheCommandEvenIfItFails(c *gocheck.C) {
-	s.provisioner.PrepareFailure("ExecuteCommand", &errors.Http{Code: 500, Message: "something went wrong"})
+	s.provisioner.PrepareFailure("ExecuteCommandOnUnit", &provision.ExitError{Status: 3})
 	s.provisioner.PrepareOutput([]byte("failure output"))
 	a := app.App{
 		Name:      "secrets",
@@ -1089,9 +1197,73 @@ func (s *S) TestRunHandlerReturnsTheOutputOfTheCommandEvenIfItFails(c *gocheck.C
 	c.Assert(err, gocheck.IsNil)
 	recorder := httptest.NewRecorder()
 	err = RunCommand(recorder, request, s.user)
-	c.Assert(err, gocheck.NotNil)
-	c.Assert(err.Error(), gocheck.Equals, "something went wrong")
-	c.Assert(recorder.Body.String(), gocheck.Equals, "failure output")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "[i-0800] failure output\n\nUnit i-0800 exited with status 3.\n")
+}
+
+func (s *S) TestRunHandlerWithTarget(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "secrets/0", State: "started"},
+			{Name: "secrets/1", State: "started"},
+			{Name: "secrets/2", State: "started"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/run/?:name=%s&units=2&parallel=1", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("ls"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RunCommand(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	expected := "\nUnit secrets/0 exited with status 0.\nUnit secrets/1 exited with status 0.\n"
+	c.Assert(recorder.Body.String(), gocheck.Equals, expected)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, gocheck.HasLen, 2)
+	url = fmt.Sprintf("/apps/%s/run/?:name=%s&unit=secrets/2", a.Name, a.Name)
+	request, err = http.NewRequest("POST", url, strings.NewReader("ls"))
+	c.Assert(err, gocheck.IsNil)
+	recorder = httptest.NewRecorder()
+	err = RunCommand(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "\nUnit secrets/2 exited with status 0.\n")
+}
+
+func (s *S) TestRunHandlerInvalidTarget(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "secrets/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	var tests = []struct {
+		query   string
+		message string
+	}{
+		{"units=0", `Parameter "units" must be a positive integer.`},
+		{"units=two", `Parameter "units" must be a positive integer.`},
+		{"unit=secrets/9", `The app "secrets" has no unit named "secrets/9".`},
+	}
+	for _, t := range tests {
+		url := fmt.Sprintf("/apps/%s/run/?:name=%s&%s", a.Name, a.Name, t.query)
+		request, err := http.NewRequest("POST", url, strings.NewReader("ls"))
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = RunCommand(recorder, request, s.user)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
 }
 
 func (s *S) TestRunHandlerReturnsBadRequestIfTheCommandIsMissing(c *gocheck.C) {
@@ -1812,16 +1984,12 @@ func (s *S) TestAppLogShouldHaveContentType(c *gocheck.C) {
 		Name:      "lost",
 		Framework: "vougan",
 		Teams:     []string{s.team.Name},
-		Logs: []app.Applog{
-			{
-				Date:    time.Now(),
-				Message: "Something new",
-			},
-		},
 	}
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	a.Log("Something new", "tsuru")
 	url := fmt.Sprintf("/apps/%s/log/?:name=%s&lines=10", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, gocheck.IsNil)
@@ -1841,6 +2009,7 @@ func (s *S) TestAppLogSelectByLines(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	for i := 0; i < 15; i++ {
 		a.Log(strconv.Itoa(i), "source")
 	}
@@ -1869,6 +2038,7 @@ func (s *S) TestAppLogSelectBySource(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	a.Log("mars log", "mars")
 	a.Log("earth log", "earth")
 	url := fmt.Sprintf("/apps/%s/log/?:name=%s&source=mars&lines=10", a.Name, a.Name)
@@ -1889,6 +2059,93 @@ func (s *S) TestAppLogSelectBySource(c *gocheck.C) {
 	c.Assert(logs[0].Source, gocheck.Equals, "mars")
 }
 
+func (s *S) TestAppLogSelectByUnitLevelAndText(c *gocheck.C) {
+	a := app.App{
+		Name:      "lost",
+		Framework: "vougan",
+		Teams:     []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	err = a.AddLogs([]app.Applog{
+		{Message: "connection refused", Unit: "lost/0", Level: "error"},
+		{Message: "connection refused", Unit: "lost/1", Level: "error"},
+		{Message: "connection established", Unit: "lost/0", Level: "error"},
+		{Message: "connection refused", Unit: "lost/0", Level: "info"},
+	})
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log/?:name=%s&lines=10&unit=lost/0&level=warning&grep=refused", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "connection refused")
+	c.Assert(logs[0].Unit, gocheck.Equals, "lost/0")
+	c.Assert(logs[0].Level, gocheck.Equals, "error")
+}
+
+func (s *S) TestAppLogSelectByTimeRange(c *gocheck.C) {
+	a := app.App{
+		Name:      "lost",
+		Framework: "vougan",
+		Teams:     []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	date := time.Date(2013, 7, 10, 12, 0, 0, 0, time.UTC)
+	err = a.AddLogs([]app.Applog{
+		{Message: "first", Date: date},
+		{Message: "second", Date: date.Add(time.Hour)},
+		{Message: "third", Date: date.Add(2 * time.Hour)},
+	})
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log/?:name=%s&lines=10&since=2013-07-10T12:30:00Z&until=2013-07-10T14:00:00Z", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "second")
+	c.Assert(logs[1].Message, gocheck.Equals, "third")
+}
+
+func (s *S) TestAppLogReturnsBadRequestIfFiltersAreInvalid(c *gocheck.C) {
+	var tests = []struct {
+		query   string
+		message string
+	}{
+		{"since=yesterday", `Parameter "since" must be a date in RFC 3339 format.`},
+		{"until=2013-07-10", `Parameter "until" must be a date in RFC 3339 format.`},
+		{"level=fatal", app.ErrInvalidLogLevel.Error()},
+		{"grep=conn(", "Invalid regular expression: error parsing regexp: missing closing ): `conn(`."},
+	}
+	for _, t := range tests {
+		url := "/apps/something/log/?:name=doesntmatter&lines=10&" + t.query
+		request, err := http.NewRequest("GET", url, nil)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appLog(recorder, request, s.user)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
 func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *gocheck.C) {
 	a := app.App{
 		Name:      "lost",
@@ -1898,6 +2155,7 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	logs := make([]app.Applog, 15)
 	now := time.Now()
 	for i := 0; i < 15; i++ {
@@ -1905,11 +2163,11 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *gocheck.C) {
 			Date:    now.Add(time.Duration(i) * time.Hour),
 			Message: strconv.Itoa(i),
 			Source:  "source",
+			AppName: a.Name,
 		}
+		err = s.conn.Logs().Insert(logs[i])
+		c.Assert(err, gocheck.IsNil)
 	}
-	a.Logs = logs
-	err = s.conn.Apps().Update(bson.M{"name": a.Name}, a)
-	c.Assert(err, gocheck.IsNil)
 	url := fmt.Sprintf("/apps/%s/log/?:name=%s&lines=3", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, gocheck.IsNil)
@@ -1938,6 +2196,7 @@ func (s *S) TestAppLogShouldReturnLogByApp(c *gocheck.C) {
 	err := s.conn.Apps().Insert(app1)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": app1.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app1.Name})
 	app1.Log("app1 log", "source")
 	app2 := app.App{
 		Name:      "app2",
@@ -1947,6 +2206,7 @@ func (s *S) TestAppLogShouldReturnLogByApp(c *gocheck.C) {
 	err = s.conn.Apps().Insert(app2)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": app2.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app2.Name})
 	app2.Log("app2 log", "source")
 	app3 := app.App{
 		Name:      "app3",
@@ -1956,6 +2216,7 @@ func (s *S) TestAppLogShouldReturnLogByApp(c *gocheck.C) {
 	err = s.conn.Apps().Insert(app3)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": app3.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app3.Name})
 	app3.Log("app3 log", "tsuru")
 	url := fmt.Sprintf("/apps/%s/log/?:name=%s&lines=10", app3.Name, app3.Name)
 	request, err := http.NewRequest("GET", url, nil)
@@ -2352,6 +2613,72 @@ func (s *S) TestRestartHandler(c *gocheck.C) {
 	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
 }
 
+func (s *S) TestRestartHandlerRolling(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+	s.provisioner.PrepareOutput([]byte("healthcheck:\n  path: /\n  port: " + port + "\n")) // loadHooks
+	a := app.App{
+		Name:  "rollingstress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "rollingstress/0", State: "started", Ip: "127.0.0.1"},
+			{Name: "rollingstress/1", State: "started", Ip: "127.0.0.1"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/restart?:name=%s&rolling=1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RestartHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	result := strings.Replace(recorder.Body.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, ".*# ---> Restarting units rollingstress/0#.*# ---> Restarting units rollingstress/1#.*")
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"rollingstress/0", "rollingstress/1"})
+}
+
+func (s *S) TestRestartHandlerRollingInvalidBatch(c *gocheck.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/restart?:name=%s&rolling=many", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RestartHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "Invalid batch size: many")
+}
+
+func (s *S) TestRestartHandlerRollingWithoutHealthcheck(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // loadHooks
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/restart?:name=%s&rolling=1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RestartHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The app must declare a health check in app.conf to be restarted in rolling mode.")
+}
+
 func (s *S) TestRestartHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
 	request, err := http.NewRequest("GET", "/apps/unknown/restart?:name=unknown", nil)
 	c.Assert(err, gocheck.IsNil)
@@ -2379,17 +2706,257 @@ func (s *S) TestRestartHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *go
 	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
 }
 
+func (s *S) TestStopHandler(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/stop?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = StopHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "\n ---> Stopping your app\n")
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStopped.String())
+}
+
+func (s *S) TestStopHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/stop?:name=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = StopHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestStopHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/stop?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = StopHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestStartHandler(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Name: "i-0800", State: "stopped"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/start?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = StartHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "\n ---> Starting your app\n")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+}
+
+func (s *S) TestStartHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/start?:name=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = StartHandler(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestSetLogRetention(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"retention":7}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.Equals, 7)
+}
+
+func (s *S) TestSetLogRetentionNegativeValue(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"retention":-1}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The log retention must not be negative.")
+}
+
+func (s *S) TestSetLogRetentionMissingFromTheBody(c *gocheck.C) {
+	bodies := []io.Reader{nil, strings.NewReader(`{}`), strings.NewReader(`{"days":3}`)}
+	for _, b := range bodies {
+		request, err := http.NewRequest("PUT", "/apps/unknown/log?:name=unknown", b)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = setLogRetention(recorder, request, s.user)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, "You must provide the log retention.")
+	}
+}
+
+func (s *S) TestSetLogRetentionUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "lost", Framework: "vougan"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"retention":7}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestSetDeployStrategy(c *gocheck.C) {
+	a := app.App{Name: "skyline", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(bson.M{
+		"name":        a.Name,
+		"teams":       a.Teams,
+		"healthcheck": bson.M{"path": "/healthcheck"},
+	})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy-strategy?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"strategy":"blue-green"}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setDeployStrategy(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, app.BlueGreenStrategy)
+}
+
+func (s *S) TestSetDeployStrategyWithoutHealthcheck(c *gocheck.C) {
+	a := app.App{Name: "skyline", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy-strategy?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"strategy":"blue-green"}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setDeployStrategy(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The app must declare a health check in app.conf to be deployed in blue/green mode.")
+}
+
+func (s *S) TestSetDeployStrategyUnknownStrategy(c *gocheck.C) {
+	a := app.App{Name: "skyline", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy-strategy?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"strategy":"red-black"}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setDeployStrategy(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `Unknown deploy strategy "red-black". Valid strategies are default and blue-green.`)
+}
+
+func (s *S) TestSetDeployStrategyMissingFromTheBody(c *gocheck.C) {
+	bodies := []io.Reader{nil, strings.NewReader(`{}`), strings.NewReader(`{"mode":"blue-green"}`)}
+	for _, b := range bodies {
+		request, err := http.NewRequest("PUT", "/apps/unknown/deploy-strategy?:name=unknown", b)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = setDeployStrategy(recorder, request, s.user)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, "You must provide the deploy strategy.")
+	}
+}
+
+func (s *S) TestSetDeployStrategyUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "lost", Framework: "vougan"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy-strategy?:name=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"strategy":"blue-green"}`)
+	request, err := http.NewRequest("PUT", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setDeployStrategy(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestAddLogHandler(c *gocheck.C) {
 	a := app.App{
 		Name:      "myapp",
 		Framework: "python",
+		LogToken:  "abc123",
 	}
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	b := strings.NewReader(`["message 1", "message 2", "message 3"]`)
 	request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", b)
 	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
 	recorder := httptest.NewRecorder()
 	err = AddLogHandler(recorder, request)
 	c.Assert(err, gocheck.IsNil)
@@ -2400,12 +2967,157 @@ func (s *S) TestAddLogHandler(c *gocheck.C) {
 		"message 3",
 	}
 	for _, msg := range messages {
-		length, err := s.conn.Apps().Find(bson.M{"name": a.Name, "logs.message": msg}).Count()
+		length, err := s.conn.Logs().Find(bson.M{"appname": a.Name, "message": msg, "source": "app"}).Count()
 		c.Check(err, gocheck.IsNil)
 		c.Check(length, gocheck.Equals, 1)
 	}
 }
 
+func (s *S) TestAddLogHandlerStructuredLogs(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	b := strings.NewReader(`[
+		{"Message": "starting worker", "Source": "worker", "Unit": "myapp/1", "Level": "info", "Date": "2013-07-10T13:45:31Z"},
+		"plain message"
+	]`)
+	request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", b)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
+	recorder := httptest.NewRecorder()
+	err = AddLogHandler(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var logs []app.Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).Sort("date").All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "starting worker")
+	c.Assert(logs[0].Source, gocheck.Equals, "worker")
+	c.Assert(logs[0].Unit, gocheck.Equals, "myapp/1")
+	c.Assert(logs[0].Level, gocheck.Equals, "info")
+	c.Assert(logs[0].Date.Equal(time.Date(2013, 7, 10, 13, 45, 31, 0, time.UTC)), gocheck.Equals, true)
+	c.Assert(logs[1].Message, gocheck.Equals, "plain message")
+	c.Assert(logs[1].Source, gocheck.Equals, "app")
+}
+
+func (s *S) TestAddLogHandlerAppNotFound(c *gocheck.C) {
+	b := strings.NewReader(`["message 1"]`)
+	request, err := http.NewRequest("POST", "/apps/unknown/log/?:name=unknown", b)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
+	recorder := httptest.NewRecorder()
+	err = AddLogHandler(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "App unknown not found.")
+}
+
+func (s *S) TestAddLogHandlerInvalidToken(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	for _, header := range []string{"", "bearer wrong", "abc12"} {
+		b := strings.NewReader(`["message 1"]`)
+		request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", b)
+		c.Assert(err, gocheck.IsNil)
+		request.Header.Set("Authorization", header)
+		recorder := httptest.NewRecorder()
+		err = AddLogHandler(recorder, request)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusUnauthorized)
+		c.Assert(e.Message, gocheck.Equals, "Invalid log token.")
+	}
+	n, err := s.conn.Logs().Find(bson.M{"appname": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddLogHandlerTooManyLogs(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	messages := make([]string, maxLogBatch+1)
+	for i := range messages {
+		messages[i] = "hello"
+	}
+	data, err := json.Marshal(messages)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", strings.NewReader(string(data)))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
+	recorder := httptest.NewRecorder()
+	err = AddLogHandler(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(e.Message, gocheck.Equals, "You can't send more than 1000 logs at once.")
+}
+
+func (s *S) TestAddLogHandlerBodyTooLarge(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	data := `["` + strings.Repeat("a", maxLogBodySize) + `"]`
+	request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", strings.NewReader(data))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
+	recorder := httptest.NewRecorder()
+	err = AddLogHandler(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusRequestEntityTooLarge)
+}
+
+func (s *S) TestAddLogHandlerInvalidLevel(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	b := strings.NewReader(`[{"Message": "boom", "Level": "fatal"}]`)
+	request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", b)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer abc123")
+	recorder := httptest.NewRecorder()
+	err = AddLogHandler(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidLogLevel.Error())
+}
+
+func (s *S) TestAddLogHandlerInvalidJSON(c *gocheck.C) {
+	a := app.App{Name: "myapp", Framework: "python", LogToken: "abc123"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	for _, body := range []string{`{"Message": "hi"}`, `[1, 2]`, `not json`} {
+		request, err := http.NewRequest("POST", "/apps/myapp/log/?:name=myapp", strings.NewReader(body))
+		c.Assert(err, gocheck.IsNil)
+		request.Header.Set("Authorization", "bearer abc123")
+		recorder := httptest.NewRecorder()
+		err = AddLogHandler(recorder, request)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	}
+}
+
 func (s *S) TestgetAppOrErrorWhenUserIsAdmin(c *gocheck.C) {
 	admin := auth.User{Email: "superuser@gmail.com", Password: "123"}
 	err := s.conn.Users().Insert(&admin)
@@ -0,0 +1,56 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// getAutoScale returns the autoscale rule of an app.
+func getAutoScale(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if a.AutoScale == nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: "The app has no autoscale rule."}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.AutoScale)
+}
+
+// setAutoScale sets the autoscale rule of an app. The body of the request is
+// the rule, in JSON format.
+func setAutoScale(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the autoscale rule."}
+	}
+	var rule app.AutoScale
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	err = a.SetAutoScale(&rule)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// unsetAutoScale disables the autoscaling of an app.
+func unsetAutoScale(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	return a.SetAutoScale(nil)
+}
@@ -0,0 +1,131 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestGetAutoScale(c *gocheck.C) {
+	rule := app.AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "cpu", ScaleUp: 80, ScaleDown: 20, Cooldown: 300}
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}, AutoScale: &rule}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/elastic/autoscale?:name=elastic", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = getAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var got app.AutoScale
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.MaxUnits, gocheck.Equals, uint(5))
+	c.Assert(got.Metric, gocheck.Equals, "cpu")
+	c.Assert(got.Cooldown, gocheck.Equals, 300)
+}
+
+func (s *S) TestGetAutoScaleWithoutRule(c *gocheck.C) {
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/elastic/autoscale?:name=elastic", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = getAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestSetAutoScale(c *gocheck.C) {
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	b := strings.NewReader(`{"MinUnits":2,"MaxUnits":4,"Metric":"cpu","ScaleUp":80,"ScaleDown":10,"Cooldown":60}`)
+	request, err := http.NewRequest("PUT", "/apps/elastic/autoscale?:name=elastic", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.NotNil)
+	c.Assert(a.AutoScale.MinUnits, gocheck.Equals, uint(2))
+	c.Assert(a.AutoScale.Metric, gocheck.Equals, "cpu")
+	c.Assert(a.AutoScale.ScaleUp, gocheck.Equals, 80.0)
+}
+
+func (s *S) TestSetAutoScaleInvalidRule(c *gocheck.C) {
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	b := strings.NewReader(`{"MinUnits":2,"MaxUnits":4,"Metric":"disk","ScaleUp":100,"ScaleDown":10}`)
+	request, err := http.NewRequest("PUT", "/apps/elastic/autoscale?:name=elastic", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `Unknown metric "disk". Valid metrics are cpu, memory and requests.`)
+}
+
+func (s *S) TestSetAutoScaleInvalidBody(c *gocheck.C) {
+	request, err := http.NewRequest("PUT", "/apps/elastic/autoscale?:name=elastic", strings.NewReader("not json"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "Invalid JSON in request body.")
+}
+
+func (s *S) TestSetAutoScaleUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "elastic"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	b := strings.NewReader(`{"MinUnits":2,"MaxUnits":4,"Metric":"cpu","ScaleUp":80,"ScaleDown":10}`)
+	request, err := http.NewRequest("PUT", "/apps/elastic/autoscale?:name=elastic", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUnsetAutoScale(c *gocheck.C) {
+	rule := app.AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}, AutoScale: &rule}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/elastic/autoscale?:name=elastic", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = unsetAutoScale(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.IsNil)
+}
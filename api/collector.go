@@ -0,0 +1,37 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/lease"
+	"labix.org/v2/mgo"
+	"net/http"
+)
+
+// collectorHealth returns the lease of the collector that collects status,
+// along with the time of its last successful run. It responds with 503 when
+// the collector didn't run successfully within the duration of its lease.
+func collectorHealth(w http.ResponseWriter, r *http.Request) error {
+	l, err := lease.Get("collector")
+	if err == mgo.ErrNotFound {
+		return &errors.Http{Code: http.StatusServiceUnavailable, Message: "The collector has never run."}
+	}
+	if err != nil {
+		return err
+	}
+	healthy := l.Healthy()
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"Owner":   l.Owner,
+		"Expires": l.Expires,
+		"LastRun": l.LastRun,
+		"Healthy": healthy,
+	})
+}
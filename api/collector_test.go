@@ -0,0 +1,65 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/lease"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestCollectorHealth(c *gocheck.C) {
+	defer s.conn.Leases().RemoveId("collector")
+	_, err := lease.Acquire("collector", "host1:42", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	err = lease.Done("collector", "host1:42", time.Now())
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("GET", "/collector/health", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = collectorHealth(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result["Owner"], gocheck.Equals, "host1:42")
+	c.Assert(result["Healthy"], gocheck.Equals, true)
+}
+
+func (s *S) TestCollectorHealthWhenTheRunIsLate(c *gocheck.C) {
+	defer s.conn.Leases().RemoveId("collector")
+	_, err := lease.Acquire("collector", "host1:42", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	err = lease.Done("collector", "host1:42", time.Now().Add(-2*time.Minute))
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("GET", "/collector/health", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = collectorHealth(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusServiceUnavailable)
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result["Healthy"], gocheck.Equals, false)
+}
+
+func (s *S) TestCollectorHealthWithoutLease(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/collector/health", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = collectorHealth(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusServiceUnavailable)
+	c.Assert(e.Message, gocheck.Equals, "The collector has never run.")
+}
@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// copyFromUnit streams a gzipped tar archive with the file or directory in
+// the given path of a unit of the app.
+func copyFromUnit(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	query := r.URL.Query()
+	a, err := getApp(query.Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-gzip")
+	err = a.CopyFromUnit(query.Get("unit"), query.Get("path"), w)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// copyToUnit extracts the gzipped tar archive sent in the body of the request
+// in the given directory of a unit of the app.
+func copyToUnit(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	query := r.URL.Query()
+	a, err := getApp(query.Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the archive in the body of the request."}
+	}
+	defer r.Body.Close()
+	err = a.CopyToUnit(query.Get("unit"), query.Get("path"), r.Body)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
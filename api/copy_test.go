@@ -0,0 +1,136 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestCopyFromUnit(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "secrets/0", State: "started"},
+			{Name: "secrets/1", State: "started"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareOutput([]byte("archive"))
+	url := "/apps/secrets/files?:name=secrets&unit=secrets/1&path=/tmp/heap.hprof"
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyFromUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "archive")
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/x-gzip")
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "secrets/1")
+}
+
+func (s *S) TestCopyFromUnitInvalidPath(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "secrets/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/secrets/files?:name=secrets", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyFromUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "Invalid path.")
+}
+
+func (s *S) TestCopyFromUnitForbidden(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Units:     []app.Unit{{Name: "secrets/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/secrets/files?:name=secrets&path=heap.hprof", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyFromUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(s.provisioner.GetCmds("", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestCopyToUnit(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "secrets/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := "/apps/secrets/files?:name=secrets&path=fixtures"
+	request, err := http.NewRequest("POST", url, strings.NewReader("archive"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyToUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "secrets/0")
+	c.Assert(string(cmds[0].Input), gocheck.Equals, "archive")
+}
+
+func (s *S) TestCopyToUnitWithoutArchive(c *gocheck.C) {
+	a := app.App{
+		Name:      "secrets",
+		Framework: "arch enemy",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "secrets/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/secrets/files?:name=secrets&path=fixtures", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyToUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestCopyToUnitAppNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/apps/unknown/files?:name=unknown&path=fixtures", strings.NewReader("archive"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = copyToUnit(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,195 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// deploysList lists the deploys of an app, the most recent first.
+func deploysList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	deploys, err := app.ListDeploys(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(deploys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deploys)
+}
+
+// deployInfo returns a deploy of an app, including its output.
+func deployInfo(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	d, err := app.GetDeploy(r.URL.Query().Get(":deploy"))
+	if err != nil || d.App != a.Name {
+		return &errors.Http{Code: http.StatusNotFound, Message: "Deploy not found."}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(d)
+}
+
+// rollback deploys again the commit of a previous deploy of the app,
+// streaming the progress of the deploy.
+func rollback(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	d, err := app.GetDeploy(r.URL.Query().Get(":deploy"))
+	if err != nil || d.App != a.Name {
+		return &errors.Http{Code: http.StatusNotFound, Message: "Deploy not found."}
+	}
+	w.Header().Set("Content-Type", "text")
+	logWriter := LogWriter{&a, w}
+	err = write(&logWriter, []byte("\n ---> Rolling back to "+d.Commit+"\n"))
+	if err != nil {
+		return err
+	}
+	err = a.Rollback(d.Id.Hex(), u.Email, &logWriter)
+	if err != nil {
+		return err
+	}
+	return write(&logWriter, []byte("\n ---> Rollback done!\n\n"))
+}
+
+// maxArchiveSize is the maximum size, in bytes, of the archive of a deploy.
+var maxArchiveSize int64 = 512 << 20
+
+// deployArchive deploys the app using the gzipped tar archive sent in the body
+// of the request, streaming the progress of the deploy. When the canary
+// parameter is present (for example, canary=10%), the archive is deployed as a
+// canary release receiving that share of the requests.
+func deployArchive(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the archive in the body of the request."}
+	}
+	defer r.Body.Close()
+	share := 0
+	canary := r.URL.Query().Get("canary")
+	if canary != "" {
+		share, err = strconv.Atoi(strings.TrimSuffix(canary, "%"))
+		if err != nil {
+			return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid share of the canary."}
+		}
+	}
+	archive, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxArchiveSize))
+	if err != nil {
+		return &errors.Http{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("The archive must not be larger than %d bytes.", maxArchiveSize),
+		}
+	}
+	if canary != "" {
+		return deployCanary(w, &a, share, bytes.NewReader(archive), u)
+	}
+	w.Header().Set("Content-Type", "text")
+	logWriter := LogWriter{&a, w}
+	err = write(&logWriter, []byte("\n ---> Tsuru receiving archive\n"))
+	if err != nil {
+		return err
+	}
+	err = a.DeployArchive(bytes.NewReader(archive), u.Email, &logWriter)
+	if err != nil {
+		return err
+	}
+	return write(&logWriter, []byte("\n ---> Deploy done!\n\n"))
+}
+
+// deployCanary deploys the archive as a canary release of the app, streaming
+// the progress of the deploy.
+func deployCanary(w http.ResponseWriter, a *app.App, share int, archive io.Reader, u *auth.User) error {
+	w.Header().Set("Content-Type", "text")
+	logWriter := LogWriter{a, w}
+	err := write(&logWriter, []byte("\n ---> Tsuru receiving archive\n"))
+	if err != nil {
+		return err
+	}
+	err = a.DeployCanary(archive, u.Email, share, &logWriter)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	return write(&logWriter, []byte("\n ---> Canary deployed!\n\n"))
+}
+
+// canaryStatus returns the statistics of the canary release of an app.
+func canaryStatus(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	report, err := a.CanaryStatus()
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
+// promoteCanary deploys the canary release of an app in all its units,
+// streaming the progress.
+func promoteCanary(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text")
+	logWriter := LogWriter{&a, w}
+	err = a.PromoteCanary(&logWriter)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	return write(&logWriter, []byte("\n ---> Canary promoted!\n\n"))
+}
+
+// abortCanary removes the canary release of an app, streaming the progress.
+func abortCanary(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text")
+	logWriter := LogWriter{&a, w}
+	err = a.AbortCanary(&logWriter)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	return write(&logWriter, []byte("\n ---> Canary aborted!\n\n"))
+}
@@ -0,0 +1,426 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	tsuruTesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func (s *S) TestDeploysList(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	now := time.Now()
+	deploys := []app.DeployData{
+		{Id: bson.NewObjectId(), App: a.Name, Commit: "a9b1e3f", Start: now.Add(-time.Hour), Success: true},
+		{Id: bson.NewObjectId(), App: a.Name, Commit: "b0c2f4e", Start: now, Output: "deployed"},
+	}
+	for _, d := range deploys {
+		err = s.conn.Deploys().Insert(d)
+		c.Assert(err, gocheck.IsNil)
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	request, err := http.NewRequest("GET", "/apps/otherapp/deploys?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var result []map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, 2)
+	c.Assert(result[0]["Id"], gocheck.Equals, deploys[1].Id.Hex())
+	c.Assert(result[0]["Commit"], gocheck.Equals, "b0c2f4e")
+	c.Assert(result[0]["Output"], gocheck.Equals, "")
+	c.Assert(result[1]["Commit"], gocheck.Equals, "a9b1e3f")
+	c.Assert(result[1]["Success"], gocheck.Equals, true)
+}
+
+func (s *S) TestDeploysListNoDeploys(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/otherapp/deploys?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestDeploysListUserWithoutAccess(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/otherapp/deploys?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDeployInfo(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d := app.DeployData{Id: bson.NewObjectId(), App: a.Name, Commit: "a9b1e3f", Output: "deployed"}
+	err = s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.Id)
+	url := "/apps/otherapp/deploys/" + d.Id.Hex() + "?:name=otherapp&:deploy=" + d.Id.Hex()
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result["Commit"], gocheck.Equals, "a9b1e3f")
+	c.Assert(result["Output"], gocheck.Equals, "deployed")
+}
+
+func (s *S) TestDeployInfoDeployFromAnotherApp(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d := app.DeployData{Id: bson.NewObjectId(), App: "secretapp", Commit: "a9b1e3f"}
+	err = s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.Id)
+	url := "/apps/otherapp/deploys/" + d.Id.Hex() + "?:name=otherapp&:deploy=" + d.Id.Hex()
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRollback(c *gocheck.C) {
+	deployer := tsuruTesting.NewFakeDeployer()
+	app.Provisioner = deployer
+	defer func() {
+		app.Provisioner = s.provisioner
+	}()
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d := app.DeployData{Id: bson.NewObjectId(), App: a.Name, Commit: "a9b1e3f", Start: time.Now()}
+	err = s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := "/apps/otherapp/deploys/" + d.Id.Hex() + "/rollback?:name=otherapp&:deploy=" + d.Id.Hex()
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	expected := "\n ---> Rolling back to a9b1e3f\nDeploying otherapp\n\n ---> Rollback done!\n\n"
+	c.Assert(recorder.Body.String(), gocheck.Equals, expected)
+	c.Assert(deployer.Versions(&a), gocheck.DeepEquals, []string{"a9b1e3f"})
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name, "user": s.user.Email}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestRollbackUnknownDeploy(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploys/abc/rollback?:name=otherapp&:deploy=abc", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e, gocheck.ErrorMatches, "^Deploy not found.$")
+}
+
+func (s *S) TestDeployArchive(c *gocheck.C) {
+	uploader := tsuruTesting.NewFakeUploader()
+	uploader.PrepareOutput(nil) // install
+	uploader.PrepareOutput(nil) // loadHooks
+	app.Provisioner = uploader
+	defer func() {
+		app.Provisioner = s.provisioner
+	}()
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy?:name=otherapp", strings.NewReader("archive content"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployArchive(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s)^\n ---> Tsuru receiving archive\n.*\n ---> Deploy done!\n\n$")
+	c.Assert(uploader.Archives(&a), gocheck.DeepEquals, [][]byte{[]byte("archive content")})
+	c.Assert(uploader.Restarts(&a), gocheck.Equals, 1)
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name, "user": s.user.Email}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestDeployArchiveWithoutArchive(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployArchive(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestDeployArchiveTooLarge(c *gocheck.C) {
+	uploader := tsuruTesting.NewFakeUploader()
+	app.Provisioner = uploader
+	defer func() {
+		app.Provisioner = s.provisioner
+	}()
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	old := maxArchiveSize
+	maxArchiveSize = 10
+	defer func() {
+		maxArchiveSize = old
+	}()
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy?:name=otherapp", strings.NewReader("archive content"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployArchive(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(uploader.Archives(&a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestDeployArchiveUserWithoutAccess(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy?:name=otherapp", strings.NewReader("archive content"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployArchive(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDeployArchiveCanary(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+	a := app.App{
+		Name:      "canaryapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "canaryapp-0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	appConf := []byte("healthcheck:\n  path: /\n  port: " + port + "\n")
+	// app.conf of the stable units, then apprc, upload, dependencies and
+	// app.conf of the canary units.
+	s.provisioner.PrepareOutput(appConf)
+	for i := 0; i < 3; i++ {
+		s.provisioner.PrepareOutput(nil)
+	}
+	s.provisioner.PrepareOutput(appConf)
+	request, err := http.NewRequest("POST", "/apps/canaryapp/deploy?:name=canaryapp&canary=10%25", strings.NewReader("archive content"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployArchive(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s)^\n ---> Tsuru receiving archive\n.*\n ---> Canary deployed!\n\n$")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.NotNil)
+	c.Assert(a.Canary.Share, gocheck.Equals, 10)
+	c.Assert(a.Units, gocheck.HasLen, 2)
+}
+
+func (s *S) TestDeployArchiveCanaryInvalidShare(c *gocheck.C) {
+	a := app.App{Name: "canaryapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	for _, share := range []string{"ten", "150%25"} {
+		request, err := http.NewRequest("POST", "/apps/canaryapp/deploy?:name=canaryapp&canary="+share, strings.NewReader("archive content"))
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = deployArchive(recorder, request, s.user)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestCanaryStatus(c *gocheck.C) {
+	a := app.App{
+		Name:      "canaryapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "canaryapp-0", Version: "v1"},
+			{Name: "canaryapp-1", Version: "v2"},
+		},
+		Canary: &app.Canary{Version: "v2", Share: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.SetUnitStats(&a, "canaryapp-0", provision.UnitStats{Requests: 90})
+	s.provisioner.SetUnitStats(&a, "canaryapp-1", provision.UnitStats{Requests: 10, Errors: 2})
+	request, err := http.NewRequest("GET", "/apps/canaryapp/canary?:name=canaryapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = canaryStatus(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var report app.CanaryReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, gocheck.IsNil)
+	expected := app.CanaryReport{
+		Version: "v2",
+		Share:   10,
+		Units:   []string{"canaryapp-1"},
+		Canary:  provision.UnitStats{Requests: 10, Errors: 2},
+		Stable:  provision.UnitStats{Requests: 90},
+	}
+	c.Assert(report, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCanaryStatusWithoutCanary(c *gocheck.C) {
+	a := app.App{Name: "canaryapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/canaryapp/canary?:name=canaryapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = canaryStatus(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The app has no canary release in progress.")
+}
+
+func (s *S) TestPromoteCanary(c *gocheck.C) {
+	a := app.App{
+		Name:      "canaryapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "canaryapp-0", Version: "v1", State: "started"},
+			{Name: "canaryapp-1", Version: "v2", State: "started"},
+		},
+		Canary: &app.Canary{Version: "v2", Share: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareOutput([]byte("canary archive"))
+	request, err := http.NewRequest("POST", "/apps/canaryapp/canary/promote?:name=canaryapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = promoteCanary(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s).*\n ---> Canary promoted!\n\n$")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Version, gocheck.Equals, "v2")
+}
+
+func (s *S) TestAbortCanary(c *gocheck.C) {
+	a := app.App{
+		Name:      "canaryapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "canaryapp-0", Version: "v1"},
+			{Name: "canaryapp-1", Version: "v2"},
+		},
+		Canary: &app.Canary{Version: "v2", Share: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	request, err := http.NewRequest("DELETE", "/apps/canaryapp/canary?:name=canaryapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = abortCanary(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s).*\n ---> Canary aborted!\n\n$")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "canaryapp-0")
+}
+
+func (s *S) TestAbortCanaryWithoutCanary(c *gocheck.C) {
+	a := app.App{Name: "canaryapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/canaryapp/canary?:name=canaryapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = abortCanary(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// drainsList lists the drains of an app.
+func drainsList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	drains, err := app.ListDrains(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(drains) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(drains)
+}
+
+// drainAdd adds a drain to an app. The URL of the drain is sent in the body of
+// the request, in the format {"url": "syslog://logs.example.com:514"}.
+func drainAdd(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	msg := "You must provide the URL of the drain."
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	var v map[string]string
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	if v["url"] == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	d, err := app.AddDrain(a.Name, v["url"])
+	switch err {
+	case nil:
+	case app.ErrInvalidDrainURL:
+		return &errors.Http{Code: http.StatusBadRequest, Message: err.Error()}
+	case app.ErrDrainAlreadyExists:
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(d)
+}
+
+// drainRemove removes a drain from an app.
+func drainRemove(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	err = app.RemoveDrain(a.Name, r.URL.Query().Get(":drain"))
+	if err == app.ErrDrainNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestDrainsList(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d, err := app.AddDrain(a.Name, "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d.Id)
+	request, err := http.NewRequest("GET", "/apps/otherapp/drains?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainsList(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var result []map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	expected := []map[string]string{
+		{"Id": d.Id.Hex(), "App": "otherapp", "URL": "syslog://logs.example.com:514"},
+	}
+	c.Assert(result, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDrainsListNoDrains(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/otherapp/drains?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainsList(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestDrainsListUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/otherapp/drains?:name=otherapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainsList(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDrainAdd(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Drains().RemoveAll(bson.M{"app": a.Name})
+	body := strings.NewReader(`{"url":"https://logs.example.com/drain"}`)
+	request, err := http.NewRequest("POST", "/apps/otherapp/drains?:name=otherapp", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainAdd(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result["URL"], gocheck.Equals, "https://logs.example.com/drain")
+	drains, err := app.ListDrains(a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.HasLen, 1)
+	c.Assert(drains[0].Id.Hex(), gocheck.Equals, result["Id"])
+}
+
+func (s *S) TestDrainAddInvalidURL(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"url":"ftp://logs.example.com"}`)
+	request, err := http.NewRequest("POST", "/apps/otherapp/drains?:name=otherapp", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainAdd(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidDrainURL.Error())
+}
+
+func (s *S) TestDrainAddDuplicated(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d, err := app.AddDrain(a.Name, "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d.Id)
+	body := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("POST", "/apps/otherapp/drains?:name=otherapp", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainAdd(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestDrainAddWithoutURL(c *gocheck.C) {
+	bodies := []string{`{}`, `{"url":""}`}
+	for _, b := range bodies {
+		request, err := http.NewRequest("POST", "/apps/otherapp/drains?:name=otherapp", strings.NewReader(b))
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = drainAdd(recorder, request, s.user)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, "You must provide the URL of the drain.")
+	}
+}
+
+func (s *S) TestDrainRemove(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d, err := app.AddDrain(a.Name, "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	url := "/apps/otherapp/drains/" + d.Id.Hex() + "?:name=otherapp&:drain=" + d.Id.Hex()
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainRemove(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	drains, err := app.ListDrains(a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.HasLen, 0)
+}
+
+func (s *S) TestDrainRemoveNotFound(c *gocheck.C) {
+	a := app.App{Name: "otherapp", Framework: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/otherapp/drains/abc?:name=otherapp&:drain=abc", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = drainRemove(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
@@ -33,10 +33,14 @@ func (fn Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 	fw := FlushingWriter{w, false}
 	if err := fn(&fw, r); err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*errors.Http); ok {
+			code = e.Code
+		}
 		if fw.wrote {
 			fmt.Fprintln(&fw, err)
 		} else {
-			http.Error(&fw, err.Error(), http.StatusInternalServerError)
+			http.Error(&fw, err.Error(), code)
 		}
 		log.Print(err)
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	_ "github.com/globocom/tsuru/provision/docker"
 	_ "github.com/globocom/tsuru/provision/juju"
 	_ "github.com/globocom/tsuru/provision/local"
 	stdlog "log"
@@ -25,29 +26,8 @@ func fatal(err error) {
 	log.Fatal(err)
 }
 
-func main() {
-	logger, err := syslog.NewLogger(syslog.LOG_INFO, stdlog.LstdFlags)
-	if err != nil {
-		stdlog.Fatal(err)
-	}
-	log.SetLogger(logger)
-	configFile := flag.String("config", "/etc/tsuru/tsuru.conf", "tsuru config file")
-	dry := flag.Bool("dry", false, "dry-run: does not start the server (for testing purpose)")
-	flag.Parse()
-	err = config.ReadAndWatchConfigFile(*configFile)
-	if err != nil {
-		fatal(err)
-	}
-	connString, err := config.GetString("database:url")
-	if err != nil {
-		fatal(err)
-	}
-	dbName, err := config.GetString("database:name")
-	if err != nil {
-		fatal(err)
-	}
-	fmt.Printf("Using the database %q from the server %q.\n\n", dbName, connString)
-
+// newMux returns the router of the API, mapping each route to its handler.
+func newMux() *pat.PatternServeMux {
 	m := pat.New()
 
 	m.Get("/services/instances", AuthorizationRequiredHandler(ServicesInstancesHandler))
@@ -74,7 +54,14 @@ func main() {
 	m.Get("/apps/:name", AuthorizationRequiredHandler(AppInfo))
 	m.Post("/apps/:name", AuthorizationRequiredHandler(setCName))
 	m.Post("/apps/:name/run", AuthorizationRequiredHandler(RunCommand))
+	m.Get("/apps/:name/shell", AuthorizationRequiredHandler(appShell))
+	m.Get("/apps/:name/files", AuthorizationRequiredHandler(copyFromUnit))
+	m.Post("/apps/:name/files", AuthorizationRequiredHandler(copyToUnit))
 	m.Get("/apps/:name/restart", AuthorizationRequiredHandler(RestartHandler))
+	m.Get("/apps/:name/stop", AuthorizationRequiredHandler(StopHandler))
+	m.Get("/apps/:name/start", AuthorizationRequiredHandler(StartHandler))
+	m.Post("/apps/:name/maintenance", AuthorizationRequiredHandler(startMaintenance))
+	m.Del("/apps/:name/maintenance", AuthorizationRequiredHandler(stopMaintenance))
 	m.Get("/apps/:name/env", AuthorizationRequiredHandler(GetEnv))
 	m.Post("/apps/:name/env", AuthorizationRequiredHandler(SetEnv))
 	m.Del("/apps/:name/env", AuthorizationRequiredHandler(UnsetEnv))
@@ -82,10 +69,28 @@ func main() {
 	m.Post("/apps", AuthorizationRequiredHandler(CreateAppHandler))
 	m.Put("/apps/:name/units", AuthorizationRequiredHandler(AddUnitsHandler))
 	m.Del("/apps/:name/units", AuthorizationRequiredHandler(RemoveUnitsHandler))
-	m.Put("/apps/:app/:team", AuthorizationRequiredHandler(GrantAccessToTeamHandler))
-	m.Del("/apps/:app/:team", AuthorizationRequiredHandler(RevokeAccessFromTeamHandler))
 	m.Get("/apps/:name/log", AuthorizationRequiredHandler(appLog))
 	m.Post("/apps/:name/log", Handler(AddLogHandler))
+	m.Put("/apps/:name/log", AuthorizationRequiredHandler(setLogRetention))
+	m.Put("/apps/:name/deploy-strategy", AuthorizationRequiredHandler(setDeployStrategy))
+	m.Get("/apps/:name/drains", AuthorizationRequiredHandler(drainsList))
+	m.Post("/apps/:name/drains", AuthorizationRequiredHandler(drainAdd))
+	m.Del("/apps/:name/drains/:drain", AuthorizationRequiredHandler(drainRemove))
+	m.Post("/apps/:name/deploy", AuthorizationRequiredHandler(deployArchive))
+	m.Get("/apps/:name/deploys", AuthorizationRequiredHandler(deploysList))
+	m.Get("/apps/:name/deploys/:deploy", AuthorizationRequiredHandler(deployInfo))
+	m.Post("/apps/:name/deploys/:deploy/rollback", AuthorizationRequiredHandler(rollback))
+	m.Get("/apps/:name/canary", AuthorizationRequiredHandler(canaryStatus))
+	m.Post("/apps/:name/canary/promote", AuthorizationRequiredHandler(promoteCanary))
+	m.Del("/apps/:name/canary", AuthorizationRequiredHandler(abortCanary))
+	m.Get("/apps/:name/metrics", AuthorizationRequiredHandler(appMetrics))
+	m.Get("/apps/:name/autoscale", AuthorizationRequiredHandler(getAutoScale))
+	m.Put("/apps/:name/autoscale", AuthorizationRequiredHandler(setAutoScale))
+	m.Del("/apps/:name/autoscale", AuthorizationRequiredHandler(unsetAutoScale))
+	// pat uses the first route that matches the request, so these routes
+	// must come after all the other /apps/:name/<path> routes.
+	m.Put("/apps/:app/:team", AuthorizationRequiredHandler(GrantAccessToTeamHandler))
+	m.Del("/apps/:app/:team", AuthorizationRequiredHandler(RevokeAccessFromTeamHandler))
 
 	m.Post("/users", Handler(CreateUser))
 	m.Post("/users/:email/tokens", Handler(Login))
@@ -103,6 +108,35 @@ func main() {
 	m.Get("/healers", Handler(healers))
 	m.Get("/healers/:healer", Handler(healer))
 
+	m.Get("/collector/health", Handler(collectorHealth))
+	return m
+}
+
+func main() {
+	logger, err := syslog.NewLogger(syslog.LOG_INFO, stdlog.LstdFlags)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+	log.SetLogger(logger)
+	configFile := flag.String("config", "/etc/tsuru/tsuru.conf", "tsuru config file")
+	dry := flag.Bool("dry", false, "dry-run: does not start the server (for testing purpose)")
+	flag.Parse()
+	err = config.ReadAndWatchConfigFile(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	connString, err := config.GetString("database:url")
+	if err != nil {
+		fatal(err)
+	}
+	dbName, err := config.GetString("database:name")
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Using the database %q from the server %q.\n\n", dbName, connString)
+
+	m := newMux()
+
 	if !*dry {
 		provisioner, err := config.GetString("provisioner")
 		if err != nil {
@@ -115,6 +149,13 @@ func main() {
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
 
+		if err = app.MigrateLogs(); err != nil {
+			fatal(err)
+		}
+		if err = app.MigrateLogTokens(); err != nil {
+			fatal(err)
+		}
+
 		listen, err := config.GetString("listen")
 		if err != nil {
 			fatal(err)
@@ -0,0 +1,110 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// serve sends the request through the router of the API, authenticated as
+// s.user.
+func (s *S) serve(c *gocheck.C, method, url string, body io.Reader) *httptest.ResponseRecorder {
+	token, err := s.user.CreateToken("123")
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest(method, url, body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", token.Token)
+	recorder := httptest.NewRecorder()
+	newMux().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *S) TestMuxRoutesSetLogRetention(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	recorder := s.serve(c, "PUT", "/apps/leper/log", strings.NewReader(`{"retention":7}`))
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.Equals, 7)
+}
+
+func (s *S) TestMuxRoutesSetDeployStrategy(c *gocheck.C) {
+	err := s.conn.Apps().Insert(bson.M{
+		"name":        "skyline",
+		"teams":       []string{s.team.Name},
+		"healthcheck": bson.M{"path": "/healthcheck"},
+	})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": "skyline"})
+	recorder := s.serve(c, "PUT", "/apps/skyline/deploy-strategy", strings.NewReader(`{"strategy":"blue-green"}`))
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	a := app.App{Name: "skyline"}
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, app.BlueGreenStrategy)
+}
+
+func (s *S) TestMuxRoutesAbortCanary(c *gocheck.C) {
+	a := app.App{
+		Name:      "canaryapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "canaryapp-0", Version: "v1"},
+			{Name: "canaryapp-1", Version: "v2"},
+		},
+		Canary: &app.Canary{Version: "v2", Share: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	recorder := s.serve(c, "DELETE", "/apps/canaryapp/canary", nil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s).*\n ---> Canary aborted!\n\n$")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+}
+
+func (s *S) TestMuxRoutesSetAutoScale(c *gocheck.C) {
+	a := app.App{Name: "elastic", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	b := strings.NewReader(`{"MinUnits":2,"MaxUnits":4,"Metric":"cpu","ScaleUp":80,"ScaleDown":10,"Cooldown":60}`)
+	recorder := s.serve(c, "PUT", "/apps/elastic/autoscale", b)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.NotNil)
+	c.Assert(a.AutoScale.Metric, gocheck.Equals, "cpu")
+}
+
+func (s *S) TestMuxRoutesUnsetAutoScale(c *gocheck.C) {
+	a := app.App{
+		Name:      "elastic",
+		Teams:     []string{s.team.Name},
+		AutoScale: &app.AutoScale{MinUnits: 1, MaxUnits: 2, Metric: "cpu", ScaleUp: 80, ScaleDown: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	recorder := s.serve(c, "DELETE", "/apps/elastic/autoscale", nil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.IsNil)
+}
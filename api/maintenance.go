@@ -0,0 +1,54 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxMaintenancePageSize is the maximum size, in bytes, of maintenance pages.
+const maxMaintenancePageSize = 1 << 20
+
+// startMaintenance puts the app in maintenance. The body of the request is
+// the page served by the router during the maintenance, and may be empty.
+func startMaintenance(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	var page []byte
+	if r.Body != nil {
+		defer r.Body.Close()
+		page, err = ioutil.ReadAll(io.LimitReader(r.Body, maxMaintenancePageSize+1))
+		if err != nil {
+			return err
+		}
+		if len(page) > maxMaintenancePageSize {
+			return &errors.Http{Code: http.StatusRequestEntityTooLarge, Message: "The maintenance page must have at most 1MB."}
+		}
+	}
+	err = a.StartMaintenance(page)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// stopMaintenance ends the maintenance of the app.
+func stopMaintenance(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	err = a.StopMaintenance()
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
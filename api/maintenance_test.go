@@ -0,0 +1,97 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestStartMaintenance(c *gocheck.C) {
+	a := app.App{Name: "closed", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader("<h1>Be right back</h1>")
+	request, err := http.NewRequest("POST", "/apps/closed/maintenance?:name=closed", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = startMaintenance(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	ok, page := s.provisioner.InMaintenance(&a)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(string(page), gocheck.Equals, "<h1>Be right back</h1>")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Maintenance, gocheck.Equals, true)
+}
+
+func (s *S) TestStartMaintenancePageTooLarge(c *gocheck.C) {
+	a := app.App{Name: "closed", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := bytes.NewReader(make([]byte, maxMaintenancePageSize+1))
+	request, err := http.NewRequest("POST", "/apps/closed/maintenance?:name=closed", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = startMaintenance(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusRequestEntityTooLarge)
+	ok, _ = s.provisioner.InMaintenance(&a)
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestStartMaintenanceReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "closed"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/closed/maintenance?:name=closed", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = startMaintenance(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestStopMaintenance(c *gocheck.C) {
+	a := app.App{Name: "closed", Teams: []string{s.team.Name}, Maintenance: true}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.StartMaintenance(&a, nil)
+	request, err := http.NewRequest("DELETE", "/apps/closed/maintenance?:name=closed", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = stopMaintenance(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	ok, _ := s.provisioner.InMaintenance(&a)
+	c.Assert(ok, gocheck.Equals, false)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Maintenance, gocheck.Equals, false)
+}
+
+func (s *S) TestStopMaintenanceReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/apps/unknown/maintenance?:name=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = stopMaintenance(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,41 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+	"time"
+)
+
+// maxMetricsPeriod is the longest period of metrics that can be requested.
+// Older samples are removed from the database.
+const maxMetricsPeriod = 7 * 24 * time.Hour
+
+// appMetrics returns the samples of the resource usage of the units of an
+// app. The "since" parameter is the period of the samples, as a duration (for
+// example, "30m" or "24h"), and defaults to one hour.
+func appMetrics(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	period := time.Hour
+	if since := r.URL.Query().Get("since"); since != "" {
+		var err error
+		period, err = time.ParseDuration(since)
+		if err != nil || period <= 0 || period > maxMetricsPeriod {
+			return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid period. It must be a duration of at most 168h, like 30m or 24h."}
+		}
+	}
+	a, err := getApp(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	samples, err := a.Metrics(time.Now().Add(-period))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(samples)
+}
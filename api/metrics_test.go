@@ -0,0 +1,77 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestAppMetrics(c *gocheck.C) {
+	a := app.App{Name: "metered", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": a.Name})
+	now := time.Now()
+	err = s.conn.Metrics().Insert(
+		app.MetricsSample{App: a.Name, Unit: "metered/0", Time: now.Add(-time.Minute), Samples: 1, CPU: 10},
+		app.MetricsSample{App: a.Name, Unit: "metered/0", Time: now.Add(-2 * time.Hour), Samples: 1, CPU: 20},
+	)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("GET", "/apps/metered/metrics?:name=metered", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var samples []app.MetricsSample
+	err = json.NewDecoder(recorder.Body).Decode(&samples)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples, gocheck.HasLen, 1)
+	c.Assert(samples[0].CPU, gocheck.Equals, 10.0)
+	request, err = http.NewRequest("GET", "/apps/metered/metrics?:name=metered&since=3h", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.user)
+	c.Assert(err, gocheck.IsNil)
+	err = json.NewDecoder(recorder.Body).Decode(&samples)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples, gocheck.HasLen, 2)
+}
+
+func (s *S) TestAppMetricsInvalidPeriod(c *gocheck.C) {
+	for _, since := range []string{"yesterday", "-1h", "200h"} {
+		request, err := http.NewRequest("GET", "/apps/metered/metrics?:name=metered&since="+since, nil)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appMetrics(recorder, request, s.user)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestAppMetricsUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "metered"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/metered/metrics?:name=metered", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/cmd/term"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// shellFailureStatus is the exit status sent to the client when the shell
+// could not be opened.
+const shellFailureStatus = 255
+
+// shellSize returns the initial size of the terminal, defined by the width
+// and height parameters.
+func shellSize(query url.Values) (provision.WindowSize, error) {
+	var size provision.WindowSize
+	params := map[string]*int{"width": &size.Width, "height": &size.Height}
+	for name, value := range params {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			msg := fmt.Sprintf("Parameter %q must be a positive integer.", name)
+			return size, &errors.Http{Code: http.StatusBadRequest, Message: msg}
+		}
+		*value = n
+	}
+	return size, nil
+}
+
+// readShellInput reads the frames sent by the client of a shell, writing the
+// input of the shell to stdin and sending the new sizes of the terminal to
+// resize. It returns when the client closes the connection, or when the
+// shell stops reading its input.
+func readShellInput(r io.Reader, stdin *io.PipeWriter, resize chan provision.WindowSize) {
+	defer close(resize)
+	for {
+		f, err := term.ReadFrame(r)
+		if err != nil {
+			stdin.CloseWithError(err)
+			return
+		}
+		switch f.Type {
+		case term.FrameData:
+			if _, err = stdin.Write(f.Payload); err != nil {
+				return
+			}
+		case term.FrameResize:
+			width, height, err := f.Size()
+			if err != nil {
+				continue
+			}
+			// Only the last size matters.
+			select {
+			case <-resize:
+			default:
+			}
+			resize <- provision.WindowSize{Width: width, Height: height}
+		}
+	}
+}
+
+// appShell opens an interactive shell in a unit of the app. The connection is
+// upgraded to the protocol term.ShellProtocol, and after the upgrade the
+// errors are reported to the client in the output of the shell.
+func appShell(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), term.ShellProtocol) {
+		msg := fmt.Sprintf("You must upgrade the connection to the %s protocol.", term.ShellProtocol)
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	query := r.URL.Query()
+	size, err := shellSize(query)
+	if err != nil {
+		return err
+	}
+	a, err := getApp(query.Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	unit, err := a.ShellUnit(query.Get("unit"))
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	} else if err != nil {
+		return err
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return stderrors.New("The server doesn't support interactive shells.")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", term.ShellProtocol)
+	stdin, stdinWriter := io.Pipe()
+	defer stdin.Close()
+	resize := make(chan provision.WindowSize, 1)
+	go readShellInput(buf.Reader, stdinWriter, resize)
+	output := term.NewFrameWriter(conn)
+	opts := provision.ShellOptions{
+		Unit:   unit,
+		Stdin:  stdin,
+		Stdout: output,
+		Term:   query.Get("term"),
+		Size:   size,
+		Resize: resize,
+	}
+	status := 0
+	err = a.Shell(opts)
+	if e, ok := err.(*provision.ExitError); ok {
+		status = e.Status
+	} else if err != nil {
+		log.Printf("Failed to open a shell in the unit %s: %s", unit.GetName(), err)
+		fmt.Fprintf(output, "Failed to open the shell: %s\r\n", err)
+		status = shellFailureStatus
+	}
+	output.WriteFrame(term.ExitFrame(status))
+	return nil
+}
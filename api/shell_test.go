@@ -0,0 +1,194 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/cmd/term"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// shellRequest opens a shell in a test server, returning the server and the
+// upgraded connection.
+func (s *S) shellRequest(c *gocheck.C, query string) (*httptest.Server, net.Conn, *bufio.Reader) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fw := FlushingWriter{w, false}
+		if err := appShell(&fw, r, s.user); err != nil {
+			http.Error(&fw, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	fmt.Fprintf(conn, "GET /apps/shell?%s HTTP/1.1\r\nHost: tsuru\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", query, term.ShellProtocol)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.StatusCode, gocheck.Equals, http.StatusSwitchingProtocols)
+	c.Assert(resp.Header.Get("Upgrade"), gocheck.Equals, term.ShellProtocol)
+	return server, conn, reader
+}
+
+func readShellOutput(c *gocheck.C, r io.Reader) (string, int) {
+	var output string
+	for {
+		f, err := term.ReadFrame(r)
+		c.Assert(err, gocheck.IsNil)
+		if f.Type == term.FrameExit {
+			status, err := f.Status()
+			c.Assert(err, gocheck.IsNil)
+			return output, status
+		}
+		output += string(f.Payload)
+	}
+}
+
+func (s *S) TestAppShell(c *gocheck.C) {
+	a := app.App{
+		Name:      "someapp",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "someapp/0", State: "started"},
+			{Name: "someapp/1", State: "started"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareOutput([]byte("$ "))
+	server, conn, reader := s.shellRequest(c, ":name=someapp&unit=someapp/1&width=80&height=24&term=xterm")
+	defer server.Close()
+	defer conn.Close()
+	err = term.WriteFrame(conn, term.ResizeFrame(100, 40))
+	c.Assert(err, gocheck.IsNil)
+	err = term.WriteFrame(conn, &term.Frame{Type: term.FrameData, Payload: []byte("ls\n")})
+	c.Assert(err, gocheck.IsNil)
+	conn.(*net.TCPConn).CloseWrite()
+	output, status := readShellOutput(c, reader)
+	c.Assert(output, gocheck.Equals, "$ ls\n")
+	c.Assert(status, gocheck.Equals, 0)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "someapp/1")
+}
+
+func (s *S) TestAppShellExitStatus(c *gocheck.C) {
+	a := app.App{
+		Name:      "someapp",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "someapp/0", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareFailure("Shell", &provision.ExitError{Status: 130})
+	server, conn, reader := s.shellRequest(c, ":name=someapp")
+	defer server.Close()
+	defer conn.Close()
+	conn.(*net.TCPConn).CloseWrite()
+	_, status := readShellOutput(c, reader)
+	c.Assert(status, gocheck.Equals, 130)
+}
+
+func (s *S) TestAppShellRequiresUpgrade(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/apps/someapp/shell?:name=someapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appShell(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "You must upgrade the connection to the tsuru-shell protocol.")
+}
+
+func (s *S) TestAppShellInvalidParameters(c *gocheck.C) {
+	a := app.App{
+		Name:      "someapp",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "someapp/0", State: "started"},
+			{Name: "someapp/1", State: "down"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	var tests = []struct {
+		query   string
+		message string
+	}{
+		{":name=someapp&width=abc", `Parameter "width" must be a positive integer.`},
+		{":name=someapp&height=0", `Parameter "height" must be a positive integer.`},
+		{":name=someapp&unit=someapp/1", `The unit "someapp/1" is not started.`},
+		{":name=someapp&unit=someapp/5", `The app "someapp" has no unit named "someapp/5".`},
+	}
+	for _, t := range tests {
+		request, err := http.NewRequest("GET", "/apps/someapp/shell?"+t.query, nil)
+		c.Assert(err, gocheck.IsNil)
+		request.Header.Set("Upgrade", term.ShellProtocol)
+		recorder := httptest.NewRecorder()
+		err = appShell(recorder, request, s.user)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
+func (s *S) TestAppShellAppNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/shell?:name=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Upgrade", term.ShellProtocol)
+	recorder := httptest.NewRecorder()
+	err = appShell(recorder, request, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestShellSize(c *gocheck.C) {
+	size, err := shellSize(url.Values{"width": []string{"120"}, "height": []string{"40"}})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(size, gocheck.Equals, provision.WindowSize{Width: 120, Height: 40})
+	size, err = shellSize(url.Values{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(size, gocheck.Equals, provision.WindowSize{})
+}
+
+func (s *S) TestReadShellInput(c *gocheck.C) {
+	r, w := io.Pipe()
+	stdin, stdinWriter := io.Pipe()
+	resize := make(chan provision.WindowSize, 1)
+	go readShellInput(r, stdinWriter, resize)
+	go func() {
+		term.WriteFrame(w, term.ResizeFrame(100, 40))
+		term.WriteFrame(w, &term.Frame{Type: term.FrameData, Payload: []byte("exit\n")})
+		w.Close()
+	}()
+	input := make([]byte, 5)
+	_, err := io.ReadFull(stdin, input)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(input), gocheck.Equals, "exit\n")
+	c.Assert(<-resize, gocheck.Equals, provision.WindowSize{Width: 100, Height: 40})
+	_, ok := <-resize
+	c.Assert(ok, gocheck.Equals, false)
+	_, err = stdin.Read(input)
+	c.Assert(err, gocheck.Equals, io.EOF)
+}
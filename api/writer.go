@@ -5,8 +5,11 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"github.com/globocom/tsuru/app"
 	"io"
+	"net"
 	"net/http"
 )
 
@@ -45,3 +48,13 @@ func (w *FlushingWriter) Write(data []byte) (int, error) {
 	}
 	return n, err
 }
+
+// Hijack lets the handler take over the connection, if the underlying
+// ResponseWriter is also an http.Hijacker.
+func (w *FlushingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.wrote = true
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("The response writer doesn't support hijacking.")
+}
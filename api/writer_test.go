@@ -5,12 +5,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
+	"net"
 	"net/http/httptest"
 )
 
@@ -38,15 +40,17 @@ func (s *WriterSuite) TestLogWriter(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	writer := LogWriter{&a, &b}
 	data := []byte("ble")
 	_, err = writer.Write(data)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(b.Bytes(), gocheck.DeepEquals, data)
-	instance := app.App{}
-	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&instance)
-	logLen := len(instance.Logs)
-	c.Assert(instance.Logs[logLen-1].Message, gocheck.Equals, string(data))
+	var logs []app.Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, string(data))
 }
 
 func (s *WriterSuite) TestLogWriterShouldReturnTheDataSize(c *gocheck.C) {
@@ -57,6 +61,7 @@ func (s *WriterSuite) TestLogWriterShouldReturnTheDataSize(c *gocheck.C) {
 	var apps []App
 	s.conn.Apps().Find(bson.M{"name": "down"}).All(&apps)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	writer := LogWriter{&a, &b}
 	data := []byte("ble")
 	n, err := writer.Write(data)
@@ -98,3 +103,31 @@ func (s *WriterSuite) TestFlushingWriterWriteHeader(c *gocheck.C) {
 	c.Assert(recorder.Code, gocheck.Equals, expectedCode)
 	c.Assert(writer.wrote, gocheck.Equals, true)
 }
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw := bufio.NewReadWriter(bufio.NewReader(r.conn), bufio.NewWriter(r.conn))
+	return r.conn, rw, nil
+}
+
+func (s *WriterSuite) TestFlushingWriterHijack(c *gocheck.C) {
+	server, client := net.Pipe()
+	defer client.Close()
+	recorder := hijackRecorder{httptest.NewRecorder(), server}
+	writer := FlushingWriter{&recorder, false}
+	conn, _, err := writer.Hijack()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(conn, gocheck.Equals, server)
+	c.Assert(writer.wrote, gocheck.Equals, true)
+}
+
+func (s *WriterSuite) TestFlushingWriterHijackNotSupported(c *gocheck.C) {
+	writer := FlushingWriter{httptest.NewRecorder(), false}
+	_, _, err := writer.Hijack()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "The response writer doesn't support hijacking.")
+}
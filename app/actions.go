@@ -148,6 +148,9 @@ var createUserPolicyAction = action.Action{
 // new app. It requires a pointer to an App instance as the first parameter,
 // and the previous result to be a *s3Env (it should be used after
 // createUserPolicyAction or createBucketAction).
+//
+// It also issues the log ingestion token of the app, exported in the
+// TSURU_LOG_TOKEN variable.
 var exportEnvironmentsAction = action.Action{
 	Forward: func(ctx action.FWContext) (action.Result, error) {
 		app := ctx.Params[0].(*App)
@@ -156,9 +159,17 @@ var exportEnvironmentsAction = action.Action{
 			return nil, err
 		}
 		host, _ := config.GetString("host")
+		token, err := generateLogToken()
+		if err != nil {
+			return nil, err
+		}
+		if err = app.saveLogToken(token); err != nil {
+			return nil, err
+		}
 		envVars := []bind.EnvVar{
 			{Name: "TSURU_APPNAME", Value: app.Name},
 			{Name: "TSURU_HOST", Value: host},
+			{Name: logTokenEnv, Value: token},
 		}
 		env, ok := ctx.Previous.(*s3Env)
 		if ok {
@@ -187,7 +198,7 @@ var exportEnvironmentsAction = action.Action{
 		app := ctx.Params[0].(*App)
 		if app.Get() == nil {
 			s3Env := app.InstanceEnv(s3InstanceName)
-			vars := make([]string, len(s3Env)+2)
+			vars := make([]string, len(s3Env)+3)
 			i := 0
 			for k := range s3Env {
 				vars[i] = k
@@ -195,6 +206,7 @@ var exportEnvironmentsAction = action.Action{
 			}
 			vars[i] = "TSURU_HOST"
 			vars[i+1] = "TSURU_APPNAME"
+			vars[i+2] = logTokenEnv
 			app.UnsetEnvs(vars, false)
 		}
 	},
@@ -329,11 +329,28 @@ func (s *S) TestExportEnvironmentsForwardWithoutS3Env(c *gocheck.C) {
 	c.Assert(appEnv["TSURU_HOST"].Public, gocheck.Equals, false)
 }
 
+func (s *S) TestExportEnvironmentsForwardIssuesLogToken(c *gocheck.C) {
+	app := App{Name: "mist", Framework: "opeth"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	ctx := action.FWContext{Params: []interface{}{&app}, Previous: &app}
+	_, err = exportEnvironmentsAction.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.LogToken, gocheck.HasLen, 40)
+	appEnv := app.InstanceEnv("")
+	c.Assert(appEnv["TSURU_LOG_TOKEN"].Value, gocheck.Equals, app.LogToken)
+	c.Assert(appEnv["TSURU_LOG_TOKEN"].Public, gocheck.Equals, false)
+}
+
 func (s *S) TestExportEnvironmentsBackward(c *gocheck.C) {
 	envNames := []string{
 		"TSURU_S3_ACCESS_KEY_ID", "TSURU_S3_SECRET_KEY",
 		"TSURU_APPNAME", "TSURU_HOST", "TSURU_S3_ENDPOINT",
 		"TSURU_S3_LOCATIONCONSTRAINT", "TSURU_S3_BUCKET",
+		"TSURU_LOG_TOKEN",
 	}
 	app := App{Name: "moon", Framework: "opeth", Env: make(map[string]bind.EnvVar)}
 	for _, name := range envNames {
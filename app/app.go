@@ -37,25 +37,42 @@ var Provisioner provision.Provisioner
 var (
 	nameRegexp  = regexp.MustCompile(`^[a-z][a-z0-9-]{0,62}$`)
 	cnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][\w-.]+$`)
+
+	procfileRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
 )
 
 // App is the main type in tsuru. An app represents a real world application.
 // This struct holds information about the app: its name, address, list of
 // teams that have access to it, used platform, etc.
 type App struct {
-	Env       map[string]bind.EnvVar
-	Framework string
-	Logs      []Applog
-	Name      string
-	Ip        string
-	CName     string
-	Units     []Unit
-	Teams     []string
-	hooks     *conf
+	Env            map[string]bind.EnvVar
+	Framework      string
+	Name           string
+	Ip             string
+	CName          string
+	Units          []Unit
+	Teams          []string
+	LogRetention   int
+	LogToken       string
+	Maintenance    bool
+	DeployStrategy string
+	Canary         *Canary
+	AutoScale      *AutoScale
+
+	// Healthcheck is the health check declared in app.conf, saved every
+	// time app.conf is loaded.
+	Healthcheck healthcheck
+	hooks       *conf
+
+	// unitScoped indicates that commands must run only in the units in
+	// the list of the app, instead of all units of the app in the
+	// provisioner.
+	unitScoped bool
 }
 
 // MarshalJSON marshals the app in json format. It returns a JSON object with
-// the following keys: Name, Framework, Teams, Units, Repository and Ip.
+// the following keys: Name, Framework, Teams, Units, Repository, Ip, CName,
+// Maintenance, DeployStrategy and Canary.
 func (app *App) MarshalJSON() ([]byte, error) {
 	result := make(map[string]interface{})
 	result["Name"] = app.Name
@@ -65,6 +82,9 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["Repository"] = repository.GetUrl(app.Name)
 	result["Ip"] = app.Ip
 	result["CName"] = app.CName
+	result["Maintenance"] = app.Maintenance
+	result["DeployStrategy"] = app.DeployStrategy
+	result["Canary"] = app.Canary
 	return json.Marshal(&result)
 }
 
@@ -73,11 +93,16 @@ type Applog struct {
 	Date    time.Time
 	Message string
 	Source  string
+	AppName string
+	Unit    string
+	Level   string
 }
 
 type conf struct {
-	PreRestart []string `yaml:"pre-restart"`
-	PosRestart []string `yaml:"post-restart"`
+	PreRestart  []string          `yaml:"pre-restart"`
+	PosRestart  []string          `yaml:"post-restart"`
+	Processes   map[string]string `yaml:"processes"`
+	Healthcheck healthcheck       `yaml:"healthcheck"`
 }
 
 // Get queries the database and fills the App object with data retrieved from
@@ -178,7 +203,7 @@ func (app *App) unbind() error {
 //       enabled).
 //       2. Destroy the app unit using juju
 //       3. Unbind all service instances from the app
-//       4. Remove the app from the database
+//       4. Remove the app and its logs from the database
 func ForceDestroy(app *App) error {
 	gUrl := repository.GitServerUri()
 	(&gandalf.Client{Endpoint: gUrl}).RemoveRepository(app.Name)
@@ -195,6 +220,7 @@ func ForceDestroy(app *App) error {
 		return err
 	}
 	defer conn.Close()
+	conn.Logs().RemoveAll(bson.M{"appname": app.Name})
 	return conn.Apps().Remove(bson.M{"name": app.Name})
 }
 
@@ -212,13 +238,38 @@ func (app *App) AddUnit(u *Unit) {
 	app.Units = append(app.Units, *u)
 }
 
-// AddUnits creates n new units within the provisioner, saves new units in the
-// database and enqueues the apprc serialization.
-func (app *App) AddUnits(n uint) error {
+// AddUnits creates n new units of the given process type within the
+// provisioner, saves new units in the database and enqueues the apprc
+// serialization.
+//
+// An empty process type means web. Units of other process types can only be
+// added if the provisioner implements provision.ProcessProvisioner and the
+// process type is declared by the app (see Processes).
+func (app *App) AddUnits(n uint, process string) error {
 	if n == 0 {
 		return stderr.New("Cannot add zero units.")
 	}
-	units, err := Provisioner.AddUnits(app, n)
+	var (
+		units []provision.Unit
+		err   error
+	)
+	if process == "" || process == provision.WebProcess {
+		process = provision.WebProcess
+		units, err = Provisioner.AddUnits(app, n)
+	} else {
+		pp, ok := Provisioner.(provision.ProcessProvisioner)
+		if !ok {
+			return stderr.New("The provisioner does not support process types other than web.")
+		}
+		var processes map[string]string
+		if processes, err = app.Processes(); err != nil {
+			return err
+		}
+		if _, ok = processes[process]; !ok {
+			return fmt.Errorf("The app does not declare the process type %q.", process)
+		}
+		units, err = pp.AddProcessUnits(app, n, process)
+	}
 	if err != nil {
 		return err
 	}
@@ -234,17 +285,23 @@ func (app *App) AddUnits(n uint) error {
 	mCount := 0
 	for i, unit := range units {
 		app.Units[i+length] = Unit{
-			Name:       unit.Name,
-			Type:       unit.Type,
-			Ip:         unit.Ip,
-			Machine:    unit.Machine,
-			State:      provision.StatusPending.String(),
-			InstanceId: unit.InstanceId,
+			Name:        unit.Name,
+			Type:        unit.Type,
+			ProcessType: process,
+			Ip:          unit.Ip,
+			Machine:     unit.Machine,
+			State:       provision.StatusPending.String(),
+			InstanceId:  unit.InstanceId,
 		}
 		messages[mCount] = queue.Message{Action: RegenerateApprcAndStart, Args: []string{app.Name, unit.Name}}
 		messages[mCount+1] = queue.Message{Action: bindService, Args: []string{app.Name, unit.Name}}
 		mCount += 2
 	}
+	if app.LogToken == "" {
+		if err = app.issueLogToken(); err != nil {
+			return err
+		}
+	}
 	err = conn.Apps().Update(
 		bson.M{"name": app.Name},
 		bson.M{"$set": bson.M{"units": app.Units}},
@@ -324,17 +381,29 @@ func (app *App) removeUnits(indices []int) {
 	}
 }
 
-// RemoveUnits removes n units from the app. It's a process composed of x
-// steps:
+// RemoveUnits removes n units of the given process type from the app. An
+// empty process type means web. It's a process composed of x steps:
 //
 //     1. Remove units from the provisioner
 //     2. Unbind units from service instances bound to the app
 //     3. Remove units from the app list
 //     4. Update the app in the database
-func (app *App) RemoveUnits(n uint) error {
+//
+// It's not possible to remove all web units of the app.
+func (app *App) RemoveUnits(n uint, process string) error {
+	if process == "" {
+		process = provision.WebProcess
+	}
+	sort.Sort(UnitSlice(app.Units))
+	var indices []int
+	for i, u := range app.Units {
+		if u.GetProcessType() == process {
+			indices = append(indices, i)
+		}
+	}
 	if n == 0 {
 		return stderr.New("Cannot remove zero units.")
-	} else if l := uint(len(app.Units)); l == n {
+	} else if l := uint(len(indices)); l == n && process == provision.WebProcess {
 		return stderr.New("Cannot remove all units from an app.")
 	} else if n > l {
 		return fmt.Errorf("Cannot remove %d units from this app, it has only %d units.", n, l)
@@ -343,14 +412,12 @@ func (app *App) RemoveUnits(n uint) error {
 		removed []int
 		err     error
 	)
-	units := UnitSlice(app.Units)
-	sort.Sort(units)
-	for i := 0; i < int(n); i++ {
-		err = Provisioner.RemoveUnit(app, units[i].GetName())
+	for _, i := range indices[:n] {
+		err = Provisioner.RemoveUnit(app, app.Units[i].GetName())
 		if err == nil {
 			removed = append(removed, i)
 		}
-		app.unbindUnit(&units[i])
+		app.unbindUnit(&app.Units[i])
 	}
 	if len(removed) == 0 {
 		return err
@@ -394,6 +461,29 @@ func (app *App) unbindUnit(unit provision.AppUnit) error {
 	return nil
 }
 
+// bindUnit binds a unit to all service instances that are bound to the app.
+// Failures are logged, and don't stop the binding of the other instances.
+func (app *App) bindUnit(unit *Unit) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var instances []service.ServiceInstance
+	q := bson.M{"apps": bson.M{"$in": []string{app.Name}}}
+	err = conn.ServiceInstances().Find(q).All(&instances)
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		_, err = instance.BindUnit(app, unit)
+		if err != nil {
+			log.Printf("Error binding the unit %s with the service instance %s.", unit.Name, instance.Name)
+		}
+	}
+	return nil
+}
+
 // Available returns true if at least one of N units is started.
 func (app *App) Available() bool {
 	for _, unit := range app.ProvisionUnits() {
@@ -514,7 +604,8 @@ func (app *App) InstanceEnv(name string) map[string]bind.EnvVar {
 // loadHooks loads restart hooks from app.conf.
 //
 // app.conf uses YAML format, this function looks for two keys: pre-restart and
-// post-restart.
+// post-restart. It also loads the process types and the health check of the
+// app, saving the health check in the database.
 func (app *App) loadHooks() error {
 	if app.hooks != nil {
 		return nil
@@ -537,9 +628,75 @@ func (app *App) loadHooks() error {
 		app.Log(fmt.Sprintf("Got error while parsing yaml: %s", err), "tsuru")
 		return err
 	}
+	if err = app.saveHealthcheck(app.hooks.Healthcheck); err != nil {
+		log.Printf("Failed to save the health check of %s: %s", app.Name, err)
+	}
 	return nil
 }
 
+// Processes returns the process types declared by the app, mapping the name of
+// each process type to its command.
+//
+// Process types are read from the "processes" key of app.conf. If app.conf
+// does not declare any process type, they're read from the Procfile in the
+// root of the app repository, which uses the format "<process>: <command>".
+func (app *App) Processes() (map[string]string, error) {
+	if err := app.loadHooks(); err != nil {
+		return nil, err
+	}
+	if len(app.hooks.Processes) > 0 {
+		return app.hooks.Processes, nil
+	}
+	uRepo, err := repository.GetPath()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = app.readFile(path.Join(uRepo, "Procfile"), &buf)
+	if err != nil {
+		app.Log(fmt.Sprintf("Got error while reading the Procfile: %s", err), "tsuru")
+		return map[string]string{}, nil
+	}
+	app.hooks.Processes, err = parseProcfile(buf.Bytes())
+	return app.hooks.Processes, err
+}
+
+// readFile writes the content of the given file, read from the app units, to w.
+// When the provisioner is a UnitCommandExecutor, the file is read from the
+// first started web unit only, so the output doesn't include the headers of
+// each unit.
+func (app *App) readFile(name string, w io.Writer) error {
+	executor, ok := Provisioner.(provision.UnitCommandExecutor)
+	if !ok {
+		return app.run("cat "+name, w)
+	}
+	for _, u := range app.ProvisionUnits() {
+		unit := u.(*Unit)
+		if unit.GetProcessType() == provision.WebProcess && unit.GetStatus() == provision.StatusStarted {
+			return executor.ExecuteCommandOnUnit(w, w, app, unit, "cat "+name)
+		}
+	}
+	return stderr.New("App must be available to run commands")
+}
+
+// parseProcfile parses the content of a Procfile, returning a map of process
+// types to commands. Empty lines and comments are ignored.
+func parseProcfile(data []byte) (map[string]string, error) {
+	processes := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		matches := procfileRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("Invalid line in the Procfile: %q.", line)
+		}
+		processes[matches[1]] = matches[2]
+	}
+	return processes, nil
+}
+
 // runHook executes the given list of commands, as a hook identified by the
 // kind string. If the list is empty, it returns nil.
 //
@@ -594,22 +751,48 @@ func (app *App) postRestart(w io.Writer) error {
 // command.
 func (app *App) Run(cmd string, w io.Writer) error {
 	app.Log(fmt.Sprintf("running '%s'", cmd), "tsuru")
+	return app.run(runCommandLine(cmd), w)
+}
+
+// runCommandLine returns the command line that sources apprc and runs the
+// command in the directory of the app.
+func runCommandLine(cmd string) string {
 	source := "[ -f /home/application/apprc ] && source /home/application/apprc"
 	cd := "[ -d /home/application/current ] && cd /home/application/current"
-	cmd = fmt.Sprintf("%s; %s; %s", source, cd, cmd)
-	return app.run(cmd, w)
+	return fmt.Sprintf("%s; %s; %s", source, cd, cmd)
 }
 
 func (app *App) run(cmd string, w io.Writer) error {
 	if !app.Available() {
 		return stderr.New("App must be available to run commands")
 	}
-	return Provisioner.ExecuteCommand(w, w, app, cmd)
+	return app.execute(w, w, cmd)
 }
 
 // Command is declared just to satisfy repository.Unit interface.
 func (app *App) Command(stdout, stderr io.Writer, cmdArgs ...string) error {
-	return Provisioner.ExecuteCommand(stdout, stderr, app, cmdArgs[0], cmdArgs[1:]...)
+	return app.execute(stdout, stderr, cmdArgs[0], cmdArgs[1:]...)
+}
+
+var errRunOnUnitNotSupported = stderr.New("The provisioner can't run commands in specific units.")
+
+// execute runs the command in all units of the app. Unit scoped apps run the
+// command in each unit of their list, one at a time.
+func (app *App) execute(stdout, stderr io.Writer, cmd string, args ...string) error {
+	if !app.unitScoped {
+		return Provisioner.ExecuteCommand(stdout, stderr, app, cmd, args...)
+	}
+	executor, ok := Provisioner.(provision.UnitCommandExecutor)
+	if !ok {
+		return errRunOnUnitNotSupported
+	}
+	for _, u := range app.ProvisionUnits() {
+		err := executor.ExecuteCommandOnUnit(stdout, stderr, app, u, cmd, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Restart runs the restart hook for the app, writing its output to w.
@@ -627,9 +810,94 @@ func (app *App) Restart(w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	if err = app.clearStopped(); err != nil {
+		return err
+	}
 	return app.postRestart(w)
 }
 
+var errStartStopNotSupported = &errors.ValidationError{Message: "The provisioner can't stop and start apps."}
+
+// Stop stops all units of the app, without destroying them, writing the
+// progress to w. Stopped units are left alone by the collector until the app
+// is started or restarted.
+func (app *App) Stop(w io.Writer) error {
+	p, ok := Provisioner.(provision.StartStopper)
+	if !ok {
+		return errStartStopNotSupported
+	}
+	app.Log("stopping the app", "tsuru")
+	err := write(w, []byte("\n ---> Stopping your app\n"))
+	if err != nil {
+		return err
+	}
+	if err = p.Stop(app); err != nil {
+		return err
+	}
+	return app.setUnitsState(provision.StatusStopped)
+}
+
+// Start starts the units of a stopped app, writing the progress to w.
+func (app *App) Start(w io.Writer) error {
+	p, ok := Provisioner.(provision.StartStopper)
+	if !ok {
+		return errStartStopNotSupported
+	}
+	app.Log("starting the app", "tsuru")
+	err := write(w, []byte("\n ---> Starting your app\n"))
+	if err != nil {
+		return err
+	}
+	if err = p.Start(app); err != nil {
+		return err
+	}
+	return app.setUnitsState(provision.StatusStarted)
+}
+
+// setUnitsState changes the state of all units of the app, in the database.
+func (app *App) setUnitsState(state provision.Status) error {
+	for i := range app.Units {
+		app.Units[i].State = state.String()
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"units": app.Units}},
+	)
+}
+
+// clearStopped marks the stopped units of the app as started, in the
+// database. Restarting the app also starts its stopped units, which must be
+// updated by the collector again.
+func (app *App) clearStopped() error {
+	var conn *db.Storage
+	for i := range app.Units {
+		if app.Units[i].State != provision.StatusStopped.String() {
+			continue
+		}
+		if conn == nil {
+			var err error
+			if conn, err = db.Conn(); err != nil {
+				return err
+			}
+			defer conn.Close()
+		}
+		app.Units[i].State = provision.StatusStarted.String()
+		err := conn.Apps().Update(
+			bson.M{"name": app.Name, "units.name": app.Units[i].Name},
+			bson.M{"$set": bson.M{"units.$.state": app.Units[i].State}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // InstallDeps runs the dependencies hook for the app, writing its output to w.
 func (app *App) InstallDeps(w io.Writer) error {
 	return app.run("/var/lib/tsuru/hooks/dependencies", w)
@@ -797,6 +1065,9 @@ func (app *App) SetCName(cname string) error {
 
 // Log adds a log message to the app. Specifying a good source is good so the
 // user can filter where the message come from.
+//
+// Besides being stored, the log is sent to the listeners and to the drains of
+// the app.
 func (app *App) Log(message, source string) error {
 	messages := strings.Split(message, "\n")
 	logs := make([]Applog, 0, len(messages))
@@ -806,57 +1077,73 @@ func (app *App) Log(message, source string) error {
 				Date:    time.Now(),
 				Message: msg,
 				Source:  source,
+				AppName: app.Name,
 			}
 			logs = append(logs, l)
 		}
 	}
+	return app.addLogs(logs)
+}
+
+// AddLogs adds structured logs, usually sent by the units of the app. Logs
+// without date receive the current time, and logs without source are
+// attributed to the app. Logs with empty messages are ignored.
+//
+// It returns ErrInvalidLogLevel if any of the logs has an unknown level, and
+// in this case no log is added.
+func (app *App) AddLogs(logs []Applog) error {
+	result := make([]Applog, 0, len(logs))
+	for _, l := range logs {
+		if l.Message == "" {
+			continue
+		}
+		if !logLevels[l.Level] {
+			return ErrInvalidLogLevel
+		}
+		if l.Date.IsZero() {
+			l.Date = time.Now()
+		}
+		if l.Source == "" {
+			l.Source = "app"
+		}
+		l.AppName = app.Name
+		result = append(result, l)
+	}
+	return app.addLogs(result)
+}
+
+func (app *App) addLogs(logs []Applog) error {
 	if len(logs) > 0 {
-		go notify(app.Name, logs)
-		app.Logs = append(app.Logs, logs...)
+		notify(app.Name, logs)
+		drains.send(app.Name, logs)
 		conn, err := db.Conn()
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
-		return conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"logs": app.Logs}})
+		return app.storeLogs(conn, logs)
 	}
 	return nil
 }
 
 // LastLogs returns a list of the last `lines` log of the app, matching the
-// given source.
-func (a *App) LastLogs(lines int, source string) ([]Applog, error) {
+// given filter.
+func (app *App) LastLogs(lines int, filter LogFilter) ([]Applog, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
-	match := bson.M{}
-	match["name"] = a.Name
-	if source != "" {
-		match["logs.source"] = source
-	}
-	pipe := []bson.M{
-		{"$unwind": "$logs"},
-		{"$match": match},
-		{"$project": bson.M{"_id": 0, "logs": 1}},
-		{"$sort": bson.M{"logs.date": -1}},
-		{"$limit": lines},
-	}
-	var result []map[string]map[string]interface{}
-	err = conn.Apps().Pipe(pipe).All(&result)
+	logs := []Applog{}
+	err = conn.Logs().Find(filter.query(app.Name)).Sort("-date").Limit(lines).All(&logs)
 	if err != nil {
 		return nil, err
 	}
-	n := len(result)
-	logs := make([]Applog, n)
-	for i, row := range result {
-		log := Applog{
-			Message: row["logs"]["message"].(string),
-			Source:  row["logs"]["source"].(string),
-			Date:    row["logs"]["date"].(time.Time),
-		}
-		logs[n-i-1] = log
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
 	}
 	return logs, nil
 }
@@ -40,7 +40,6 @@ func (s *S) TestGet(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
 	newApp.Env = map[string]bind.EnvVar{}
-	newApp.Logs = []Applog{}
 	err = s.conn.Apps().Update(bson.M{"name": newApp.Name}, &newApp)
 	c.Assert(err, gocheck.IsNil)
 	myApp := App{Name: "myApp"}
@@ -61,6 +60,8 @@ func (s *S) TestForceDestroy(c *gocheck.C) {
 	err := s.conn.Apps().Insert(&a)
 	c.Assert(err, gocheck.IsNil)
 	a.Get()
+	err = a.Log("some log", "tsuru")
+	c.Assert(err, gocheck.IsNil)
 	err = ForceDestroy(&a)
 	c.Assert(err, gocheck.IsNil)
 	err = a.Get()
@@ -68,6 +69,9 @@ func (s *S) TestForceDestroy(c *gocheck.C) {
 	qt, err := s.conn.Apps().Find(bson.M{"name": a.Name}).Count()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(qt, gocheck.Equals, 0)
+	qt, err = s.conn.Logs().Find(bson.M{"appname": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(qt, gocheck.Equals, 0)
 	c.Assert(s.provisioner.FindApp(&a), gocheck.Equals, -1)
 }
 func (s *S) TestDestroy(c *gocheck.C) {
@@ -397,11 +401,11 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
 	otherApp := App{Name: "warpaint"}
-	err = otherApp.AddUnits(5)
+	err = otherApp.AddUnits(5, "")
 	c.Assert(err, gocheck.IsNil)
 	units := s.provisioner.GetUnits(&app)
 	c.Assert(units, gocheck.HasLen, 6)
-	err = otherApp.AddUnits(2)
+	err = otherApp.AddUnits(2, "")
 	c.Assert(err, gocheck.IsNil)
 	units = s.provisioner.GetUnits(&app)
 	c.Assert(units, gocheck.HasLen, 8)
@@ -437,20 +441,108 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(gotMessages, gocheck.DeepEquals, expectedMessages)
 }
 
+func (s *S) TestAddUnitsIssuesLogToken(c *gocheck.C) {
+	app := App{Name: "warpaint", Framework: "python"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	err = app.AddUnits(1, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.LogToken, gocheck.Not(gocheck.Equals), "")
+	token := app.LogToken
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.LogToken, gocheck.Equals, token)
+	c.Assert(app.Env["TSURU_LOG_TOKEN"].Value, gocheck.Equals, token)
+}
+
 func (s *S) TestAddZeroUnits(c *gocheck.C) {
 	app := App{Name: "warpaint", Framework: "ruby"}
-	err := app.AddUnits(0)
+	err := app.AddUnits(0, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add zero units.")
 }
 
 func (s *S) TestAddUnitsFailureInProvisioner(c *gocheck.C) {
 	app := App{Name: "scars", Framework: "golang"}
-	err := app.AddUnits(2)
+	err := app.AddUnits(2, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "App is not provisioned.")
 }
 
+func (s *S) TestAddUnitsOfProcessType(c *gocheck.C) {
+	app := App{
+		Name:      "warpaint",
+		Framework: "python",
+		hooks:     &conf{Processes: map[string]string{"worker": "celery worker"}},
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	err = app.AddUnits(2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, gocheck.HasLen, 3)
+	c.Assert(units[1].ProcessType, gocheck.Equals, "worker")
+	c.Assert(units[2].ProcessType, gocheck.Equals, "worker")
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.Units, gocheck.HasLen, 2)
+	for _, u := range app.Units {
+		c.Assert(u.ProcessType, gocheck.Equals, "worker")
+	}
+}
+
+func (s *S) TestAddUnitsWebProcessType(c *gocheck.C) {
+	app := App{Name: "warpaint", Framework: "python"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	err = app.AddUnits(1, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.Units, gocheck.HasLen, 1)
+	c.Assert(app.Units[0].ProcessType, gocheck.Equals, provision.WebProcess)
+}
+
+func (s *S) TestAddUnitsUndeclaredProcessType(c *gocheck.C) {
+	app := App{
+		Name:      "warpaint",
+		Framework: "python",
+		hooks:     &conf{Processes: map[string]string{"worker": "celery worker"}},
+	}
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	err := app.AddUnits(2, "clock")
+	c.Assert(err, gocheck.ErrorMatches, `^The app does not declare the process type "clock".$`)
+	c.Assert(s.provisioner.GetUnits(&app), gocheck.HasLen, 1)
+}
+
+// webOnlyProvisioner hides the optional interfaces implemented by the wrapped
+// provisioner.
+type webOnlyProvisioner struct {
+	provision.Provisioner
+}
+
+func (s *S) TestAddUnitsOfProcessTypeProvisionerWithoutProcessSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	app := App{
+		Name:      "warpaint",
+		Framework: "python",
+		hooks:     &conf{Processes: map[string]string{"worker": "celery worker"}},
+	}
+	err := app.AddUnits(2, "worker")
+	c.Assert(err, gocheck.ErrorMatches, "^The provisioner does not support process types other than web.$")
+}
+
 type hasUnitChecker struct{}
 
 func (c *hasUnitChecker) Info() *gocheck.CheckerInfo {
@@ -498,19 +590,19 @@ func (s *S) TestRemoveUnitsPriority(c *gocheck.C) {
 	c.Assert(&a, HasUnit, un[3])
 	c.Assert(&a, HasUnit, un[4])
 	c.Assert(&a, HasUnit, un[5])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[4])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[1])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[3])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[2])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[5])
 	c.Assert(&a, HasUnit, un[0])
@@ -546,9 +638,9 @@ func (s *S) TestRemoveUnits(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	app.AddUnits(4)
+	app.AddUnits(4, "")
 	otherApp := App{Name: app.Name, Units: app.Units}
-	err = otherApp.RemoveUnits(2)
+	err = otherApp.RemoveUnits(2, "")
 	c.Assert(err, gocheck.IsNil)
 	ts.Close()
 	units := s.provisioner.GetUnits(&app)
@@ -604,12 +696,51 @@ func (s *S) TestRemoveUnitsInvalidValues(c *gocheck.C) {
 	defer s.provisioner.Destroy(&app)
 	s.provisioner.AddUnits(&app, 4)
 	for _, test := range tests {
-		err := app.RemoveUnits(test.n)
+		err := app.RemoveUnits(test.n, "")
 		c.Check(err, gocheck.NotNil)
 		c.Check(err.Error(), gocheck.Equals, test.expected)
 	}
 }
 
+func (s *S) TestRemoveUnitsOfProcessType(c *gocheck.C) {
+	app := App{Name: "chemistry", Framework: "python"}
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddProcessUnits(&app, 2, "worker")
+	for _, u := range s.provisioner.GetUnits(&app) {
+		app.Units = append(app.Units, Unit{Name: u.Name, State: "started", ProcessType: u.ProcessType})
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	err = app.RemoveUnits(2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].Name, gocheck.Equals, "chemistry/0")
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.Units, gocheck.HasLen, 1)
+	c.Assert(app.Units[0].Name, gocheck.Equals, "chemistry/0")
+}
+
+func (s *S) TestRemoveUnitsOfProcessTypeInvalidValues(c *gocheck.C) {
+	app := App{
+		Name:      "chemistry",
+		Framework: "python",
+		Units: []Unit{
+			{Name: "chemistry/0"},
+			{Name: "chemistry/1", ProcessType: "worker"},
+		},
+	}
+	err := app.RemoveUnits(1, "")
+	c.Assert(err, gocheck.ErrorMatches, "^Cannot remove all units from an app.$")
+	err = app.RemoveUnits(2, "worker")
+	c.Assert(err, gocheck.ErrorMatches, "^Cannot remove 2 units from this app, it has only 1 units.$")
+	err = app.RemoveUnits(1, "clock")
+	c.Assert(err, gocheck.ErrorMatches, "^Cannot remove 1 units from this app, it has only 0 units.$")
+}
+
 func (s *S) TestRemoveUnitsFailureInProvisioner(c *gocheck.C) {
 	s.provisioner.PrepareFailure("RemoveUnit", stderr.New("Cannot remove this unit."))
 	app := App{
@@ -622,7 +753,7 @@ func (s *S) TestRemoveUnitsFailureInProvisioner(c *gocheck.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	err = app.RemoveUnits(1)
+	err = app.RemoveUnits(1, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot remove this unit.")
 }
@@ -687,7 +818,7 @@ func (s *S) TestRemoveUnitByNameOrInstanceId(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	err = s.provisioner.Provision(&app)
 	c.Assert(err, gocheck.IsNil)
-	err = app.AddUnits(4)
+	err = app.AddUnits(4, "")
 	c.Assert(err, gocheck.IsNil)
 	defer func() {
 		s.provisioner.Destroy(&app)
@@ -739,7 +870,7 @@ func (s *S) TestRemoveAbsentUnit(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	err = s.provisioner.Provision(&app)
 	c.Assert(err, gocheck.IsNil)
-	err = app.AddUnits(1)
+	err = app.AddUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	defer func() {
 		s.provisioner.Destroy(&app)
@@ -1183,6 +1314,47 @@ post-restart:
 	c.Assert(a.hooks.PosRestart, gocheck.DeepEquals, []string{"testdata/pos.sh"})
 }
 
+func (s *S) TestLoadHooksWithHealthcheck(c *gocheck.C) {
+	output := `healthcheck:
+  path: /status
+  port: 8080
+  timeout: 30
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := a.loadHooks()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.hooks.Healthcheck, gocheck.DeepEquals, healthcheck{Path: "/status", Port: 8080, Timeout: 30})
+}
+
+func (s *S) TestLoadHooksSavesHealthcheck(c *gocheck.C) {
+	output := `healthcheck:
+  path: /status
+  interval: 120
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "healthyapp",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.loadHooks()
+	c.Assert(err, gocheck.IsNil)
+	expected := healthcheck{Path: "/status", Interval: 120}
+	c.Assert(a.Healthcheck, gocheck.DeepEquals, expected)
+	stored := App{Name: a.Name}
+	err = stored.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Healthcheck, gocheck.DeepEquals, expected)
+}
+
 func (s *S) TestLoadHooksWithError(c *gocheck.C) {
 	a := App{Name: "something", Framework: "django"}
 	err := a.loadHooks()
@@ -1191,6 +1363,88 @@ func (s *S) TestLoadHooksWithError(c *gocheck.C) {
 	c.Assert(a.hooks.PosRestart, gocheck.IsNil)
 }
 
+func (s *S) TestProcessesFromAppConf(c *gocheck.C) {
+	output := `processes:
+  web: gunicorn app:app
+  worker: celery worker
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	processes, err := a.Processes()
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"web": "gunicorn app:app", "worker": "celery worker"}
+	c.Assert(processes, gocheck.DeepEquals, expected)
+	c.Assert(s.provisioner.GetCmds("cat /home/application/current/Procfile", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestProcessesFromProcfile(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("pre-restart:\n  - pre.sh\n"))
+	s.provisioner.PrepareOutput([]byte("web: gunicorn app:app\nclock: python clock.py\n"))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	processes, err := a.Processes()
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"web": "gunicorn app:app", "clock": "python clock.py"}
+	c.Assert(processes, gocheck.DeepEquals, expected)
+	c.Assert(s.provisioner.GetCmds("cat /home/application/current/Procfile", &a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestProcessesReadsTheProcfileFromASingleUnit(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)
+	s.provisioner.PrepareOutput([]byte("web: gunicorn app:app\nclock: python clock.py\n"))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units: []Unit{
+			{Name: "i-0799", State: "started", ProcessType: "worker"},
+			{Name: "i-0800", State: "started"},
+			{Name: "i-0801", State: "started"},
+		},
+	}
+	processes, err := a.Processes()
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"web": "gunicorn app:app", "clock": "python clock.py"}
+	c.Assert(processes, gocheck.DeepEquals, expected)
+	cmds := s.provisioner.GetCmds("cat /home/application/current/Procfile", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "i-0800")
+}
+
+func (s *S) TestProcessesWithoutAppConfAndProcfile(c *gocheck.C) {
+	a := App{Name: "something", Framework: "django"}
+	processes, err := a.Processes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(processes, gocheck.HasLen, 0)
+}
+
+func (s *S) TestParseProcfile(c *gocheck.C) {
+	data := `# the web process
+web: gunicorn -b 0.0.0.0:8888 app:app
+
+worker:celery worker --loglevel=info
+`
+	processes, err := parseProcfile([]byte(data))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{
+		"web":    "gunicorn -b 0.0.0.0:8888 app:app",
+		"worker": "celery worker --loglevel=info",
+	}
+	c.Assert(processes, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestParseProcfileInvalidLine(c *gocheck.C) {
+	processes, err := parseProcfile([]byte("web: gunicorn app:app\nsome worker\n"))
+	c.Assert(processes, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `^Invalid line in the Procfile: "some worker".$`)
+}
+
 func (s *S) TestPreRestart(c *gocheck.C) {
 	s.provisioner.PrepareOutput([]byte("pre-restarted"))
 	a := App{
@@ -1319,6 +1573,90 @@ func (s *S) TestRestart(c *gocheck.C) {
 	c.Assert(restarts, gocheck.Equals, 1)
 }
 
+func (s *S) TestRestartClearsTheStoppedState(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // loadHooks
+	a := App{
+		Name:      "sleepyapp",
+		Framework: "django",
+		Units:     []Unit{{Name: "sleepyapp/0", State: "stopped"}, {Name: "sleepyapp/1", State: "down"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	var b bytes.Buffer
+	err = a.Restart(&b)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(a.Units[1].State, gocheck.Equals, provision.StatusDown.String())
+}
+
+func (s *S) TestStop(c *gocheck.C) {
+	a := App{
+		Name:      "sleepyapp",
+		Framework: "django",
+		Units:     []Unit{{Name: "sleepyapp/0", State: "started"}, {Name: "sleepyapp/1", State: "down"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var b bytes.Buffer
+	err = a.Stop(&b)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.String(), gocheck.Equals, "\n ---> Stopping your app\n")
+	c.Assert(s.provisioner.GetUnits(&a)[0].Status, gocheck.Equals, provision.StatusStopped)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	for _, u := range a.Units {
+		c.Check(u.State, gocheck.Equals, provision.StatusStopped.String())
+	}
+}
+
+func (s *S) TestStart(c *gocheck.C) {
+	a := App{
+		Name:      "sleepyapp",
+		Framework: "django",
+		Units:     []Unit{{Name: "sleepyapp/0", State: "stopped"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var b bytes.Buffer
+	err = a.Start(&b)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.String(), gocheck.Equals, "\n ---> Starting your app\n")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+}
+
+func (s *S) TestStopProvisionerWithoutStartStopSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "sleepyapp"}
+	var b bytes.Buffer
+	err := a.Stop(&b)
+	c.Assert(err, gocheck.Equals, errStartStopNotSupported)
+	err = a.Start(&b)
+	c.Assert(err, gocheck.Equals, errStartStopNotSupported)
+}
+
+func (s *S) TestStopFailure(c *gocheck.C) {
+	s.provisioner.PrepareFailure("Stop", stderr.New("Failed to stop."))
+	a := App{Name: "sleepyapp", Units: []Unit{{Name: "sleepyapp/0", State: "started"}}}
+	var b bytes.Buffer
+	err := a.Stop(&b)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to stop.$")
+	c.Assert(a.Units[0].State, gocheck.Equals, "started")
+}
+
 func (s *S) TestRestartRunsPreRestartHook(c *gocheck.C) {
 	s.provisioner.PrepareOutput([]byte("pre-restart-by-restart"))
 	a := App{
@@ -1358,13 +1696,21 @@ func (s *S) TestLog(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	err = a.Log("last log msg", "tsuru")
 	c.Assert(err, gocheck.IsNil)
-	var instance App
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "last log msg")
+	c.Assert(logs[0].Source, gocheck.Equals, "tsuru")
+	c.Assert(logs[0].AppName, gocheck.Equals, a.Name)
+	var instance map[string]interface{}
 	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&instance)
-	logLen := len(instance.Logs)
-	c.Assert(instance.Logs[logLen-1].Message, gocheck.Equals, "last log msg")
-	c.Assert(instance.Logs[logLen-1].Source, gocheck.Equals, "tsuru")
+	c.Assert(err, gocheck.IsNil)
+	_, ok := instance["logs"]
+	c.Assert(ok, gocheck.Equals, false)
 }
 
 func (s *S) TestLogShouldAddOneRecordByLine(c *gocheck.C) {
@@ -1372,13 +1718,15 @@ func (s *S) TestLogShouldAddOneRecordByLine(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	err = a.Log("last log msg\nfirst log", "source")
 	c.Assert(err, gocheck.IsNil)
-	instance := App{}
-	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&instance)
-	logLen := len(instance.Logs)
-	c.Assert(instance.Logs[logLen-2].Message, gocheck.Equals, "last log msg")
-	c.Assert(instance.Logs[logLen-1].Message, gocheck.Equals, "first log")
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).Sort("_id").All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "last log msg")
+	c.Assert(logs[1].Message, gocheck.Equals, "first log")
 }
 
 func (s *S) TestLogShouldNotLogBlankLines(c *gocheck.C) {
@@ -1388,14 +1736,16 @@ func (s *S) TestLogShouldNotLogBlankLines(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	err = a.Log("some message", "tsuru")
 	c.Assert(err, gocheck.IsNil)
 	err = a.Log("", "")
 	c.Assert(err, gocheck.IsNil)
-	var instance App
-	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&instance)
-	logLen := len(instance.Logs)
-	c.Assert(instance.Logs[logLen-1].Message, gocheck.Not(gocheck.Equals), "")
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "some message")
 }
 
 func (s *S) TestLogWithListeners(c *gocheck.C) {
@@ -1409,6 +1759,7 @@ func (s *S) TestLogWithListeners(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
 	l := NewLogListener(&a)
 	defer l.Close()
 	go func() {
@@ -1461,12 +1812,13 @@ func (s *S) TestLastLogs(c *gocheck.C) {
 	err := s.conn.Apps().Insert(app)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app.Name})
 	for i := 0; i < 15; i++ {
 		app.Log(strconv.Itoa(i), "tsuru")
 		time.Sleep(1e6) // let the time flow
 	}
 	app.Log("app3 log from circus", "circus")
-	logs, err := app.LastLogs(10, "tsuru")
+	logs, err := app.LastLogs(10, LogFilter{Source: "tsuru"})
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(logs, gocheck.HasLen, 10)
 	for i := 5; i < 15; i++ {
@@ -1475,6 +1827,25 @@ func (s *S) TestLastLogs(c *gocheck.C) {
 	}
 }
 
+func (s *S) TestLastLogsShouldNotReturnLogsFromOtherApps(c *gocheck.C) {
+	a := App{Name: "app3"}
+	other := App{Name: "app4"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": bson.M{"$in": []string{a.Name, other.Name}}})
+	a.Log("app3 log", "tsuru")
+	other.Log("app4 log", "tsuru")
+	logs, err := a.LastLogs(10, LogFilter{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "app3 log")
+}
+
+func (s *S) TestLastLogsWithoutLogs(c *gocheck.C) {
+	a := App{Name: "app3"}
+	logs, err := a.LastLogs(10, LogFilter{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.DeepEquals, []Applog{})
+}
+
 func (s *S) TestGetTeams(c *gocheck.C) {
 	app := App{Name: "app", Teams: []string{s.team.Name}}
 	teams := app.GetTeams()
@@ -1502,11 +1873,13 @@ func (s *S) TestGetUnits(c *gocheck.C) {
 
 func (s *S) TestAppMarshalJson(c *gocheck.C) {
 	app := App{
-		Name:      "name",
-		Framework: "Framework",
-		Teams:     []string{"team1"},
-		Ip:        "10.10.10.1",
-		CName:     "name.mycompany.com",
+		Name:           "name",
+		Framework:      "Framework",
+		Teams:          []string{"team1"},
+		Ip:             "10.10.10.1",
+		CName:          "name.mycompany.com",
+		DeployStrategy: BlueGreenStrategy,
+		Canary:         &Canary{Version: "abc123", Share: 10},
 	}
 	expected := make(map[string]interface{})
 	expected["Name"] = "name"
@@ -1516,6 +1889,9 @@ func (s *S) TestAppMarshalJson(c *gocheck.C) {
 	expected["Units"] = nil
 	expected["Ip"] = "10.10.10.1"
 	expected["CName"] = "name.mycompany.com"
+	expected["Maintenance"] = false
+	expected["DeployStrategy"] = "blue-green"
+	expected["Canary"] = map[string]interface{}{"Version": "abc123", "Share": float64(10)}
 	data, err := app.MarshalJSON()
 	c.Assert(err, gocheck.IsNil)
 	result := make(map[string]interface{})
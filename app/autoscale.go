@@ -0,0 +1,204 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// metricsWindow is the period of the samples averaged by the metrics source
+// of tsuru (see metricsSource).
+const metricsWindow = 5 * time.Minute
+
+func init() {
+	autoscale.Register(autoscale.DefaultSource, metricsSource{})
+}
+
+// metricsSource is the autoscale source backed by the samples stored by the
+// collector (see SaveMetrics). It provides the cpu and memory metrics,
+// averaging the samples of the web units taken in the last metricsWindow.
+type metricsSource struct{}
+
+func (metricsSource) Provides(metric string) bool {
+	return metric == autoscale.CPU || metric == autoscale.Memory
+}
+
+func (metricsSource) Metrics(a provision.App) (*autoscale.Metrics, error) {
+	app, ok := a.(*App)
+	if !ok {
+		app = &App{Name: a.GetName()}
+		if err := app.Get(); err != nil {
+			return nil, err
+		}
+	}
+	samples, err := app.Metrics(time.Now().Add(-metricsWindow))
+	if err != nil {
+		return nil, err
+	}
+	web := make(map[string]bool)
+	for _, u := range webUnits(app.Units) {
+		web[u.Name] = true
+	}
+	var (
+		m autoscale.Metrics
+		n int
+	)
+	for _, sample := range samples {
+		if !web[sample.Unit] {
+			continue
+		}
+		m.CPU += sample.CPU
+		m.Memory += sample.Memory
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("No recent metrics for the app %q.", app.Name)
+	}
+	m.CPU /= float64(n)
+	m.Memory /= float64(n)
+	return &m, nil
+}
+
+// AutoScale is the autoscale rule of an app. The scaler (see App.Scale)
+// keeps the number of web units of the app between MinUnits and MaxUnits,
+// adding one unit when the metric is above ScaleUp and removing one unit when
+// it's below ScaleDown.
+type AutoScale struct {
+	MinUnits uint
+	MaxUnits uint
+
+	// Metric is the name of the metric that drives the scaling: cpu,
+	// memory or requests (see autoscale.Metrics). It must be provided by
+	// the configured metrics source (see autoscale.SourceName).
+	Metric    string
+	ScaleUp   float64
+	ScaleDown float64
+
+	// Cooldown is the minimum number of seconds between two scaling
+	// actions, and LastScale the time of the last one.
+	Cooldown  int
+	LastScale time.Time
+}
+
+// Validate checks the metric, limits and thresholds of the rule.
+func (a *AutoScale) Validate() error {
+	var msg string
+	source := autoscale.SourceName()
+	if _, ok := (&autoscale.Metrics{}).Value(a.Metric); !ok {
+		msg = fmt.Sprintf("Unknown metric %q. Valid metrics are cpu, memory and requests.", a.Metric)
+	} else if src, err := autoscale.Get(source); err != nil || !src.Provides(a.Metric) {
+		msg = fmt.Sprintf("The metric %q is not provided by the metrics source %q.", a.Metric, source)
+	} else if a.MinUnits == 0 {
+		msg = "The minimum number of units must be at least 1."
+	} else if a.MaxUnits < a.MinUnits {
+		msg = "The maximum number of units must not be less than the minimum."
+	} else if a.ScaleDown <= 0 || a.ScaleDown >= a.ScaleUp {
+		msg = "The scale down threshold must be positive and less than the scale up threshold."
+	} else if a.Cooldown < 0 {
+		msg = "The cooldown must not be negative."
+	}
+	if msg != "" {
+		return &errors.ValidationError{Message: msg}
+	}
+	return nil
+}
+
+// SetAutoScale validates and saves the autoscale rule of the app. A nil rule
+// disables autoscaling.
+func (app *App) SetAutoScale(rule *AutoScale) error {
+	if rule != nil {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		rule.LastScale = time.Time{}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"autoscale": rule}})
+	if err != nil {
+		return err
+	}
+	app.AutoScale = rule
+	return nil
+}
+
+// Scale applies the autoscale rule of the app, given the current metrics of
+// its web units. It adds or removes web units to keep their number within
+// the limits of the rule, or one unit when the metric crosses one of the
+// thresholds.
+//
+// Apps without an autoscale rule, in maintenance, with a canary release or
+// with stopped or pending units are left alone, and so are apps in the middle
+// of a blue/green deploy (with web units running different versions) and apps
+// that were scaled less than the cooldown of the rule ago.
+func (app *App) Scale(m *autoscale.Metrics) error {
+	rule := app.AutoScale
+	if rule == nil || app.Maintenance || app.Canary != nil {
+		return nil
+	}
+	if time.Since(rule.LastScale) < time.Duration(rule.Cooldown)*time.Second {
+		return nil
+	}
+	web := webUnits(app.Units)
+	for _, u := range web {
+		if u.State == provision.StatusStopped.String() || u.State == provision.StatusPending.String() {
+			return nil
+		}
+		if u.Version != web[0].Version {
+			return nil
+		}
+	}
+	value, ok := m.Value(rule.Metric)
+	if !ok {
+		return fmt.Errorf("Unknown metric %q.", rule.Metric)
+	}
+	units := len(web)
+	min, max := int(rule.MinUnits), int(rule.MaxUnits)
+	var delta int
+	switch {
+	case units < min:
+		delta = min - units
+	case units > max:
+		delta = max - units
+	case value > rule.ScaleUp && units < max:
+		delta = 1
+	case value < rule.ScaleDown && units > min:
+		delta = -1
+	}
+	if delta == 0 {
+		return nil
+	}
+	app.Log(fmt.Sprintf("autoscaling from %d to %d units (%s: %.2f)", units, units+delta, rule.Metric, value), "tsuru")
+	var err error
+	if delta > 0 {
+		err = app.AddUnits(uint(delta), provision.WebProcess)
+	} else {
+		err = app.RemoveUnits(uint(-delta), provision.WebProcess)
+	}
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	now := time.Now()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"autoscale.lastscale": now}})
+	if err != nil {
+		return err
+	}
+	rule.LastScale = now
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestAutoScaleValidate(c *gocheck.C) {
+	valid := AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "cpu", ScaleUp: 80, ScaleDown: 20, Cooldown: 300}
+	c.Assert(valid.Validate(), gocheck.IsNil)
+	var tests = []struct {
+		change func(*AutoScale)
+		msg    string
+	}{
+		{func(a *AutoScale) { a.Metric = "disk" }, `Unknown metric "disk". Valid metrics are cpu, memory and requests.`},
+		{func(a *AutoScale) { a.Metric = "requests" }, `The metric "requests" is not provided by the metrics source "tsuru".`},
+		{func(a *AutoScale) { a.MinUnits = 0 }, "The minimum number of units must be at least 1."},
+		{func(a *AutoScale) { a.MaxUnits = 0 }, "The maximum number of units must not be less than the minimum."},
+		{func(a *AutoScale) { a.ScaleDown = 80 }, "The scale down threshold must be positive and less than the scale up threshold."},
+		{func(a *AutoScale) { a.ScaleDown = -1 }, "The scale down threshold must be positive and less than the scale up threshold."},
+		{func(a *AutoScale) { a.ScaleDown = 0 }, "The scale down threshold must be positive and less than the scale up threshold."},
+		{func(a *AutoScale) { a.Cooldown = -1 }, "The cooldown must not be negative."},
+	}
+	for _, t := range tests {
+		rule := valid
+		t.change(&rule)
+		err := rule.Validate()
+		c.Check(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+		c.Check(err, gocheck.ErrorMatches, t.msg)
+	}
+}
+
+func (s *S) TestAutoScaleValidateWithTheConfiguredSource(c *gocheck.C) {
+	config.Set("autoscale:metrics-source", "fake")
+	defer config.Unset("autoscale:metrics-source")
+	rule := AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "requests", ScaleUp: 100, ScaleDown: 10}
+	c.Assert(rule.Validate(), gocheck.IsNil)
+	config.Set("autoscale:metrics-source", "unknown")
+	err := rule.Validate()
+	c.Assert(err, gocheck.ErrorMatches, `The metric "requests" is not provided by the metrics source "unknown".`)
+}
+
+func (s *S) TestMetricsSourceProvides(c *gocheck.C) {
+	var src metricsSource
+	c.Assert(src.Provides("cpu"), gocheck.Equals, true)
+	c.Assert(src.Provides("memory"), gocheck.Equals, true)
+	c.Assert(src.Provides("requests"), gocheck.Equals, false)
+	registered, err := autoscale.Get("tsuru")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(registered, gocheck.Equals, autoscale.Source(src))
+}
+
+func (s *S) TestMetricsSourceAveragesTheRecentSamplesOfTheWebUnits(c *gocheck.C) {
+	a := App{
+		Name:      "metered",
+		Framework: "python",
+		Units: []Unit{
+			{Name: "metered/0", ProcessType: "web"},
+			{Name: "metered/1", ProcessType: "web"},
+			{Name: "metered/2", ProcessType: "worker"},
+		},
+	}
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": a.Name})
+	now := time.Now()
+	samples := []interface{}{
+		MetricsSample{App: a.Name, Unit: "metered/0", Time: now, Samples: 1, CPU: 10, Memory: 20},
+		MetricsSample{App: a.Name, Unit: "metered/1", Time: now, Samples: 1, CPU: 30, Memory: 40},
+		MetricsSample{App: a.Name, Unit: "metered/2", Time: now, Samples: 1, CPU: 90, Memory: 90},
+		MetricsSample{App: a.Name, Unit: "metered/0", Time: now.Add(-time.Hour), Samples: 1, CPU: 90, Memory: 90},
+	}
+	err := s.conn.Metrics().Insert(samples...)
+	c.Assert(err, gocheck.IsNil)
+	m, err := metricsSource{}.Metrics(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*m, gocheck.Equals, autoscale.Metrics{CPU: 20, Memory: 30})
+}
+
+func (s *S) TestMetricsSourceWithoutRecentSamples(c *gocheck.C) {
+	a := App{Name: "unmetered", Units: []Unit{{Name: "unmetered/0", ProcessType: "web"}}}
+	_, err := metricsSource{}.Metrics(&a)
+	c.Assert(err, gocheck.ErrorMatches, `No recent metrics for the app "unmetered".`)
+}
+
+func (s *S) TestSetAutoScale(c *gocheck.C) {
+	a := App{Name: "scalable", Framework: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	rule := AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "cpu", ScaleUp: 80, ScaleDown: 20, LastScale: time.Now()}
+	err = a.SetAutoScale(&rule)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.Equals, &rule)
+	c.Assert(rule.LastScale.IsZero(), gocheck.Equals, true)
+	stored := App{Name: a.Name}
+	err = stored.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.AutoScale.MaxUnits, gocheck.Equals, uint(5))
+	c.Assert(stored.AutoScale.Metric, gocheck.Equals, "cpu")
+	err = a.SetAutoScale(nil)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.AutoScale, gocheck.IsNil)
+	err = stored.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.AutoScale, gocheck.IsNil)
+}
+
+func (s *S) TestSetAutoScaleInvalidRule(c *gocheck.C) {
+	a := App{Name: "scalable", Framework: "python"}
+	err := a.SetAutoScale(&AutoScale{MinUnits: 1, MaxUnits: 5, Metric: "disk"})
+	c.Assert(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(a.AutoScale, gocheck.IsNil)
+}
+
+// scalableApp creates an app with the given number of web units and the
+// given autoscale rule, in the database and in the provisioner.
+func (s *S) scalableApp(c *gocheck.C, name string, units uint, rule *AutoScale) *App {
+	a := App{Name: name, Framework: "python", AutoScale: rule}
+	s.provisioner.Provision(&a)
+	if units > 1 {
+		_, err := s.provisioner.AddUnits(&a, units-1)
+		c.Assert(err, gocheck.IsNil)
+	}
+	for _, u := range s.provisioner.GetUnits(&a) {
+		a.Units = append(a.Units, Unit{Name: u.Name, Ip: u.Ip, State: u.Status.String()})
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	return &a
+}
+
+func (s *S) destroyScalableApp(a *App) {
+	s.provisioner.Destroy(a)
+	s.conn.Apps().Remove(bson.M{"name": a.Name})
+}
+
+func (s *S) TestScaleUp(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-up", 2, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 3)
+	c.Assert(a.AutoScale.LastScale.IsZero(), gocheck.Equals, false)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 3)
+	c.Assert(a.AutoScale.LastScale.IsZero(), gocheck.Equals, false)
+}
+
+func (s *S) TestScaleUpRespectsTheMaximum(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 2, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-max", 2, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 2)
+	c.Assert(a.AutoScale.LastScale.IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestScaleDown(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "requests", ScaleUp: 100, ScaleDown: 10}
+	a := s.scalableApp(c, "scale-down", 2, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{Requests: 5})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleDownRespectsTheMinimum(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 2, MaxUnits: 3, Metric: "memory", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-min", 2, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{Memory: 5})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 2)
+}
+
+func (s *S) TestScaleToTheLimits(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 3, MaxUnits: 5, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-limits", 1, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{CPU: 50})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 3)
+}
+
+func (s *S) TestScaleWithinTheThresholds(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-steady", 2, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{CPU: 50})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 2)
+}
+
+func (s *S) TestScaleRespectsTheCooldown(c *gocheck.C) {
+	last := time.Now().Add(-time.Minute)
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20, Cooldown: 300, LastScale: last}
+	a := s.scalableApp(c, "scale-cooldown", 1, &rule)
+	defer s.destroyScalableApp(a)
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+	a.AutoScale.LastScale = time.Now().Add(-10 * time.Minute)
+	err = a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 2)
+}
+
+func (s *S) TestScaleSkipsAppsWithCanary(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-canary", 1, &rule)
+	defer s.destroyScalableApp(a)
+	a.Canary = &Canary{Version: "abc123", Share: 10}
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleSkipsStoppedApps(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-stopped", 1, &rule)
+	defer s.destroyScalableApp(a)
+	a.Units = []Unit{{Name: "scale-stopped/0", State: "stopped"}}
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleSkipsAppsInMaintenance(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-maintenance", 1, &rule)
+	defer s.destroyScalableApp(a)
+	a.Maintenance = true
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleSkipsAppsWithPendingUnits(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-pending", 1, &rule)
+	defer s.destroyScalableApp(a)
+	a.Units = append(a.Units, Unit{Name: "scale-pending/1", State: "pending"})
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleSkipsAppsInTheMiddleOfABlueGreenDeploy(c *gocheck.C) {
+	rule := AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := s.scalableApp(c, "scale-bluegreen", 1, &rule)
+	defer s.destroyScalableApp(a)
+	a.Units[0].Version = "v1"
+	a.Units = append(a.Units, Unit{Name: "scale-bluegreen/1", State: "started", Version: "v2"})
+	err := a.Scale(&autoscale.Metrics{CPU: 90})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleWithoutRule(c *gocheck.C) {
+	a := App{Name: "not-scalable"}
+	c.Assert(a.Scale(&autoscale.Metrics{CPU: 90}), gocheck.IsNil)
+}
@@ -0,0 +1,419 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// BlueGreenStrategy is the deploy strategy that deploys the app in a new set
+// of units, switching the router to them once they're healthy.
+const BlueGreenStrategy = "blue-green"
+
+const (
+	defaultStandbyTimeout = 600
+	defaultGracePeriod    = 30
+)
+
+// standbyInterval is the interval between two checks while waiting for the
+// new units of a blue/green deploy to start.
+var standbyInterval = 5 * time.Second
+
+var (
+	errBlueGreenNotSupported  = &errors.ValidationError{Message: "The provisioner can't deploy apps in blue/green mode."}
+	errNoBlueGreenHealthcheck = &errors.ValidationError{Message: "The app must declare a health check in app.conf to be deployed in blue/green mode."}
+)
+
+// SetDeployStrategy defines how the app is deployed from git. The default
+// strategy (an empty string or "default") updates the code of the units in
+// place and restarts them. The blue-green strategy deploys the new code in a
+// new set of units (see blueGreenDeploy), and requires a provisioner that
+// implements provision.BlueGreenProvisioner and a health check declared in
+// app.conf.
+func (app *App) SetDeployStrategy(strategy string) error {
+	switch strategy {
+	case "", "default":
+		strategy = ""
+	case BlueGreenStrategy:
+		if _, ok := blueGreenProvisioner(); !ok {
+			return errBlueGreenNotSupported
+		}
+		if !app.hasHealthcheck() {
+			return errNoBlueGreenHealthcheck
+		}
+	default:
+		msg := fmt.Sprintf("Unknown deploy strategy %q. Valid strategies are default and %s.", strategy, BlueGreenStrategy)
+		return &errors.ValidationError{Message: msg}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"deploystrategy": strategy}})
+	if err != nil {
+		return err
+	}
+	app.DeployStrategy = strategy
+	return nil
+}
+
+// blueGreenProvisioner returns the provisioner as a BlueGreenProvisioner.
+// Deployers use their own deploy strategy, so they can't deploy in blue/green
+// mode.
+func blueGreenProvisioner() (provision.BlueGreenProvisioner, bool) {
+	if _, ok := Provisioner.(provision.Deployer); ok {
+		return nil, false
+	}
+	p, ok := Provisioner.(provision.BlueGreenProvisioner)
+	return p, ok
+}
+
+// hasHealthcheck returns whether the app declares a health check in app.conf.
+// When app.conf can't be read from the units, the health check saved in the
+// database is used.
+func (app *App) hasHealthcheck() bool {
+	app.loadHooks()
+	return app.hooks.Healthcheck.Path != "" || app.Healthcheck.Path != ""
+}
+
+// blueGreenDeploy deploys the given commit of the app in a new set of units,
+// writing the progress to w. It's composed of the following steps:
+//
+//     1. Add new units, as many as the app has of each process type, without
+//        adding them to the router
+//     2. Wait for the new units to start
+//     3. Clone the repository, install dependencies and restart the new units
+//     4. Check the health of the new web units, using the health check
+//        declared in app.conf, and bind the new units to service instances
+//     5. Switch the router from the old units to the new units
+//     6. Remove the old units, after the grace period (blue-green:grace-period)
+//
+// If any step before the switch fails, the new units are removed and the old
+// units keep serving the app. Apps with web units that don't declare a health
+// check are refused before any unit is added.
+func (app *App) blueGreenDeploy(commit string, w io.Writer) error {
+	p, ok := blueGreenProvisioner()
+	if !ok {
+		return errBlueGreenNotSupported
+	}
+	old := make([]Unit, len(app.Units))
+	copy(old, app.Units)
+	if len(old) == 0 {
+		return stderr.New("The app has no units to replace.")
+	}
+	if len(webUnits(old)) > 0 && !app.hasHealthcheck() {
+		return errNoBlueGreenHealthcheck
+	}
+	app.Log("deploying in blue/green mode", "tsuru")
+	err := write(w, []byte("\n ---> Adding new units\n"))
+	if err != nil {
+		return err
+	}
+	standby, err := app.addStandbyUnits(p, old)
+	if err == nil {
+		standby, err = app.deployStandby(p, standby, w, func(green *App, w io.Writer) error {
+			return green.cloneRepository(commit, w)
+		})
+	}
+	if err == nil {
+		err = write(w, []byte("\n ---> Switching the router to the new units\n"))
+	}
+	if err == nil {
+		err = p.SwitchUnits(app, unitsOf(app, standby), unitsOf(app, old))
+	}
+	if err != nil {
+		app.Log(fmt.Sprintf("blue/green deploy aborted: %s", err), "tsuru")
+		fmt.Fprintf(w, "\n ---> Blue/green deploy aborted: %s\n", err)
+		if dErr := app.discardUnits(standby); dErr != nil {
+			log.Printf("Failed to remove the new units of %s: %s", app.Name, dErr)
+		}
+		return err
+	}
+	err = write(w, []byte("\n ---> Removing the old units\n"))
+	if err != nil {
+		return err
+	}
+	grace := defaultGracePeriod
+	if v, err := config.GetInt("blue-green:grace-period"); err == nil {
+		grace = v
+	}
+	time.Sleep(time.Duration(grace) * time.Second)
+	return app.discardUnits(old)
+}
+
+// addStandbyUnits adds to the app new units matching the given units, saving
+// them in the database. The added units are returned even when the
+// provisioner fails to add all of them.
+func (app *App) addStandbyUnits(p provision.BlueGreenProvisioner, units []Unit) ([]Unit, error) {
+	var processes []string
+	counts := make(map[string]uint)
+	for _, u := range units {
+		process := u.GetProcessType()
+		if counts[process] == 0 {
+			processes = append(processes, process)
+		}
+		counts[process]++
+	}
+	var (
+		standby []Unit
+		err     error
+	)
+	for _, process := range processes {
+		var added []provision.Unit
+		added, err = p.AddStandbyUnits(app, counts[process], process)
+		for _, unit := range added {
+			state := unit.Status.String()
+			if state == "" {
+				state = provision.StatusPending.String()
+			}
+			standby = append(standby, Unit{
+				Name:        unit.Name,
+				Type:        unit.Type,
+				ProcessType: process,
+				Ip:          unit.Ip,
+				Machine:     unit.Machine,
+				State:       state,
+				InstanceId:  unit.InstanceId,
+			})
+		}
+		if err != nil {
+			break
+		}
+	}
+	if sErr := app.pushUnits(standby); err == nil {
+		err = sErr
+	}
+	return standby, err
+}
+
+// deployStandby puts the code of the app in the standby units using the given
+// function, installs dependencies and restarts the units, then checks their
+// health and binds them to the service instances of the app. The function
+// receives a copy of the app scoped to the standby units (see unitScoped).
+//
+// It returns the standby units as stored in the database, after they start.
+func (app *App) deployStandby(p provision.BlueGreenProvisioner, standby []Unit, w io.Writer, fetch func(*App, io.Writer) error) ([]Unit, error) {
+	units, err := app.waitUnits(standby)
+	if err != nil {
+		return standby, err
+	}
+	for i := range app.Units {
+		for _, u := range units {
+			if app.Units[i].Name == u.Name {
+				app.Units[i] = u
+			}
+		}
+	}
+	green := *app
+	green.Units = units
+	green.hooks = nil
+	green.unitScoped = true
+	if err = green.serializeEnvVars(); err != nil {
+		return units, err
+	}
+	if err = fetch(&green, w); err != nil {
+		return units, err
+	}
+	if err = write(w, []byte("\n ---> Installing dependencies\n")); err != nil {
+		return units, err
+	}
+	if err = green.InstallDeps(w); err != nil {
+		return units, err
+	}
+	if err = write(w, []byte("\n ---> Starting the new units\n")); err != nil {
+		return units, err
+	}
+	if err = green.restartUnits(p, w); err != nil {
+		return units, err
+	}
+	if err = write(w, []byte("\n ---> Checking the health of the new units\n")); err != nil {
+		return units, err
+	}
+	for _, u := range green.ProvisionUnits() {
+		if u.GetProcessType() != provision.WebProcess {
+			continue
+		}
+		if green.hooks.Healthcheck.Path == "" {
+			return units, errNoBlueGreenHealthcheck
+		}
+		if err = green.hooks.Healthcheck.wait(u.GetIp()); err != nil {
+			return units, fmt.Errorf("%s failed the health check (%s)", u.GetName(), err)
+		}
+	}
+	for i := range green.Units {
+		if err = app.bindUnit(&green.Units[i]); err != nil {
+			return units, err
+		}
+	}
+	return units, nil
+}
+
+// cloneRepository clones (or pulls) the repository of the app in its units,
+// checking out the given commit when it's not empty.
+func (app *App) cloneRepository(commit string, w io.Writer) error {
+	err := write(w, []byte("\n ---> Replicating the application repository across new units\n"))
+	if err != nil {
+		return err
+	}
+	out, err := repository.CloneOrPull(app)
+	if err != nil {
+		return &provision.Error{Reason: string(out), Err: err}
+	}
+	if err = write(w, out); err != nil {
+		return err
+	}
+	if commit == "" {
+		return nil
+	}
+	err = write(w, []byte(fmt.Sprintf("\n ---> Checking out %s\n", commit)))
+	if err != nil {
+		return err
+	}
+	out, err = repository.Checkout(app, commit)
+	if err != nil {
+		return &provision.Error{Reason: string(out), Err: err}
+	}
+	return write(w, out)
+}
+
+// restartUnits runs the pre-restart hooks, restarts the units of the app one
+// by one and runs the post-restart hooks.
+func (app *App) restartUnits(p provision.RollingRestarter, w io.Writer) error {
+	err := app.preRestart(w)
+	if err != nil {
+		return err
+	}
+	for _, u := range app.ProvisionUnits() {
+		if err = p.RestartUnit(app, u); err != nil {
+			return fmt.Errorf("%s failed to restart (%s)", u.GetName(), err)
+		}
+	}
+	return app.postRestart(w)
+}
+
+// waitUnits waits until the given units are started, returning them as
+// stored in the database. The timeout is defined by the
+// blue-green:standby-timeout setting.
+func (app *App) waitUnits(units []Unit) ([]Unit, error) {
+	if unitList(units).Started() {
+		return units, nil
+	}
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = u.Name
+	}
+	timeout := defaultStandbyTimeout
+	if v, err := config.GetInt("blue-green:standby-timeout"); err == nil {
+		timeout = v
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		a := App{Name: app.Name}
+		if err := a.Get(); err != nil {
+			return nil, err
+		}
+		started := getUnits(&a, names)
+		if len(started) == len(names) && started.Started() {
+			return started, nil
+		}
+		if state := started.State(); state == provision.StatusError.String() || state == provision.StatusDown.String() {
+			return nil, fmt.Errorf("The new units are in %q state.", state)
+		}
+		if time.Now().After(deadline) {
+			return nil, stderr.New("Timed out waiting for the new units to start.")
+		}
+		time.Sleep(standbyInterval)
+	}
+}
+
+// discardUnits removes the given units from the provisioner and from the
+// app, unbinding them from service instances.
+func (app *App) discardUnits(units []Unit) error {
+	if len(units) == 0 {
+		return nil
+	}
+	discarded := make(map[string]bool, len(units))
+	for i := range units {
+		if err := Provisioner.RemoveUnit(app, units[i].Name); err != nil {
+			log.Printf("Failed to remove the unit %s: %s", units[i].Name, err)
+		}
+		app.unbindUnit(&units[i])
+		discarded[units[i].Name] = true
+	}
+	return app.pullUnits(discarded)
+}
+
+// pushUnits adds the given units to the app, in the database. Other units of
+// the app are not touched, so updates made by the collector are kept.
+func (app *App) pushUnits(units []Unit) error {
+	if len(units) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$push": bson.M{"units": bson.M{"$each": units}}},
+	)
+	if err != nil {
+		return err
+	}
+	app.Units = append(app.Units, units...)
+	return nil
+}
+
+// pullUnits removes the units with the given names from the app, in the
+// database.
+func (app *App) pullUnits(names map[string]bool) error {
+	in := make([]string, 0, len(names))
+	for name := range names {
+		in = append(in, name)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$pull": bson.M{"units": bson.M{"name": bson.M{"$in": in}}}},
+	)
+	if err != nil {
+		return err
+	}
+	var kept []Unit
+	for _, u := range app.Units {
+		if !names[u.Name] {
+			kept = append(kept, u)
+		}
+	}
+	app.Units = kept
+	return nil
+}
+
+// unitsOf converts the given units to provision.AppUnit, bound to the app.
+func unitsOf(app *App, units []Unit) []provision.AppUnit {
+	result := make([]provision.AppUnit, len(units))
+	for i, u := range units {
+		other := u
+		other.app = app
+		result[i] = &other
+	}
+	return result
+}
@@ -0,0 +1,255 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"strings"
+)
+
+func (s *S) TestSetDeployStrategy(c *gocheck.C) {
+	a := App{Name: "bluestrategy", Healthcheck: healthcheck{Path: "/healthcheck"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetDeployStrategy(BlueGreenStrategy)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, BlueGreenStrategy)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, BlueGreenStrategy)
+	err = a.SetDeployStrategy("default")
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, "")
+}
+
+func (s *S) TestSetDeployStrategyWithoutHealthcheck(c *gocheck.C) {
+	a := App{Name: "bluestrategy"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetDeployStrategy(BlueGreenStrategy)
+	c.Assert(err, gocheck.Equals, errNoBlueGreenHealthcheck)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.DeployStrategy, gocheck.Equals, "")
+}
+
+func (s *S) TestSetDeployStrategyUnknownStrategy(c *gocheck.C) {
+	a := App{Name: "bluestrategy"}
+	err := a.SetDeployStrategy("red-black")
+	c.Assert(err, gocheck.ErrorMatches, `Unknown deploy strategy "red-black". Valid strategies are default and blue-green.`)
+}
+
+func (s *S) TestSetDeployStrategyProvisionerWithoutBlueGreenSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "bluestrategy"}
+	err := a.SetDeployStrategy(BlueGreenStrategy)
+	c.Assert(err, gocheck.Equals, errBlueGreenNotSupported)
+}
+
+func (s *S) TestBlueGreenDeploy(c *gocheck.C) {
+	config.Set("blue-green:grace-period", 0)
+	defer config.Unset("blue-green:grace-period")
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	a := App{
+		Name:           "bluegreen",
+		Framework:      "python",
+		DeployStrategy: BlueGreenStrategy,
+		Units:          []Unit{{Name: "bluegreen/0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	appConf := []byte(fmt.Sprintf("healthcheck:\n  path: %s\n  port: %d\n", h.Path, h.Port))
+	// app.conf of the old units, then apprc, git clone, dependencies and
+	// app.conf of the new units.
+	s.provisioner.PrepareOutput(appConf)
+	for i := 0; i < 3; i++ {
+		s.provisioner.PrepareOutput(nil)
+	}
+	s.provisioner.PrepareOutput(appConf)
+	var buf bytes.Buffer
+	err = a.Deploy("", "", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	newUnit := a.Units[0].Name
+	c.Assert(newUnit, gocheck.Not(gocheck.Equals), "bluegreen/0")
+	standby, old := s.provisioner.Switched(&a)
+	c.Assert(standby, gocheck.DeepEquals, []string{newUnit})
+	c.Assert(old, gocheck.DeepEquals, []string{"bluegreen/0"})
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{newUnit})
+	for _, cmd := range s.provisioner.GetCmds("", &a) {
+		c.Assert(cmd.Unit, gocheck.Equals, newUnit)
+	}
+	units := s.provisioner.GetUnits(&a)
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].Name, gocheck.Equals, newUnit)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Name, gocheck.Equals, newUnit)
+	out := buf.String()
+	c.Assert(strings.Contains(out, " ---> Switching the router to the new units\n"), gocheck.Equals, true)
+	c.Assert(strings.Contains(out, " ---> Removing the old units\n"), gocheck.Equals, true)
+	deploys, err := ListDeploys(a.Name)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	c.Assert(deploys, gocheck.HasLen, 1)
+	c.Assert(deploys[0].Success, gocheck.Equals, true)
+}
+
+func (s *S) TestBlueGreenDeployWithoutHealthcheck(c *gocheck.C) {
+	a := App{
+		Name:  "bluenocheck",
+		Units: []Unit{{Name: "bluenocheck/0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareOutput(nil) // app.conf
+	var buf bytes.Buffer
+	err = a.blueGreenDeploy("", &buf)
+	c.Assert(err, gocheck.Equals, errNoBlueGreenHealthcheck)
+	c.Assert(a.Units, gocheck.DeepEquals, []Unit{{Name: "bluenocheck/0", State: provision.StatusStarted.String()}})
+	standby, _ := s.provisioner.Switched(&a)
+	c.Assert(standby, gocheck.IsNil)
+	units := s.provisioner.GetUnits(&a)
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].Name, gocheck.Equals, "bluenocheck/0")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(buf.String(), gocheck.Equals, "")
+}
+
+func (s *S) TestBlueGreenDeployWorkers(c *gocheck.C) {
+	config.Set("blue-green:grace-period", 0)
+	defer config.Unset("blue-green:grace-period")
+	a := App{
+		Name: "blueworker",
+		Units: []Unit{
+			{Name: "blueworker/0", State: provision.StatusStarted.String(), ProcessType: "worker"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var buf bytes.Buffer
+	err = a.blueGreenDeploy("", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].ProcessType, gocheck.Equals, "worker")
+	c.Assert(a.Units[0].Name, gocheck.Not(gocheck.Equals), "blueworker/0")
+}
+
+func (s *S) TestBlueGreenDeployFailureToAddUnits(c *gocheck.C) {
+	a := App{
+		Name:  "bluefail",
+		Units: []Unit{{Name: "bluefail/0", State: provision.StatusStarted.String()}},
+		hooks: &conf{Healthcheck: healthcheck{Path: "/healthcheck"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareFailure("AddStandbyUnits", errors.New("no capacity"))
+	var buf bytes.Buffer
+	err = a.blueGreenDeploy("", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "no capacity")
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	standby, _ := s.provisioner.Switched(&a)
+	c.Assert(standby, gocheck.IsNil)
+}
+
+func (s *S) TestBlueGreenDeployFailureToSwitch(c *gocheck.C) {
+	a := App{
+		Name:  "blueswitch",
+		Units: []Unit{{Name: "blueswitch/0", State: provision.StatusStarted.String(), ProcessType: "worker"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("SwitchUnits", errors.New("router is down"))
+	var buf bytes.Buffer
+	err = a.blueGreenDeploy("", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "router is down")
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "blueswitch/0")
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestBlueGreenDeployProvisionerWithoutBlueGreenSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "bluenosupport", Units: []Unit{{Name: "bluenosupport/0"}}}
+	var buf bytes.Buffer
+	err := a.blueGreenDeploy("", &buf)
+	c.Assert(err, gocheck.Equals, errBlueGreenNotSupported)
+}
+
+func (s *S) TestDiscardUnitsKeepsTheOtherUnits(c *gocheck.C) {
+	a := App{
+		Name: "bluediscard",
+		Units: []Unit{
+			{Name: "bluediscard/0", State: provision.StatusStarted.String()},
+			{Name: "bluediscard/1", State: provision.StatusStarted.String()},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.conn.Apps().Update(
+		bson.M{"name": a.Name, "units.name": "bluediscard/0"},
+		bson.M{"$set": bson.M{"units.$.state": provision.StatusDown.String()}},
+	)
+	c.Assert(err, gocheck.IsNil)
+	err = a.discardUnits([]Unit{a.Units[1]})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	var stored App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Units, gocheck.HasLen, 1)
+	c.Assert(stored.Units[0].Name, gocheck.Equals, "bluediscard/0")
+	c.Assert(stored.Units[0].State, gocheck.Equals, provision.StatusDown.String())
+}
+
+func (s *S) TestPushUnits(c *gocheck.C) {
+	a := App{Name: "bluepush", Units: []Unit{{Name: "bluepush/0"}}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.pushUnits([]Unit{{Name: "bluepush/1"}, {Name: "bluepush/2"}})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 3)
+	var stored App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Units, gocheck.HasLen, 3)
+	c.Assert(stored.Units[2].Name, gocheck.Equals, "bluepush/2")
+}
@@ -0,0 +1,348 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+var (
+	errCanaryNotSupported  = &errors.ValidationError{Message: "The provisioner can't deploy canary releases."}
+	errCanaryInProgress    = &errors.ValidationError{Message: "The app has a canary release in progress. Promote or abort it before deploying again."}
+	errNoCanary            = &errors.ValidationError{Message: "The app has no canary release in progress."}
+	errInvalidCanaryShare  = &errors.ValidationError{Message: "The share of the canary must be between 1% and 99%."}
+	errNoCanaryHealthcheck = &errors.ValidationError{Message: "The app must declare a health check in app.conf to deploy canary releases."}
+)
+
+// Canary is a new version of an app deployed to a subset of its web units,
+// that receives a share of the requests to the app. The canary units are the
+// units with the version of the canary.
+type Canary struct {
+	// Version is the id of the deploy of the canary.
+	Version string
+
+	// Share is the percentage of the requests routed to the canary units.
+	Share int
+
+	// Started is the time when the canary units started receiving
+	// requests. Only requests after it are counted by CanaryStatus.
+	Started time.Time
+}
+
+// CanaryReport contains the statistics of the requests answered by the
+// canary units and by the other (stable) web units of an app.
+type CanaryReport struct {
+	Version string
+	Share   int
+	Units   []string
+	Canary  provision.UnitStats
+	Stable  provision.UnitStats
+}
+
+// canaryProvisioner returns the provisioner as a CanaryProvisioner. The code
+// of canaries is sent to the units through their standard input, so the
+// provisioner must also be an InputCommandExecutor.
+func canaryProvisioner() (provision.CanaryProvisioner, bool) {
+	if _, ok := Provisioner.(provision.Deployer); ok {
+		return nil, false
+	}
+	p, ok := Provisioner.(provision.CanaryProvisioner)
+	if !ok {
+		return nil, false
+	}
+	_, ok = Provisioner.(provision.InputCommandExecutor)
+	return p, ok
+}
+
+// DeployCanary deploys the code contained in the given gzipped tar archive in
+// new web units of the app, routing the given share (a percentage) of the
+// requests to them. The number of canary units is the share of the current
+// web units, rounded up.
+//
+// The canary units are deployed like in blue/green deploys (see
+// blueGreenDeploy), and removed if anything fails. The canary is kept until
+// it's promoted (PromoteCanary) or aborted (AbortCanary), and the app can't be
+// deployed again in the meantime.
+func (app *App) DeployCanary(archive io.Reader, user string, share int, w io.Writer) error {
+	if share < 1 || share > 99 {
+		return errInvalidCanaryShare
+	}
+	if app.Canary != nil {
+		return errCanaryInProgress
+	}
+	p, ok := canaryProvisioner()
+	if !ok {
+		return errCanaryNotSupported
+	}
+	path, err := repository.GetPath()
+	if err != nil {
+		return fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	stable := webUnits(app.Units)
+	if len(stable) == 0 {
+		return &errors.ValidationError{Message: "The app has no web units."}
+	}
+	if !app.hasHealthcheck() {
+		return errNoCanaryHealthcheck
+	}
+	return app.recordDeploy(DeployData{User: user}, w, func(w io.Writer, version string) error {
+		content, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		return app.canaryDeploy(p, content, path, share, version, w)
+	})
+}
+
+func (app *App) canaryDeploy(p provision.CanaryProvisioner, archive []byte, path string, share int, version string, w io.Writer) error {
+	stable := webUnits(app.Units)
+	n := (len(stable)*share + 99) / 100
+	app.Log(fmt.Sprintf("deploying a canary release to %d units", n), "tsuru")
+	err := write(w, []byte(fmt.Sprintf("\n ---> Adding %d canary units\n", n)))
+	if err != nil {
+		return err
+	}
+	canary, err := app.addStandbyUnits(p, stable[:n])
+	if err == nil {
+		canary, err = app.deployStandby(p, canary, w, func(green *App, w io.Writer) error {
+			err := write(w, []byte("\n ---> Uploading the archive to the canary units\n"))
+			if err != nil {
+				return err
+			}
+			return green.uploadToUnits(archive, path, w)
+		})
+		if err == errNoBlueGreenHealthcheck {
+			err = errNoCanaryHealthcheck
+		}
+	}
+	if err == nil {
+		err = app.setUnitsVersion(canary, version)
+	}
+	if err == nil {
+		err = write(w, []byte(fmt.Sprintf("\n ---> Routing %d%% of the requests to the canary units\n", share)))
+	}
+	if err == nil {
+		wc, ws := canaryWeights(share, len(canary), len(stable))
+		if err = p.SetUnitsWeight(app, unitsOf(app, stable), ws); err == nil {
+			err = p.SetUnitsWeight(app, unitsOf(app, canary), wc)
+		}
+	}
+	if err == nil {
+		err = app.saveCanary(&Canary{Version: version, Share: share, Started: time.Now()})
+	}
+	if err != nil {
+		app.Log(fmt.Sprintf("canary deploy aborted: %s", err), "tsuru")
+		fmt.Fprintf(w, "\n ---> Canary deploy aborted: %s\n", err)
+		if wErr := p.SetUnitsWeight(app, unitsOf(app, stable), 1); wErr != nil {
+			log.Printf("Failed to reset the weight of the units of %s: %s", app.Name, wErr)
+		}
+		if dErr := app.discardUnits(canary); dErr != nil {
+			log.Printf("Failed to remove the canary units of %s: %s", app.Name, dErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// canaryWeights returns the weights of each canary unit and of each stable
+// unit, so the canary units receive the given share of the requests.
+func canaryWeights(share, canary, stable int) (int, int) {
+	wc, ws := share*stable, (100-share)*canary
+	a, b := wc, ws
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return wc / a, ws / a
+}
+
+// CanaryStatus returns the statistics of the canary of the app, compared to
+// the stable web units, as reported by the router. Only requests answered
+// since the canary started are counted.
+func (app *App) CanaryStatus() (*CanaryReport, error) {
+	if app.Canary == nil {
+		return nil, errNoCanary
+	}
+	p, ok := canaryProvisioner()
+	if !ok {
+		return nil, errCanaryNotSupported
+	}
+	web := webUnits(app.Units)
+	stats, err := p.UnitsStats(app, unitsOf(app, web), app.Canary.Started)
+	if err != nil {
+		return nil, err
+	}
+	report := CanaryReport{Version: app.Canary.Version, Share: app.Canary.Share}
+	for _, u := range web {
+		s := stats[u.Name]
+		if u.Version == app.Canary.Version {
+			report.Units = append(report.Units, u.Name)
+			report.Canary.Requests += s.Requests
+			report.Canary.Errors += s.Errors
+		} else {
+			report.Stable.Requests += s.Requests
+			report.Stable.Errors += s.Errors
+		}
+	}
+	return &report, nil
+}
+
+// PromoteCanary deploys the code of the canary in the other units of the app,
+// restarting them one by one, then removes the canary units and routes the
+// requests evenly again.
+func (app *App) PromoteCanary(w io.Writer) error {
+	if app.Canary == nil {
+		return errNoCanary
+	}
+	p, ok := canaryProvisioner()
+	if !ok {
+		return errCanaryNotSupported
+	}
+	path, err := repository.GetPath()
+	if err != nil {
+		return fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	canary, stable := app.canaryUnits()
+	if len(canary) == 0 {
+		return fmt.Errorf("The canary units of the app %q were not found.", app.Name)
+	}
+	app.Log("promoting the canary release", "tsuru")
+	err = write(w, []byte(fmt.Sprintf("\n ---> Fetching the code from the canary unit %s\n", canary[0].Name)))
+	if err != nil {
+		return err
+	}
+	var archive, stderr bytes.Buffer
+	executor := Provisioner.(provision.InputCommandExecutor)
+	cmd := fmt.Sprintf("tar -czf - -C %s .", path)
+	err = executor.ExecuteCommandOnUnit(&archive, &stderr, app, unitsOf(app, canary[:1])[0], cmd)
+	if err != nil {
+		return &provision.Error{Reason: stderr.String(), Err: err}
+	}
+	promoted := *app
+	promoted.Units = stable
+	promoted.hooks = nil
+	promoted.unitScoped = true
+	if err = write(w, []byte("\n ---> Uploading the code to the other units\n")); err != nil {
+		return err
+	}
+	if err = promoted.uploadToUnits(archive.Bytes(), path, w); err != nil {
+		return err
+	}
+	if err = write(w, []byte("\n ---> Installing dependencies\n")); err != nil {
+		return err
+	}
+	if err = promoted.InstallDeps(w); err != nil {
+		return err
+	}
+	if err = write(w, []byte("\n ---> Restarting the units\n")); err != nil {
+		return err
+	}
+	if err = promoted.restartUnits(p, w); err != nil {
+		return err
+	}
+	if err = app.setUnitsVersion(stable, app.Canary.Version); err != nil {
+		return err
+	}
+	if err = write(w, []byte("\n ---> Removing the canary units\n")); err != nil {
+		return err
+	}
+	return app.removeCanary(p, canary, stable)
+}
+
+// AbortCanary removes the canary units of the app and routes the requests
+// evenly to the other units again.
+func (app *App) AbortCanary(w io.Writer) error {
+	if app.Canary == nil {
+		return errNoCanary
+	}
+	p, ok := canaryProvisioner()
+	if !ok {
+		return errCanaryNotSupported
+	}
+	app.Log("aborting the canary release", "tsuru")
+	err := write(w, []byte("\n ---> Removing the canary units\n"))
+	if err != nil {
+		return err
+	}
+	canary, stable := app.canaryUnits()
+	return app.removeCanary(p, canary, stable)
+}
+
+// removeCanary resets the weight of the stable units, removes the canary
+// units and clears the canary of the app.
+func (app *App) removeCanary(p provision.CanaryProvisioner, canary, stable []Unit) error {
+	err := p.SetUnitsWeight(app, unitsOf(app, webUnits(stable)), 1)
+	if err != nil {
+		return err
+	}
+	if err = app.discardUnits(canary); err != nil {
+		return err
+	}
+	return app.saveCanary(nil)
+}
+
+// canaryUnits splits the units of the app in canary units and the other
+// (stable) units.
+func (app *App) canaryUnits() (canary, stable []Unit) {
+	for _, u := range app.Units {
+		if app.Canary != nil && u.Version == app.Canary.Version {
+			canary = append(canary, u)
+		} else {
+			stable = append(stable, u)
+		}
+	}
+	return canary, stable
+}
+
+// saveCanary sets the canary of the app, saving it in the database.
+func (app *App) saveCanary(c *Canary) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"canary": c}})
+	if err != nil {
+		return err
+	}
+	app.Canary = c
+	return nil
+}
+
+// uploadToUnits extracts the gzipped tar archive in the directory path of
+// each unit of the app, replacing the previous content of the directory but
+// its git checkout (see provision.ExtractCommand). The provisioner must be an
+// InputCommandExecutor.
+func (app *App) uploadToUnits(archive []byte, path string, w io.Writer) error {
+	executor := Provisioner.(provision.InputCommandExecutor)
+	cmd := provision.ExtractCommand(path)
+	for _, u := range app.ProvisionUnits() {
+		err := executor.ExecuteCommandOnUnitWithInput(bytes.NewReader(archive), w, w, app, u, cmd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webUnits returns the web units in the given list.
+func webUnits(units []Unit) []Unit {
+	var web []Unit
+	for _, u := range units {
+		if u.GetProcessType() == provision.WebProcess {
+			web = append(web, u)
+		}
+	}
+	return web
+}
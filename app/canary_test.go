@@ -0,0 +1,304 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"strings"
+)
+
+func (s *S) TestCanaryWeights(c *gocheck.C) {
+	var tests = []struct {
+		share, canary, stable int
+		wc, ws                int
+	}{
+		{10, 1, 2, 2, 9},
+		{50, 1, 1, 1, 1},
+		{25, 1, 4, 4, 3},
+		{99, 1, 1, 99, 1},
+	}
+	for _, t := range tests {
+		wc, ws := canaryWeights(t.share, t.canary, t.stable)
+		c.Check(wc, gocheck.Equals, t.wc)
+		c.Check(ws, gocheck.Equals, t.ws)
+	}
+}
+
+func (s *S) TestDeployCanary(c *gocheck.C) {
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	a := App{
+		Name:      "canaryapp",
+		Framework: "python",
+		Units: []Unit{
+			{Name: "canaryapp-stable-0", State: provision.StatusStarted.String(), Version: "v1"},
+			{Name: "canaryapp-stable-1", State: provision.StatusStarted.String(), Version: "v1"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	appConf := []byte(fmt.Sprintf("healthcheck:\n  path: %s\n  port: %d\n", h.Path, h.Port))
+	// app.conf of the stable units, then apprc, upload, dependencies and
+	// app.conf of the canary units.
+	s.provisioner.PrepareOutput(appConf)
+	for i := 0; i < 3; i++ {
+		s.provisioner.PrepareOutput(nil)
+	}
+	s.provisioner.PrepareOutput(appConf)
+	var buf bytes.Buffer
+	err = a.DeployCanary(strings.NewReader("archive content"), "gopher@tsuru.io", 10, &buf)
+	c.Assert(err, gocheck.IsNil)
+	var d DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Success, gocheck.Equals, true)
+	c.Assert(a.Canary.Version, gocheck.Equals, d.Id.Hex())
+	c.Assert(a.Canary.Share, gocheck.Equals, 10)
+	c.Assert(a.Canary.Started.IsZero(), gocheck.Equals, false)
+	started := a.Canary.Started
+	c.Assert(a.Units, gocheck.HasLen, 3)
+	canary := a.Units[2]
+	c.Assert(canary.Version, gocheck.Equals, d.Id.Hex())
+	upload := provision.ExtractCommand("/home/application/current")
+	cmds := s.provisioner.GetCmds(upload, &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, canary.Name)
+	c.Assert(string(cmds[0].Input), gocheck.Equals, "archive content")
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{canary.Name})
+	c.Assert(s.provisioner.Weight(&a, "canaryapp-stable-0"), gocheck.Equals, 9)
+	c.Assert(s.provisioner.Weight(&a, "canaryapp-stable-1"), gocheck.Equals, 9)
+	c.Assert(s.provisioner.Weight(&a, canary.Name), gocheck.Equals, 2)
+	c.Assert(strings.Contains(buf.String(), " ---> Routing 10% of the requests to the canary units\n"), gocheck.Equals, true)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary.Version, gocheck.Equals, d.Id.Hex())
+	c.Assert(a.Canary.Share, gocheck.Equals, 10)
+	c.Assert(a.Canary.Started.Unix(), gocheck.Equals, started.Unix())
+	c.Assert(a.Units, gocheck.HasLen, 3)
+	c.Assert(a.Units[0].Version, gocheck.Equals, "v1")
+	c.Assert(a.Units[2].Version, gocheck.Equals, d.Id.Hex())
+}
+
+func (s *S) TestDeployCanaryInvalidShare(c *gocheck.C) {
+	a := App{Name: "canaryshare", Units: []Unit{{Name: "canaryshare-0"}}}
+	var buf bytes.Buffer
+	for _, share := range []int{0, 100, -10} {
+		err := a.DeployCanary(strings.NewReader("archive"), "", share, &buf)
+		c.Check(err, gocheck.Equals, errInvalidCanaryShare)
+	}
+}
+
+func (s *S) TestDeployCanaryInProgress(c *gocheck.C) {
+	a := App{
+		Name:   "canarytwice",
+		Units:  []Unit{{Name: "canarytwice-0"}},
+		Canary: &Canary{Version: "v2", Share: 10},
+	}
+	var buf bytes.Buffer
+	err := a.DeployCanary(strings.NewReader("archive"), "", 10, &buf)
+	c.Assert(err, gocheck.Equals, errCanaryInProgress)
+}
+
+func (s *S) TestDeployCanaryWithoutWebUnits(c *gocheck.C) {
+	a := App{Name: "canaryworker", Units: []Unit{{Name: "canaryworker-0", ProcessType: "worker"}}}
+	var buf bytes.Buffer
+	err := a.DeployCanary(strings.NewReader("archive"), "", 10, &buf)
+	c.Assert(err, gocheck.ErrorMatches, "The app has no web units.")
+}
+
+func (s *S) TestDeployCanaryWithoutHealthcheck(c *gocheck.C) {
+	a := App{
+		Name:  "canarynocheck",
+		Units: []Unit{{Name: "canarynocheck-0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareOutput(nil) // app.conf
+	var buf bytes.Buffer
+	err = a.DeployCanary(strings.NewReader("archive"), "", 10, &buf)
+	c.Assert(err, gocheck.Equals, errNoCanaryHealthcheck)
+	c.Assert(buf.String(), gocheck.Equals, "")
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 1)
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestDeployCanaryProvisionerWithoutCanarySupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "canarynosupport", Units: []Unit{{Name: "canarynosupport-0"}}}
+	var buf bytes.Buffer
+	err := a.DeployCanary(strings.NewReader("archive"), "", 10, &buf)
+	c.Assert(err, gocheck.Equals, errCanaryNotSupported)
+}
+
+func (s *S) TestDeployCanaryFailureRemovesTheCanaryUnits(c *gocheck.C) {
+	a := App{
+		Name:  "canaryfail",
+		Units: []Unit{{Name: "canaryfail-stable-0", State: provision.StatusStarted.String()}},
+		hooks: &conf{Healthcheck: healthcheck{Path: "/healthcheck"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var buf bytes.Buffer
+	err = a.DeployCanary(strings.NewReader("archive"), "", 50, &buf)
+	c.Assert(err, gocheck.Equals, errNoCanaryHealthcheck)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "canaryfail-stable-0")
+	c.Assert(s.provisioner.Weight(&a, "canaryfail-stable-0"), gocheck.Equals, 1)
+	c.Assert(strings.Contains(buf.String(), " ---> Canary deploy aborted: "), gocheck.Equals, true)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+}
+
+func (s *S) TestDeployWithCanaryInProgress(c *gocheck.C) {
+	a := App{Name: "canarydeploy", Canary: &Canary{Version: "v2", Share: 10}}
+	var buf bytes.Buffer
+	err := a.Deploy("", "", &buf)
+	c.Assert(err, gocheck.Equals, errCanaryInProgress)
+	err = a.DeployArchive(strings.NewReader("archive"), "", &buf)
+	c.Assert(err, gocheck.Equals, errCanaryInProgress)
+}
+
+func (s *S) TestCanaryStatus(c *gocheck.C) {
+	a := App{
+		Name: "canarystatus",
+		Units: []Unit{
+			{Name: "canarystatus-0", Version: "v1"},
+			{Name: "canarystatus-1", Version: "v1"},
+			{Name: "canarystatus-2", Version: "v1", ProcessType: "worker"},
+			{Name: "canarystatus-3", Version: "v2"},
+		},
+		Canary: &Canary{Version: "v2", Share: 20},
+	}
+	s.provisioner.SetUnitStats(&a, "canarystatus-0", provision.UnitStats{Requests: 40, Errors: 1})
+	s.provisioner.SetUnitStats(&a, "canarystatus-1", provision.UnitStats{Requests: 38})
+	s.provisioner.SetUnitStats(&a, "canarystatus-3", provision.UnitStats{Requests: 20, Errors: 5})
+	report, err := a.CanaryStatus()
+	c.Assert(err, gocheck.IsNil)
+	expected := CanaryReport{
+		Version: "v2",
+		Share:   20,
+		Units:   []string{"canarystatus-3"},
+		Canary:  provision.UnitStats{Requests: 20, Errors: 5},
+		Stable:  provision.UnitStats{Requests: 78, Errors: 1},
+	}
+	c.Assert(*report, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCanaryStatusWithoutCanary(c *gocheck.C) {
+	a := App{Name: "canarynone"}
+	_, err := a.CanaryStatus()
+	c.Assert(err, gocheck.Equals, errNoCanary)
+}
+
+func (s *S) TestPromoteCanary(c *gocheck.C) {
+	a := App{
+		Name: "canarypromote",
+		Units: []Unit{
+			{Name: "canarypromote-0", Version: "v1", State: provision.StatusStarted.String()},
+			{Name: "canarypromote-1", Version: "v1", State: provision.StatusStarted.String(), ProcessType: "worker"},
+			{Name: "canarypromote-2", Version: "v2", State: provision.StatusStarted.String()},
+		},
+		Canary: &Canary{Version: "v2", Share: 10},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.SetUnitsWeight(&a, unitsOf(&a, a.Units[:1]), 9)
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner.PrepareOutput([]byte("canary archive"))
+	var buf bytes.Buffer
+	err = a.PromoteCanary(&buf)
+	c.Assert(err, gocheck.IsNil)
+	fetch := s.provisioner.GetCmds("tar -czf - -C /home/application/current .", &a)
+	c.Assert(fetch, gocheck.HasLen, 1)
+	c.Assert(fetch[0].Unit, gocheck.Equals, "canarypromote-2")
+	upload := provision.ExtractCommand("/home/application/current")
+	cmds := s.provisioner.GetCmds(upload, &a)
+	c.Assert(cmds, gocheck.HasLen, 2)
+	for i, cmd := range cmds {
+		c.Assert(cmd.Unit, gocheck.Equals, fmt.Sprintf("canarypromote-%d", i))
+		c.Assert(string(cmd.Input), gocheck.Equals, "canary archive")
+	}
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"canarypromote-0", "canarypromote-1"})
+	c.Assert(s.provisioner.Weight(&a, "canarypromote-0"), gocheck.Equals, 1)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 2)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 2)
+	for _, u := range a.Units {
+		c.Assert(u.Version, gocheck.Equals, "v2")
+	}
+}
+
+func (s *S) TestPromoteCanaryWithoutCanary(c *gocheck.C) {
+	a := App{Name: "canarynone"}
+	var buf bytes.Buffer
+	err := a.PromoteCanary(&buf)
+	c.Assert(err, gocheck.Equals, errNoCanary)
+}
+
+func (s *S) TestAbortCanary(c *gocheck.C) {
+	a := App{
+		Name: "canaryabort",
+		Units: []Unit{
+			{Name: "canaryabort-0", Version: "v1"},
+			{Name: "canaryabort-1", Version: "v2"},
+		},
+		Canary: &Canary{Version: "v2", Share: 50},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.SetUnitsWeight(&a, unitsOf(&a, a.Units[:1]), 3)
+	c.Assert(err, gocheck.IsNil)
+	var buf bytes.Buffer
+	err = a.AbortCanary(&buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "canaryabort-0")
+	c.Assert(s.provisioner.Weight(&a, "canaryabort-0"), gocheck.Equals, 1)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Canary, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+}
+
+func (s *S) TestAbortCanaryWithoutCanary(c *gocheck.C) {
+	a := App{Name: "canarynone"}
+	var buf bytes.Buffer
+	err := a.AbortCanary(&buf)
+	c.Assert(err, gocheck.Equals, errNoCanary)
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"path"
+	"strings"
+)
+
+// appDir is the directory of the app in the units. Relative paths in copies
+// are relative to this directory.
+const appDir = "/home/application/current"
+
+// shellQuote quotes the string to be used as a single argument in a shell
+// command line.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (app *App) copyUnit(unitName string) (provision.AppUnit, error) {
+	units, err := app.runUnits(RunTarget{Unit: unitName, Units: 1})
+	if err != nil {
+		return nil, err
+	}
+	return units[0], nil
+}
+
+// copyError converts failures of the copy command to validation errors,
+// using the standard error of the command as message.
+func copyError(err error, stderr *bytes.Buffer) error {
+	if _, ok := err.(*provision.ExitError); ok {
+		msg := fmt.Sprintf("Failed to copy the files: %s", strings.TrimSpace(stderr.String()))
+		return &errors.ValidationError{Message: msg}
+	}
+	return err
+}
+
+// CopyFromUnit writes to w a gzipped tar archive with the file or directory in
+// the given path of the unit. Entries in the archive are named after the base
+// name of the path. When unitName is empty, the first started unit of the app
+// is used.
+func (app *App) CopyFromUnit(unitName, src string, w io.Writer) error {
+	executor, ok := Provisioner.(provision.UnitCommandExecutor)
+	if !ok {
+		return &errors.ValidationError{Message: "The provisioner can't copy files from units."}
+	}
+	p := path.Clean(src)
+	if src == "" || p == "/" {
+		return &errors.ValidationError{Message: "Invalid path."}
+	}
+	unit, err := app.copyUnit(unitName)
+	if err != nil {
+		return err
+	}
+	app.Log(fmt.Sprintf("copying %s from the unit %s", src, unit.GetName()), "tsuru")
+	var stderr bytes.Buffer
+	err = executor.ExecuteCommandOnUnit(w, &stderr, app, unit, copyFromCommand(src))
+	return copyError(err, &stderr)
+}
+
+// copyFromCommand returns the command that writes the archive of the given
+// path to the standard output. The command checks that the path exists before
+// writing anything, so a missing path is reported as an error instead of an
+// empty archive.
+func copyFromCommand(src string) string {
+	p := path.Clean(src)
+	missing := shellQuote(src + ": No such file or directory")
+	return fmt.Sprintf(
+		"[ -d %s ] && cd %s; [ -e %s ] || { echo %s >&2; exit 1; }; tar -czf - -C %s -- %s",
+		appDir, appDir, shellQuote(p), missing, shellQuote(path.Dir(p)), shellQuote(path.Base(p)),
+	)
+}
+
+// CopyToUnit extracts the gzipped tar archive in the directory in the given
+// path of the unit, creating the directory if needed. When unitName is
+// empty, the first started unit of the app is used.
+func (app *App) CopyToUnit(unitName, dst string, archive io.Reader) error {
+	executor, ok := Provisioner.(provision.InputCommandExecutor)
+	if !ok {
+		return &errors.ValidationError{Message: "The provisioner can't copy files to units."}
+	}
+	if dst == "" {
+		return &errors.ValidationError{Message: "Invalid path."}
+	}
+	unit, err := app.copyUnit(unitName)
+	if err != nil {
+		return err
+	}
+	app.Log(fmt.Sprintf("copying files to %s in the unit %s", dst, unit.GetName()), "tsuru")
+	dir := shellQuote(path.Clean(dst))
+	cmd := fmt.Sprintf("[ -d %s ] && cd %s; mkdir -p %s && tar -xzf - -C %s", appDir, appDir, dir, dir)
+	var stdout, stderr bytes.Buffer
+	err = executor.ExecuteCommandOnUnitWithInput(archive, &stdout, &stderr, app, unit, cmd)
+	return copyError(err, &stderr)
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	tsuruErrors "github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+func (s *S) TestShellQuote(c *gocheck.C) {
+	c.Assert(shellQuote("heap.hprof"), gocheck.Equals, "'heap.hprof'")
+	c.Assert(shellQuote("it's"), gocheck.Equals, `'it'\''s'`)
+}
+
+func (s *S) TestCopyFromUnit(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("archive"))
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	err := app.CopyFromUnit("myapp/1", "/tmp/dumps/heap.hprof", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "archive")
+	expected := "[ -d /home/application/current ] && cd /home/application/current;"
+	expected += " [ -e '/tmp/dumps/heap.hprof' ] || { echo '/tmp/dumps/heap.hprof: No such file or directory' >&2; exit 1; };"
+	expected += " tar -czf - -C '/tmp/dumps' -- 'heap.hprof'"
+	cmds := s.provisioner.GetCmds(expected, &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "myapp/1")
+}
+
+func (s *S) TestCopyFromUnitRelativePath(c *gocheck.C) {
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "started"}},
+	}
+	var buf bytes.Buffer
+	err := app.CopyFromUnit("", "static/", &buf)
+	c.Assert(err, gocheck.IsNil)
+	expected := "[ -d /home/application/current ] && cd /home/application/current;"
+	expected += " [ -e 'static' ] || { echo 'static/: No such file or directory' >&2; exit 1; };"
+	expected += " tar -czf - -C '.' -- 'static'"
+	cmds := s.provisioner.GetCmds(expected, &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "myapp/0")
+}
+
+func (s *S) TestCopyFromUnitFailure(c *gocheck.C) {
+	s.provisioner.PrepareFailure("ExecuteCommandOnUnit", &provision.ExitError{Status: 2})
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "started"}},
+	}
+	var buf bytes.Buffer
+	err := app.CopyFromUnit("", "heap.hprof", &buf)
+	c.Assert(err, gocheck.NotNil)
+	_, ok := err.(*tsuruErrors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to copy the files: ")
+}
+
+func (s *S) TestCopyFromCommandWithMissingPath(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", copyFromCommand("heap.hprof"))
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(stdout.Len(), gocheck.Equals, 0)
+	c.Assert(stderr.String(), gocheck.Equals, "heap.hprof: No such file or directory\n")
+}
+
+func (s *S) TestCopyFromCommand(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(path.Join(dir, "heap.hprof"), []byte("heap"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	var stdout bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", copyFromCommand("heap.hprof"))
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+	c.Assert(err, gocheck.IsNil)
+	gz, err := gzip.NewReader(&stdout)
+	c.Assert(err, gocheck.IsNil)
+	header, err := tar.NewReader(gz).Next()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(header.Name, gocheck.Equals, "heap.hprof")
+}
+
+func (s *S) TestCopyFromUnitInvalidArguments(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "down"},
+		},
+	}
+	var tests = []struct {
+		unit    string
+		path    string
+		message string
+	}{
+		{"", "", "Invalid path."},
+		{"", "/", "Invalid path."},
+		{"myapp/1", "heap.hprof", `The unit "myapp/1" is not started.`},
+		{"myapp/7", "heap.hprof", `The app "myapp" has no unit named "myapp/7".`},
+	}
+	for _, t := range tests {
+		var buf bytes.Buffer
+		err := app.CopyFromUnit(t.unit, t.path, &buf)
+		e, ok := err.(*tsuruErrors.ValidationError)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
+func (s *S) TestCopyToUnit(c *gocheck.C) {
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "started"}},
+	}
+	err := app.CopyToUnit("myapp/0", "fixtures/", strings.NewReader("archive"))
+	c.Assert(err, gocheck.IsNil)
+	expected := "[ -d /home/application/current ] && cd /home/application/current;"
+	expected += " mkdir -p 'fixtures' && tar -xzf - -C 'fixtures'"
+	cmds := s.provisioner.GetCmds(expected, &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "myapp/0")
+	c.Assert(string(cmds[0].Input), gocheck.Equals, "archive")
+}
+
+func (s *S) TestCopyToUnitFailure(c *gocheck.C) {
+	s.provisioner.PrepareFailure("ExecuteCommandOnUnitWithInput", &provision.ExitError{Status: 2})
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "started"}},
+	}
+	err := app.CopyToUnit("", "fixtures", strings.NewReader("archive"))
+	_, ok := err.(*tsuruErrors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestCopyToUnitInvalidPath(c *gocheck.C) {
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "started"}},
+	}
+	err := app.CopyToUnit("", "", strings.NewReader("archive"))
+	e, ok := err.(*tsuruErrors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "Invalid path.")
+}
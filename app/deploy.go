@@ -0,0 +1,292 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// DeployData represents a deploy of an app. Every deploy is stored in the
+// deploys collection, along with its output.
+type DeployData struct {
+	Id       bson.ObjectId `bson:"_id"`
+	App      string
+	Commit   string
+	User     string
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Success  bool
+	Output   string `bson:",omitempty"`
+
+	// Pusher is the user that pushed the commit, as reported by the git
+	// hook of the repository. Unlike User, it isn't verified by tsuru.
+	Pusher string `bson:",omitempty"`
+}
+
+// MarshalJSON marshals the deploy in json format. The id of the deploy is
+// represented in hexadecimal, and the duration in seconds.
+func (d *DeployData) MarshalJSON() ([]byte, error) {
+	result := make(map[string]interface{})
+	result["Id"] = d.Id.Hex()
+	result["App"] = d.App
+	result["Commit"] = d.Commit
+	result["User"] = d.User
+	result["Pusher"] = d.Pusher
+	result["Start"] = d.Start
+	result["End"] = d.End
+	result["Duration"] = d.Duration.Seconds()
+	result["Success"] = d.Success
+	result["Output"] = d.Output
+	return json.Marshal(&result)
+}
+
+// ListDeploys returns the deploys of the given app, the most recent first.
+// The output of the deploys is not loaded, use GetDeploy for that.
+func ListDeploys(appName string) ([]DeployData, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deploys []DeployData
+	err = conn.Deploys().Find(bson.M{"app": appName}).Select(bson.M{"output": 0}).Sort("-start").All(&deploys)
+	return deploys, err
+}
+
+// GetDeploy returns the deploy identified by the given id, including its
+// output.
+func GetDeploy(id string) (*DeployData, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, fmt.Errorf("Deploy %q not found.", id)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var d DeployData
+	if err = conn.Deploys().FindId(bson.ObjectIdHex(id)).One(&d); err != nil {
+		return nil, fmt.Errorf("Deploy %q not found.", id)
+	}
+	return &d, nil
+}
+
+// Deploy deploys the given commit of the app, writing the progress of the
+// deploy to w. If commit is empty, the latest version of the app is deployed.
+// The user is the email of the user that triggered the deploy, if known.
+//
+// If the provisioner implements provision.Deployer, the deploy is delegated to
+// it. Otherwise, tsuru uses the git based deploy: it clones (or pulls) the app
+// repository in each unit, installs dependencies and restarts the app. Apps
+// using the blue-green strategy are deployed in a new set of units instead
+// (see SetDeployStrategy).
+//
+// The deploy is recorded in the database, with its output, and the id of the
+// deploy becomes the version of the units of the app.
+func (app *App) Deploy(commit, user string, w io.Writer) error {
+	return app.deploy(DeployData{Commit: commit, User: user}, w)
+}
+
+// DeployPush deploys the given commit of the app after a push to its
+// repository. The pusher, reported by the git hook, can't be verified, so
+// it's recorded as the Pusher of the deploy, not as its User.
+func (app *App) DeployPush(commit, pusher string, w io.Writer) error {
+	return app.deploy(DeployData{Commit: commit, Pusher: pusher}, w)
+}
+
+// deploy deploys the commit of the given deploy, recording it (see Deploy).
+func (app *App) deploy(d DeployData, w io.Writer) error {
+	if app.Canary != nil {
+		return errCanaryInProgress
+	}
+	commit := d.Commit
+	return app.recordDeploy(d, w, func(w io.Writer, version string) error {
+		var err error
+		if deployer, ok := Provisioner.(provision.Deployer); ok {
+			err = deployer.Deploy(app, commit, w)
+		} else if app.DeployStrategy == BlueGreenStrategy {
+			err = app.blueGreenDeploy(commit, w)
+		} else {
+			err = app.gitDeploy(commit, w)
+		}
+		if err != nil {
+			return err
+		}
+		app.recordVersion(version)
+		return nil
+	})
+}
+
+// DeployArchive deploys the code contained in the given gzipped tar archive,
+// writing the progress of the deploy to w. The archive is extracted in each
+// unit of the app through the provisioner, then tsuru installs dependencies
+// and restarts the app.
+//
+// The provisioner must implement provision.Uploader. The deploy is recorded
+// in the database without a commit, so it's not possible to roll back to it.
+func (app *App) DeployArchive(archive io.Reader, user string, w io.Writer) error {
+	if app.Canary != nil {
+		return errCanaryInProgress
+	}
+	uploader, ok := Provisioner.(provision.Uploader)
+	if !ok {
+		return errors.New("The provisioner does not support deploys from archives.")
+	}
+	path, err := repository.GetPath()
+	if err != nil {
+		return fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	return app.recordDeploy(DeployData{User: user}, w, func(w io.Writer, version string) error {
+		err := write(w, []byte("\n ---> Uploading the archive to units\n"))
+		if err != nil {
+			return err
+		}
+		err = uploader.Upload(app, archive, path, w)
+		if err != nil {
+			return err
+		}
+		err = write(w, []byte("\n ---> Installing dependencies\n"))
+		if err != nil {
+			return err
+		}
+		err = app.InstallDeps(w)
+		if err != nil {
+			return err
+		}
+		err = app.Restart(w)
+		if err != nil {
+			return err
+		}
+		app.recordVersion(version)
+		return nil
+	})
+}
+
+// recordDeploy runs the given deploy function, recording the deploy, filled
+// with the app, id and times, and its output in the database. The deploy function receives the id of the deploy
+// in hexadecimal, used as the version of the deployed units.
+func (app *App) recordDeploy(d DeployData, w io.Writer, deploy func(io.Writer, string) error) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	d.Id = bson.NewObjectId()
+	d.App = app.Name
+	d.Start = time.Now()
+	if err = conn.Deploys().Insert(d); err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	err = deploy(io.MultiWriter(w, &output), d.Id.Hex())
+	d.End = time.Now()
+	d.Duration = d.End.Sub(d.Start)
+	d.Success = err == nil
+	d.Output = output.String()
+	if uErr := conn.Deploys().UpdateId(d.Id, d); uErr != nil {
+		log.Printf("Failed to record the deploy of %s: %s", app.Name, uErr)
+	}
+	return err
+}
+
+// Rollback deploys again the commit of a previous deploy of the app.
+func (app *App) Rollback(deployId, user string, w io.Writer) error {
+	d, err := GetDeploy(deployId)
+	if err != nil {
+		return err
+	}
+	if d.App != app.Name {
+		return fmt.Errorf("Deploy %q not found.", deployId)
+	}
+	if d.Commit == "" {
+		return fmt.Errorf("Deploy %q has no commit, can't roll back to it.", deployId)
+	}
+	return app.Deploy(d.Commit, user, w)
+}
+
+// recordVersion sets the version of all units of the app after a successful
+// deploy. Failures are only logged, as the deploy is already done.
+func (app *App) recordVersion(version string) {
+	if err := app.setUnitsVersion(app.Units, version); err != nil {
+		log.Printf("Failed to record the version of the units of %s: %s", app.Name, err)
+	}
+}
+
+// setUnitsVersion sets the version of the given units of the app, saving them
+// in the database.
+func (app *App) setUnitsVersion(units []Unit, version string) error {
+	names := make(map[string]bool, len(units))
+	for _, u := range units {
+		names[u.Name] = true
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for i := range app.Units {
+		if !names[app.Units[i].Name] {
+			continue
+		}
+		app.Units[i].Version = version
+		err = conn.Apps().Update(
+			bson.M{"name": app.Name, "units.name": app.Units[i].Name},
+			bson.M{"$set": bson.M{"units.$.version": version}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *App) gitDeploy(commit string, w io.Writer) error {
+	err := write(w, []byte("\n ---> Replicating the application repository across units\n"))
+	if err != nil {
+		return err
+	}
+	out, err := repository.CloneOrPull(app)
+	if err != nil {
+		return &provision.Error{Reason: string(out), Err: err}
+	}
+	err = write(w, out)
+	if err != nil {
+		return err
+	}
+	if commit != "" {
+		err = write(w, []byte(fmt.Sprintf("\n ---> Checking out %s\n", commit)))
+		if err != nil {
+			return err
+		}
+		out, err = repository.Checkout(app, commit)
+		if err != nil {
+			return &provision.Error{Reason: string(out), Err: err}
+		}
+		err = write(w, out)
+		if err != nil {
+			return err
+		}
+	}
+	err = write(w, []byte("\n ---> Installing dependencies\n"))
+	if err != nil {
+		return err
+	}
+	err = app.InstallDeps(w)
+	if err != nil {
+		return err
+	}
+	return app.Restart(w)
+}
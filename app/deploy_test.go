@@ -0,0 +1,335 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	stderr "errors"
+	"github.com/globocom/tsuru/provision"
+	ttesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"strings"
+	"time"
+)
+
+func (s *S) TestDeployUsesGitWhenProvisionerIsNotADeployer(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("cloned"))    // clone
+	s.provisioner.PrepareOutput([]byte("installed")) // install
+	s.provisioner.PrepareOutput(nil)                 // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err = a.Deploy("", "", &buf)
+	c.Assert(err, gocheck.IsNil)
+	regexp := `^# ---> Replicating the application repository across units#cloned#` +
+		` ---> Installing dependencies#installed.*# ---> Restarting your app#.*$`
+	c.Assert(strings.Replace(buf.String(), "\n", "#", -1), gocheck.Matches, regexp)
+	cmds := s.provisioner.GetCmds("/var/lib/tsuru/hooks/dependencies", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 1)
+}
+
+func (s *S) TestDeployUsesGitChecksOutTheCommit(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("cloned"))      // clone
+	s.provisioner.PrepareOutput([]byte("checked out")) // checkout
+	s.provisioner.PrepareOutput([]byte("installed"))   // install
+	s.provisioner.PrepareOutput(nil)                   // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a9b1e3f", "", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Matches, `(?s).*cloned\n ---> Checking out a9b1e3f\nchecked out.*`)
+	checkout := "cd /home/application/current && (git fetch -q --unshallow origin || git fetch -q origin) && git checkout -q a9b1e3f"
+	c.Assert(s.provisioner.GetCmds(checkout, &a), gocheck.HasLen, 1)
+}
+
+func (s *S) TestDeployUsesGitFailureToCloneAndPull(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("failed to clone"))
+	s.provisioner.PrepareFailure("ExecuteCommand", stderr.New("exit status 1"))
+	s.provisioner.PrepareOutput([]byte("failed to pull"))
+	s.provisioner.PrepareFailure("ExecuteCommand", stderr.New("exit status 1"))
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("", "", &buf)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Reason, gocheck.Equals, "failed to pull")
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 0)
+}
+
+func (s *S) TestDeployDelegatesToTheDeployer(c *gocheck.C) {
+	deployer := ttesting.NewFakeDeployer()
+	Provisioner = deployer
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a9b1e3f", "", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "Deploying someApp\n")
+	c.Assert(deployer.Deploys(&a), gocheck.Equals, 1)
+	c.Assert(deployer.Versions(&a), gocheck.DeepEquals, []string{"a9b1e3f"})
+	c.Assert(deployer.GetCmds("", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestDeployRecordsTheDeploy(c *gocheck.C) {
+	deployer := ttesting.NewFakeDeployer()
+	Provisioner = deployer
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "someApp", Framework: "django"}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a9b1e3f", "gopher@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	var deploys []DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).All(&deploys)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 1)
+	d := deploys[0]
+	c.Assert(d.Commit, gocheck.Equals, "a9b1e3f")
+	c.Assert(d.User, gocheck.Equals, "gopher@tsuru.io")
+	c.Assert(d.Success, gocheck.Equals, true)
+	c.Assert(d.Output, gocheck.Equals, "Deploying someApp\n")
+	c.Assert(d.End.Before(d.Start), gocheck.Equals, false)
+	c.Assert(d.Duration, gocheck.Equals, d.End.Sub(d.Start))
+}
+
+func (s *S) TestDeployPushRecordsThePusher(c *gocheck.C) {
+	deployer := ttesting.NewFakeDeployer()
+	Provisioner = deployer
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "someApp", Framework: "django"}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.DeployPush("a9b1e3f", "gopher@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	var deploys []DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).All(&deploys)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 1)
+	c.Assert(deploys[0].Commit, gocheck.Equals, "a9b1e3f")
+	c.Assert(deploys[0].User, gocheck.Equals, "")
+	c.Assert(deploys[0].Pusher, gocheck.Equals, "gopher@tsuru.io")
+	c.Assert(deploys[0].Success, gocheck.Equals, true)
+}
+
+func (s *S) TestDeployRecordsFailedDeploys(c *gocheck.C) {
+	deployer := ttesting.NewFakeDeployer()
+	deployer.PrepareFailure("Deploy", stderr.New("something went wrong"))
+	Provisioner = deployer
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "someApp", Framework: "django"}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a9b1e3f", "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "something went wrong")
+	var d DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Success, gocheck.Equals, false)
+}
+
+func (s *S) TestDeployArchive(c *gocheck.C) {
+	uploader := ttesting.NewFakeUploader()
+	uploader.PrepareOutput([]byte("installed")) // install
+	uploader.PrepareOutput(nil)                 // loadHooks
+	Provisioner = uploader
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err = a.DeployArchive(strings.NewReader("archive content"), "gopher@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	regexp := `^# ---> Uploading the archive to units#Uploading someApp#` +
+		`# ---> Installing dependencies#installed.*# ---> Restarting your app#.*$`
+	c.Assert(strings.Replace(buf.String(), "\n", "#", -1), gocheck.Matches, regexp)
+	c.Assert(uploader.Archives(&a), gocheck.DeepEquals, [][]byte{[]byte("archive content")})
+	c.Assert(uploader.Paths(&a), gocheck.DeepEquals, []string{"/home/application/current"})
+	c.Assert(uploader.GetCmds("/var/lib/tsuru/hooks/dependencies", &a), gocheck.HasLen, 1)
+	c.Assert(uploader.Restarts(&a), gocheck.Equals, 1)
+	var d DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Commit, gocheck.Equals, "")
+	c.Assert(d.User, gocheck.Equals, "gopher@tsuru.io")
+	c.Assert(d.Success, gocheck.Equals, true)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].Version, gocheck.Equals, d.Id.Hex())
+}
+
+func (s *S) TestDeployArchiveUploadFailure(c *gocheck.C) {
+	uploader := ttesting.NewFakeUploader()
+	uploader.PrepareFailure("Upload", stderr.New("failed to upload"))
+	Provisioner = uploader
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "someApp", Framework: "django"}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.DeployArchive(strings.NewReader("archive content"), "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "failed to upload")
+	c.Assert(uploader.Restarts(&a), gocheck.Equals, 0)
+	var d DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Success, gocheck.Equals, false)
+}
+
+func (s *S) TestDeployArchiveProvisionerIsNotAnUploader(c *gocheck.C) {
+	a := App{Name: "someApp", Framework: "django"}
+	var buf bytes.Buffer
+	err := a.DeployArchive(strings.NewReader("archive content"), "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "^The provisioner does not support deploys from archives.$")
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestListDeploys(c *gocheck.C) {
+	now := time.Now()
+	deploys := []DeployData{
+		{Id: bson.NewObjectId(), App: "someApp", Commit: "a9b1e3f", Start: now.Add(-time.Hour), Output: "first"},
+		{Id: bson.NewObjectId(), App: "someApp", Commit: "b0c2f4e", Start: now, Output: "second"},
+		{Id: bson.NewObjectId(), App: "otherApp", Commit: "c1d3a5f", Start: now},
+	}
+	for _, d := range deploys {
+		err := s.conn.Deploys().Insert(d)
+		c.Assert(err, gocheck.IsNil)
+	}
+	defer s.conn.Deploys().RemoveAll(nil)
+	result, err := ListDeploys("someApp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, 2)
+	c.Assert(result[0].Commit, gocheck.Equals, "b0c2f4e")
+	c.Assert(result[1].Commit, gocheck.Equals, "a9b1e3f")
+	c.Assert(result[0].Output, gocheck.Equals, "")
+}
+
+func (s *S) TestGetDeploy(c *gocheck.C) {
+	d := DeployData{Id: bson.NewObjectId(), App: "someApp", Commit: "a9b1e3f", Output: "deployed"}
+	err := s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.Id)
+	result, err := GetDeploy(d.Id.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Commit, gocheck.Equals, "a9b1e3f")
+	c.Assert(result.Output, gocheck.Equals, "deployed")
+}
+
+func (s *S) TestGetDeployNotFound(c *gocheck.C) {
+	_, err := GetDeploy(bson.NewObjectId().Hex())
+	c.Assert(err, gocheck.ErrorMatches, `Deploy ".*" not found.`)
+	_, err = GetDeploy("invalid")
+	c.Assert(err, gocheck.ErrorMatches, `Deploy "invalid" not found.`)
+}
+
+func (s *S) TestDeployDataMarshalJSON(c *gocheck.C) {
+	d := DeployData{
+		Id:       bson.NewObjectId(),
+		App:      "someApp",
+		Commit:   "a9b1e3f",
+		User:     "gopher@tsuru.io",
+		Duration: 90 * time.Second,
+		Success:  true,
+		Pusher:   "gopher@tsuru.io",
+	}
+	data, err := json.Marshal(&d)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result["Id"], gocheck.Equals, d.Id.Hex())
+	c.Assert(result["Commit"], gocheck.Equals, "a9b1e3f")
+	c.Assert(result["User"], gocheck.Equals, "gopher@tsuru.io")
+	c.Assert(result["Pusher"], gocheck.Equals, "gopher@tsuru.io")
+	c.Assert(result["Duration"], gocheck.Equals, float64(90))
+	c.Assert(result["Success"], gocheck.Equals, true)
+}
+
+func (s *S) TestRollback(c *gocheck.C) {
+	deployer := ttesting.NewFakeDeployer()
+	Provisioner = deployer
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "someApp", Framework: "django"}
+	old := DeployData{Id: bson.NewObjectId(), App: a.Name, Commit: "a9b1e3f", Start: time.Now()}
+	err := s.conn.Deploys().Insert(old)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err = a.Rollback(old.Id.Hex(), "gopher@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deployer.Versions(&a), gocheck.DeepEquals, []string{"a9b1e3f"})
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name, "commit": "a9b1e3f", "user": "gopher@tsuru.io"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestRollbackDeployFromAnotherApp(c *gocheck.C) {
+	a := App{Name: "someApp", Framework: "django"}
+	other := DeployData{Id: bson.NewObjectId(), App: "otherApp", Commit: "a9b1e3f"}
+	err := s.conn.Deploys().Insert(other)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(other.Id)
+	var buf bytes.Buffer
+	err = a.Rollback(other.Id.Hex(), "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, `Deploy ".*" not found.`)
+}
+
+func (s *S) TestRollbackDeployWithoutCommit(c *gocheck.C) {
+	a := App{Name: "someApp", Framework: "django"}
+	d := DeployData{Id: bson.NewObjectId(), App: a.Name}
+	err := s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.Id)
+	var buf bytes.Buffer
+	err = a.Rollback(d.Id.Hex(), "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, `Deploy ".*" has no commit, can't roll back to it.`)
+}
@@ -0,0 +1,330 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDrainNotFound      = errors.New("Drain not found.")
+	ErrDrainAlreadyExists = errors.New("This drain already exists.")
+	ErrInvalidDrainURL    = errors.New("Invalid drain URL. Use syslog://host:port, syslog+udp://host:port or https://host/path.")
+)
+
+var (
+	// drainBufferSize is the number of logs buffered for each drain. Logs
+	// that don't fit in the buffer are dropped.
+	drainBufferSize = 1000
+
+	// drainBatchSize is the maximum number of logs sent to a drain at once.
+	drainBatchSize = 100
+
+	// drainFlushInterval is the maximum amount of time that a log waits in
+	// the buffer before being sent to the drain.
+	drainFlushInterval = time.Second
+
+	// drainRetries is the number of times that tsuru tries to send a batch
+	// of logs to a drain before giving up on it.
+	drainRetries = 3
+
+	// drainRetryInterval is the base interval between two attempts.
+	drainRetryInterval = time.Second
+
+	// drainRefreshInterval defines how often the list of drains of an app
+	// is reloaded from the database.
+	drainRefreshInterval = 30 * time.Second
+)
+
+// Drain is an endpoint that receives the logs of an app. Drains are stored in
+// the drains collection.
+//
+// The URL of the drain defines the protocol used to send the logs:
+//
+//   - syslog://host:port: syslog messages (RFC 5424) over TCP
+//   - syslog+udp://host:port: syslog messages (RFC 5424) over UDP
+//   - https://host/path: batches of logs, in JSON, sent in POST requests
+type Drain struct {
+	Id  bson.ObjectId `bson:"_id"`
+	App string
+	URL string
+}
+
+// MarshalJSON marshals the drain in json format. The id of the drain is
+// represented in hexadecimal.
+func (d *Drain) MarshalJSON() ([]byte, error) {
+	result := make(map[string]interface{})
+	result["Id"] = d.Id.Hex()
+	result["App"] = d.App
+	result["URL"] = d.URL
+	return json.Marshal(&result)
+}
+
+func validateDrainURL(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return ErrInvalidDrainURL
+	}
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return ErrInvalidDrainURL
+		}
+	case "https":
+	default:
+		return ErrInvalidDrainURL
+	}
+	return nil
+}
+
+// AddDrain adds a drain to the given app. Logs of the app are sent to the
+// drain from now on.
+func AddDrain(appName, rawurl string) (*Drain, error) {
+	rawurl = strings.TrimSpace(rawurl)
+	if err := validateDrainURL(rawurl); err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	n, err := conn.Drains().Find(bson.M{"app": appName, "url": rawurl}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrDrainAlreadyExists
+	}
+	d := Drain{Id: bson.NewObjectId(), App: appName, URL: rawurl}
+	if err = conn.Drains().Insert(d); err != nil {
+		return nil, err
+	}
+	drains.invalidate(appName)
+	return &d, nil
+}
+
+// ListDrains returns the drains of the given app.
+func ListDrains(appName string) ([]Drain, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var result []Drain
+	err = conn.Drains().Find(bson.M{"app": appName}).All(&result)
+	return result, err
+}
+
+// RemoveDrain removes a drain from the given app.
+func RemoveDrain(appName, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrDrainNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Drains().Remove(bson.M{"_id": bson.ObjectIdHex(id), "app": appName})
+	if err == mgo.ErrNotFound {
+		return ErrDrainNotFound
+	}
+	if err != nil {
+		return err
+	}
+	drains.invalidate(appName)
+	return nil
+}
+
+// drainRegistry keeps the forwarders of the drains of each app, reloading
+// them from the database periodically, so changes made by other tsuru
+// processes are eventually seen.
+type drainRegistry struct {
+	apps map[string]*appDrains
+	sync.Mutex
+}
+
+type appDrains struct {
+	loaded     time.Time
+	forwarders map[bson.ObjectId]*drainForwarder
+}
+
+var drains = drainRegistry{apps: make(map[string]*appDrains)}
+
+// send sends the logs to all drains of the app. It never blocks.
+func (r *drainRegistry) send(appName string, logs []Applog) {
+	for _, f := range r.forwarders(appName) {
+		f.send(logs)
+	}
+}
+
+func (r *drainRegistry) forwarders(appName string) []*drainForwarder {
+	r.Lock()
+	defer r.Unlock()
+	entry := r.apps[appName]
+	if entry == nil || time.Since(entry.loaded) > drainRefreshInterval {
+		entry = r.reload(appName, entry)
+	}
+	result := make([]*drainForwarder, 0, len(entry.forwarders))
+	for _, f := range entry.forwarders {
+		result = append(result, f)
+	}
+	return result
+}
+
+// reload loads the drains of the app from the database, keeping the
+// forwarders of drains that still exist and stopping the others.
+func (r *drainRegistry) reload(appName string, old *appDrains) *appDrains {
+	list, err := ListDrains(appName)
+	if err != nil {
+		log.Printf("Failed to load the drains of the app %s: %s", appName, err)
+		if old != nil {
+			return old
+		}
+	}
+	entry := &appDrains{loaded: time.Now(), forwarders: make(map[bson.ObjectId]*drainForwarder)}
+	for _, d := range list {
+		if old != nil {
+			if f, ok := old.forwarders[d.Id]; ok {
+				entry.forwarders[d.Id] = f
+				delete(old.forwarders, d.Id)
+				continue
+			}
+		}
+		f, err := newDrainForwarder(d)
+		if err != nil {
+			log.Printf("Failed to start the drain %s of the app %s: %s", d.URL, appName, err)
+			continue
+		}
+		entry.forwarders[d.Id] = f
+	}
+	if old != nil {
+		for _, f := range old.forwarders {
+			f.stop()
+		}
+	}
+	r.apps[appName] = entry
+	return entry
+}
+
+// invalidate forces the drains of the app to be reloaded in the next send.
+func (r *drainRegistry) invalidate(appName string) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.apps[appName]; ok {
+		entry.loaded = time.Time{}
+	}
+}
+
+// drainForwarder buffers the logs of a drain, sending them in batches.
+type drainForwarder struct {
+	drain   Drain
+	writer  drainWriter
+	c       chan Applog
+	quit    chan struct{}
+	dropped uint64
+}
+
+func newDrainForwarder(d Drain) (*drainForwarder, error) {
+	w, err := newDrainWriter(d)
+	if err != nil {
+		return nil, err
+	}
+	f := drainForwarder{
+		drain:  d,
+		writer: w,
+		c:      make(chan Applog, drainBufferSize),
+		quit:   make(chan struct{}),
+	}
+	go f.run()
+	return &f, nil
+}
+
+func (f *drainForwarder) send(logs []Applog) {
+	for _, l := range logs {
+		select {
+		case f.c <- l:
+		default:
+			atomic.AddUint64(&f.dropped, 1)
+		}
+	}
+}
+
+func (f *drainForwarder) stop() {
+	close(f.quit)
+}
+
+func (f *drainForwarder) run() {
+	ticker := time.NewTicker(drainFlushInterval)
+	defer ticker.Stop()
+	defer f.writer.Close()
+	batch := make([]Applog, 0, drainBatchSize)
+	for {
+		select {
+		case l := <-f.c:
+			batch = append(batch, l)
+			if len(batch) < drainBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-f.quit:
+			f.flushPending(batch)
+			return
+		}
+		f.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flushPending sends the batch and all logs still buffered in the
+// forwarder.
+func (f *drainForwarder) flushPending(batch []Applog) {
+	for {
+		select {
+		case l := <-f.c:
+			batch = append(batch, l)
+			if len(batch) == drainBatchSize {
+				f.flush(batch)
+				batch = batch[:0]
+			}
+		default:
+			f.flush(batch)
+			return
+		}
+	}
+}
+
+// flush sends the batch to the drain, retrying in case of failures. The batch
+// is discarded after drainRetries failed attempts.
+func (f *drainForwarder) flush(batch []Applog) {
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	for i := 0; i < drainRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * drainRetryInterval)
+		}
+		if err = f.writer.Write(batch); err == nil {
+			return
+		}
+	}
+	log.Printf("Failed to send %d logs of the app %s to the drain %s: %s", len(batch), f.drain.App, f.drain.URL, err)
+}
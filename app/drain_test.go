@@ -0,0 +1,391 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func (s *S) TestValidateDrainURL(c *gocheck.C) {
+	valid := []string{
+		"syslog://logs.example.com:514",
+		"syslog+udp://10.0.0.1:514",
+		"https://logs.example.com/drain?token=123",
+	}
+	for _, u := range valid {
+		c.Check(validateDrainURL(u), gocheck.IsNil)
+	}
+	invalid := []string{
+		"",
+		"logs.example.com:514",
+		"syslog://logs.example.com",
+		"http://logs.example.com/drain",
+		"ftp://logs.example.com",
+		"https:///drain",
+	}
+	for _, u := range invalid {
+		c.Check(validateDrainURL(u), gocheck.Equals, ErrInvalidDrainURL)
+	}
+}
+
+func (s *S) TestAddDrain(c *gocheck.C) {
+	d, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d.Id)
+	c.Assert(d.App, gocheck.Equals, "myapp")
+	c.Assert(d.URL, gocheck.Equals, "syslog://logs.example.com:514")
+	var stored Drain
+	err = s.conn.Drains().FindId(d.Id).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored, gocheck.DeepEquals, *d)
+}
+
+func (s *S) TestAddDrainInvalidURL(c *gocheck.C) {
+	d, err := AddDrain("myapp", "ftp://logs.example.com")
+	c.Assert(d, gocheck.IsNil)
+	c.Assert(err, gocheck.Equals, ErrInvalidDrainURL)
+}
+
+func (s *S) TestAddDrainDuplicated(c *gocheck.C) {
+	d, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d.Id)
+	_, err = AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.Equals, ErrDrainAlreadyExists)
+}
+
+func (s *S) TestListDrains(c *gocheck.C) {
+	d1, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d1.Id)
+	d2, err := AddDrain("otherapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d2.Id)
+	list, err := ListDrains("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(list, gocheck.DeepEquals, []Drain{*d1})
+}
+
+func (s *S) TestRemoveDrain(c *gocheck.C) {
+	d, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	err = RemoveDrain("myapp", d.Id.Hex())
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Drains().FindId(d.Id).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestRemoveDrainNotFound(c *gocheck.C) {
+	d, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Drains().RemoveId(d.Id)
+	err = RemoveDrain("otherapp", d.Id.Hex())
+	c.Assert(err, gocheck.Equals, ErrDrainNotFound)
+	err = RemoveDrain("myapp", "invalid")
+	c.Assert(err, gocheck.Equals, ErrDrainNotFound)
+	err = RemoveDrain("myapp", bson.NewObjectId().Hex())
+	c.Assert(err, gocheck.Equals, ErrDrainNotFound)
+}
+
+func (s *S) TestDrainMarshalJSON(c *gocheck.C) {
+	d := Drain{Id: bson.NewObjectId(), App: "myapp", URL: "syslog://logs.example.com:514"}
+	data, err := json.Marshal(&d)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"Id": d.Id.Hex(), "App": "myapp", "URL": "syslog://logs.example.com:514"}
+	c.Assert(result, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestFormatSyslog(c *gocheck.C) {
+	date := time.Date(2013, 7, 10, 13, 45, 31, 3000, time.UTC)
+	l := Applog{Date: date, Message: "something happened", Source: "app"}
+	msg := formatSyslog("myapp", l)
+	c.Assert(string(msg), gocheck.Equals, "<14>1 2013-07-10T13:45:31.000003Z tsuru myapp app - - something happened")
+	l.Source = ""
+	msg = formatSyslog("myapp", l)
+	c.Assert(string(msg), gocheck.Equals, "<14>1 2013-07-10T13:45:31.000003Z tsuru myapp - - - something happened")
+}
+
+func (s *S) TestFormatSyslogWithUnitAndLevel(c *gocheck.C) {
+	date := time.Date(2013, 7, 10, 13, 45, 31, 3000, time.UTC)
+	l := Applog{Date: date, Message: "something failed", Source: "app", Unit: "myapp/0", Level: "error"}
+	msg := formatSyslog("myapp", l)
+	c.Assert(string(msg), gocheck.Equals, "<11>1 2013-07-10T13:45:31.000003Z tsuru myapp app myapp/0 - something failed")
+	l.Level = "debug"
+	msg = formatSyslog("myapp", l)
+	c.Assert(string(msg), gocheck.Equals, "<15>1 2013-07-10T13:45:31.000003Z tsuru myapp app myapp/0 - something failed")
+	l.Level = "critical"
+	msg = formatSyslog("myapp", l)
+	c.Assert(string(msg), gocheck.Equals, "<10>1 2013-07-10T13:45:31.000003Z tsuru myapp app myapp/0 - something failed")
+}
+
+// readSyslogFrames reads n octet-counted syslog messages from the connection.
+func readSyslogFrames(conn net.Conn, n int) ([]string, error) {
+	var frames []string
+	reader := bufio.NewReader(conn)
+	for i := 0; i < n; i++ {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return frames, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			return frames, err
+		}
+		frame := make([]byte, size)
+		if _, err = io.ReadFull(reader, frame); err != nil {
+			return frames, err
+		}
+		frames = append(frames, string(frame))
+	}
+	return frames, nil
+}
+
+func (s *S) TestSyslogWriterTCP(c *gocheck.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	defer listener.Close()
+	frames := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		f, _ := readSyslogFrames(conn, 2)
+		frames <- f
+	}()
+	w := syslogWriter{network: "tcp", addr: listener.Addr().String(), app: "myapp"}
+	defer w.Close()
+	date := time.Date(2013, 7, 10, 13, 45, 31, 0, time.UTC)
+	err = w.Write([]Applog{
+		{Date: date, Message: "first", Source: "app"},
+		{Date: date, Message: "second", Source: "tsuru"},
+	})
+	c.Assert(err, gocheck.IsNil)
+	select {
+	case f := <-frames:
+		c.Assert(f, gocheck.DeepEquals, []string{
+			"<14>1 2013-07-10T13:45:31.000000Z tsuru myapp app - - first",
+			"<14>1 2013-07-10T13:45:31.000000Z tsuru myapp tsuru - - second",
+		})
+	case <-time.After(2e9):
+		c.Fatal("Timed out waiting for the syslog messages.")
+	}
+}
+
+func (s *S) TestSyslogWriterUDP(c *gocheck.C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	w := syslogWriter{network: "udp", addr: conn.LocalAddr().String(), app: "myapp"}
+	defer w.Close()
+	date := time.Date(2013, 7, 10, 13, 45, 31, 0, time.UTC)
+	err = w.Write([]Applog{{Date: date, Message: "hello", Source: "app"}})
+	c.Assert(err, gocheck.IsNil)
+	conn.SetReadDeadline(time.Now().Add(2e9))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(buf[:n]), gocheck.Equals, "<14>1 2013-07-10T13:45:31.000000Z tsuru myapp app - - hello")
+}
+
+func (s *S) TestSyslogWriterConnectionFailure(c *gocheck.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	addr := listener.Addr().String()
+	listener.Close()
+	w := syslogWriter{network: "tcp", addr: addr, app: "myapp"}
+	err = w.Write([]Applog{{Date: time.Now(), Message: "hello"}})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(w.conn, gocheck.IsNil)
+}
+
+func (s *S) TestNewDrainWriter(c *gocheck.C) {
+	w, err := newDrainWriter(Drain{App: "myapp", URL: "syslog://logs.example.com:514"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(w, gocheck.DeepEquals, &syslogWriter{network: "tcp", addr: "logs.example.com:514", app: "myapp"})
+	w, err = newDrainWriter(Drain{App: "myapp", URL: "syslog+udp://logs.example.com:514"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(w, gocheck.DeepEquals, &syslogWriter{network: "udp", addr: "logs.example.com:514", app: "myapp"})
+	w, err = newDrainWriter(Drain{App: "myapp", URL: "https://logs.example.com/drain"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(w.(*httpsWriter).url, gocheck.Equals, "https://logs.example.com/drain")
+	_, err = newDrainWriter(Drain{App: "myapp", URL: "ftp://logs.example.com"})
+	c.Assert(err, gocheck.Equals, ErrInvalidDrainURL)
+}
+
+func (s *S) TestHttpsWriterTimeout(c *gocheck.C) {
+	oldTimeout := drainTimeout
+	drainTimeout = 50 * time.Millisecond
+	defer func() { drainTimeout = oldTimeout }()
+	block := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+	w := httpsWriter{url: server.URL, client: drainClient()}
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Write([]Applog{{Date: time.Now(), Message: "hello"}})
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, gocheck.NotNil)
+	case <-time.After(2e9):
+		c.Fatal("The drain writer did not time out.")
+	}
+}
+
+type fakeDrainWriter struct {
+	mut     sync.Mutex
+	batches [][]Applog
+	fail    int
+	closed  bool
+}
+
+func (w *fakeDrainWriter) Write(logs []Applog) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.fail > 0 {
+		w.fail--
+		return net.UnknownNetworkError("fake")
+	}
+	w.batches = append(w.batches, append([]Applog(nil), logs...))
+	return nil
+}
+
+func (w *fakeDrainWriter) Close() error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeDrainWriter) Batches() [][]Applog {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.batches
+}
+
+func (s *S) TestDrainForwarderBatches(c *gocheck.C) {
+	oldSize := drainBatchSize
+	drainBatchSize = 2
+	defer func() { drainBatchSize = oldSize }()
+	w := &fakeDrainWriter{}
+	f := drainForwarder{writer: w, c: make(chan Applog, 10), quit: make(chan struct{})}
+	go f.run()
+	f.send([]Applog{{Message: "1"}, {Message: "2"}, {Message: "3"}})
+	f.stop()
+	timeout := time.After(2e9)
+	for {
+		w.mut.Lock()
+		closed := w.closed
+		w.mut.Unlock()
+		if closed {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("Timed out waiting for the forwarder.")
+		case <-time.After(1e6):
+		}
+	}
+	batches := w.Batches()
+	c.Assert(batches, gocheck.HasLen, 2)
+	c.Assert(batches[0], gocheck.DeepEquals, []Applog{{Message: "1"}, {Message: "2"}})
+	c.Assert(batches[1], gocheck.DeepEquals, []Applog{{Message: "3"}})
+}
+
+func (s *S) TestDrainForwarderRetries(c *gocheck.C) {
+	oldInterval := drainRetryInterval
+	drainRetryInterval = 1e6
+	defer func() { drainRetryInterval = oldInterval }()
+	w := &fakeDrainWriter{fail: drainRetries - 1}
+	f := drainForwarder{writer: w}
+	f.flush([]Applog{{Message: "1"}})
+	c.Assert(w.Batches(), gocheck.DeepEquals, [][]Applog{{{Message: "1"}}})
+}
+
+func (s *S) TestDrainForwarderGivesUpAfterRetries(c *gocheck.C) {
+	oldInterval := drainRetryInterval
+	drainRetryInterval = 1e6
+	defer func() { drainRetryInterval = oldInterval }()
+	w := &fakeDrainWriter{fail: drainRetries}
+	f := drainForwarder{writer: w}
+	f.flush([]Applog{{Message: "1"}})
+	c.Assert(w.Batches(), gocheck.HasLen, 0)
+	c.Assert(w.fail, gocheck.Equals, 0)
+}
+
+func (s *S) TestDrainForwarderDropsWhenTheBufferIsFull(c *gocheck.C) {
+	f := drainForwarder{c: make(chan Applog, 1)}
+	f.send([]Applog{{Message: "1"}, {Message: "2"}, {Message: "3"}})
+	c.Assert(f.dropped, gocheck.Equals, uint64(2))
+}
+
+func (s *S) TestLogSendsToDrains(c *gocheck.C) {
+	oldInterval := drainFlushInterval
+	drainFlushInterval = 1e7
+	defer func() { drainFlushInterval = oldInterval }()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	defer listener.Close()
+	frames := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		f, _ := readSyslogFrames(conn, 1)
+		frames <- f
+	}()
+	a := App{Name: "drained"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	d, err := AddDrain(a.Name, "syslog://"+listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	defer RemoveDrain(a.Name, d.Id.Hex())
+	err = a.Log("hello drain", "app")
+	c.Assert(err, gocheck.IsNil)
+	select {
+	case f := <-frames:
+		c.Assert(f, gocheck.HasLen, 1)
+		c.Assert(strings.HasSuffix(f[0], " tsuru drained app - - hello drain"), gocheck.Equals, true)
+	case <-time.After(2e9):
+		c.Fatal("Timed out waiting for the drain.")
+	}
+}
+
+func (s *S) TestDrainRegistryReloadStopsRemovedDrains(c *gocheck.C) {
+	d, err := AddDrain("myapp", "syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	fs := drains.forwarders("myapp")
+	c.Assert(fs, gocheck.HasLen, 1)
+	c.Assert(fs[0].drain, gocheck.DeepEquals, *d)
+	err = RemoveDrain("myapp", d.Id.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains.forwarders("myapp"), gocheck.HasLen, 0)
+	select {
+	case <-fs[0].quit:
+	default:
+		c.Fatal("The forwarder of the removed drain was not stopped.")
+	}
+}
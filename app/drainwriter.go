@@ -0,0 +1,167 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// drainTimeout is the timeout for connecting and writing to syslog drains.
+var drainTimeout = 10 * time.Second
+
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// drainWriter sends batches of logs to a drain.
+type drainWriter interface {
+	Write(logs []Applog) error
+	Close() error
+}
+
+func newDrainWriter(d Drain) (drainWriter, error) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "syslog":
+		return &syslogWriter{network: "tcp", addr: u.Host, app: d.App}, nil
+	case "syslog+udp":
+		return &syslogWriter{network: "udp", addr: u.Host, app: d.App}, nil
+	case "https":
+		return &httpsWriter{url: d.URL, client: drainClient()}, nil
+	}
+	return nil, ErrInvalidDrainURL
+}
+
+// syslogSeverities maps log levels to syslog severities. Logs without level
+// are informational.
+var syslogSeverities = map[string]int{
+	"debug":    7,
+	"info":     6,
+	"warning":  4,
+	"error":    3,
+	"critical": 2,
+}
+
+// formatSyslog formats the log as a RFC 5424 message, using the user-level
+// facility and the severity matching the level of the log. The source of the
+// log is used as the process id, and the unit as the message id.
+func formatSyslog(appName string, l Applog) []byte {
+	source := l.Source
+	if source == "" {
+		source = "-"
+	}
+	unit := l.Unit
+	if unit == "" {
+		unit = "-"
+	}
+	severity, ok := syslogSeverities[l.Level]
+	if !ok {
+		severity = 6
+	}
+	date := l.Date.UTC().Format(syslogTimeFormat)
+	return []byte(fmt.Sprintf("<%d>1 %s tsuru %s %s %s - %s", 8+severity, date, appName, source, unit, l.Message))
+}
+
+// syslogWriter sends logs to a syslog server. Over TCP, messages are framed
+// using octet counting (RFC 6587). Over UDP, each message is sent in its own
+// datagram.
+type syslogWriter struct {
+	network string
+	addr    string
+	app     string
+	conn    net.Conn
+}
+
+func (w *syslogWriter) Write(logs []Applog) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, drainTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(drainTimeout))
+	var buf bytes.Buffer
+	for _, l := range logs {
+		msg := formatSyslog(w.app, l)
+		if w.network == "udp" {
+			if _, err := w.conn.Write(msg); err != nil {
+				w.Close()
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+	}
+	if buf.Len() > 0 {
+		if _, err := w.conn.Write(buf.Bytes()); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// drainClient returns an HTTP client that gives up on connections and
+// requests that take longer than drainTimeout, so a slow drain doesn't block
+// the forwarder forever.
+func drainClient() *http.Client {
+	dial := func(network, addr string) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, addr, drainTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return conn, conn.SetDeadline(time.Now().Add(drainTimeout))
+	}
+	transport := &http.Transport{
+		Dial:                  dial,
+		DisableKeepAlives:     true,
+		ResponseHeaderTimeout: drainTimeout,
+	}
+	return &http.Client{Transport: transport}
+}
+
+// httpsWriter sends logs to an HTTPS endpoint, as a JSON array in the body of
+// a POST request.
+type httpsWriter struct {
+	url    string
+	client *http.Client
+}
+
+func (w *httpsWriter) Write(logs []Applog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("The drain returned the status %d.", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *httpsWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"time"
+)
+
+// UnitEvent is a change in the state of a unit, as seen by the collector. From
+// is empty when the unit is new to the app.
+type UnitEvent struct {
+	App  string
+	Unit string
+	From string
+	To   string
+	Time time.Time
+}
+
+// SaveUnitEvents stores the given events in the events collection.
+func SaveUnitEvents(events []UnitEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		docs[i] = events[i]
+	}
+	return conn.Events().Insert(docs...)
+}
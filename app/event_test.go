@@ -0,0 +1,36 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestSaveUnitEvents(c *gocheck.C) {
+	defer s.conn.Events().RemoveAll(bson.M{"app": "eventful"})
+	now := time.Now().Truncate(time.Second)
+	events := []UnitEvent{
+		{App: "eventful", Unit: "eventful/0", To: "started", Time: now},
+		{App: "eventful", Unit: "eventful/1", From: "started", To: "down", Time: now},
+	}
+	err := SaveUnitEvents(events)
+	c.Assert(err, gocheck.IsNil)
+	var got []UnitEvent
+	err = s.conn.Events().Find(bson.M{"app": "eventful"}).Sort("unit").All(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 2)
+	c.Assert(got[0].Unit, gocheck.Equals, "eventful/0")
+	c.Assert(got[0].From, gocheck.Equals, "")
+	c.Assert(got[0].To, gocheck.Equals, "started")
+	c.Assert(got[0].Time.Equal(now), gocheck.Equals, true)
+	c.Assert(got[1].From, gocheck.Equals, "started")
+	c.Assert(got[1].To, gocheck.Equals, "down")
+}
+
+func (s *S) TestSaveUnitEventsWithoutEvents(c *gocheck.C) {
+	c.Assert(SaveUnitEvents(nil), gocheck.IsNil)
+}
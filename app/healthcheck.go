@@ -0,0 +1,251 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthcheckPort           = 80
+	defaultHealthcheckStatus         = http.StatusOK
+	defaultHealthcheckTimeout        = 60
+	defaultHealthcheckRequestTimeout = 5
+)
+
+// healthcheckInterval is the interval between two checks while waiting for a
+// unit to become healthy.
+var healthcheckInterval = time.Second
+
+// unhealthyThreshold is the number of consecutive failed health checks after
+// which a unit is considered unhealthy.
+var unhealthyThreshold = 3
+
+// healthcheck is the HTTP health check of an app, declared in the
+// "healthcheck" section of app.conf:
+//
+//	healthcheck:
+//	  path: /healthcheck
+//	  port: 8080
+//	  status: 200
+//	  timeout: 60
+//	  request-timeout: 5
+//	  interval: 120
+//
+// Only the path is required. The timeout is the number of seconds to wait for
+// a restarted unit to become healthy, and the request timeout is the number
+// of seconds to wait for the answer of each request. The interval is the
+// minimum number of seconds between two checks of the same unit by the
+// collector (see App.CheckHealth); by default, units are checked every time
+// the collector runs.
+type healthcheck struct {
+	Path           string `yaml:"path"`
+	Port           int    `yaml:"port"`
+	Status         int    `yaml:"status"`
+	Timeout        int    `yaml:"timeout"`
+	RequestTimeout int    `yaml:"request-timeout"`
+	Interval       int    `yaml:"interval"`
+}
+
+func (h *healthcheck) url(ip string) string {
+	port := h.Port
+	if port == 0 {
+		port = defaultHealthcheckPort
+	}
+	path := h.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return fmt.Sprintf("http://%s:%d%s", ip, port, path)
+}
+
+func (h *healthcheck) timeout() time.Duration {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthcheckTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func (h *healthcheck) requestTimeout() time.Duration {
+	timeout := h.RequestTimeout
+	if timeout == 0 {
+		timeout = defaultHealthcheckRequestTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// client returns an HTTP client that gives up on requests that take longer
+// than the request timeout of the health check.
+func (h *healthcheck) client() *http.Client {
+	timeout := h.requestTimeout()
+	dial := func(network, addr string) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return conn, conn.SetDeadline(time.Now().Add(timeout))
+	}
+	return &http.Client{Transport: &http.Transport{Dial: dial, DisableKeepAlives: true}}
+}
+
+// check sends one request to the health check of the unit with the given IP,
+// returning an error if the unit doesn't answer with the expected status.
+func (h *healthcheck) check(ip string) error {
+	url := h.url(ip)
+	resp, err := h.client().Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	status := h.Status
+	if status == 0 {
+		status = defaultHealthcheckStatus
+	}
+	if resp.StatusCode != status {
+		return fmt.Errorf("%s returned status %d, expected %d", url, resp.StatusCode, status)
+	}
+	return nil
+}
+
+// wait checks the unit with the given IP until it passes the health check or
+// the timeout expires, returning the error of the last check.
+func (h *healthcheck) wait(ip string) error {
+	deadline := time.Now().Add(h.timeout())
+	for {
+		err := h.check(ip)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(healthcheckInterval)
+	}
+}
+
+// CheckHealth sends a request to the health check of the app (see
+// healthcheck) in each of its started and unhealthy web units, recording the
+// result in the units. It doesn't save the units.
+//
+// Units that fail unhealthyThreshold consecutive checks become unhealthy and,
+// if the provisioner is a RollingRestarter, are removed from the router. The
+// last started web unit of the app is never removed: it keeps failing the
+// checks until another unit is able to take its place. Unhealthy units that
+// pass a check are started and added back to the router. Apps without a
+// health check are left alone.
+func (app *App) CheckHealth() {
+	hc := app.Healthcheck
+	if hc.Path == "" {
+		return
+	}
+	var (
+		wg      sync.WaitGroup
+		checked []int
+	)
+	now := time.Now()
+	interval := time.Duration(hc.Interval) * time.Second
+	errs := make([]error, len(app.Units))
+	for i, u := range app.Units {
+		if u.GetProcessType() != provision.WebProcess || now.Sub(u.LastHealthcheck) < interval {
+			continue
+		}
+		if u.State != provision.StatusStarted.String() && u.State != provision.StatusUnhealthy.String() {
+			continue
+		}
+		checked = append(checked, i)
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			errs[i] = hc.check(ip)
+		}(i, u.Ip)
+	}
+	wg.Wait()
+	for _, i := range checked {
+		app.recordHealth(&app.Units[i], errs[i], now)
+	}
+}
+
+// recordHealth records the result of a health check in the unit, changing its
+// state when it becomes unhealthy or recovers.
+func (app *App) recordHealth(u *Unit, err error, when time.Time) {
+	u.LastHealthcheck = when
+	if err == nil {
+		u.HealthcheckFailures = 0
+		u.HealthcheckError = ""
+		if u.State == provision.StatusUnhealthy.String() {
+			app.Log(fmt.Sprintf("unit %s is healthy again", u.Name), "tsuru")
+			u.State = provision.StatusStarted.String()
+			app.routeUnit(u, true)
+		}
+		return
+	}
+	u.HealthcheckFailures++
+	u.HealthcheckError = err.Error()
+	if u.State == provision.StatusStarted.String() && u.HealthcheckFailures >= unhealthyThreshold {
+		if !app.hasOtherRoutableUnit(u) {
+			app.Log(fmt.Sprintf("unit %s is unhealthy, but it's the last started web unit: %s", u.Name, err), "tsuru")
+			return
+		}
+		app.Log(fmt.Sprintf("unit %s is unhealthy: %s", u.Name, err), "tsuru")
+		u.State = provision.StatusUnhealthy.String()
+		app.routeUnit(u, false)
+	}
+}
+
+// hasOtherRoutableUnit reports whether the app has a started web unit other
+// than u.
+func (app *App) hasOtherRoutableUnit(u *Unit) bool {
+	for _, other := range app.Units {
+		if other.Name != u.Name && other.GetProcessType() == provision.WebProcess && other.State == provision.StatusStarted.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// routeUnit adds the unit to the router or removes it, when the provisioner
+// supports it.
+func (app *App) routeUnit(u *Unit, enable bool) {
+	p, ok := Provisioner.(provision.RollingRestarter)
+	if !ok {
+		return
+	}
+	unit := unitsOf(app, []Unit{*u})[0]
+	var err error
+	if enable {
+		err = p.EnableUnit(app, unit)
+	} else {
+		err = p.DisableUnit(app, unit)
+	}
+	if err != nil {
+		log.Printf("Failed to update the route of the unit %s of %s: %s", u.Name, app.Name, err)
+	}
+}
+
+// saveHealthcheck stores the health check of the app in the database, so the
+// collector can check the units without reading app.conf.
+func (app *App) saveHealthcheck(hc healthcheck) error {
+	if hc == app.Healthcheck {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"healthcheck": hc}})
+	if err != nil {
+		return err
+	}
+	app.Healthcheck = hc
+	return nil
+}
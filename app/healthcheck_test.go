@@ -0,0 +1,223 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthcheckServer starts a server that answers the health check of the
+// app, returning a healthcheck pointing to it and the server.
+func healthcheckServer(handler http.HandlerFunc) (healthcheck, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Host[strings.Index(u.Host, ":")+1:])
+	return healthcheck{Path: "/healthcheck", Port: port, Timeout: 1, RequestTimeout: 1}, server
+}
+
+func (s *S) TestHealthcheckURL(c *gocheck.C) {
+	h := healthcheck{Path: "status"}
+	c.Assert(h.url("10.10.10.1"), gocheck.Equals, "http://10.10.10.1:80/status")
+	h = healthcheck{Path: "/status", Port: 8080}
+	c.Assert(h.url("10.10.10.1"), gocheck.Equals, "http://10.10.10.1:8080/status")
+}
+
+func (s *S) TestHealthcheckCheck(c *gocheck.C) {
+	var path string
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	})
+	defer server.Close()
+	c.Assert(h.check("127.0.0.1"), gocheck.IsNil)
+	c.Assert(path, gocheck.Equals, "/healthcheck")
+}
+
+func (s *S) TestHealthcheckCheckUnexpectedStatus(c *gocheck.C) {
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer server.Close()
+	err := h.check("127.0.0.1")
+	c.Assert(err, gocheck.ErrorMatches, `^http://127.0.0.1:\d+/healthcheck returned status 500, expected 200$`)
+	h.Status = http.StatusInternalServerError
+	c.Assert(h.check("127.0.0.1"), gocheck.IsNil)
+}
+
+func (s *S) TestHealthcheckWait(c *gocheck.C) {
+	old := healthcheckInterval
+	healthcheckInterval = 10 * time.Millisecond
+	defer func() {
+		healthcheckInterval = old
+	}()
+	var (
+		mut   sync.Mutex
+		calls int
+	)
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	defer server.Close()
+	c.Assert(h.wait("127.0.0.1"), gocheck.IsNil)
+	c.Assert(calls, gocheck.Equals, 3)
+}
+
+func (s *S) TestHealthcheckWaitTimeout(c *gocheck.C) {
+	old := healthcheckInterval
+	healthcheckInterval = 100 * time.Millisecond
+	defer func() {
+		healthcheckInterval = old
+	}()
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	err := h.wait("127.0.0.1")
+	c.Assert(err, gocheck.ErrorMatches, `^.* returned status 503, expected 200$`)
+}
+
+func (s *S) TestHealthcheckCheckTimeout(c *gocheck.C) {
+	done := make(chan bool)
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	})
+	defer server.Close()
+	defer close(done)
+	h.Timeout = 60
+	start := time.Now()
+	c.Assert(h.check("127.0.0.1"), gocheck.NotNil)
+	c.Assert(time.Since(start) < 10*time.Second, gocheck.Equals, true)
+}
+
+func (s *S) TestHealthcheckRequestTimeout(c *gocheck.C) {
+	h := healthcheck{Timeout: 60}
+	c.Assert(h.requestTimeout(), gocheck.Equals, defaultHealthcheckRequestTimeout*time.Second)
+	h.RequestTimeout = 2
+	c.Assert(h.requestTimeout(), gocheck.Equals, 2*time.Second)
+}
+
+// healthcheckApp returns an app with two web units that answer the health
+// check with the given status codes, in order, and a worker unit.
+func healthcheckApp(codes ...int) (*App, *httptest.Server) {
+	var mut sync.Mutex
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		w.WriteHeader(codes[0])
+		if len(codes) > 1 {
+			codes = codes[1:]
+		}
+	})
+	a := App{
+		Name:        "healthy",
+		Healthcheck: h,
+		Units: []Unit{
+			{Name: "healthy-0", Ip: "127.0.0.1", State: provision.StatusStarted.String()},
+			{Name: "healthy-1", Ip: "127.0.0.1", State: provision.StatusStarted.String(), ProcessType: "worker"},
+			{Name: "healthy-2", Ip: "127.0.0.1", State: provision.StatusStarted.String()},
+		},
+	}
+	return &a, server
+}
+
+func (s *S) TestCheckHealth(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusOK)
+	defer server.Close()
+	a.Units[0].HealthcheckFailures = 2
+	a.Units[0].HealthcheckError = "connection refused"
+	a.CheckHealth()
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 0)
+	c.Assert(a.Units[0].HealthcheckError, gocheck.Equals, "")
+	c.Assert(a.Units[0].LastHealthcheck.IsZero(), gocheck.Equals, false)
+	c.Assert(a.Units[1].LastHealthcheck.IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckHealthMarksUnitsUnhealthy(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusInternalServerError)
+	defer server.Close()
+	unit := unitsOf(a, a.Units[:1])[0]
+	for i := 1; i < unhealthyThreshold; i++ {
+		a.CheckHealth()
+		c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+		c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, i)
+		c.Assert(s.provisioner.Disabled(unit), gocheck.Equals, false)
+	}
+	a.CheckHealth()
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusUnhealthy.String())
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, unhealthyThreshold)
+	c.Assert(a.Units[0].HealthcheckError, gocheck.Matches, `^.* returned status 500, expected 200$`)
+	c.Assert(s.provisioner.Disabled(unit), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckHealthKeepsTheLastStartedWebUnit(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusInternalServerError)
+	defer server.Close()
+	a.Units[0].State = provision.StatusUnhealthy.String()
+	unit := unitsOf(a, a.Units[2:])[0]
+	for i := 0; i < unhealthyThreshold; i++ {
+		a.CheckHealth()
+	}
+	c.Assert(a.Units[2].State, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(a.Units[2].HealthcheckFailures, gocheck.Equals, unhealthyThreshold)
+	c.Assert(a.Units[2].HealthcheckError, gocheck.Matches, `^.* returned status 500, expected 200$`)
+	c.Assert(s.provisioner.Disabled(unit), gocheck.Equals, false)
+}
+
+func (s *S) TestCheckHealthRecoversUnhealthyUnits(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusOK)
+	defer server.Close()
+	a.Units[0].State = provision.StatusUnhealthy.String()
+	a.Units[0].HealthcheckFailures = 5
+	unit := unitsOf(a, a.Units[:1])[0]
+	s.provisioner.DisableUnit(a, unit)
+	a.CheckHealth()
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 0)
+	c.Assert(s.provisioner.Disabled(unit), gocheck.Equals, false)
+}
+
+func (s *S) TestCheckHealthSkipsStoppedUnits(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusInternalServerError)
+	defer server.Close()
+	a.Units[0].State = provision.StatusStopped.String()
+	a.CheckHealth()
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 0)
+	c.Assert(a.Units[0].LastHealthcheck.IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckHealthRespectsTheInterval(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusInternalServerError)
+	defer server.Close()
+	a.Healthcheck.Interval = 60
+	last := time.Now().Add(-30 * time.Second)
+	a.Units[0].LastHealthcheck = last
+	a.CheckHealth()
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 0)
+	c.Assert(a.Units[0].LastHealthcheck, gocheck.Equals, last)
+	a.Units[0].LastHealthcheck = time.Now().Add(-time.Minute)
+	a.CheckHealth()
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 1)
+}
+
+func (s *S) TestCheckHealthWithoutHealthcheck(c *gocheck.C) {
+	a, server := healthcheckApp(http.StatusInternalServerError)
+	defer server.Close()
+	a.Healthcheck = healthcheck{}
+	a.CheckHealth()
+	c.Assert(a.Units[0].LastHealthcheck.IsZero(), gocheck.Equals, true)
+}
@@ -6,8 +6,10 @@ package app
 
 import (
 	"errors"
+	"github.com/globocom/tsuru/log"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -15,28 +17,162 @@ const (
 	open
 )
 
-var listeners = struct {
-	m map[string][]*LogListener
+var (
+	// logBufferSize is the number of messages buffered for each listener.
+	// When the buffer is full, the oldest message is dropped.
+	logBufferSize = 1000
+
+	// logIdleTimeout is the maximum amount of time that a listener may
+	// take to consume a message. Listeners that don't consume their
+	// pending messages within this time are evicted.
+	logIdleTimeout = 5 * time.Minute
+)
+
+// logBroker fans out the logs of apps to their listeners. Publishing never
+// blocks: each listener has its own buffer and its own goroutine delivering
+// messages to the listener channel.
+type logBroker struct {
+	m    map[string][]*LogListener
+	once sync.Once
 	sync.RWMutex
-}{
-	m: make(map[string][]*LogListener),
 }
 
+var listeners = logBroker{m: make(map[string][]*LogListener)}
+
+func (b *logBroker) subscribe(l *LogListener) {
+	b.once.Do(func() {
+		go b.evictLoop(time.Tick(logIdleTimeout / 2))
+	})
+	b.Lock()
+	b.m[l.appname] = append(b.m[l.appname], l)
+	b.Unlock()
+}
+
+func (b *logBroker) unsubscribe(l *LogListener) {
+	b.Lock()
+	defer b.Unlock()
+	list := b.m[l.appname]
+	index := -1
+	for i, listener := range list {
+		if listener == l {
+			index = i
+			break
+		}
+	}
+	if index > -1 {
+		list[index], list[len(list)-1] = list[len(list)-1], list[index]
+		list = list[:len(list)-1]
+		if len(list) == 0 {
+			delete(b.m, l.appname)
+		} else {
+			b.m[l.appname] = list
+		}
+	}
+}
+
+func (b *logBroker) publish(appName string, messages []Applog) {
+	b.RLock()
+	ls := append([]*LogListener(nil), b.m[appName]...)
+	b.RUnlock()
+	for _, l := range ls {
+		l.push(messages)
+	}
+}
+
+// evictIdle closes all listeners that are idle at the given time, returning
+// the number of evicted listeners.
+func (b *logBroker) evictIdle(now time.Time) int {
+	var idle []*LogListener
+	b.RLock()
+	for _, ls := range b.m {
+		for _, l := range ls {
+			if l.idle(now) {
+				idle = append(idle, l)
+			}
+		}
+	}
+	b.RUnlock()
+	for _, l := range idle {
+		log.Printf("Evicting idle log listener of the app %s (%d dropped messages).", l.appname, l.Dropped())
+		l.Close()
+	}
+	return len(idle)
+}
+
+func (b *logBroker) evictLoop(ticker <-chan time.Time) {
+	for now := range ticker {
+		b.evictIdle(now)
+	}
+}
+
+// logRing is a fixed size FIFO of logs, that overwrites the oldest log when
+// it's full.
+type logRing struct {
+	items  []Applog
+	start  int
+	length int
+}
+
+func newLogRing(size int) logRing {
+	return logRing{items: make([]Applog, size)}
+}
+
+// push adds a log to the ring, returning true if the oldest log was dropped to
+// make room for it.
+func (r *logRing) push(l Applog) bool {
+	if r.length == len(r.items) {
+		r.items[r.start] = l
+		r.start = (r.start + 1) % len(r.items)
+		return true
+	}
+	r.items[(r.start+r.length)%len(r.items)] = l
+	r.length++
+	return false
+}
+
+func (r *logRing) pop() (Applog, bool) {
+	if r.length == 0 {
+		return Applog{}, false
+	}
+	l := r.items[r.start]
+	r.items[r.start] = Applog{}
+	r.start = (r.start + 1) % len(r.items)
+	r.length--
+	return l, true
+}
+
+// LogListener receives the logs of an app, in the channel C. Slow listeners
+// never block the app: when the listener buffer is full, the oldest messages
+// are dropped, and listeners that stop consuming messages are eventually
+// closed.
 type LogListener struct {
 	C       <-chan Applog
 	c       chan Applog
 	state   int32
 	appname string
+	dropped uint64
+
+	mut          sync.Mutex
+	buffer       logRing
+	inflight     bool
+	pendingSince time.Time
+	wake         chan struct{}
+	quit         chan struct{}
 }
 
 func NewLogListener(a *App) *LogListener {
-	c := make(chan Applog, 10)
-	l := LogListener{C: c, c: c, state: open, appname: a.Name}
-	listeners.Lock()
-	list := listeners.m[l.appname]
-	list = append(list, &l)
-	listeners.m[a.Name] = list
-	listeners.Unlock()
+	c := make(chan Applog)
+	l := LogListener{
+		C:       c,
+		c:       c,
+		state:   open,
+		appname: a.Name,
+		buffer:  newLogRing(logBufferSize),
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+	go l.deliver()
+	listeners.subscribe(&l)
 	return &l
 }
 
@@ -44,37 +180,73 @@ func (l *LogListener) Close() error {
 	if !atomic.CompareAndSwapInt32(&l.state, open, closed) {
 		return errors.New("Already closed.")
 	}
-	close(l.c)
-	listeners.Lock()
-	defer listeners.Unlock()
-	list := listeners.m[l.appname]
-	index := -1
-	for i, listener := range list {
-		if listener == l {
-			index = i
-			break
+	close(l.quit)
+	listeners.unsubscribe(l)
+	return nil
+}
+
+// Dropped returns the number of messages that were dropped because the
+// listener buffer was full.
+func (l *LogListener) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+func (l *LogListener) push(messages []Applog) {
+	l.mut.Lock()
+	if l.buffer.length == 0 && !l.inflight {
+		l.pendingSince = time.Now()
+	}
+	for _, msg := range messages {
+		if l.buffer.push(msg) {
+			atomic.AddUint64(&l.dropped, 1)
 		}
 	}
-	if index > -1 {
-		list[index], list[len(list)-1] = list[len(list)-1], list[index]
-		listeners.m[l.appname] = list[:len(list)-1]
+	l.mut.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
 	}
-	return nil
 }
 
-func notify(appName string, messages []Applog) {
-	var wg sync.WaitGroup
-	listeners.RLock()
-	ls := listeners.m[appName]
-	listeners.RUnlock()
-	for _, l := range ls {
-		wg.Add(1)
-		go func(l *LogListener) {
-			for _, msg := range messages {
-				l.c <- msg
+// idle reports whether the listener has messages pending for longer than
+// logIdleTimeout.
+func (l *LogListener) idle(now time.Time) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	pending := l.buffer.length > 0 || l.inflight
+	return pending && now.Sub(l.pendingSince) > logIdleTimeout
+}
+
+// deliver sends the buffered messages to the listener channel, until the
+// listener is closed. It's the only goroutine that sends on or closes the
+// channel.
+func (l *LogListener) deliver() {
+	defer close(l.c)
+	for {
+		l.mut.Lock()
+		msg, ok := l.buffer.pop()
+		l.inflight = ok
+		l.mut.Unlock()
+		if !ok {
+			select {
+			case <-l.wake:
+				continue
+			case <-l.quit:
+				return
 			}
-			wg.Done()
-		}(l)
+		}
+		select {
+		case l.c <- msg:
+			l.mut.Lock()
+			l.inflight = false
+			l.pendingSince = time.Now()
+			l.mut.Unlock()
+		case <-l.quit:
+			return
+		}
 	}
-	wg.Wait()
+}
+
+func notify(appName string, messages []Applog) {
+	listeners.publish(appName, messages)
 }
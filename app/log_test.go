@@ -6,6 +6,7 @@ package app
 
 import (
 	"launchpad.net/gocheck"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -16,13 +17,12 @@ func (s *S) TestNewLogListener(c *gocheck.C) {
 	c.Assert(l.appname, gocheck.Equals, "myapp")
 	c.Assert(l.state, gocheck.Equals, open)
 	c.Assert(l.C, gocheck.NotNil)
-	close(l.c)
-	_, ok := <-l.C
-	c.Assert(ok, gocheck.Equals, false)
 	ls := listeners.m["myapp"]
 	c.Assert(ls, gocheck.HasLen, 1)
 	c.Assert(ls[0], gocheck.Equals, l)
-	delete(listeners.m, "myapp")
+	l.Close()
+	_, ok := <-l.C
+	c.Assert(ok, gocheck.Equals, false)
 }
 
 func (s *S) TestLogListenerClose(c *gocheck.C) {
@@ -94,3 +94,86 @@ func (s *S) TestNotify(c *gocheck.C) {
 	defer logs.Unlock()
 	c.Assert(logs.l, gocheck.DeepEquals, ms)
 }
+
+func (s *S) TestNotifyDoesNotBlockOnSlowListeners(c *gocheck.C) {
+	app := App{Name: "fade"}
+	l := NewLogListener(&app)
+	defer l.Close()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < logBufferSize*2; i++ {
+			notify(app.Name, []Applog{{Message: strconv.Itoa(i)}})
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(2e9):
+		c.Fatal("notify blocked on a listener that is not reading.")
+	}
+}
+
+func (s *S) TestNotifyDropsOldestMessages(c *gocheck.C) {
+	old := logBufferSize
+	logBufferSize = 3
+	defer func() { logBufferSize = old }()
+	app := App{Name: "fade"}
+	l := NewLogListener(&app)
+	defer l.Close()
+	var ms []Applog
+	for i := 0; i < 10; i++ {
+		ms = append(ms, Applog{Message: strconv.Itoa(i)})
+	}
+	notify(app.Name, ms)
+	var got []string
+	timeout := time.After(2e9)
+	for len(got) < 3 {
+		select {
+		case msg := <-l.C:
+			got = append(got, msg.Message)
+		case <-timeout:
+			c.Fatal("Timed out.")
+		}
+	}
+	c.Assert(got, gocheck.DeepEquals, []string{"7", "8", "9"})
+	c.Assert(l.Dropped(), gocheck.Equals, uint64(7))
+}
+
+func (s *S) TestLogRing(c *gocheck.C) {
+	r := newLogRing(2)
+	c.Assert(r.push(Applog{Message: "1"}), gocheck.Equals, false)
+	c.Assert(r.push(Applog{Message: "2"}), gocheck.Equals, false)
+	c.Assert(r.push(Applog{Message: "3"}), gocheck.Equals, true)
+	msg, ok := r.pop()
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(msg.Message, gocheck.Equals, "2")
+	msg, ok = r.pop()
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(msg.Message, gocheck.Equals, "3")
+	_, ok = r.pop()
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestEvictIdleListeners(c *gocheck.C) {
+	app := App{Name: "fade"}
+	idle := NewLogListener(&app)
+	defer idle.Close()
+	other := NewLogListener(&App{Name: "other"})
+	defer other.Close()
+	notify(app.Name, []Applog{{Message: "nobody reads me"}})
+	c.Assert(listeners.evictIdle(time.Now()), gocheck.Equals, 0)
+	n := listeners.evictIdle(time.Now().Add(logIdleTimeout + time.Second))
+	c.Assert(n, gocheck.Equals, 1)
+	c.Assert(idle.state, gocheck.Equals, closed)
+	c.Assert(other.state, gocheck.Equals, open)
+	c.Assert(listeners.m["fade"], gocheck.HasLen, 0)
+	for _ = range idle.C {
+	}
+}
+
+func (s *S) TestListenerWithoutPendingMessagesIsNotIdle(c *gocheck.C) {
+	app := App{Name: "fade"}
+	l := NewLogListener(&app)
+	defer l.Close()
+	c.Assert(l.idle(time.Now().Add(2*logIdleTimeout)), gocheck.Equals, false)
+}
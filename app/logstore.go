@@ -0,0 +1,347 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/queue"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"time"
+)
+
+// logTokenEnv is the environment variable that holds the log ingestion token
+// of the app in its units.
+const logTokenEnv = "TSURU_LOG_TOKEN"
+
+// ErrInvalidLogLevel is returned by AddLogs when a log has an unknown level.
+var ErrInvalidLogLevel = errors.New("Invalid log level. Valid levels are debug, info, warning, error and critical.")
+
+var logLevels = map[string]bool{
+	"":         true,
+	"debug":    true,
+	"info":     true,
+	"warning":  true,
+	"error":    true,
+	"critical": true,
+}
+
+// logLevelOrder lists the log levels from the least to the most severe.
+var logLevelOrder = []string{"debug", "info", "warning", "error", "critical"}
+
+// LogFilter filters the logs of an app. Empty fields don't filter anything.
+type LogFilter struct {
+	// Source and Unit match the source and the unit of the log.
+	Source string
+	Unit   string
+
+	// Level is the minimum level of the logs. Logs without level don't
+	// match filters with a level.
+	Level string
+
+	// Since and Until define the range of dates of the logs. Both are
+	// inclusive.
+	Since time.Time
+	Until time.Time
+
+	// Grep is a regular expression that must match the message of the
+	// log.
+	Grep string
+
+	grep *regexp.Regexp
+}
+
+// Validate checks the level and compiles the regular expression of the
+// filter. It must be called before Match.
+func (f *LogFilter) Validate() error {
+	if !logLevels[f.Level] {
+		return ErrInvalidLogLevel
+	}
+	f.grep = nil
+	if f.Grep != "" {
+		re, err := regexp.Compile(f.Grep)
+		if err != nil {
+			return fmt.Errorf("Invalid regular expression: %s.", err)
+		}
+		f.grep = re
+	}
+	return nil
+}
+
+// levels returns the levels that match the filter, or nil if the filter has
+// no level.
+func (f *LogFilter) levels() []string {
+	for i, level := range logLevelOrder {
+		if level == f.Level {
+			return logLevelOrder[i:]
+		}
+	}
+	return nil
+}
+
+// query returns the MongoDB query that selects the logs of the given app
+// matching the filter.
+func (f *LogFilter) query(appName string) bson.M {
+	query := bson.M{"appname": appName}
+	if f.Source != "" {
+		query["source"] = f.Source
+	}
+	if f.Unit != "" {
+		query["unit"] = f.Unit
+	}
+	if levels := f.levels(); levels != nil {
+		query["level"] = bson.M{"$in": levels}
+	}
+	date := bson.M{}
+	if !f.Since.IsZero() {
+		date["$gte"] = f.Since
+	}
+	if !f.Until.IsZero() {
+		date["$lte"] = f.Until
+	}
+	if len(date) > 0 {
+		query["date"] = date
+	}
+	if f.Grep != "" {
+		query["message"] = bson.RegEx{Pattern: f.Grep}
+	}
+	return query
+}
+
+// Match reports whether the log matches the filter.
+func (f *LogFilter) Match(l Applog) bool {
+	if f.Source != "" && l.Source != f.Source {
+		return false
+	}
+	if f.Unit != "" && l.Unit != f.Unit {
+		return false
+	}
+	if levels := f.levels(); levels != nil {
+		found := false
+		for _, level := range levels {
+			if level == l.Level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && l.Date.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && l.Date.After(f.Until) {
+		return false
+	}
+	if f.grep != nil && !f.grep.MatchString(l.Message) {
+		return false
+	}
+	return true
+}
+
+// logRetention returns for how long the logs of the app are kept. It's
+// defined by the LogRetention field of the app (in days), falling back to the
+// logs:retention-days setting. A zero duration means that logs are kept
+// forever.
+func (app *App) logRetention() time.Duration {
+	days := app.LogRetention
+	if days == 0 {
+		days, _ = config.GetInt("logs:retention-days")
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// storeLogs inserts the given logs in the logs collection. When the app has a
+// retention period, each log receives an expiration date, and MongoDB removes
+// it when the date is reached.
+func (app *App) storeLogs(conn *db.Storage, logs []Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	retention := app.logRetention()
+	docs := make([]interface{}, len(logs))
+	for i, l := range logs {
+		doc := bson.M{
+			"appname": app.Name,
+			"date":    l.Date,
+			"message": l.Message,
+			"source":  l.Source,
+		}
+		if l.Unit != "" {
+			doc["unit"] = l.Unit
+		}
+		if l.Level != "" {
+			doc["level"] = l.Level
+		}
+		if retention > 0 {
+			doc["expireat"] = l.Date.Add(retention)
+		}
+		docs[i] = doc
+	}
+	return conn.Logs().Insert(docs...)
+}
+
+func generateLogToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (app *App) saveLogToken(token string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	app.LogToken = token
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"logtoken": app.LogToken}},
+	)
+}
+
+// issueLogToken generates a new log ingestion token for the app, saving it in
+// the database along with the TSURU_LOG_TOKEN environment variable. It's used
+// for apps created before log tokens existed: the variable reaches the units
+// when their apprc is regenerated.
+func (app *App) issueLogToken() error {
+	token, err := generateLogToken()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	env := bind.EnvVar{Name: logTokenEnv, Value: token}
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"logtoken": token, "env." + logTokenEnv: env}},
+	)
+	if err != nil {
+		return err
+	}
+	if app.Env == nil {
+		app.Env = make(map[string]bind.EnvVar)
+	}
+	app.LogToken = token
+	app.Env[logTokenEnv] = env
+	return nil
+}
+
+// ValidLogToken reports whether the given token is the log ingestion token of
+// the app. Units use this token to send their logs to tsuru.
+func (app *App) ValidLogToken(token string) bool {
+	if app.LogToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(app.LogToken), []byte(token)) == 1
+}
+
+// SetLogRetention defines for how many days the logs of the app are kept. Zero
+// means that the app uses the default retention, defined by the
+// logs:retention-days setting.
+//
+// The new retention applies only to logs added after the change.
+func (app *App) SetLogRetention(days int) error {
+	if days < 0 {
+		return errors.New("The log retention must not be negative.")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	app.LogRetention = days
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"logretention": app.LogRetention}},
+	)
+}
+
+// MigrateLogs moves the logs embedded in app documents, stored by older
+// versions of tsuru, to the logs collection.
+//
+// It's safe to call MigrateLogs more than once: apps without embedded logs
+// are not touched.
+func MigrateLogs() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{"logs": bson.M{"$exists": true}}
+	fields := bson.M{"name": 1, "logretention": 1, "logs": 1}
+	iter := conn.Apps().Find(query).Select(fields).Iter()
+	for {
+		var a struct {
+			Name         string
+			LogRetention int
+			Logs         []Applog
+		}
+		if !iter.Next(&a) {
+			break
+		}
+		app := App{Name: a.Name, LogRetention: a.LogRetention}
+		if err := app.storeLogs(conn, a.Logs); err != nil {
+			iter.Close()
+			return err
+		}
+		err := conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$unset": bson.M{"logs": 1}})
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		log.Printf("Moved %d logs of the app %s to the logs collection.", len(a.Logs), a.Name)
+	}
+	return iter.Close()
+}
+
+// MigrateLogTokens issues log ingestion tokens to the apps created by older
+// versions of tsuru, and regenerates the apprc of their units, so the units
+// are able to send logs.
+//
+// It's safe to call MigrateLogTokens more than once: apps that already have a
+// log token are not touched.
+func MigrateLogTokens() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{"$or": []bson.M{
+		{"logtoken": bson.M{"$exists": false}},
+		{"logtoken": ""},
+	}}
+	var apps []App
+	err = conn.Apps().Find(query).Select(bson.M{"name": 1, "env": 1}).All(&apps)
+	if err != nil {
+		return err
+	}
+	messages := make([]queue.Message, len(apps))
+	for i := range apps {
+		if err = apps[i].issueLogToken(); err != nil {
+			return err
+		}
+		messages[i] = queue.Message{Action: regenerateApprc, Args: []string{apps[i].Name}}
+		log.Printf("Issued the log token of the app %s.", apps[i].Name)
+	}
+	if len(messages) > 0 {
+		Enqueue(messages...)
+	}
+	return nil
+}
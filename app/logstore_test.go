@@ -0,0 +1,311 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestLogRetentionFromApp(c *gocheck.C) {
+	config.Set("logs:retention-days", 30)
+	defer config.Unset("logs:retention-days")
+	a := App{Name: "myapp", LogRetention: 7}
+	c.Assert(a.logRetention(), gocheck.Equals, 7*24*time.Hour)
+}
+
+func (s *S) TestLogRetentionFromConfig(c *gocheck.C) {
+	config.Set("logs:retention-days", 30)
+	defer config.Unset("logs:retention-days")
+	a := App{Name: "myapp"}
+	c.Assert(a.logRetention(), gocheck.Equals, 30*24*time.Hour)
+}
+
+func (s *S) TestLogRetentionWithoutConfig(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	c.Assert(a.logRetention(), gocheck.Equals, time.Duration(0))
+}
+
+func (s *S) TestStoreLogsSetsTheExpirationDate(c *gocheck.C) {
+	a := App{Name: "myapp", LogRetention: 2}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	now := time.Now()
+	logs := []Applog{{Date: now, Message: "hello", Source: "tsuru"}}
+	err := a.storeLogs(s.conn, logs)
+	c.Assert(err, gocheck.IsNil)
+	var doc struct {
+		AppName  string
+		Message  string
+		ExpireAt time.Time
+	}
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).One(&doc)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(doc.Message, gocheck.Equals, "hello")
+	c.Assert(doc.ExpireAt.Unix(), gocheck.Equals, now.Add(48*time.Hour).Unix())
+}
+
+func (s *S) TestStoreLogsWithoutRetention(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	logs := []Applog{{Date: time.Now(), Message: "hello", Source: "tsuru"}}
+	err := a.storeLogs(s.conn, logs)
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Logs().Find(bson.M{"appname": a.Name, "expireat": bson.M{"$exists": true}}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestSetLogRetention(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetLogRetention(15)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.Equals, 15)
+	a = App{Name: "myapp"}
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.Equals, 15)
+}
+
+func (s *S) TestSetLogRetentionNegative(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	err := a.SetLogRetention(-1)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "The log retention must not be negative.")
+}
+
+func (s *S) TestMigrateLogs(c *gocheck.C) {
+	now := time.Now()
+	doc := bson.M{
+		"name": "oldapp",
+		"logs": []Applog{
+			{Date: now, Message: "first", Source: "tsuru"},
+			{Date: now.Add(time.Second), Message: "second", Source: "app"},
+		},
+	}
+	err := s.conn.Apps().Insert(doc)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": "oldapp"})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "oldapp"})
+	err = MigrateLogs()
+	c.Assert(err, gocheck.IsNil)
+	a := App{Name: "oldapp"}
+	logs, err := a.LastLogs(10, LogFilter{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "first")
+	c.Assert(logs[1].Message, gocheck.Equals, "second")
+	c.Assert(logs[1].Source, gocheck.Equals, "app")
+	n, err := s.conn.Apps().Find(bson.M{"name": "oldapp", "logs": bson.M{"$exists": true}}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	err = MigrateLogs()
+	c.Assert(err, gocheck.IsNil)
+	n, err = s.conn.Logs().Find(bson.M{"appname": "oldapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestMigrateLogTokens(c *gocheck.C) {
+	err := s.conn.Apps().Insert(bson.M{"name": "oldapp"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": "oldapp"})
+	err = s.conn.Apps().Insert(bson.M{"name": "newapp", "logtoken": "123"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": "newapp"})
+	err = MigrateLogTokens()
+	c.Assert(err, gocheck.IsNil)
+	message, err := aqueue().Get(2e9)
+	c.Assert(err, gocheck.IsNil)
+	defer message.Delete()
+	c.Assert(message.Action, gocheck.Equals, regenerateApprc)
+	c.Assert(message.Args, gocheck.DeepEquals, []string{"oldapp"})
+	a := App{Name: "oldapp"}
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogToken, gocheck.HasLen, 40)
+	c.Assert(a.Env[logTokenEnv].Value, gocheck.Equals, a.LogToken)
+	c.Assert(a.ValidLogToken(a.LogToken), gocheck.Equals, true)
+	token := a.LogToken
+	err = MigrateLogTokens()
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogToken, gocheck.Equals, token)
+	b := App{Name: "newapp"}
+	err = b.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.LogToken, gocheck.Equals, "123")
+}
+
+func (s *S) TestGenerateLogToken(c *gocheck.C) {
+	token, err := generateLogToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(token, gocheck.HasLen, 40)
+	other, err := generateLogToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(other, gocheck.Not(gocheck.Equals), token)
+}
+
+func (s *S) TestIssueLogToken(c *gocheck.C) {
+	a := App{
+		Name: "myapp",
+		Env:  map[string]bind.EnvVar{"DATABASE_HOST": {Name: "DATABASE_HOST", Value: "localhost"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	a = App{Name: "myapp"}
+	err = a.issueLogToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogToken, gocheck.HasLen, 40)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogToken, gocheck.HasLen, 40)
+	c.Assert(a.Env["DATABASE_HOST"].Value, gocheck.Equals, "localhost")
+	c.Assert(a.Env[logTokenEnv].Value, gocheck.Equals, a.LogToken)
+	c.Assert(a.Env[logTokenEnv].Public, gocheck.Equals, false)
+}
+
+func (s *S) TestValidLogToken(c *gocheck.C) {
+	a := App{Name: "myapp", LogToken: "abc123"}
+	c.Assert(a.ValidLogToken("abc123"), gocheck.Equals, true)
+	c.Assert(a.ValidLogToken("abc12"), gocheck.Equals, false)
+	c.Assert(a.ValidLogToken(""), gocheck.Equals, false)
+}
+
+func (s *S) TestValidLogTokenAppWithoutToken(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	c.Assert(a.ValidLogToken(""), gocheck.Equals, false)
+}
+
+func (s *S) TestAddLogs(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	date := time.Date(2013, 7, 10, 12, 0, 0, 0, time.UTC)
+	logs := []Applog{
+		{Message: "starting", Unit: "myapp/0", Level: "info", Date: date},
+		{Message: ""},
+		{Message: "failed to connect", Source: "worker", Level: "error"},
+	}
+	err := a.AddLogs(logs)
+	c.Assert(err, gocheck.IsNil)
+	var stored []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name}).Sort("date").All(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored, gocheck.HasLen, 2)
+	c.Assert(stored[0].Message, gocheck.Equals, "starting")
+	c.Assert(stored[0].Source, gocheck.Equals, "app")
+	c.Assert(stored[0].Unit, gocheck.Equals, "myapp/0")
+	c.Assert(stored[0].Level, gocheck.Equals, "info")
+	c.Assert(stored[0].Date.Equal(date), gocheck.Equals, true)
+	c.Assert(stored[1].Message, gocheck.Equals, "failed to connect")
+	c.Assert(stored[1].Source, gocheck.Equals, "worker")
+	c.Assert(stored[1].Level, gocheck.Equals, "error")
+	c.Assert(stored[1].Date.IsZero(), gocheck.Equals, false)
+}
+
+func (s *S) TestAddLogsInvalidLevel(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	logs := []Applog{
+		{Message: "starting", Level: "info"},
+		{Message: "boom", Level: "fatal"},
+	}
+	err := a.AddLogs(logs)
+	c.Assert(err, gocheck.Equals, ErrInvalidLogLevel)
+	n, err := s.conn.Logs().Find(bson.M{"appname": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestLogFilterValidate(c *gocheck.C) {
+	f := LogFilter{Level: "warning", Grep: "^conn.*refused$"}
+	c.Assert(f.Validate(), gocheck.IsNil)
+	f = LogFilter{Level: "fatal"}
+	c.Assert(f.Validate(), gocheck.Equals, ErrInvalidLogLevel)
+	f = LogFilter{Grep: "conn(refused"}
+	err := f.Validate()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Matches, "^Invalid regular expression: .*")
+}
+
+func (s *S) TestLogFilterMatch(c *gocheck.C) {
+	date := time.Date(2013, 7, 10, 12, 0, 0, 0, time.UTC)
+	l := Applog{Date: date, Message: "connection refused", Source: "app", Unit: "myapp/0", Level: "error"}
+	var tests = []struct {
+		filter   LogFilter
+		expected bool
+	}{
+		{LogFilter{}, true},
+		{LogFilter{Source: "app"}, true},
+		{LogFilter{Source: "tsuru"}, false},
+		{LogFilter{Unit: "myapp/0"}, true},
+		{LogFilter{Unit: "myapp/1"}, false},
+		{LogFilter{Level: "warning"}, true},
+		{LogFilter{Level: "error"}, true},
+		{LogFilter{Level: "critical"}, false},
+		{LogFilter{Since: date}, true},
+		{LogFilter{Since: date.Add(time.Second)}, false},
+		{LogFilter{Until: date}, true},
+		{LogFilter{Until: date.Add(-time.Second)}, false},
+		{LogFilter{Grep: "refused$"}, true},
+		{LogFilter{Grep: "^refused"}, false},
+	}
+	for _, t := range tests {
+		c.Assert(t.filter.Validate(), gocheck.IsNil)
+		c.Check(t.filter.Match(l), gocheck.Equals, t.expected)
+	}
+}
+
+func (s *S) TestLogFilterMatchLevelWithoutLevel(c *gocheck.C) {
+	l := Applog{Date: time.Now(), Message: "restarting", Source: "tsuru"}
+	f := LogFilter{Level: "debug"}
+	c.Assert(f.Validate(), gocheck.IsNil)
+	c.Assert(f.Match(l), gocheck.Equals, false)
+}
+
+func (s *S) TestLastLogsWithFilter(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	date := time.Date(2013, 7, 10, 12, 0, 0, 0, time.UTC)
+	logs := []Applog{
+		{Date: date, Message: "starting", Unit: "myapp/0", Level: "info"},
+		{Date: date.Add(time.Minute), Message: "connection refused", Unit: "myapp/0", Level: "error"},
+		{Date: date.Add(2 * time.Minute), Message: "connection refused", Unit: "myapp/1", Level: "error"},
+		{Date: date.Add(3 * time.Minute), Message: "connection refused", Unit: "myapp/0", Level: "warning"},
+		{Date: date.Add(4 * time.Minute), Message: "connection refused", Unit: "myapp/0", Level: "critical"},
+	}
+	err := a.AddLogs(logs)
+	c.Assert(err, gocheck.IsNil)
+	filter := LogFilter{
+		Unit:  "myapp/0",
+		Level: "error",
+		Since: date.Add(time.Minute),
+		Until: date.Add(3 * time.Minute),
+		Grep:  "refused$",
+	}
+	result, err := a.LastLogs(10, filter)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, 1)
+	c.Assert(result[0].Message, gocheck.Equals, "connection refused")
+	c.Assert(result[0].Date.Equal(date.Add(time.Minute)), gocheck.Equals, true)
+	result, err = a.LastLogs(10, LogFilter{Level: "warning", Since: date.Add(2 * time.Minute)})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, 3)
+	c.Assert(result[0].Unit, gocheck.Equals, "myapp/1")
+	c.Assert(result[2].Level, gocheck.Equals, "critical")
+}
+
+func (s *S) TestLastLogsInvalidFilter(c *gocheck.C) {
+	a := App{Name: "myapp"}
+	_, err := a.LastLogs(10, LogFilter{Level: "fatal"})
+	c.Assert(err, gocheck.Equals, ErrInvalidLogLevel)
+}
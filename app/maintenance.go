@@ -0,0 +1,66 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+)
+
+var errMaintenanceNotSupported = &errors.ValidationError{Message: "The provisioner doesn't support maintenance mode."}
+
+// StartMaintenance puts the app in maintenance: the router answers all
+// requests to the app with the given page (or its default 503 page, when the
+// page is empty), while the units keep running.
+func (app *App) StartMaintenance(page []byte) error {
+	p, ok := Provisioner.(provision.MaintenanceProvisioner)
+	if !ok {
+		return errMaintenanceNotSupported
+	}
+	app.Log("starting maintenance", "tsuru")
+	if err := p.StartMaintenance(app, page); err != nil {
+		return maintenanceError(err)
+	}
+	return app.setMaintenance(true)
+}
+
+// StopMaintenance makes the router deliver requests to the units of the app
+// again.
+func (app *App) StopMaintenance() error {
+	p, ok := Provisioner.(provision.MaintenanceProvisioner)
+	if !ok {
+		return errMaintenanceNotSupported
+	}
+	app.Log("stopping maintenance", "tsuru")
+	if err := p.StopMaintenance(app); err != nil {
+		return maintenanceError(err)
+	}
+	return app.setMaintenance(false)
+}
+
+func (app *App) setMaintenance(maintenance bool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"maintenance": maintenance}})
+	if err != nil {
+		return err
+	}
+	app.Maintenance = maintenance
+	return nil
+}
+
+// maintenanceError converts the error returned by provisioners whose router
+// doesn't support maintenance mode to a ValidationError.
+func maintenanceError(err error) error {
+	if err == provision.ErrMaintenanceNotSupported {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	return err
+}
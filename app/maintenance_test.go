@@ -0,0 +1,68 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestStartMaintenance(c *gocheck.C) {
+	a := App{Name: "closedapp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.StartMaintenance([]byte("<h1>Be right back</h1>"))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Maintenance, gocheck.Equals, true)
+	ok, page := s.provisioner.InMaintenance(&a)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(string(page), gocheck.Equals, "<h1>Be right back</h1>")
+	var stored App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Maintenance, gocheck.Equals, true)
+}
+
+func (s *S) TestStopMaintenance(c *gocheck.C) {
+	a := App{Name: "closedapp", Maintenance: true}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.StartMaintenance(&a, nil)
+	err = a.StopMaintenance()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Maintenance, gocheck.Equals, false)
+	ok, _ := s.provisioner.InMaintenance(&a)
+	c.Assert(ok, gocheck.Equals, false)
+	var stored App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Maintenance, gocheck.Equals, false)
+}
+
+func (s *S) TestMaintenanceProvisionerWithoutMaintenanceSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "closedapp"}
+	err := a.StartMaintenance(nil)
+	c.Assert(err, gocheck.Equals, errMaintenanceNotSupported)
+	err = a.StopMaintenance()
+	c.Assert(err, gocheck.Equals, errMaintenanceNotSupported)
+}
+
+func (s *S) TestStartMaintenanceRouterWithoutMaintenanceSupport(c *gocheck.C) {
+	s.provisioner.PrepareFailure("StartMaintenance", provision.ErrMaintenanceNotSupported)
+	a := App{Name: "closedapp"}
+	err := a.StartMaintenance(nil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, provision.ErrMaintenanceNotSupported.Error())
+	c.Assert(a.Maintenance, gocheck.Equals, false)
+}
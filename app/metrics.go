@@ -0,0 +1,138 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// rawMetricsAge is how long raw samples are kept before being downsampled to
+// hourly samples.
+const rawMetricsAge = time.Hour
+
+// MetricsSample is the average resource usage of a unit in a period of time.
+//
+// The collector stores a raw sample of each unit every time it runs (see
+// SaveMetrics). Raw samples older than an hour are merged into hourly samples
+// (see DownsampleMetrics), and all samples are removed after a week.
+type MetricsSample struct {
+	Id   bson.ObjectId `bson:"_id,omitempty"`
+	App  string
+	Unit string
+	Time time.Time
+
+	// Hourly indicates that the sample is the average of the raw samples
+	// of the hour starting at Time, and Samples is the number of raw
+	// samples averaged.
+	Hourly  bool
+	Samples int
+
+	CPU    float64
+	Memory float64
+	Disk   float64
+}
+
+// merge adds the raw samples averaged in other to the sample.
+func (s *MetricsSample) merge(other *MetricsSample) {
+	n := float64(s.Samples + other.Samples)
+	w1, w2 := float64(s.Samples)/n, float64(other.Samples)/n
+	s.CPU = s.CPU*w1 + other.CPU*w2
+	s.Memory = s.Memory*w1 + other.Memory*w2
+	s.Disk = s.Disk*w1 + other.Disk*w2
+	s.Samples += other.Samples
+}
+
+// SaveMetrics stores the samples collected from the provisioner as raw samples
+// taken at the given time.
+func SaveMetrics(metrics []provision.UnitMetrics, when time.Time) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	samples := make([]interface{}, len(metrics))
+	for i, m := range metrics {
+		samples[i] = MetricsSample{
+			App:     m.AppName,
+			Unit:    m.Unit,
+			Time:    when,
+			Samples: 1,
+			CPU:     m.CPU,
+			Memory:  m.Memory,
+			Disk:    m.Disk,
+		}
+	}
+	return conn.Metrics().Insert(samples...)
+}
+
+// DownsampleMetrics merges the raw samples of the hours that ended more than
+// an hour before now into hourly samples.
+func DownsampleMetrics(now time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var raw []MetricsSample
+	limit := now.Add(-rawMetricsAge).Truncate(time.Hour)
+	err = conn.Metrics().Find(bson.M{"hourly": false, "time": bson.M{"$lt": limit}}).All(&raw)
+	if err != nil || len(raw) == 0 {
+		return err
+	}
+	type key struct {
+		app, unit string
+		hour      int64
+	}
+	hourly := make(map[key]*MetricsSample)
+	ids := make([]bson.ObjectId, len(raw))
+	for i := range raw {
+		s := &raw[i]
+		hour := s.Time.Truncate(time.Hour)
+		k := key{s.App, s.Unit, hour.Unix()}
+		if h, ok := hourly[k]; ok {
+			h.merge(s)
+		} else {
+			hourly[k] = &MetricsSample{App: s.App, Unit: s.Unit, Time: hour, Hourly: true, Samples: s.Samples, CPU: s.CPU, Memory: s.Memory, Disk: s.Disk}
+		}
+		ids[i] = s.Id
+	}
+	for _, h := range hourly {
+		var stored MetricsSample
+		q := bson.M{"app": h.App, "unit": h.Unit, "time": h.Time, "hourly": true}
+		err = conn.Metrics().Find(q).One(&stored)
+		if err == nil {
+			stored.merge(h)
+			err = conn.Metrics().UpdateId(stored.Id, stored)
+		} else if err == mgo.ErrNotFound {
+			err = conn.Metrics().Insert(h)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = conn.Metrics().RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// Metrics returns the samples of the resource usage of the units of the app
+// taken since the given time, sorted by unit and time.
+func (app *App) Metrics(since time.Time) ([]MetricsSample, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	samples := []MetricsSample{}
+	q := bson.M{"app": app.Name, "time": bson.M{"$gte": since}}
+	err = conn.Metrics().Find(q).Sort("unit", "time").All(&samples)
+	return samples, err
+}
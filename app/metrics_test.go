@@ -0,0 +1,100 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestSaveMetrics(c *gocheck.C) {
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": "metered"})
+	now := time.Now().Truncate(time.Second)
+	metrics := []provision.UnitMetrics{
+		{AppName: "metered", Unit: "metered/0", CPU: 10, Memory: 20, Disk: 30},
+		{AppName: "metered", Unit: "metered/1", CPU: 40, Memory: 50, Disk: 60},
+	}
+	err := SaveMetrics(metrics, now)
+	c.Assert(err, gocheck.IsNil)
+	var samples []MetricsSample
+	err = s.conn.Metrics().Find(bson.M{"app": "metered"}).Sort("unit").All(&samples)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples, gocheck.HasLen, 2)
+	c.Assert(samples[0].Unit, gocheck.Equals, "metered/0")
+	c.Assert(samples[0].Time.Equal(now), gocheck.Equals, true)
+	c.Assert(samples[0].Samples, gocheck.Equals, 1)
+	c.Assert(samples[0].Hourly, gocheck.Equals, false)
+	c.Assert(samples[0].CPU, gocheck.Equals, 10.0)
+	c.Assert(samples[1].Unit, gocheck.Equals, "metered/1")
+	c.Assert(samples[1].Disk, gocheck.Equals, 60.0)
+}
+
+func (s *S) TestSaveMetricsWithoutSamples(c *gocheck.C) {
+	c.Assert(SaveMetrics(nil, time.Now()), gocheck.IsNil)
+}
+
+func (s *S) TestDownsampleMetrics(c *gocheck.C) {
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": "metered"})
+	hour := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+	now := hour.Add(2*time.Hour + 30*time.Minute)
+	samples := []interface{}{
+		MetricsSample{App: "metered", Unit: "metered/0", Time: hour.Add(10 * time.Minute), Samples: 1, CPU: 10, Memory: 20, Disk: 30},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: hour.Add(20 * time.Minute), Samples: 1, CPU: 30, Memory: 40, Disk: 30},
+		MetricsSample{App: "metered", Unit: "metered/1", Time: hour.Add(10 * time.Minute), Samples: 1, CPU: 50, Memory: 50, Disk: 50},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: hour.Add(time.Hour + 40*time.Minute), Samples: 1, CPU: 90},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: hour, Hourly: true, Samples: 2, CPU: 40, Memory: 20, Disk: 30},
+	}
+	err := s.conn.Metrics().Insert(samples...)
+	c.Assert(err, gocheck.IsNil)
+	err = DownsampleMetrics(now)
+	c.Assert(err, gocheck.IsNil)
+	var got []MetricsSample
+	err = s.conn.Metrics().Find(bson.M{"app": "metered"}).Sort("unit", "time").All(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 3)
+	c.Assert(got[0].Hourly, gocheck.Equals, true)
+	c.Assert(got[0].Time.Equal(hour), gocheck.Equals, true)
+	c.Assert(got[0].Samples, gocheck.Equals, 4)
+	c.Assert(got[0].CPU, gocheck.Equals, 30.0)
+	c.Assert(got[0].Memory, gocheck.Equals, 25.0)
+	c.Assert(got[0].Disk, gocheck.Equals, 30.0)
+	c.Assert(got[1].Hourly, gocheck.Equals, false)
+	c.Assert(got[1].CPU, gocheck.Equals, 90.0)
+	c.Assert(got[2].Unit, gocheck.Equals, "metered/1")
+	c.Assert(got[2].Hourly, gocheck.Equals, true)
+	c.Assert(got[2].Samples, gocheck.Equals, 1)
+	c.Assert(got[2].CPU, gocheck.Equals, 50.0)
+}
+
+func (s *S) TestAppMetrics(c *gocheck.C) {
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": bson.M{"$in": []string{"metered", "other"}}})
+	now := time.Now()
+	samples := []interface{}{
+		MetricsSample{App: "metered", Unit: "metered/1", Time: now.Add(-time.Minute), Samples: 1, CPU: 10},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: now.Add(-time.Minute), Samples: 1, CPU: 20},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: now.Add(-2 * time.Minute), Samples: 1, CPU: 30},
+		MetricsSample{App: "metered", Unit: "metered/0", Time: now.Add(-2 * time.Hour), Samples: 1, CPU: 40},
+		MetricsSample{App: "other", Unit: "other/0", Time: now.Add(-time.Minute), Samples: 1, CPU: 50},
+	}
+	err := s.conn.Metrics().Insert(samples...)
+	c.Assert(err, gocheck.IsNil)
+	a := App{Name: "metered"}
+	got, err := a.Metrics(now.Add(-time.Hour))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 3)
+	c.Assert(got[0].Unit, gocheck.Equals, "metered/0")
+	c.Assert(got[0].CPU, gocheck.Equals, 30.0)
+	c.Assert(got[1].CPU, gocheck.Equals, 20.0)
+	c.Assert(got[2].Unit, gocheck.Equals, "metered/1")
+}
+
+func (s *S) TestAppMetricsWithoutSamples(c *gocheck.C) {
+	a := App{Name: "unmetered"}
+	got, err := a.Metrics(time.Now().Add(-time.Hour))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 0)
+}
@@ -7,13 +7,10 @@ package app
 import (
 	"errors"
 	"fmt"
-	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
-	"github.com/globocom/tsuru/service"
 	"io/ioutil"
-	"labix.org/v2/mgo/bson"
 	"sync"
 )
 
@@ -65,28 +62,13 @@ func bindUnit(msg *queue.Message) error {
 		msg.Delete()
 		return fmt.Errorf("Error handling %q: app %q does not exist.", msg.Action, a.Name)
 	}
-	conn, err := db.Conn()
-	if err != nil {
-		return fmt.Errorf("Error handling %q: %s", msg.Action, err)
-	}
-	defer conn.Close()
 	units := getUnits(&a, msg.Args[1:])
 	if len(units) == 0 {
 		msg.Delete()
 		return errors.New("Unknown unit in the message.")
 	}
-	unit := units[0]
-	var instances []service.ServiceInstance
-	q := bson.M{"apps": bson.M{"$in": []string{msg.Args[0]}}}
-	err = conn.ServiceInstances().Find(q).All(&instances)
-	if err != nil {
-		return err
-	}
-	for _, instance := range instances {
-		_, err = instance.BindUnit(&a, &unit)
-		if err != nil {
-			log.Printf("Error binding the unit %s with the service instance %s.", unit.Name, instance.Name)
-		}
+	if err = a.bindUnit(&units[0]); err != nil {
+		return fmt.Errorf("Error handling %q: %s", msg.Action, err)
 	}
 	return nil
 }
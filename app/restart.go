@@ -0,0 +1,130 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"strings"
+)
+
+var (
+	errRollingRestartNotSupported = &errors.ValidationError{Message: "The provisioner can't restart apps in rolling mode."}
+	errNoHealthcheck              = &errors.ValidationError{Message: "The app must declare a health check in app.conf to be restarted in rolling mode."}
+	errInvalidBatch               = &errors.ValidationError{Message: "The batch size must be greater than zero."}
+)
+
+// RollingRestart restarts the units of the app in batches of the given size,
+// writing the progress to w.
+//
+// The units of each batch are taken out of the router while they restart, and
+// put back once they pass the health check declared in app.conf. Workers are
+// not checked. If any unit of a batch fails to restart or to become healthy,
+// the restart is aborted and the failing units are left out of the router.
+func (app *App) RollingRestart(w io.Writer, batch int) error {
+	p, ok := Provisioner.(provision.RollingRestarter)
+	if !ok {
+		return errRollingRestartNotSupported
+	}
+	if batch < 1 {
+		return errInvalidBatch
+	}
+	if err := app.loadHooks(); err != nil {
+		return err
+	}
+	if app.hooks.Healthcheck.Path == "" {
+		return errNoHealthcheck
+	}
+	app.Log("executing hook to restart in rolling mode", "tsuru")
+	err := app.preRestart(w)
+	if err != nil {
+		return err
+	}
+	units := app.ProvisionUnits()
+	for i := 0; i < len(units); i += batch {
+		end := i + batch
+		if end > len(units) {
+			end = len(units)
+		}
+		if err = app.restartBatch(w, p, units[i:end]); err != nil {
+			app.Log(fmt.Sprintf("rolling restart aborted: %s", err), "tsuru")
+			fmt.Fprintf(w, "\n ---> Rolling restart aborted: %s\n", err)
+			return err
+		}
+	}
+	if err = app.clearStopped(); err != nil {
+		return err
+	}
+	return app.postRestart(w)
+}
+
+// restartBatch restarts the given units, waiting for the web units to pass
+// the health check before putting them back in the router.
+func (app *App) restartBatch(w io.Writer, p provision.RollingRestarter, units []provision.AppUnit) error {
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = u.GetName()
+	}
+	err := write(w, []byte(fmt.Sprintf("\n ---> Restarting units %s\n", strings.Join(names, ", "))))
+	if err != nil {
+		return err
+	}
+	var failures []string
+	restarted := make([]provision.AppUnit, 0, len(units))
+	for _, u := range units {
+		if err := p.DisableUnit(app, u); err != nil {
+			return err
+		}
+		if err := p.RestartUnit(app, u); err != nil {
+			failures = append(failures, fmt.Sprintf("%s failed to restart (%s)", u.GetName(), err))
+			continue
+		}
+		restarted = append(restarted, u)
+	}
+	hc := app.hooks.Healthcheck
+	ips := unitIps()
+	for _, u := range restarted {
+		if u.GetProcessType() == provision.WebProcess {
+			ip, ok := ips[u.GetName()]
+			if !ok {
+				ip = u.GetIp()
+			}
+			if err := hc.wait(ip); err != nil {
+				failures = append(failures, fmt.Sprintf("%s failed the health check (%s)", u.GetName(), err))
+				continue
+			}
+		}
+		if err := p.EnableUnit(app, u); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, " ---> Unit %s is back\n", u.GetName())
+	}
+	if len(failures) > 0 {
+		return stderr.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// unitIps returns the IPs of the units, as reported by the provisioner, by
+// unit name. Units may get a new IP when restarted, and the IPs stored in the
+// database are updated only by the collector.
+func unitIps() map[string]string {
+	units, err := Provisioner.CollectStatus()
+	if err != nil {
+		log.Printf("Failed to get the IPs of the units: %s", err)
+		return nil
+	}
+	ips := make(map[string]string, len(units))
+	for _, u := range units {
+		if u.Ip != "" {
+			ips[u.Name] = u.Ip
+		}
+	}
+	return ips
+}
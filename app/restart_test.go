@@ -0,0 +1,158 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"github.com/globocom/tsuru/provision"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"strings"
+)
+
+func (s *S) TestRollingRestart(c *gocheck.C) {
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	a := App{
+		Name:  "rolling",
+		hooks: &conf{Healthcheck: h},
+		Units: []Unit{
+			{Name: "rolling/0", Ip: "127.0.0.1"},
+			{Name: "rolling/1", Ip: "127.0.0.1"},
+			{Name: "rolling/2", Ip: "127.0.0.1"},
+		},
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 2)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"rolling/0", "rolling/1", "rolling/2"})
+	for _, u := range a.ProvisionUnits() {
+		c.Assert(s.provisioner.Disabled(u), gocheck.Equals, false)
+	}
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 0)
+	out := buf.String()
+	c.Assert(strings.Contains(out, " ---> Restarting units rolling/0, rolling/1\n"), gocheck.Equals, true)
+	c.Assert(strings.Contains(out, " ---> Restarting units rolling/2\n"), gocheck.Equals, true)
+	c.Assert(strings.Contains(out, " ---> Unit rolling/2 is back\n"), gocheck.Equals, true)
+}
+
+// movingProvisioner reports the units of the app "moving" with the IP
+// 127.0.0.1, as if they got a new IP when restarted.
+type movingProvisioner struct {
+	*ttesting.FakeProvisioner
+}
+
+func (p movingProvisioner) CollectStatus() ([]provision.Unit, error) {
+	return []provision.Unit{
+		{Name: "moving/0", AppName: "moving", Ip: "127.0.0.1", Status: provision.StatusStarted},
+	}, nil
+}
+
+func (s *S) TestRollingRestartChecksTheNewIpOfTheUnits(c *gocheck.C) {
+	Provisioner = movingProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	a := App{
+		Name:  "moving",
+		hooks: &conf{Healthcheck: h},
+		Units: []Unit{{Name: "moving/0", Ip: "192.0.2.10"}},
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"moving/0"})
+	c.Assert(s.provisioner.Disabled(a.ProvisionUnits()[0]), gocheck.Equals, false)
+}
+
+func (s *S) TestRollingRestartDoesNotCheckWorkers(c *gocheck.C) {
+	a := App{
+		Name:  "rollworker",
+		hooks: &conf{Healthcheck: healthcheck{Path: "/healthcheck"}},
+		Units: []Unit{{Name: "rollworker/0", ProcessType: "worker"}},
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"rollworker/0"})
+	c.Assert(s.provisioner.Disabled(a.ProvisionUnits()[0]), gocheck.Equals, false)
+}
+
+func (s *S) TestRollingRestartAbortsWhenHealthcheckFails(c *gocheck.C) {
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	h.Timeout = -1
+	a := App{
+		Name:  "rollsick",
+		hooks: &conf{Healthcheck: h},
+		Units: []Unit{
+			{Name: "rollsick/0", Ip: "127.0.0.1"},
+			{Name: "rollsick/1", Ip: "127.0.0.1"},
+		},
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.ErrorMatches, `^rollsick/0 failed the health check \(.* returned status 503, expected 200\)$`)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"rollsick/0"})
+	units := a.ProvisionUnits()
+	c.Assert(s.provisioner.Disabled(units[0]), gocheck.Equals, true)
+	c.Assert(s.provisioner.Disabled(units[1]), gocheck.Equals, false)
+	c.Assert(strings.Contains(buf.String(), " ---> Rolling restart aborted: rollsick/0 failed the health check"), gocheck.Equals, true)
+}
+
+func (s *S) TestRollingRestartAbortsWhenUnitFailsToRestart(c *gocheck.C) {
+	h, server := healthcheckServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	a := App{
+		Name:  "rollfail",
+		hooks: &conf{Healthcheck: h},
+		Units: []Unit{
+			{Name: "rollfail/0", Ip: "127.0.0.1"},
+			{Name: "rollfail/1", Ip: "127.0.0.1"},
+			{Name: "rollfail/2", Ip: "127.0.0.1"},
+		},
+	}
+	s.provisioner.PrepareFailure("RestartUnit", errors.New("container is gone"))
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 2)
+	c.Assert(err, gocheck.ErrorMatches, `^rollfail/0 failed to restart \(container is gone\)$`)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"rollfail/1"})
+	units := a.ProvisionUnits()
+	c.Assert(s.provisioner.Disabled(units[0]), gocheck.Equals, true)
+	c.Assert(s.provisioner.Disabled(units[1]), gocheck.Equals, false)
+	c.Assert(s.provisioner.Disabled(units[2]), gocheck.Equals, false)
+}
+
+func (s *S) TestRollingRestartWithoutHealthcheck(c *gocheck.C) {
+	a := App{Name: "rollnocheck", hooks: &conf{}, Units: []Unit{{Name: "rollnocheck/0"}}}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.Equals, errNoHealthcheck)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestRollingRestartInvalidBatch(c *gocheck.C) {
+	a := App{Name: "rollbatch", hooks: &conf{Healthcheck: healthcheck{Path: "/"}}}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 0)
+	c.Assert(err, gocheck.Equals, errInvalidBatch)
+}
+
+func (s *S) TestRollingRestartProvisionerWithoutRollingSupport(c *gocheck.C) {
+	Provisioner = webOnlyProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "rollunsupported", hooks: &conf{Healthcheck: healthcheck{Path: "/"}}}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.Equals, errRollingRestartNotSupported)
+}
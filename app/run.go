@@ -0,0 +1,173 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"sync"
+)
+
+// runFailureStatus is the exit status reported for units in which the
+// command could not be executed (for example, when the unit is unreachable).
+const runFailureStatus = 255
+
+// RunTarget defines the units in which a command runs.
+type RunTarget struct {
+	// Unit is the name of the unit that runs the command. When empty, the
+	// command runs in all started units of the app.
+	Unit string
+
+	// Units limits the number of units that run the command. Zero means
+	// no limit.
+	Units int
+
+	// Parallel defines whether the command runs in all units at the same
+	// time, instead of one unit after the other.
+	Parallel bool
+}
+
+// RunResult is the result of running a command in a unit.
+type RunResult struct {
+	Unit     string
+	ExitCode int
+}
+
+// runUnits returns the units of the app that match the target.
+func (app *App) runUnits(target RunTarget) ([]provision.AppUnit, error) {
+	if target.Units < 0 {
+		return nil, &errors.ValidationError{Message: "The number of units must be positive."}
+	}
+	var units []provision.AppUnit
+	for _, u := range app.ProvisionUnits() {
+		if target.Unit != "" && u.GetName() != target.Unit {
+			continue
+		}
+		if u.GetStatus() != provision.StatusStarted {
+			if target.Unit != "" {
+				msg := fmt.Sprintf("The unit %q is not started.", target.Unit)
+				return nil, &errors.ValidationError{Message: msg}
+			}
+			continue
+		}
+		units = append(units, u)
+	}
+	if target.Unit != "" && len(units) == 0 {
+		msg := fmt.Sprintf("The app %q has no unit named %q.", app.Name, target.Unit)
+		return nil, &errors.ValidationError{Message: msg}
+	}
+	if len(units) == 0 {
+		return nil, &errors.ValidationError{Message: "The app has no started units."}
+	}
+	if target.Units > 0 && target.Units < len(units) {
+		units = units[:target.Units]
+	}
+	return units, nil
+}
+
+// RunOn executes the command in the target units of the app, sourcing apprc
+// before running the command. Each line of the output is prefixed by the
+// name of the unit that wrote it.
+//
+// It returns the exit status of the command in each unit. Provisioners that
+// are not UnitCommandExecutors can only run commands in all units, and in
+// this case the output is not prefixed and no result is returned.
+func (app *App) RunOn(cmd string, w io.Writer, target RunTarget) ([]RunResult, error) {
+	executor, ok := Provisioner.(provision.UnitCommandExecutor)
+	if !ok {
+		if target != (RunTarget{}) {
+			return nil, &errors.ValidationError{Message: "The provisioner can't run commands in specific units."}
+		}
+		return nil, app.Run(cmd, w)
+	}
+	if !app.Available() {
+		return nil, stderr.New("App must be available to run commands")
+	}
+	units, err := app.runUnits(target)
+	if err != nil {
+		return nil, err
+	}
+	app.Log(fmt.Sprintf("running '%s'", cmd), "tsuru")
+	cmd = runCommandLine(cmd)
+	var mut sync.Mutex
+	results := make([]RunResult, len(units))
+	run := func(i int, unit provision.AppUnit) {
+		pw := prefixWriter{w: w, mut: &mut, prefix: []byte(fmt.Sprintf("[%s] ", unit.GetName()))}
+		err := executor.ExecuteCommandOnUnit(&pw, &pw, app, unit, cmd)
+		results[i] = RunResult{Unit: unit.GetName()}
+		if e, ok := err.(*provision.ExitError); ok {
+			results[i].ExitCode = e.Status
+		} else if err != nil {
+			pw.Close()
+			fmt.Fprintf(&pw, "Failed to run the command: %s\n", err)
+			results[i].ExitCode = runFailureStatus
+		}
+		pw.Close()
+	}
+	var wg sync.WaitGroup
+	for i, unit := range units {
+		if !target.Parallel {
+			run(i, unit)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, unit provision.AppUnit) {
+			defer wg.Done()
+			run(i, unit)
+		}(i, unit)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// prefixWriter writes whole lines to the underlying writer, prefixing each
+// line. Incomplete lines are buffered until a line break is written or the
+// writer is closed. The mutex is shared by all writers of the same underlying
+// writer, so lines from different units are never mixed.
+type prefixWriter struct {
+	w      io.Writer
+	mut    *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	data := make([]byte, 0, len(p.prefix)+len(line))
+	data = append(data, p.prefix...)
+	data = append(data, line...)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	_, err := p.w.Write(data)
+	return err
+}
+
+// Close writes the buffered incomplete line, if any.
+func (p *prefixWriter) Close() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
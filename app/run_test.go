@@ -0,0 +1,190 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	tsuruErrors "github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func (s *S) TestRunOn(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("file1\nfile2\n"))
+	s.provisioner.PrepareOutput([]byte("file3"))
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/0"}, {Unit: "myapp/1"}})
+	c.Assert(buf.String(), gocheck.Equals, "[myapp/0] file1\n[myapp/0] file2\n[myapp/1] file3\n")
+	expected := "[ -f /home/application/apprc ] && source /home/application/apprc;"
+	expected += " [ -d /home/application/current ] && cd /home/application/current;"
+	expected += " ls"
+	cmds := s.provisioner.GetCmds(expected, &app)
+	c.Assert(cmds, gocheck.HasLen, 2)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "myapp/0")
+	c.Assert(cmds[1].Unit, gocheck.Equals, "myapp/1")
+}
+
+func (s *S) TestRunOnSkipsUnitsThatAreNotStarted(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "down"},
+			{Name: "myapp/1", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/1"}})
+}
+
+func (s *S) TestRunOnOneUnit(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{Unit: "myapp/1"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/1"}})
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "myapp/1")
+}
+
+func (s *S) TestRunOnNUnits(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "started"},
+			{Name: "myapp/2", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{Units: 2})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/0"}, {Unit: "myapp/1"}})
+}
+
+func (s *S) TestRunOnInParallel(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "started"},
+			{Name: "myapp/2", State: "started"},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		s.provisioner.PrepareOutput([]byte("line 1\nline 2\n"))
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{Parallel: true})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/0"}, {Unit: "myapp/1"}, {Unit: "myapp/2"}})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	c.Assert(lines, gocheck.DeepEquals, []string{
+		"[myapp/0] line 1", "[myapp/0] line 2",
+		"[myapp/1] line 1", "[myapp/1] line 2",
+		"[myapp/2] line 1", "[myapp/2] line 2",
+	})
+}
+
+func (s *S) TestRunOnExitCodes(c *gocheck.C) {
+	s.provisioner.PrepareFailure("ExecuteCommandOnUnit", &provision.ExitError{Status: 2})
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("false", &buf, RunTarget{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/0", ExitCode: 2}})
+}
+
+func (s *S) TestRunOnFailure(c *gocheck.C) {
+	s.provisioner.PrepareFailure("ExecuteCommandOnUnit", errors.New("connection refused"))
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+		},
+	}
+	var buf bytes.Buffer
+	results, err := app.RunOn("ls", &buf, RunTarget{})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(results, gocheck.DeepEquals, []RunResult{{Unit: "myapp/0", ExitCode: 255}})
+	c.Assert(buf.String(), gocheck.Equals, "[myapp/0] Failed to run the command: connection refused\n")
+}
+
+func (s *S) TestRunOnInvalidTargets(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "down"},
+		},
+	}
+	var tests = []struct {
+		target  RunTarget
+		message string
+	}{
+		{RunTarget{Unit: "myapp/9"}, `The app "myapp" has no unit named "myapp/9".`},
+		{RunTarget{Unit: "myapp/1"}, `The unit "myapp/1" is not started.`},
+		{RunTarget{Units: -1}, "The number of units must be positive."},
+	}
+	for _, t := range tests {
+		var buf bytes.Buffer
+		_, err := app.RunOn("ls", &buf, t.target)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*tsuruErrors.ValidationError)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
+func (s *S) TestRunOnAppNotAvailable(c *gocheck.C) {
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "down"}},
+	}
+	var buf bytes.Buffer
+	_, err := app.RunOn("ls", &buf, RunTarget{})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "App must be available to run commands")
+}
+
+func (s *S) TestPrefixWriter(c *gocheck.C) {
+	var buf bytes.Buffer
+	var mut sync.Mutex
+	w := prefixWriter{w: &buf, mut: &mut, prefix: []byte("[myapp/0] ")}
+	w.Write([]byte("first line\nsec"))
+	c.Assert(buf.String(), gocheck.Equals, "[myapp/0] first line\n")
+	w.Write([]byte("ond line\n\nthird"))
+	c.Assert(buf.String(), gocheck.Equals, "[myapp/0] first line\n[myapp/0] second line\n[myapp/0] \n")
+	err := w.Close()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "[myapp/0] first line\n[myapp/0] second line\n[myapp/0] \n[myapp/0] third\n")
+}
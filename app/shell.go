@@ -0,0 +1,48 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+)
+
+// shellCommand is the command that runs in interactive shells, after sourcing
+// apprc.
+const shellCommand = "exec ${SHELL:-/bin/bash}"
+
+var errShellNotSupported = &errors.ValidationError{Message: "The provisioner doesn't support interactive shells."}
+
+// ShellUnit returns the unit in which an interactive shell should be opened:
+// the unit with the given name, or the first started unit of the app when the
+// name is empty.
+func (app *App) ShellUnit(unitName string) (provision.AppUnit, error) {
+	if _, ok := Provisioner.(provision.ShellProvisioner); !ok {
+		return nil, errShellNotSupported
+	}
+	if !app.Available() {
+		return nil, stderr.New("App must be available to open shells")
+	}
+	units, err := app.runUnits(RunTarget{Unit: unitName, Units: 1})
+	if err != nil {
+		return nil, err
+	}
+	return units[0], nil
+}
+
+// Shell opens an interactive shell in the unit of the options (see ShellUnit),
+// sourcing apprc. It returns when the shell exits.
+func (app *App) Shell(opts provision.ShellOptions) error {
+	sheller, ok := Provisioner.(provision.ShellProvisioner)
+	if !ok {
+		return errShellNotSupported
+	}
+	opts.App = app
+	opts.Cmd = runCommandLine(shellCommand)
+	app.Log(fmt.Sprintf("opening a shell in the unit %s", opts.Unit.GetName()), "tsuru")
+	return sheller.Shell(opts)
+}
@@ -0,0 +1,87 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	tsuruErrors "github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+	"strings"
+)
+
+func (s *S) TestShellUnit(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "down"},
+			{Name: "myapp/1", State: "started"},
+			{Name: "myapp/2", State: "started"},
+		},
+	}
+	unit, err := app.ShellUnit("")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(unit.GetName(), gocheck.Equals, "myapp/1")
+	unit, err = app.ShellUnit("myapp/2")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(unit.GetName(), gocheck.Equals, "myapp/2")
+}
+
+func (s *S) TestShellUnitInvalidUnit(c *gocheck.C) {
+	app := App{
+		Name: "myapp",
+		Units: []Unit{
+			{Name: "myapp/0", State: "started"},
+			{Name: "myapp/1", State: "down"},
+		},
+	}
+	_, err := app.ShellUnit("myapp/1")
+	e, ok := err.(*tsuruErrors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `The unit "myapp/1" is not started.`)
+	_, err = app.ShellUnit("myapp/9")
+	e, ok = err.(*tsuruErrors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `The app "myapp" has no unit named "myapp/9".`)
+}
+
+func (s *S) TestShellUnitAppNotAvailable(c *gocheck.C) {
+	app := App{
+		Name:  "myapp",
+		Units: []Unit{{Name: "myapp/0", State: "down"}},
+	}
+	_, err := app.ShellUnit("")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "App must be available to open shells")
+}
+
+func (s *S) TestShell(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("$ "))
+	app := App{
+		Name:  "shellapp",
+		Units: []Unit{{Name: "shellapp/0", State: "started"}},
+	}
+	unit, err := app.ShellUnit("")
+	c.Assert(err, gocheck.IsNil)
+	var buf bytes.Buffer
+	opts := provision.ShellOptions{
+		Unit:   unit,
+		Stdin:  strings.NewReader("exit\n"),
+		Stdout: &buf,
+	}
+	err = app.Shell(opts)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "$ exit\n")
+	expected := "[ -f /home/application/apprc ] && source /home/application/apprc;"
+	expected += " [ -d /home/application/current ] && cd /home/application/current;"
+	expected += " exec ${SHELL:-/bin/bash}"
+	cmds := s.provisioner.GetCmds(expected, &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "shellapp/0")
+	logs, err := app.LastLogs(1, LogFilter{Source: "tsuru"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "opening a shell in the unit shellapp/0")
+}
@@ -6,6 +6,7 @@ package app
 
 import (
 	"github.com/globocom/tsuru/provision"
+	"time"
 )
 
 // Unit is the smaller bit in tsuru. Each app is composed of one or more units.
@@ -13,14 +14,28 @@ import (
 // The unit is equivalent to a machine. How the machine is actually represented
 // (baremetal, virtual machine, jails, containers, etc.) is up to the
 // provisioner.
+//
+// Each unit runs one of the process types of the app (web, worker, clock,
+// etc.). Only web units receive requests from the load balancer.
 type Unit struct {
-	Name       string
-	Type       string
-	Machine    int
-	InstanceId string
-	Ip         string
-	State      string
-	app        *App
+	Name        string
+	Type        string
+	ProcessType string
+	Machine     int
+	InstanceId  string
+	Ip          string
+	State       string
+
+	// Version is the id of the deploy that put the code running in the
+	// unit (see DeployData).
+	Version string
+
+	// HealthcheckFailures is the number of consecutive failed health
+	// checks of the unit, and HealthcheckError the error of the last one.
+	HealthcheckFailures int
+	HealthcheckError    string
+	LastHealthcheck     time.Time
+	app                 *App
 }
 
 func (u *Unit) GetName() string {
@@ -43,6 +58,15 @@ func (u *Unit) GetInstanceId() string {
 	return u.InstanceId
 }
 
+// GetProcessType returns the process type of the unit. Units created before
+// the introduction of process types are web units.
+func (u *Unit) GetProcessType() string {
+	if u.ProcessType == "" {
+		return provision.WebProcess
+	}
+	return u.ProcessType
+}
+
 // UnitSlice attaches the methods of sort.Interface to []Unit, sorting in increasing order.
 type UnitSlice []Unit
 
@@ -54,10 +78,12 @@ func (u UnitSlice) Less(i, j int) bool {
 	weight := map[string]int{
 		string(provision.StatusError):      0,
 		string(provision.StatusDown):       1,
-		string(provision.StatusPending):    2,
-		string(provision.StatusCreating):   3,
-		string(provision.StatusInstalling): 4,
-		string(provision.StatusStarted):    5,
+		string(provision.StatusUnhealthy):  2,
+		string(provision.StatusStopped):    3,
+		string(provision.StatusPending):    4,
+		string(provision.StatusCreating):   5,
+		string(provision.StatusInstalling): 6,
+		string(provision.StatusStarted):    7,
 	}
 	return weight[u[i].State] < weight[u[j].State]
 }
@@ -43,6 +43,13 @@ func (s *S) TestUnitGetStatus(c *gocheck.C) {
 	}
 }
 
+func (s *S) TestUnitGetProcessType(c *gocheck.C) {
+	u := Unit{Name: "abcdef"}
+	c.Assert(u.GetProcessType(), gocheck.Equals, provision.WebProcess)
+	u.ProcessType = "worker"
+	c.Assert(u.GetProcessType(), gocheck.Equals, "worker")
+}
+
 func (s *S) TestUnitShouldBeABinderUnit(c *gocheck.C) {
 	var _ bind.Unit = &Unit{}
 }
@@ -60,12 +67,15 @@ func (s *S) TestUnitSliceLess(c *gocheck.C) {
 		Unit{Name: "d", State: string(provision.StatusCreating)},
 		Unit{Name: "e", State: string(provision.StatusInstalling)},
 		Unit{Name: "f", State: string(provision.StatusStarted)},
+		Unit{Name: "g", State: string(provision.StatusStopped)},
 	}
 	c.Assert(units.Less(0, 1), gocheck.Equals, true)
 	c.Assert(units.Less(1, 2), gocheck.Equals, true)
 	c.Assert(units.Less(2, 3), gocheck.Equals, true)
 	c.Assert(units.Less(4, 5), gocheck.Equals, true)
 	c.Assert(units.Less(5, 0), gocheck.Equals, false)
+	c.Assert(units.Less(1, 6), gocheck.Equals, true)
+	c.Assert(units.Less(6, 2), gocheck.Equals, true)
 }
 
 func (s *S) TestUnitSliceSwap(c *gocheck.C) {
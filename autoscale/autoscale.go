@@ -0,0 +1,87 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autoscale provides an interface for sources of the metrics used to
+// scale apps automatically.
+package autoscale
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+)
+
+// Metrics are the average resource usage of the web units of an app.
+type Metrics struct {
+	// CPU and Memory are the percentages of CPU and memory used by the
+	// units.
+	CPU    float64
+	Memory float64
+
+	// Requests is the number of requests per second received by each unit.
+	Requests float64
+}
+
+// Names of the metrics, as used in autoscale rules.
+const (
+	CPU      = "cpu"
+	Memory   = "memory"
+	Requests = "requests"
+)
+
+// Value returns the value of the metric with the given name (cpu, memory or
+// requests). It returns false if the metric is unknown.
+func (m *Metrics) Value(metric string) (float64, bool) {
+	switch metric {
+	case CPU:
+		return m.CPU, true
+	case Memory:
+		return m.Memory, true
+	case Requests:
+		return m.Requests, true
+	}
+	return 0, false
+}
+
+// Source is a source of metrics of apps.
+type Source interface {
+	// Metrics returns the average resource usage of the web units of the
+	// app.
+	Metrics(app provision.App) (*Metrics, error)
+
+	// Provides indicates whether the source provides the metric with the
+	// given name.
+	Provides(metric string) bool
+}
+
+// DefaultSource is the name of the source used when the
+// autoscale:metrics-source setting is not defined. It's registered by the
+// app package, and uses the metrics stored by the collector.
+const DefaultSource = "tsuru"
+
+// SourceName returns the name of the source configured in the
+// autoscale:metrics-source setting, or DefaultSource.
+func SourceName() string {
+	name, err := config.GetString("autoscale:metrics-source")
+	if err != nil {
+		return DefaultSource
+	}
+	return name
+}
+
+var sources = make(map[string]Source)
+
+// Register registers a new source in the Source registry.
+func Register(name string, s Source) {
+	sources[name] = s
+}
+
+// Get gets the named source from the registry.
+func Get(name string) (Source, error) {
+	s, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown metrics source: %q.", name)
+	}
+	return s, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+type fakeSource struct{}
+
+func (fakeSource) Metrics(app provision.App) (*Metrics, error) {
+	return &Metrics{}, nil
+}
+
+func (fakeSource) Provides(metric string) bool {
+	return true
+}
+
+func (s *S) TestRegisterAndGetSource(c *gocheck.C) {
+	var src fakeSource
+	Register("my-source", src)
+	got, err := Get("my-source")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.DeepEquals, src)
+	_, err = Get("unknown-source")
+	c.Assert(err, gocheck.ErrorMatches, `Unknown metrics source: "unknown-source".`)
+}
+
+func (s *S) TestSourceName(c *gocheck.C) {
+	defer config.Unset("autoscale:metrics-source")
+	c.Assert(SourceName(), gocheck.Equals, DefaultSource)
+	config.Set("autoscale:metrics-source", "my-source")
+	c.Assert(SourceName(), gocheck.Equals, "my-source")
+}
+
+func (s *S) TestMetricsValue(c *gocheck.C) {
+	m := Metrics{CPU: 50.5, Memory: 20, Requests: 100}
+	var tests = []struct {
+		metric string
+		value  float64
+		ok     bool
+	}{
+		{CPU, 50.5, true},
+		{Memory, 20, true},
+		{Requests, 100, true},
+		{"disk", 0, false},
+	}
+	for _, t := range tests {
+		value, ok := m.Value(t.metric)
+		c.Check(value, gocheck.Equals, t.value)
+		c.Check(ok, gocheck.Equals, t.ok)
+	}
+}
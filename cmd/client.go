@@ -5,10 +5,14 @@
 package cmd
 
 import (
+	"bufio"
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 )
@@ -17,6 +21,13 @@ type Doer interface {
 	Do(request *http.Request) (*http.Response, error)
 }
 
+// Upgrader is a Doer that is also able to upgrade the connection of a
+// request to another protocol.
+type Upgrader interface {
+	Doer
+	Upgrade(request *http.Request, protocol string) (io.ReadWriteCloser, error)
+}
+
 type Client struct {
 	HttpClient     *http.Client
 	context        *Context
@@ -82,3 +93,67 @@ download the last version.
 	}
 	return response, nil
 }
+
+// Upgrade sends the request asking the server to upgrade the connection to
+// the given protocol, and returns the upgraded connection.
+func (c *Client) Upgrade(request *http.Request, protocol string) (io.ReadWriteCloser, error) {
+	if token, err := readToken(); err == nil {
+		request.Header.Set("Authorization", token)
+	}
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", protocol)
+	conn, err := c.dial(request.URL)
+	if err != nil {
+		return nil, c.detectClientError(&url.Error{Op: request.Method, URL: request.URL.String(), Err: err})
+	}
+	if err = request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		defer conn.Close()
+		defer response.Body.Close()
+		if response.StatusCode > 399 {
+			result, _ := ioutil.ReadAll(response.Body)
+			return nil, errors.New(string(result))
+		}
+		return nil, fmt.Errorf("The server did not upgrade the connection to %s.", protocol)
+	}
+	return &upgradedConn{Conn: conn, reader: reader}, nil
+}
+
+func (c *Client) dial(u *url.URL) (net.Conn, error) {
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if u.Scheme == "https" {
+			addr += ":443"
+		} else {
+			addr += ":80"
+		}
+	}
+	if u.Scheme != "https" {
+		return net.Dial("tcp", addr)
+	}
+	var config *tls.Config
+	if t, ok := c.HttpClient.Transport.(*http.Transport); ok {
+		config = t.TLSClientConfig
+	}
+	return tls.Dial("tcp", addr, config)
+}
+
+// upgradedConn is a connection upgraded to another protocol. Data sent by the
+// server right after the upgrade may be already buffered in the reader.
+type upgradedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *upgradedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -5,10 +5,13 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"github.com/globocom/tsuru/fs/testing"
+	"io"
 	"launchpad.net/gocheck"
 	"net/http"
+	"net/http/httptest"
 )
 
 func (s *S) TestShouldReturnBodyMessageOnError(c *gocheck.C) {
@@ -132,3 +135,58 @@ func (s *S) TestShouldSkupValidationIfServerDoesNotReturnSupportedHeader(c *goch
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(buf.String(), gocheck.Equals, "")
 }
+
+func (s *S) TestUpgrade(c *gocheck.C) {
+	fsystem = &testing.RecordingFs{FileContent: "mytoken"}
+	defer func() {
+		fsystem = nil
+	}()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || r.Header.Get("Authorization") != "mytoken" {
+			http.Error(w, "You must upgrade to echo.", http.StatusBadRequest)
+			return
+		}
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nhello "))
+		io.Copy(conn, buf)
+	}))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/echo", nil)
+	c.Assert(err, gocheck.IsNil)
+	client := NewClient(&http.Client{}, nil, manager)
+	conn, err := client.Upgrade(request, "echo")
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("world\n"))
+	c.Assert(err, gocheck.IsNil)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(line, gocheck.Equals, "hello world\n")
+}
+
+func (s *S) TestUpgradeReturnsBodyMessageOnError(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "App not found.", http.StatusNotFound)
+	}))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/echo", nil)
+	c.Assert(err, gocheck.IsNil)
+	client := NewClient(&http.Client{}, nil, manager)
+	_, err = client.Upgrade(request, "echo")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "App not found.\n")
+}
+
+func (s *S) TestUpgradeNotSupported(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/echo", nil)
+	c.Assert(err, gocheck.IsNil)
+	client := NewClient(&http.Client{}, nil, manager)
+	_, err = client.Upgrade(request, "echo")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "The server did not upgrade the connection to echo.")
+}
@@ -26,6 +26,16 @@ func (e osExiter) Exit(code int) {
 	os.Exit(code)
 }
 
+// ExitError is returned by commands that want the program to exit with the
+// given status. The manager doesn't print anything for these errors.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
 type Manager struct {
 	Commands      map[string]Command
 	name          string
@@ -111,7 +121,9 @@ func (m *Manager) Run(args []string) {
 	context := Context{args, m.stdout, m.stderr, m.stdin}
 	client := NewClient(&http.Client{}, &context, m)
 	err := command.Run(&context, client)
-	if err != nil {
+	if e, ok := err.(*ExitError); ok {
+		status = e.Code
+	} else if err != nil {
 		re := regexp.MustCompile(`^((Invalid token)|(You must provide the Authorization header))`)
 		errorMsg := err.Error()
 		if re.MatchString(errorMsg) {
@@ -52,6 +52,18 @@ func (c *ErrorCommand) Run(context *Context, client Doer) error {
 	return errors.New(c.msg)
 }
 
+type ExitCommand struct {
+	code int
+}
+
+func (c *ExitCommand) Info() *Info {
+	return &Info{Name: "exit"}
+}
+
+func (c *ExitCommand) Run(context *Context, client Doer) error {
+	return &ExitError{Code: c.code}
+}
+
 type CommandWithFlags struct {
 	fs      *gnuflag.FlagSet
 	age     int
@@ -94,6 +106,18 @@ func (s *S) TestManagerRunShouldReturnStatus1WhenCommandFail(c *gocheck.C) {
 	c.Assert(manager.e.(*recordingExiter).value(), gocheck.Equals, 1)
 }
 
+func (s *S) TestManagerRunWithExitError(c *gocheck.C) {
+	manager.Register(&ExitCommand{code: 3})
+	manager.Run([]string{"exit"})
+	c.Assert(manager.e.(*recordingExiter).value(), gocheck.Equals, 3)
+	c.Assert(manager.stderr.(*bytes.Buffer).String(), gocheck.Equals, "")
+}
+
+func (s *S) TestExitError(c *gocheck.C) {
+	var err error = &ExitError{Code: 2}
+	c.Assert(err.Error(), gocheck.Equals, "exit status 2")
+}
+
 func (s *S) TestManagerRunShouldAppendNewLineOnErrorWhenItsNotPresent(c *gocheck.C) {
 	manager.Register(&ErrorCommand{msg: "You are wrong"})
 	manager.Run([]string{"error"})
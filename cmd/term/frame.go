@@ -0,0 +1,152 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package term
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ShellProtocol is the protocol used in the upgraded connections of
+// interactive shells.
+//
+// After the upgrade, the client and the server exchange frames. Each frame
+// has one byte with its type, four bytes with the length of its payload (big
+// endian) and the payload.
+const ShellProtocol = "tsuru-shell"
+
+// Types of frames.
+const (
+	// FrameData carries input (from the client) or output (from the
+	// server) of the shell.
+	FrameData byte = 'd'
+
+	// FrameResize is sent by the client when its terminal is resized. The
+	// payload has the number of columns and rows, as two 16 bits integers.
+	FrameResize byte = 'r'
+
+	// FrameExit is the last frame sent by the server. The payload has the
+	// exit status of the shell, as a 32 bits integer.
+	FrameExit byte = 'x'
+)
+
+// MaxFrameSize is the maximum size of the payload of a frame.
+const MaxFrameSize = 32 * 1024
+
+var (
+	ErrFrameTooLarge  = errors.New("term: frame too large")
+	ErrInvalidPayload = errors.New("term: invalid frame payload")
+)
+
+// Frame is a message exchanged by clients and servers of interactive shells.
+type Frame struct {
+	Type    byte
+	Payload []byte
+}
+
+// Size returns the number of columns and rows in a FrameResize.
+func (f *Frame) Size() (width, height int, err error) {
+	if f.Type != FrameResize || len(f.Payload) != 4 {
+		return 0, 0, ErrInvalidPayload
+	}
+	width = int(binary.BigEndian.Uint16(f.Payload))
+	height = int(binary.BigEndian.Uint16(f.Payload[2:]))
+	return width, height, nil
+}
+
+// Status returns the exit status in a FrameExit.
+func (f *Frame) Status() (int, error) {
+	if f.Type != FrameExit || len(f.Payload) != 4 {
+		return 0, ErrInvalidPayload
+	}
+	return int(int32(binary.BigEndian.Uint32(f.Payload))), nil
+}
+
+// ReadFrame reads the next frame from r.
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	f := Frame{Type: header[0], Payload: make([]byte, size)}
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &f, nil
+}
+
+// WriteFrame writes the frame to w.
+func WriteFrame(w io.Writer, f *Frame) error {
+	if len(f.Payload) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	data := make([]byte, 5+len(f.Payload))
+	data[0] = f.Type
+	binary.BigEndian.PutUint32(data[1:], uint32(len(f.Payload)))
+	copy(data[5:], f.Payload)
+	_, err := w.Write(data)
+	return err
+}
+
+// ResizeFrame returns a FrameResize with the given number of columns and
+// rows.
+func ResizeFrame(width, height int) *Frame {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint16(payload, uint16(width))
+	binary.BigEndian.PutUint16(payload[2:], uint16(height))
+	return &Frame{Type: FrameResize, Payload: payload}
+}
+
+// ExitFrame returns a FrameExit with the given exit status.
+func ExitFrame(status int) *Frame {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(int32(status)))
+	return &Frame{Type: FrameExit, Payload: payload}
+}
+
+// FrameWriter sends everything written to it in FrameData frames. It's safe
+// for concurrent use, and the underlying writer must be written only through
+// the FrameWriter, so frames are never mixed.
+type FrameWriter struct {
+	w   io.Writer
+	mut sync.Mutex
+}
+
+// NewFrameWriter returns a FrameWriter that writes to w.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+func (fw *FrameWriter) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		size := len(b)
+		if size > MaxFrameSize {
+			size = MaxFrameSize
+		}
+		if err := fw.WriteFrame(&Frame{Type: FrameData, Payload: b[:size]}); err != nil {
+			return n, err
+		}
+		n += size
+		b = b[size:]
+	}
+	return n, nil
+}
+
+// WriteFrame writes the frame to the underlying writer.
+func (fw *FrameWriter) WriteFrame(f *Frame) error {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	return WriteFrame(fw.w, f)
+}
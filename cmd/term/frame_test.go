@@ -0,0 +1,80 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package term
+
+import (
+	"bytes"
+	"io"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+func (s *S) TestWriteAndReadFrame(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := WriteFrame(&buf, &Frame{Type: FrameData, Payload: []byte("ls\n")})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.Bytes(), gocheck.DeepEquals, []byte{'d', 0, 0, 0, 3, 'l', 's', '\n'})
+	f, err := ReadFrame(&buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(f.Type, gocheck.Equals, FrameData)
+	c.Assert(string(f.Payload), gocheck.Equals, "ls\n")
+	_, err = ReadFrame(&buf)
+	c.Assert(err, gocheck.Equals, io.EOF)
+}
+
+func (s *S) TestReadFrameTruncated(c *gocheck.C) {
+	buf := bytes.NewBuffer([]byte{'d', 0, 0, 0, 3, 'l'})
+	_, err := ReadFrame(buf)
+	c.Assert(err, gocheck.Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *S) TestReadFrameTooLarge(c *gocheck.C) {
+	buf := bytes.NewBuffer([]byte{'d', 0, 1, 0, 0})
+	_, err := ReadFrame(buf)
+	c.Assert(err, gocheck.Equals, ErrFrameTooLarge)
+}
+
+func (s *S) TestResizeFrame(c *gocheck.C) {
+	f := ResizeFrame(120, 40)
+	c.Assert(f.Type, gocheck.Equals, FrameResize)
+	width, height, err := f.Size()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(width, gocheck.Equals, 120)
+	c.Assert(height, gocheck.Equals, 40)
+	_, _, err = ExitFrame(0).Size()
+	c.Assert(err, gocheck.Equals, ErrInvalidPayload)
+}
+
+func (s *S) TestExitFrame(c *gocheck.C) {
+	f := ExitFrame(127)
+	c.Assert(f.Type, gocheck.Equals, FrameExit)
+	status, err := f.Status()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(status, gocheck.Equals, 127)
+	_, err = ResizeFrame(80, 24).Status()
+	c.Assert(err, gocheck.Equals, ErrInvalidPayload)
+}
+
+func (s *S) TestFrameWriterSplitsLargeWrites(c *gocheck.C) {
+	var buf bytes.Buffer
+	w := NewFrameWriter(&buf)
+	data := bytes.Repeat([]byte("a"), MaxFrameSize+10)
+	n, err := w.Write(data)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, len(data))
+	f, err := ReadFrame(&buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(f.Payload, gocheck.HasLen, MaxFrameSize)
+	f, err = ReadFrame(&buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(f.Payload, gocheck.HasLen, 10)
+	c.Assert(f.Type, gocheck.Equals, FrameData)
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package term
+
+import (
+	"github.com/globocom/tsuru/pty"
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, e := syscall.Syscall6(syscall.SYS_IOCTL, fd, request, arg, 0, 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// IsTerminal returns whether the given file descriptor is a terminal.
+func IsTerminal(fd uintptr) bool {
+	var termios Termios
+	return ioctl(fd, TCGETS, uintptr(unsafe.Pointer(&termios))) == nil
+}
+
+// MakeRaw puts the terminal in raw mode, returning its previous state, that
+// should be restored with Restore.
+func MakeRaw(fd uintptr) (*Termios, error) {
+	var oldState Termios
+	if err := ioctl(fd, TCGETS, uintptr(unsafe.Pointer(&oldState))); err != nil {
+		return nil, err
+	}
+	termios := oldState
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, TCSETS, uintptr(unsafe.Pointer(&termios))); err != nil {
+		return nil, err
+	}
+	return &oldState, nil
+}
+
+// Restore restores the state of the terminal, returned by MakeRaw.
+func Restore(fd uintptr, state *Termios) error {
+	return ioctl(fd, TCSETS, uintptr(unsafe.Pointer(state)))
+}
+
+// GetSize returns the number of columns and rows of the terminal.
+func GetSize(fd uintptr) (width, height int, err error) {
+	return pty.GetSize(fd)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/globocom/tsuru/cmd"
 	"io"
 	"io/ioutil"
+	"launchpad.net/gnuflag"
 	"net/http"
 	"strings"
 )
@@ -58,19 +59,21 @@ func (c *AppInfo) Run(context *cmd.Context, client cmd.Doer) error {
 }
 
 type unit struct {
-	Name  string
-	Ip    string
-	State string
+	Name             string
+	Ip               string
+	State            string
+	HealthcheckError string
 }
 
 type app struct {
-	Ip         string
-	CName      string
-	Name       string
-	Framework  string
-	Repository string
-	Teams      []string
-	Units      []unit
+	Ip          string
+	CName       string
+	Name        string
+	Framework   string
+	Repository  string
+	Teams       []string
+	Units       []unit
+	Maintenance bool
 }
 
 func (a *app) Addr() string {
@@ -90,13 +93,20 @@ Address: %s
 	teams := strings.Join(a.Teams, ", ")
 	units := cmd.NewTable()
 	units.Headers = cmd.Row([]string{"Unit", "State"})
+	var unhealthy string
 	for _, unit := range a.Units {
 		units.AddRow(cmd.Row([]string{unit.Name, unit.State}))
+		if unit.State == "unhealthy" {
+			unhealthy += fmt.Sprintf("Unit %s failed the health check: %s\n", unit.Name, unit.HealthcheckError)
+		}
 	}
 	args := []interface{}{a.Name, a.Repository, a.Framework, teams, a.Addr()}
+	if a.Maintenance {
+		format += "Maintenance: on\n"
+	}
 	if len(a.Units) > 0 {
-		format += "Units:\n%s"
-		args = append(args, units)
+		format += "Units:\n%s%s"
+		args = append(args, units, unhealthy)
 	}
 	return fmt.Sprintf(format, args...)
 }
@@ -244,6 +254,8 @@ func (c AppList) Info() *cmd.Info {
 
 type AppRestart struct {
 	GuessingCommand
+	rolling int
+	fs      *gnuflag.FlagSet
 }
 
 func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
@@ -251,7 +263,11 @@ func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/restart", appName))
+	path := fmt.Sprintf("/apps/%s/restart", appName)
+	if c.rolling > 0 {
+		path += fmt.Sprintf("?rolling=%d", c.rolling)
+	}
+	url, err := cmd.GetUrl(path)
 	if err != nil {
 		return err
 	}
@@ -274,14 +290,89 @@ func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
 func (c *AppRestart) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "restart",
-		Usage: "restart [--app appname]",
+		Usage: "restart [--app appname] [--rolling batch]",
 		Desc: `restarts an app.
 
+With --rolling, units are restarted in batches of the given size: each batch
+is taken out of the router while it restarts, and put back once it passes the
+health check declared in app.conf. The restart is aborted if a batch fails.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppRestart) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.IntVar(&c.rolling, "rolling", 0, "restart the units in batches of the given size, checking their health")
+	}
+	return c.fs
+}
+
+type AppStop struct {
+	GuessingCommand
+}
+
+func (c *AppStop) Run(context *cmd.Context, client cmd.Doer) error {
+	return runAppAction(&c.GuessingCommand, "stop", context, client)
+}
+
+func (c *AppStop) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-stop",
+		Usage: "app-stop [--app appname]",
+		Desc: `stops an app, keeping its units and configuration. Use app-start to
+start it again.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+type AppStart struct {
+	GuessingCommand
+}
+
+func (c *AppStart) Run(context *cmd.Context, client cmd.Doer) error {
+	return runAppAction(&c.GuessingCommand, "start", context, client)
+}
+
+func (c *AppStart) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-start",
+		Usage: "app-start [--app appname]",
+		Desc: `starts an app stopped by app-stop.
+
 If you don't provide the app name, tsuru will try to guess it.`,
 		MinArgs: 0,
 	}
 }
 
+// runAppAction sends the given action (stop or start) to the app, copying the
+// output of the server to the standard output.
+func runAppAction(g *GuessingCommand, action string, context *cmd.Context, client cmd.Doer) error {
+	appName, err := g.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/%s", appName, action))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
 type SetCName struct {
 	GuessingCommand
 }
@@ -57,6 +57,59 @@ Units:
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestAppInfoInMaintenance(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","CName":"","Ip":"myapp.tsuru.io","Framework":"php","Repository":"git@git.com:php.git","Maintenance":true,"Units":[],"Teams":["tsuruteam"]}`
+	expected := `Application: app1
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Address: myapp.tsuru.io
+Maintenance: on
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppInfoWithUnhealthyUnits(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","CName":"","Ip":"myapp.tsuru.io","Framework":"php","Repository":"git@git.com:php.git","Units":[{"Ip":"10.10.10.10","Name":"app1/0","State":"started"}, {"Ip":"9.9.9.9","Name":"app1/1","State":"unhealthy","HealthcheckError":"connection refused"}],"Teams":["tsuruteam"]}`
+	expected := `Application: app1
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Address: myapp.tsuru.io
+Units:
++--------+-----------+
+| Unit   | State     |
++--------+-----------+
+| app1/0 | started   |
+| app1/1 | unhealthy |
++--------+-----------+
+Unit app1/1 failed the health check: connection refused
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
 func (s *S) TestAppInfoNoUnits(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	result := `{"Name":"app1","Ip":"app1.tsuru.io","Framework":"php","Repository":"git@git.com:php.git","State":"dead", "Units":[],"Teams":["tsuruteam","crane"]}`
@@ -418,19 +471,155 @@ func (s *S) TestAppRestartWithoutTheFlag(c *gocheck.C) {
 func (s *S) TestAppRestartInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:  "restart",
-		Usage: "restart [--app appname]",
+		Usage: "restart [--app appname] [--rolling batch]",
 		Desc: `restarts an app.
 
+With --rolling, units are restarted in batches of the given size: each batch
+is taken out of the router while it restarts, and put back once it passes the
+health check declared in app.conf. The restart is aborted if a batch fails.
+
 If you don't provide the app name, tsuru will try to guess it.`,
 		MinArgs: 0,
 	}
 	c.Assert((&AppRestart{}).Info(), gocheck.DeepEquals, expected)
 }
 
+func (s *S) TestAppRestartRolling(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{
+			msg:    "Restarted",
+			status: http.StatusOK,
+		},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/handful_of_nothing/restart" &&
+				req.URL.Query().Get("rolling") == "2" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--app", "handful_of_nothing", "--rolling", "2"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Restarted")
+}
+
+func (s *S) TestAppRestartFlags(c *gocheck.C) {
+	command := AppRestart{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"--rolling", "3"})
+	rolling := flagset.Lookup("rolling")
+	c.Assert(rolling, gocheck.NotNil)
+	c.Assert(rolling.Name, gocheck.Equals, "rolling")
+	c.Assert(rolling.Value.String(), gocheck.Equals, "3")
+	c.Assert(rolling.DefValue, gocheck.Equals, "0")
+	c.Assert(command.rolling, gocheck.Equals, 3)
+}
+
 func (s *S) TestAppRestartIsAFlaggedCommand(c *gocheck.C) {
 	var _ cmd.FlaggedCommand = &AppRestart{}
 }
 
+func (s *S) TestAppStop(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{
+			msg:    "Stopped",
+			status: http.StatusOK,
+		},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/handful_of_nothing/stop" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppStop{}
+	command.Flags().Parse(true, []string{"--app", "handful_of_nothing"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Stopped")
+}
+
+func (s *S) TestAppStopInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-stop",
+		Usage: "app-stop [--app appname]",
+		Desc: `stops an app, keeping its units and configuration. Use app-start to
+start it again.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppStop{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppStopIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppStop{}
+}
+
+func (s *S) TestAppStart(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{
+			msg:    "Started",
+			status: http.StatusOK,
+		},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/motorbreath/start" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "motorbreath"}
+	command := AppStart{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Started")
+}
+
+func (s *S) TestAppStartInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-start",
+		Usage: "app-start [--app appname]",
+		Desc: `starts an app stopped by app-stop.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppStart{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppStartIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppStart{}
+}
+
 func (s *S) TestSetCName(c *gocheck.C) {
 	var (
 		called         bool
@@ -0,0 +1,129 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+)
+
+type autoScale struct {
+	MinUnits  uint
+	MaxUnits  uint
+	Metric    string
+	ScaleUp   float64
+	ScaleDown float64
+	Cooldown  int
+}
+
+type AutoScaleSet struct {
+	GuessingCommand
+	rule autoScale
+	fs   *gnuflag.FlagSet
+}
+
+func (c *AutoScaleSet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "autoscale-set",
+		Usage: "autoscale-set --min units --max units --metric <cpu|memory> --up threshold --down threshold [--cooldown seconds] [--app appname]",
+		Desc: `sets the autoscale rule of an app.
+
+tsuru keeps the number of web units of the app between --min and --max,
+adding one unit when the metric is above the --up threshold and removing one
+unit when it's below the --down threshold. The cpu and memory metrics are
+percentages, averaged over the web units of the app. After scaling the app,
+tsuru waits at least --cooldown seconds before scaling it again.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AutoScaleSet) Run(context *cmd.Context, client cmd.Doer) error {
+	set := make(map[string]bool)
+	c.Flags().Visit(func(f *gnuflag.Flag) { set[f.Name] = true })
+	if !set["up"] || !set["down"] {
+		return errors.New("The --up and --down thresholds are required.")
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/autoscale", appName))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(c.rule)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, "Autoscale rule of the app %q set: %d to %d units, scaling on %s.\n", appName, c.rule.MinUnits, c.rule.MaxUnits, c.rule.Metric)
+	return nil
+}
+
+func (c *AutoScaleSet) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.UintVar(&c.rule.MinUnits, "min", 1, "the minimum number of web units")
+		c.fs.UintVar(&c.rule.MaxUnits, "max", 1, "the maximum number of web units")
+		c.fs.StringVar(&c.rule.Metric, "metric", "cpu", "the metric that drives the scaling: cpu or memory")
+		c.fs.Float64Var(&c.rule.ScaleUp, "up", 0, "the value of the metric above which a unit is added")
+		c.fs.Float64Var(&c.rule.ScaleDown, "down", 0, "the value of the metric below which a unit is removed")
+		c.fs.IntVar(&c.rule.Cooldown, "cooldown", 300, "the minimum number of seconds between two scaling actions")
+	}
+	return c.fs
+}
+
+type AutoScaleUnset struct {
+	GuessingCommand
+}
+
+func (c *AutoScaleUnset) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "autoscale-unset",
+		Usage: "autoscale-unset [--app appname]",
+		Desc: `removes the autoscale rule of an app. The number of units of the app is not
+changed.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AutoScaleUnset) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/autoscale", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, "Autoscale rule of the app %q removed.\n", appName)
+	return nil
+}
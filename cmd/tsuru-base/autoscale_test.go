@@ -0,0 +1,98 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestAutoScaleSetInfo(c *gocheck.C) {
+	info := (&AutoScaleSet{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "autoscale-set")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestAutoScaleSet(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var rule autoScale
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			json.NewDecoder(req.Body).Decode(&rule)
+			return req.URL.Path == "/apps/cobra/autoscale" && req.Method == "PUT"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AutoScaleSet{}
+	command.Flags().Parse(true, []string{"--app", "cobra", "--min", "2", "--max", "6", "--metric", "memory", "--up", "80", "--down", "20.5"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Autoscale rule of the app \"cobra\" set: 2 to 6 units, scaling on memory.\n")
+	expected := autoScale{MinUnits: 2, MaxUnits: 6, Metric: "memory", ScaleUp: 80, ScaleDown: 20.5, Cooldown: 300}
+	c.Assert(rule, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAutoScaleSetRequiresTheThresholds(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool { return false },
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var tests = [][]string{
+		{"--app", "cobra", "--min", "2", "--max", "6"},
+		{"--app", "cobra", "--min", "2", "--max", "6", "--up", "80"},
+		{"--app", "cobra", "--min", "2", "--max", "6", "--down", "20"},
+	}
+	for _, args := range tests {
+		command := AutoScaleSet{}
+		command.Flags().Parse(true, args)
+		err := command.Run(&context, client)
+		c.Check(err, gocheck.ErrorMatches, "The --up and --down thresholds are required.")
+	}
+	c.Assert(stdout.String(), gocheck.Equals, "")
+}
+
+func (s *S) TestAutoScaleSetIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AutoScaleSet{}
+}
+
+func (s *S) TestAutoScaleUnsetInfo(c *gocheck.C) {
+	info := (&AutoScaleUnset{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "autoscale-unset")
+	c.Assert(info.Usage, gocheck.Equals, "autoscale-unset [--app appname]")
+}
+
+func (s *S) TestAutoScaleUnset(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/cobra/autoscale" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AutoScaleUnset{}
+	command.Flags().Parse(true, []string{"--app", "cobra"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Autoscale rule of the app \"cobra\" removed.\n")
+}
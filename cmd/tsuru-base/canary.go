@@ -0,0 +1,113 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type canaryStats struct {
+	Requests int
+	Errors   int
+}
+
+// errorRate returns the percentage of requests that failed.
+func (s canaryStats) errorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) * 100 / float64(s.Requests)
+}
+
+type canaryReport struct {
+	Version string
+	Share   int
+	Units   []string
+	Canary  canaryStats
+	Stable  canaryStats
+}
+
+type AppCanary struct {
+	GuessingCommand
+}
+
+func (c *AppCanary) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-canary",
+		Usage: "app-canary <status|promote|abort> [--app appname]",
+		Desc: `manages the canary release of an app, deployed with deploy --canary.
+
+"status" shows the error rate (responses with status 5xx) of the canary units
+and of the other units of the app, as reported by the router. "promote"
+deploys the code of the canary in all units of the app and removes the canary
+units, while "abort" just removes the canary units. In both cases, the
+requests are routed evenly to the units of the app again.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppCanary) Run(context *cmd.Context, client cmd.Doer) error {
+	var method, path string
+	switch context.Args[0] {
+	case "status":
+		method = "GET"
+	case "promote":
+		method, path = "POST", "/promote"
+	case "abort":
+		method = "DELETE"
+	default:
+		return errors.New(`Invalid action. Use "status", "promote" or "abort".`)
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/canary%s", appName, path))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if method != "GET" {
+		_, err = io.Copy(context.Stdout, response.Body)
+		return err
+	}
+	var report canaryReport
+	if err = json.NewDecoder(response.Body).Decode(&report); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Canary %s of the app %q: %d%% of the requests.\n", report.Version, appName, report.Share)
+	fmt.Fprintf(context.Stdout, "Canary units: %s\n\n", strings.Join(report.Units, ", "))
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Units", "Requests", "Errors", "Error rate"})
+	for _, row := range []struct {
+		name  string
+		stats canaryStats
+	}{{"canary", report.Canary}, {"stable", report.Stable}} {
+		table.AddRow(cmd.Row([]string{
+			row.name,
+			fmt.Sprint(row.stats.Requests),
+			fmt.Sprint(row.stats.Errors),
+			fmt.Sprintf("%.2f%%", row.stats.errorRate()),
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
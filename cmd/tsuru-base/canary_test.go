@@ -0,0 +1,111 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestAppCanaryInfo(c *gocheck.C) {
+	info := (&AppCanary{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-canary")
+	c.Assert(info.Usage, gocheck.Equals, "app-canary <status|promote|abort> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestAppCanaryStatus(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"Version":"5204d1a0","Share":10,"Units":["sparrow/3"],"Canary":{"Requests":20,"Errors":5},"Stable":{"Requests":80,"Errors":0}}`
+	expected := `Canary 5204d1a0 of the app "sparrow": 10% of the requests.
+Canary units: sparrow/3
+
++--------+----------+--------+------------+
+| Units  | Requests | Errors | Error rate |
++--------+----------+--------+------------+
+| canary | 20       | 5      | 25.00%     |
+| stable | 80       | 0      | 0.00%      |
++--------+----------+--------+------------+
+`
+	context := cmd.Context{
+		Args:   []string{"status"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/canary" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppCanary{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppCanaryPromote(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"promote"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "Canary promoted!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/canary/promote" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppCanary{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Canary promoted!")
+}
+
+func (s *S) TestAppCanaryAbort(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"abort"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "Canary aborted!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/canary" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppCanary{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Canary aborted!")
+}
+
+func (s *S) TestAppCanaryInvalidAction(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"release"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{status: http.StatusOK}}, nil, manager)
+	command := AppCanary{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.ErrorMatches, `Invalid action. Use "status", "promote" or "abort".`)
+}
+
+func (s *S) TestAppCanaryIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppCanary{}
+}
@@ -0,0 +1,190 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type AppCopy struct{}
+
+func (c *AppCopy) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-cp",
+		Usage: "app-cp <source> <destination>",
+		Desc: `copies files to and from the units of an app.
+
+One of the paths must be in a unit of an app, in the format
+<appname>:<unitname>:<path>. If the unit name is omitted (<appname>::<path>),
+the first started unit of the app is used. Relative paths in the unit are
+relative to the directory of the app.
+
+The source, a file or a directory, is copied into the destination directory,
+which is created if it doesn't exist.`,
+		MinArgs: 2,
+	}
+}
+
+// unitPath is a path in a unit of an app.
+type unitPath struct {
+	app  string
+	unit string
+	path string
+}
+
+// parseUnitPath parses a path in the format <appname>:<unitname>:<path>.
+func parseUnitPath(value string) (unitPath, bool) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return unitPath{}, false
+	}
+	return unitPath{app: parts[0], unit: parts[1], path: parts[2]}, true
+}
+
+func (p unitPath) url() (string, error) {
+	query := url.Values{}
+	query.Set("path", p.path)
+	if p.unit != "" {
+		query.Set("unit", p.unit)
+	}
+	return cmd.GetUrl(fmt.Sprintf("/apps/%s/files?%s", p.app, query.Encode()))
+}
+
+func (c *AppCopy) Run(context *cmd.Context, client cmd.Doer) error {
+	src, srcInUnit := parseUnitPath(context.Args[0])
+	dst, dstInUnit := parseUnitPath(context.Args[1])
+	if srcInUnit == dstInUnit {
+		return errors.New("One of the paths must be in a unit of an app, in the format <appname>:<unitname>:<path>.")
+	}
+	if srcInUnit {
+		return c.download(src, context.Args[1], client)
+	}
+	return c.upload(context.Args[0], dst, client)
+}
+
+func (c *AppCopy) upload(src string, dst unitPath, client cmd.Doer) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	u, err := dst.url()
+	if err != nil {
+		return err
+	}
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeArchive(w, src, filepath.Base(src), false))
+	}()
+	defer r.Close()
+	request, err := http.NewRequest("POST", u, r)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-gzip")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (c *AppCopy) download(src unitPath, dst string, client cmd.Doer) error {
+	u, err := src.url()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err = extractArchive(response.Body, dst); err != nil {
+		return fmt.Errorf("Failed to copy the files: %s", err)
+	}
+	return nil
+}
+
+// extractArchive extracts the gzipped tar archive in the directory dir,
+// creating it if needed. Entries outside the directory are rejected, and
+// symbolic links are created only after all files are extracted, so files are
+// never written through them. Empty
+// archives are rejected.
+func extractArchive(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var links []*tar.Header
+	var entries int
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			if entries == 0 {
+				return errors.New("the archive is empty")
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid file in the archive: %s", header.Name)
+		}
+		entries++
+		target := filepath.Join(dir, name)
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(tr, target, mode)
+		case tar.TypeSymlink:
+			header.Name = target
+			links = append(links, header)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, header := range links {
+		if err = os.Symlink(header.Linkname, header.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
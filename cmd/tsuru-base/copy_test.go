@@ -0,0 +1,173 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+func (s *S) TestAppCopyInfo(c *gocheck.C) {
+	info := (&AppCopy{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-cp")
+	c.Assert(info.Usage, gocheck.Equals, "app-cp <source> <destination>")
+	c.Assert(info.MinArgs, gocheck.Equals, 2)
+}
+
+func (s *S) TestParseUnitPath(c *gocheck.C) {
+	var tests = []struct {
+		input    string
+		expected unitPath
+		ok       bool
+	}{
+		{"sparrow:sparrow/0:/tmp/log", unitPath{"sparrow", "sparrow/0", "/tmp/log"}, true},
+		{"sparrow::log", unitPath{"sparrow", "", "log"}, true},
+		{"sparrow::c:d", unitPath{"sparrow", "", "c:d"}, true},
+		{"/tmp/log", unitPath{}, false},
+		{"sparrow:log", unitPath{}, false},
+		{"::log", unitPath{}, false},
+	}
+	for _, t := range tests {
+		p, ok := parseUnitPath(t.input)
+		c.Check(ok, gocheck.Equals, t.ok)
+		c.Check(p, gocheck.Equals, t.expected)
+	}
+}
+
+func (s *S) TestAppCopyUpload(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "static")
+	err = os.MkdirAll(src, 0755)
+	c.Assert(err, gocheck.IsNil)
+	err = ioutil.WriteFile(filepath.Join(src, "app.css"), []byte("body {}"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	var (
+		files          map[string]string
+		stdout, stderr bytes.Buffer
+	)
+	trans := &conditionalTransport{
+		transport{status: http.StatusOK},
+		func(req *http.Request) bool {
+			files = make(map[string]string)
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				return false
+			}
+			tr := tar.NewReader(gz)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return false
+				}
+				content, _ := ioutil.ReadAll(tr)
+				files[header.Name] = string(content)
+			}
+			return req.URL.Path == "/apps/sparrow/files" && req.Method == "POST" &&
+				req.URL.Query().Get("unit") == "sparrow/0" &&
+				req.URL.Query().Get("path") == "public" &&
+				req.Header.Get("Content-Type") == "application/x-gzip"
+		},
+	}
+	context := cmd.Context{
+		Args:   []string{src, "sparrow:sparrow/0:public"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err = (&AppCopy{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{
+		"static/":        "",
+		"static/app.css": "body {}",
+	}
+	c.Assert(files, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppCopyDownload(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "log", Mode: 0755, Typeflag: tar.TypeDir})
+	tw.WriteHeader(&tar.Header{Name: "log/app.log", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hello"))
+	tw.Close()
+	gz.Close()
+	var stdout, stderr bytes.Buffer
+	trans := &conditionalTransport{
+		transport{msg: buf.String(), status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/files" && req.Method == "GET" &&
+				req.URL.Query().Get("unit") == "" &&
+				req.URL.Query().Get("path") == "log"
+		},
+	}
+	dst := filepath.Join(dir, "logs")
+	context := cmd.Context{
+		Args:   []string{"sparrow::log", dst},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err = (&AppCopy{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(dst, "log", "app.log"))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(content), gocheck.Equals, "hello")
+}
+
+func (s *S) TestAppCopyRequiresOneUnitPath(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	expected := "One of the paths must be in a unit of an app, in the format <appname>:<unitname>:<path>."
+	for _, args := range [][]string{{"a", "b"}, {"sparrow::a", "sparrow::b"}} {
+		context := cmd.Context{Args: args, Stdout: &stdout, Stderr: &stderr}
+		err := (&AppCopy{}).Run(&context, nil)
+		c.Check(err, gocheck.ErrorMatches, expected)
+	}
+}
+
+func (s *S) TestExtractArchiveRejectsFilesOutsideTheDirectory(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("evil"))
+	tw.Close()
+	gz.Close()
+	err = extractArchive(&buf, filepath.Join(dir, "dst"))
+	c.Assert(err, gocheck.ErrorMatches, `invalid file in the archive: \.\./evil`)
+	_, err = os.Stat(filepath.Join(dir, "evil"))
+	c.Assert(os.IsNotExist(err), gocheck.Equals, true)
+}
+
+func (s *S) TestExtractArchiveRejectsEmptyArchives(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-cp")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tar.NewWriter(gz).Close()
+	gz.Close()
+	err = extractArchive(&buf, filepath.Join(dir, "dst"))
+	c.Assert(err, gocheck.ErrorMatches, "the archive is empty")
+}
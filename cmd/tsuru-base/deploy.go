@@ -0,0 +1,344 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"io/ioutil"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type deploy struct {
+	Id       string
+	Commit   string
+	User     string
+	Pusher   string
+	Start    time.Time
+	Duration float64
+	Success  bool
+}
+
+type AppDeploys struct {
+	GuessingCommand
+}
+
+func (c *AppDeploys) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploys",
+		Usage: "app-deploys [--app appname]",
+		Desc: `lists the deploys of an app, the most recent first.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppDeploys) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/deploys", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintf(context.Stdout, "App %q has no deploys.\n", appName)
+		return nil
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return c.Show(result, context)
+}
+
+func (c *AppDeploys) Show(result []byte, context *cmd.Context) error {
+	var deploys []deploy
+	err := json.Unmarshal(result, &deploys)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Id", "Commit", "User", "Date", "Duration", "Status"})
+	for _, d := range deploys {
+		commit := d.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		status := "failed"
+		if d.Success {
+			status = "success"
+		}
+		user := d.User
+		if user == "" && d.Pusher != "" {
+			user = d.Pusher + " (unverified)"
+		}
+		duration := time.Duration(d.Duration * float64(time.Second))
+		table.AddRow(cmd.Row([]string{
+			d.Id, commit, user, d.Start.Format("2006-01-02 15:04:05"), duration.String(), status,
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type AppRollback struct {
+	GuessingCommand
+}
+
+func (c *AppRollback) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <deploy-id> [--app appname]",
+		Desc: `deploys again the commit of a previous deploy of an app.
+
+Use app-deploys to find the id of the deploy. If you don't provide the app
+name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppRollback) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/deploys/%s/rollback", appName, context.Args[0]))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
+type AppDeployStrategy struct {
+	GuessingCommand
+}
+
+func (c *AppDeployStrategy) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploy-strategy",
+		Usage: "app-deploy-strategy <default|blue-green> [--app appname]",
+		Desc: `defines how an app is deployed from git.
+
+The default strategy updates the code of the units in place and restarts them.
+The blue-green strategy deploys the new code in a new set of units, and
+switches the router to them only after they pass the health check declared in
+app.conf, then removes the old units. Failed blue/green deploys don't affect
+the running units.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppDeployStrategy) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/deploy-strategy", appName))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"strategy": context.Args[0]})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, "Deploy strategy of the app %q set to %s.\n", appName, context.Args[0])
+	return nil
+}
+
+type Deploy struct {
+	GuessingCommand
+	canary string
+	fs     *gnuflag.FlagSet
+}
+
+func (c *Deploy) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "deploy",
+		Usage: "deploy [dir|file] [--app appname] [--canary share%]",
+		Desc: `deploys an app from a directory or a gzipped tar archive, without git.
+
+If a directory is given, its content (except for the .git directory) is packed
+in a gzipped tar archive and sent to tsuru. If a file is given, it must be a
+gzipped tar archive, and it's sent as is. The default is the current
+directory.
+
+With --canary, the code is deployed in new units that receive roughly the
+given share of the requests (for example, --canary 10%), while the other units
+keep running the current code. Use app-canary to follow the error rate of the
+canary and to promote or abort it.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *Deploy) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	path := "."
+	if len(context.Args) > 0 {
+		path = context.Args[0]
+	}
+	archive, err := archiveFor(path)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("/apps/%s/deploy", appName)
+	if c.canary != "" {
+		query := url.Values{}
+		query.Set("canary", c.canary)
+		endpoint += "?" + query.Encode()
+	}
+	u, err := cmd.GetUrl(endpoint)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", u, archive)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-gzip")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
+func (c *Deploy) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.canary, "canary", "", "deploy a canary release receiving the given share of the requests")
+	}
+	return c.fs
+}
+
+// archiveFor returns a gzipped tar archive for the given path. If the path is
+// a file, its content is returned, otherwise the directory is packed.
+func archiveFor(path string) (*bytes.Buffer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if !fi.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		_, err = io.Copy(&buf, f)
+		return &buf, err
+	}
+	if err = writeArchive(&buf, path, "", true); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// writeArchive writes to w a gzipped tar archive with the file or directory in
+// path. Entries are named after their path relative to path, prefixed by
+// prefix. The .git directory is skipped when skipGit is true.
+func writeArchive(w io.Writer, path, prefix string, skipGit bool) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(path, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipGit && fi.IsDir() && fi.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(path, name)
+		if err != nil {
+			return err
+		}
+		entry := filepath.ToSlash(filepath.Join(prefix, rel))
+		if entry == "." {
+			return nil
+		}
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		header.Name = entry
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
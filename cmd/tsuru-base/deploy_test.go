@@ -0,0 +1,323 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+func (s *S) TestAppDeploysInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-deploys",
+		Usage: "app-deploys [--app appname]",
+		Desc: `lists the deploys of an app, the most recent first.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppDeploys{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppDeploys(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Id":"5204d1a0","Commit":"a9b1e3fdeadbeef","User":"gopher@tsuru.io","Start":"2013-08-09T10:30:00Z","Duration":90,"Success":true},
+{"Id":"5204d1a1","Commit":"b0c2f4e","User":"","Start":"2013-08-08T09:00:00Z","Duration":2,"Success":false},
+{"Id":"5204d1a2","Commit":"c1d3a5f","User":"","Pusher":"gopher@tsuru.io","Start":"2013-08-07T08:00:00Z","Duration":30,"Success":true}]`
+	expected := `+----------+---------+------------------------------+---------------------+----------+---------+
+| Id       | Commit  | User                         | Date                | Duration | Status  |
++----------+---------+------------------------------+---------------------+----------+---------+
+| 5204d1a0 | a9b1e3f | gopher@tsuru.io              | 2013-08-09 10:30:00 | 1m30s    | success |
+| 5204d1a1 | b0c2f4e |                              | 2013-08-08 09:00:00 | 2s       | failed  |
+| 5204d1a2 | c1d3a5f | gopher@tsuru.io (unverified) | 2013-08-07 08:00:00 | 30s      | success |
++----------+---------+------------------------------+---------------------+----------+---------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/deploys" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeploys{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppDeploysWithoutDeploys(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{status: http.StatusNoContent}}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := AppDeploys{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "App \"sparrow\" has no deploys.\n")
+}
+
+func (s *S) TestAppDeploysIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppDeploys{}
+}
+
+func (s *S) TestAppRollbackInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <deploy-id> [--app appname]",
+		Desc: `deploys again the commit of a previous deploy of an app.
+
+Use app-deploys to find the id of the deploy. If you don't provide the app
+name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+	c.Assert((&AppRollback{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppRollback(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Args:   []string{"5204d1a0"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "Rollback done!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/sparrow/deploys/5204d1a0/rollback" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := AppRollback{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Rollback done!")
+}
+
+func (s *S) TestAppRollbackIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppRollback{}
+}
+
+func (s *S) TestAppDeployStrategyInfo(c *gocheck.C) {
+	info := (&AppDeployStrategy{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-deploy-strategy")
+	c.Assert(info.Usage, gocheck.Equals, "app-deploy-strategy <default|blue-green> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestAppDeployStrategy(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"blue-green"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{status: http.StatusOK},
+		func(req *http.Request) bool {
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			return req.URL.Path == "/apps/sparrow/deploy-strategy" && req.Method == "PUT" &&
+				body["strategy"] == "blue-green"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := AppDeployStrategy{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Deploy strategy of the app \"sparrow\" set to blue-green.\n")
+}
+
+func (s *S) TestAppDeployStrategyIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppDeployStrategy{}
+}
+
+func (s *S) TestDeployInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "deploy",
+		Usage: "deploy [dir|file] [--app appname] [--canary share%]",
+		Desc: `deploys an app from a directory or a gzipped tar archive, without git.
+
+If a directory is given, its content (except for the .git directory) is packed
+in a gzipped tar archive and sent to tsuru. If a file is given, it must be a
+gzipped tar archive, and it's sent as is. The default is the current
+directory.
+
+With --canary, the code is deployed in new units that receive roughly the
+given share of the requests (for example, --canary 10%), while the other units
+keep running the current code. Use app-canary to follow the error rate of the
+canary and to promote or abort it.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&Deploy{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDeployDirectory(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-deploy")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	err = os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	c.Assert(err, gocheck.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	err = os.MkdirAll(filepath.Join(dir, "static"), 0755)
+	c.Assert(err, gocheck.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "app.py"), []byte("print 'hello'"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "static", "app.css"), []byte("body {}"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	var (
+		files          map[string]string
+		stdout, stderr bytes.Buffer
+	)
+	trans := &conditionalTransport{
+		transport{msg: "Deploy done!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			files = make(map[string]string)
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				return false
+			}
+			tr := tar.NewReader(gz)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return false
+				}
+				content, _ := ioutil.ReadAll(tr)
+				files[header.Name] = string(content)
+			}
+			return req.URL.Path == "/apps/sparrow/deploy" && req.Method == "POST" &&
+				req.Header.Get("Content-Type") == "application/x-gzip"
+		},
+	}
+	context := cmd.Context{
+		Args:   []string{dir},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := Deploy{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Deploy done!")
+	expected := map[string]string{
+		"app.py":         "print 'hello'",
+		"static/":        "",
+		"static/app.css": "body {}",
+	}
+	c.Assert(files, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDeployFile(c *gocheck.C) {
+	f, err := ioutil.TempFile("", "tsuru-deploy")
+	c.Assert(err, gocheck.IsNil)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("some archive")
+	c.Assert(err, gocheck.IsNil)
+	f.Close()
+	var (
+		body           []byte
+		stdout, stderr bytes.Buffer
+	)
+	trans := &conditionalTransport{
+		transport{msg: "Deploy done!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			body, _ = ioutil.ReadAll(req.Body)
+			return req.URL.Path == "/apps/sparrow/deploy" && req.Method == "POST"
+		},
+	}
+	context := cmd.Context{
+		Args:   []string{f.Name()},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := Deploy{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(body), gocheck.Equals, "some archive")
+}
+
+func (s *S) TestDeployCanary(c *gocheck.C) {
+	f, err := ioutil.TempFile("", "tsuru-deploy")
+	c.Assert(err, gocheck.IsNil)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("some archive")
+	c.Assert(err, gocheck.IsNil)
+	f.Close()
+	var stdout, stderr bytes.Buffer
+	trans := &conditionalTransport{
+		transport{msg: "Canary deployed!", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/deploy" && req.Method == "POST" &&
+				req.URL.Query().Get("canary") == "10%"
+		},
+	}
+	context := cmd.Context{
+		Args:   []string{f.Name()},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := Deploy{}
+	command.Flags().Parse(true, []string{"--app", "sparrow", "--canary", "10%"})
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Canary deployed!")
+}
+
+func (s *S) TestDeployUnknownPath(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"/tmp/tsuru/does/not/exist"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{status: http.StatusOK}}, nil, manager)
+	command := Deploy{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(os.IsNotExist(err), gocheck.Equals, true)
+}
+
+func (s *S) TestDeployIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &Deploy{}
+}
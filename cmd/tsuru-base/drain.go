@@ -0,0 +1,158 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+)
+
+type drain struct {
+	Id  string
+	URL string
+}
+
+type DrainAdd struct {
+	GuessingCommand
+}
+
+func (c *DrainAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "drain-add",
+		Usage: "drain-add <url> [--app appname]",
+		Desc: `adds a drain to an app. All logs of the app are forwarded to the drain.
+
+The URL of the drain may be a syslog endpoint (syslog://host:port for TCP or
+syslog+udp://host:port for UDP), or an HTTPS endpoint (https://host/path).
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *DrainAdd) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/drains", appName))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"url": context.Args[0]})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var d drain
+	if err = json.NewDecoder(response.Body).Decode(&d); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Drain %s successfully added to the app %q.\n", d.Id, appName)
+	return nil
+}
+
+type DrainList struct {
+	GuessingCommand
+}
+
+func (c *DrainList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "drain-list",
+		Usage: "drain-list [--app appname]",
+		Desc: `lists the drains of an app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *DrainList) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/drains", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintf(context.Stdout, "App %q has no drains.\n", appName)
+		return nil
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var drains []drain
+	if err = json.Unmarshal(result, &drains); err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Id", "URL"})
+	for _, d := range drains {
+		table.AddRow(cmd.Row([]string{d.Id, d.URL}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type DrainRemove struct {
+	GuessingCommand
+}
+
+func (c *DrainRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "drain-remove",
+		Usage: "drain-remove <drain-id> [--app appname]",
+		Desc: `removes a drain from an app.
+
+Use drain-list to find the id of the drain. If you don't provide the app name,
+tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *DrainRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/drains/%s", appName, context.Args[0]))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Drain %s successfully removed from the app %q.\n", context.Args[0], appName)
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestDrainAddInfo(c *gocheck.C) {
+	info := (&DrainAdd{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "drain-add")
+	c.Assert(info.Usage, gocheck.Equals, "drain-add <url> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestDrainAdd(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Args:   []string{"syslog://logs.example.com:514"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: `{"Id":"5204d1a0","App":"sparrow","URL":"syslog://logs.example.com:514"}`, status: http.StatusOK},
+		func(req *http.Request) bool {
+			called = true
+			var body map[string]string
+			data, _ := ioutil.ReadAll(req.Body)
+			json.Unmarshal(data, &body)
+			return req.URL.Path == "/apps/sparrow/drains" && req.Method == "POST" &&
+				body["url"] == "syslog://logs.example.com:514"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := DrainAdd{}
+	command.Flags().Parse(true, []string{"--app", "sparrow"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Drain 5204d1a0 successfully added to the app \"sparrow\".\n")
+}
+
+func (s *S) TestDrainAddIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &DrainAdd{}
+}
+
+func (s *S) TestDrainListInfo(c *gocheck.C) {
+	info := (&DrainList{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "drain-list")
+	c.Assert(info.Usage, gocheck.Equals, "drain-list [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestDrainList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Id":"5204d1a0","App":"sparrow","URL":"syslog://logs.example.com:514"},
+{"Id":"5204d1a1","App":"sparrow","URL":"https://logs.example.com/drain"}]`
+	expected := `+----------+--------------------------------+
+| Id       | URL                            |
++----------+--------------------------------+
+| 5204d1a0 | syslog://logs.example.com:514  |
+| 5204d1a1 | https://logs.example.com/drain |
++----------+--------------------------------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/drains" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := DrainList{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestDrainListWithoutDrains(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{status: http.StatusNoContent}}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := DrainList{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "App \"sparrow\" has no drains.\n")
+}
+
+func (s *S) TestDrainRemoveInfo(c *gocheck.C) {
+	info := (&DrainRemove{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "drain-remove")
+	c.Assert(info.Usage, gocheck.Equals, "drain-remove <drain-id> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestDrainRemove(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Args:   []string{"5204d1a0"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/sparrow/drains/5204d1a0" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := DrainRemove{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Drain 5204d1a0 successfully removed from the app \"sparrow\".\n")
+}
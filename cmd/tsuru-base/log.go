@@ -6,18 +6,41 @@ package tsuru
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
 	"io"
 	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
+var (
+	// logReconnectAttempts is the number of times that log --follow tries
+	// to reconnect to the server without receiving new logs before giving
+	// up.
+	logReconnectAttempts = 5
+
+	// logReconnectInterval is the interval between two reconnection
+	// attempts.
+	logReconnectInterval = 2 * time.Second
+
+	// logReconnectLines is the maximum number of lines requested when
+	// reconnecting.
+	logReconnectLines = 1000
+)
+
 type AppLog struct {
 	GuessingCommand
 	fs     *gnuflag.FlagSet
 	source string
+	unit   string
+	level  string
+	grep   string
+	since  string
+	until  string
 	lines  int
 	follow bool
 }
@@ -25,16 +48,45 @@ type AppLog struct {
 func (c *AppLog) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "log",
-		Usage: "log [--app appname] [--lines numberOfLines] [--source source]",
+		Usage: "log [--app appname] [--lines numberOfLines] [--source source] [--unit unit] [--level level] [--grep regexp] [--since date] [--until date] [--follow]",
 		Desc: `show logs for an app.
 
-If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.`,
+If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.
+
+The --since and --until flags accept a date in RFC 3339 format (2013-07-10T13:45:00Z) or a duration
+relative to now (10m, 2h). The --level flag shows logs with the given level or a more severe one.`,
 		MinArgs: 0,
 	}
 }
 
+// jsonWriter prints the logs received from the server. When following logs,
+// it keeps track of the last printed logs, so they aren't printed again after
+// a reconnection.
 type jsonWriter struct {
-	w io.Writer
+	w       io.Writer
+	printed int
+
+	// last is the date of the most recent log printed, and seen counts the
+	// logs printed with this date.
+	last time.Time
+	seen map[string]int
+
+	// skip counts the logs that were printed before the reconnection, and
+	// must be skipped when the server sends them again.
+	skip map[string]int
+}
+
+func logKey(l log) string {
+	return l.Source + "\x00" + l.Unit + "\x00" + l.Message
+}
+
+// resume prepares the writer for a new connection, that will request logs
+// since the date of the last printed log.
+func (j *jsonWriter) resume() {
+	j.skip = make(map[string]int, len(j.seen))
+	for k, v := range j.seen {
+		j.skip[k] = v
+	}
 }
 
 func (j *jsonWriter) Write(b []byte) (int, error) {
@@ -44,9 +96,33 @@ func (j *jsonWriter) Write(b []byte) (int, error) {
 		return len(b), nil
 	}
 	for _, l := range logs {
+		// The server stores dates with millisecond precision.
+		d := l.Date.Truncate(time.Millisecond)
+		key := logKey(l)
+		if j.skip != nil {
+			if d.Before(j.last) {
+				continue
+			}
+			if d.Equal(j.last) && j.skip[key] > 0 {
+				j.skip[key]--
+				continue
+			}
+		}
 		date := l.Date.Format("2006-01-02 15:04:05")
 		prefix := fmt.Sprintf("%s [%s]:", date, l.Source)
+		if l.Unit != "" {
+			prefix = fmt.Sprintf("%s [%s][%s]:", date, l.Source, l.Unit)
+		}
 		fmt.Fprintf(j.w, "%s %s\n", cmd.Colorfy(prefix, "blue", "", ""), l.Message)
+		j.printed++
+		if j.seen == nil || d.After(j.last) {
+			j.last = d
+			j.seen = make(map[string]int)
+			j.skip = nil
+		}
+		if d.Equal(j.last) {
+			j.seen[key]++
+		}
 	}
 	return len(b), nil
 }
@@ -55,24 +131,54 @@ type log struct {
 	Date    time.Time
 	Message string
 	Source  string
+	Unit    string
 }
 
-func (c *AppLog) Run(context *cmd.Context, client cmd.Doer) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
+// parseLogDate parses a date in RFC 3339 format, or a duration relative to
+// the given time.
+func parseLogDate(value string, now time.Time) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/log?lines=%d", appName, c.lines))
-	if err != nil {
-		return err
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("Invalid date %q. Use a date in RFC 3339 format or a duration, like 10m.", value)
 	}
-	if c.source != "" {
-		url = fmt.Sprintf("%s&source=%s", url, c.source)
+	return now.Add(-d), nil
+}
+
+func (c *AppLog) query(now time.Time) (url.Values, error) {
+	query := url.Values{}
+	query.Set("lines", strconv.Itoa(c.lines))
+	params := map[string]string{"source": c.source, "unit": c.unit, "level": c.level, "grep": c.grep}
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	dates := map[string]string{"since": c.since, "until": c.until}
+	for name, value := range dates {
+		if value == "" {
+			continue
+		}
+		date, err := parseLogDate(value, now)
+		if err != nil {
+			return nil, err
+		}
+		query.Set(name, date.UTC().Format(time.RFC3339Nano))
 	}
 	if c.follow {
-		url += "&follow=1"
+		query.Set("follow", "1")
+	}
+	return query, nil
+}
+
+func (c *AppLog) stream(appName string, query url.Values, w io.Writer, client cmd.Doer) error {
+	u, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/log?%s", appName, query.Encode()))
+	if err != nil {
+		return err
 	}
-	request, err := http.NewRequest("GET", url, nil)
+	request, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return err
 	}
@@ -84,12 +190,44 @@ func (c *AppLog) Run(context *cmd.Context, client cmd.Doer) error {
 		return nil
 	}
 	defer response.Body.Close()
-	w := jsonWriter{context.Stdout}
-	for n, err := io.Copy(&w, response.Body); n > 0 && err == nil; n, err = io.Copy(&w, response.Body) {
+	for n, err := io.Copy(w, response.Body); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
 	}
 	return nil
 }
 
+func (c *AppLog) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	query, err := c.query(start)
+	if err != nil {
+		return err
+	}
+	w := jsonWriter{w: context.Stdout}
+	if err = c.stream(appName, query, &w, client); err != nil || !c.follow {
+		return err
+	}
+	// The server closed the connection. Reconnect, asking for the logs
+	// since the last one that was printed.
+	for attempt := 0; attempt < logReconnectAttempts; attempt++ {
+		time.Sleep(logReconnectInterval)
+		since := w.last
+		if since.IsZero() {
+			since = start
+		}
+		query.Set("since", since.UTC().Format(time.RFC3339Nano))
+		query.Set("lines", strconv.Itoa(logReconnectLines))
+		printed := w.printed
+		w.resume()
+		if c.stream(appName, query, &w, client) == nil && w.printed > printed {
+			attempt = -1
+		}
+	}
+	return errors.New("Lost the connection to the tsuru server.")
+}
+
 func (c *AppLog) Flags() *gnuflag.FlagSet {
 	if c.fs == nil {
 		c.fs = c.GuessingCommand.Flags()
@@ -97,6 +235,13 @@ func (c *AppLog) Flags() *gnuflag.FlagSet {
 		c.fs.IntVar(&c.lines, "l", 10, "The number of log lines to display")
 		c.fs.StringVar(&c.source, "source", "", "The log from the given source")
 		c.fs.StringVar(&c.source, "s", "", "The log from the given source")
+		c.fs.StringVar(&c.unit, "unit", "", "The log from the given unit")
+		c.fs.StringVar(&c.unit, "u", "", "The log from the given unit")
+		c.fs.StringVar(&c.level, "level", "", "The minimum level of the log")
+		c.fs.StringVar(&c.grep, "grep", "", "The log matching the given regular expression")
+		c.fs.StringVar(&c.grep, "g", "", "The log matching the given regular expression")
+		c.fs.StringVar(&c.since, "since", "", "The log since the given date or duration")
+		c.fs.StringVar(&c.until, "until", "", "The log until the given date or duration")
 		c.fs.BoolVar(&c.follow, "follow", false, "Follow logs")
 		c.fs.BoolVar(&c.follow, "f", false, "Follow logs")
 	}
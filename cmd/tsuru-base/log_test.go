@@ -7,7 +7,9 @@ package tsuru
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
 	"launchpad.net/gocheck"
 	"net/http"
 	"strings"
@@ -23,7 +25,7 @@ func (s *S) TestJsonWriter(c *gocheck.C) {
 	b, err := json.Marshal(logs)
 	c.Assert(err, gocheck.IsNil)
 	var buf bytes.Buffer
-	w := jsonWriter{&buf}
+	w := jsonWriter{w: &buf}
 	n, err := w.Write(b)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(n, gocheck.Equals, len(b))
@@ -33,9 +35,27 @@ func (s *S) TestJsonWriter(c *gocheck.C) {
 	c.Assert(buf.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestJsonWriterWithUnit(c *gocheck.C) {
+	t := time.Now()
+	logs := []log{
+		{Date: t, Message: "Starting worker", Source: "worker", Unit: "myapp/1"},
+		{Date: t, Message: "Something happened", Source: "tsuru"},
+	}
+	b, err := json.Marshal(logs)
+	c.Assert(err, gocheck.IsNil)
+	var buf bytes.Buffer
+	w := jsonWriter{w: &buf}
+	_, err = w.Write(b)
+	c.Assert(err, gocheck.IsNil)
+	tfmt := "2006-01-02 15:04:05"
+	expected := cmd.Colorfy(t.Format(tfmt)+" [worker][myapp/1]:", "blue", "", "") + " Starting worker\n"
+	expected = expected + cmd.Colorfy(t.Format(tfmt)+" [tsuru]:", "blue", "", "") + " Something happened\n"
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
 func (s *S) TestJsonWriterInvalidJson(c *gocheck.C) {
 	var buf bytes.Buffer
-	w := jsonWriter{&buf}
+	w := jsonWriter{w: &buf}
 	b := []byte("-----")
 	n, err := w.Write(b)
 	c.Assert(err, gocheck.IsNil)
@@ -109,10 +129,13 @@ func (s *S) TestAppLogShouldReturnNilIfHasNoContent(c *gocheck.C) {
 func (s *S) TestAppLogInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:  "log",
-		Usage: "log [--app appname] [--lines numberOfLines] [--source source]",
+		Usage: "log [--app appname] [--lines numberOfLines] [--source source] [--unit unit] [--level level] [--grep regexp] [--since date] [--until date] [--follow]",
 		Desc: `show logs for an app.
 
-If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.`,
+If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.
+
+The --since and --until flags accept a date in RFC 3339 format (2013-07-10T13:45:00Z) or a duration
+relative to now (10m, 2h). The --level flag shows logs with the given level or a more severe one.`,
 		MinArgs: 0,
 	}
 	c.Assert((&AppLog{}).Info(), gocheck.DeepEquals, expected)
@@ -194,17 +217,132 @@ func (s *S) TestAppLogWithFollow(c *gocheck.C) {
 			status: http.StatusOK,
 		},
 		func(req *http.Request) bool {
-			return req.URL.Query().Get("lines") == "12" && req.URL.Query().Get("follow") == "1"
+			return req.URL.Query().Get("follow") == "1"
 		},
 	}
+	old := logReconnectInterval
+	logReconnectInterval = 0
+	defer func() { logReconnectInterval = old }()
 	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	err := command.Run(&context, client)
-	c.Assert(err, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Lost the connection to the tsuru server.")
 	got := stdout.String()
 	got = strings.Replace(got, "-0300 -0300", "-0300 BRT", -1)
 	c.Assert(got, gocheck.Equals, expected)
 }
 
+// sequenceTransport answers each request with the next message, recording
+// the requests.
+type sequenceTransport struct {
+	msgs     []string
+	requests []*http.Request
+}
+
+func (t *sequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	if len(t.msgs) == 0 {
+		return nil, errors.New("connection refused")
+	}
+	msg := t.msgs[0]
+	t.msgs = t.msgs[1:]
+	return &http.Response{Body: ioutil.NopCloser(strings.NewReader(msg)), StatusCode: http.StatusOK}, nil
+}
+
+func (s *S) TestAppLogFollowReconnectsWithoutDuplicatingLines(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	first := `[{"Source":"app","Unit":"lost/0","Date":"2012-06-20T14:17:22.75Z","Message":"first"},{"Source":"app","Unit":"lost/0","Date":"2012-06-20T14:17:22.753Z","Message":"second"}]`
+	second := `[{"Source":"app","Unit":"lost/0","Date":"2012-06-20T14:17:22.753Z","Message":"second"},{"Source":"app","Unit":"lost/1","Date":"2012-06-20T14:17:22.753Z","Message":"second"},{"Source":"app","Unit":"lost/0","Date":"2012-06-20T14:17:23Z","Message":"third"}]`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	fake := &FakeGuesser{name: "lost"}
+	command := AppLog{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, []string{"-f", "--unit", "lost/0"})
+	trans := &sequenceTransport{msgs: []string{first, second}}
+	oldInterval, oldAttempts := logReconnectInterval, logReconnectAttempts
+	logReconnectInterval, logReconnectAttempts = 0, 2
+	defer func() {
+		logReconnectInterval, logReconnectAttempts = oldInterval, oldAttempts
+	}()
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Lost the connection to the tsuru server.")
+	expected := cmd.Colorfy("2012-06-20 14:17:22 [app][lost/0]:", "blue", "", "") + " first\n"
+	expected += cmd.Colorfy("2012-06-20 14:17:22 [app][lost/0]:", "blue", "", "") + " second\n"
+	expected += cmd.Colorfy("2012-06-20 14:17:22 [app][lost/1]:", "blue", "", "") + " second\n"
+	expected += cmd.Colorfy("2012-06-20 14:17:23 [app][lost/0]:", "blue", "", "") + " third\n"
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+	c.Assert(trans.requests, gocheck.HasLen, 4)
+	query := trans.requests[0].URL.Query()
+	c.Assert(query.Get("lines"), gocheck.Equals, "10")
+	c.Assert(query.Get("unit"), gocheck.Equals, "lost/0")
+	c.Assert(query.Get("since"), gocheck.Equals, "")
+	query = trans.requests[1].URL.Query()
+	c.Assert(query.Get("lines"), gocheck.Equals, "1000")
+	c.Assert(query.Get("unit"), gocheck.Equals, "lost/0")
+	c.Assert(query.Get("since"), gocheck.Equals, "2012-06-20T14:17:22.753Z")
+	c.Assert(query.Get("follow"), gocheck.Equals, "1")
+	query = trans.requests[2].URL.Query()
+	c.Assert(query.Get("since"), gocheck.Equals, "2012-06-20T14:17:23Z")
+}
+
+func (s *S) TestAppLogWithFilters(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	fake := &FakeGuesser{name: "lost"}
+	command := AppLog{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, []string{
+		"--unit", "lost/1", "--level", "error", "--grep", "conn.* refused",
+		"--since", "2013-07-10T12:00:00Z", "--until", "2013-07-10T13:00:00-03:00",
+	})
+	trans := &conditionalTransport{
+		transport{msg: "[]", status: http.StatusOK},
+		func(req *http.Request) bool {
+			query := req.URL.Query()
+			return query.Get("unit") == "lost/1" && query.Get("level") == "error" &&
+				query.Get("grep") == "conn.* refused" &&
+				query.Get("since") == "2013-07-10T12:00:00Z" &&
+				query.Get("until") == "2013-07-10T16:00:00Z" &&
+				query.Get("follow") == ""
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestAppLogInvalidDate(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	fake := &FakeGuesser{name: "lost"}
+	command := AppLog{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, []string{"--since", "yesterday"})
+	err := command.Run(&context, nil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Invalid date "yesterday". Use a date in RFC 3339 format or a duration, like 10m.`)
+}
+
+func (s *S) TestParseLogDate(c *gocheck.C) {
+	now := time.Date(2013, 7, 10, 12, 0, 0, 0, time.UTC)
+	date, err := parseLogDate("2013-07-09T10:00:00Z", now)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(date.Equal(time.Date(2013, 7, 9, 10, 0, 0, 0, time.UTC)), gocheck.Equals, true)
+	date, err = parseLogDate("90m", now)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(date.Equal(time.Date(2013, 7, 10, 10, 30, 0, 0, time.UTC)), gocheck.Equals, true)
+	_, err = parseLogDate("-10m", now)
+	c.Assert(err, gocheck.NotNil)
+}
+
 func (s *S) TestAppLogFlagSet(c *gocheck.C) {
 	command := AppLog{}
 	flagset := command.Flags()
@@ -258,3 +396,29 @@ func (s *S) TestAppLogFlagSet(c *gocheck.C) {
 	c.Check(sfollow.Value.String(), gocheck.Equals, "true")
 	c.Check(sfollow.DefValue, gocheck.Equals, "false")
 }
+
+func (s *S) TestAppLogFilterFlags(c *gocheck.C) {
+	command := AppLog{}
+	flagset := command.Flags()
+	flagset.Parse(true, []string{"-u", "lost/0", "--level", "error", "-g", "refused", "--since", "1h", "--until", "10m"})
+	c.Check(command.unit, gocheck.Equals, "lost/0")
+	c.Check(command.level, gocheck.Equals, "error")
+	c.Check(command.grep, gocheck.Equals, "refused")
+	c.Check(command.since, gocheck.Equals, "1h")
+	c.Check(command.until, gocheck.Equals, "10m")
+	unit := flagset.Lookup("unit")
+	c.Check(unit, gocheck.NotNil)
+	c.Check(unit.Usage, gocheck.Equals, "The log from the given unit")
+	level := flagset.Lookup("level")
+	c.Check(level, gocheck.NotNil)
+	c.Check(level.Usage, gocheck.Equals, "The minimum level of the log")
+	grep := flagset.Lookup("grep")
+	c.Check(grep, gocheck.NotNil)
+	c.Check(grep.Usage, gocheck.Equals, "The log matching the given regular expression")
+	since := flagset.Lookup("since")
+	c.Check(since, gocheck.NotNil)
+	c.Check(since.Usage, gocheck.Equals, "The log since the given date or duration")
+	until := flagset.Lookup("until")
+	c.Check(until, gocheck.NotNil)
+	c.Check(until.Usage, gocheck.Equals, "The log until the given date or duration")
+}
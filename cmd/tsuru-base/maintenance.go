@@ -0,0 +1,83 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"launchpad.net/gnuflag"
+	"net/http"
+)
+
+type AppMaintenance struct {
+	GuessingCommand
+	fs   *gnuflag.FlagSet
+	page string
+}
+
+func (c *AppMaintenance) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-maintenance",
+		Usage: "app-maintenance <on|off> [--page file] [--app appname]",
+		Desc: `puts an app in maintenance (on), or takes it out of maintenance (off).
+
+While in maintenance, the router answers all requests to the app with a static
+page and the status 503. The units keep running, so commands like "tsuru run"
+still work. The --page flag defines the HTML file served during the
+maintenance; by default, the router serves its own 503 page.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppMaintenance) Run(context *cmd.Context, client cmd.Doer) error {
+	var method, msg string
+	switch context.Args[0] {
+	case "on":
+		method, msg = "POST", "App %q is now in maintenance.\n"
+	case "off":
+		method, msg = "DELETE", "App %q is no longer in maintenance.\n"
+	default:
+		return errors.New(`Invalid mode. Use "on" or "off".`)
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	var page []byte
+	if c.page != "" && method == "POST" {
+		if page, err = ioutil.ReadFile(c.page); err != nil {
+			return err
+		}
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/maintenance", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(page))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/html")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, msg, appName)
+	return nil
+}
+
+func (c *AppMaintenance) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.page, "page", "", "HTML file served while the app is in maintenance")
+	}
+	return c.fs
+}
@@ -0,0 +1,90 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+func (s *S) TestAppMaintenanceInfo(c *gocheck.C) {
+	info := (&AppMaintenance{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-maintenance")
+	c.Assert(info.Usage, gocheck.Equals, "app-maintenance <on|off> [--page file] [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestAppMaintenanceOn(c *gocheck.C) {
+	dir, err := ioutil.TempDir("", "tsuru-maintenance")
+	c.Assert(err, gocheck.IsNil)
+	defer os.RemoveAll(dir)
+	page := filepath.Join(dir, "maintenance.html")
+	err = ioutil.WriteFile(page, []byte("<h1>Be right back</h1>"), 0644)
+	c.Assert(err, gocheck.IsNil)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"on"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{status: http.StatusOK},
+		func(req *http.Request) bool {
+			body, _ := ioutil.ReadAll(req.Body)
+			return req.URL.Path == "/apps/sparrow/maintenance" && req.Method == "POST" &&
+				string(body) == "<h1>Be right back</h1>"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppMaintenance{}
+	command.Flags().Parse(true, []string{"--app", "sparrow", "--page", page})
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "App \"sparrow\" is now in maintenance.\n")
+}
+
+func (s *S) TestAppMaintenanceOff(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"off"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/sparrow/maintenance" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "sparrow"}
+	command := AppMaintenance{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "App \"sparrow\" is no longer in maintenance.\n")
+}
+
+func (s *S) TestAppMaintenanceInvalidMode(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"maybe"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppMaintenance{}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, nil)
+	c.Assert(err, gocheck.ErrorMatches, `^Invalid mode. Use "on" or "off".$`)
+}
+
+func (s *S) TestAppMaintenanceIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppMaintenance{}
+}
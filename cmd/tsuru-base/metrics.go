@@ -0,0 +1,130 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+)
+
+type metricsSample struct {
+	Unit    string
+	Samples int
+	CPU     float64
+	Memory  float64
+	Disk    float64
+}
+
+// unitUsage summarizes the samples of a unit.
+type unitUsage struct {
+	last    metricsSample
+	samples int
+	cpu     float64
+	memory  float64
+}
+
+func (u *unitUsage) add(s metricsSample) {
+	u.last = s
+	u.cpu += s.CPU * float64(s.Samples)
+	u.memory += s.Memory * float64(s.Samples)
+	u.samples += s.Samples
+}
+
+type AppMetrics struct {
+	GuessingCommand
+	since string
+	fs    *gnuflag.FlagSet
+}
+
+func (c *AppMetrics) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-metrics",
+		Usage: "app-metrics [--app appname] [--since period]",
+		Desc: `shows the resource usage of the units of an app.
+
+For each unit, app-metrics displays the usage of CPU, memory and disk in the
+last sample, and the average usage of CPU and memory in the given period (for
+example, --since 30m or --since 24h). The default period is one hour, and the
+longest is one week. CPU usage is the percentage of one CPU, while memory and
+disk usage are percentages of the memory and the disk available to the unit.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppMetrics) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("/apps/%s/metrics", appName)
+	if c.since != "" {
+		query := url.Values{}
+		query.Set("since", c.since)
+		endpoint += "?" + query.Encode()
+	}
+	u, err := cmd.GetUrl(endpoint)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var samples []metricsSample
+	if err = json.NewDecoder(response.Body).Decode(&samples); err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		fmt.Fprintf(context.Stdout, "No metrics available for the app %q.\n", appName)
+		return nil
+	}
+	var units []string
+	usage := make(map[string]*unitUsage)
+	for _, s := range samples {
+		if usage[s.Unit] == nil {
+			usage[s.Unit] = &unitUsage{}
+			units = append(units, s.Unit)
+		}
+		usage[s.Unit].add(s)
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Unit", "CPU", "Memory", "Disk", "Avg CPU", "Avg memory"})
+	for _, name := range units {
+		u := usage[name]
+		n := float64(u.samples)
+		if n == 0 {
+			n = 1
+		}
+		table.AddRow(cmd.Row([]string{
+			name,
+			fmt.Sprintf("%.1f%%", u.last.CPU),
+			fmt.Sprintf("%.1f%%", u.last.Memory),
+			fmt.Sprintf("%.1f%%", u.last.Disk),
+			fmt.Sprintf("%.1f%%", u.cpu/n),
+			fmt.Sprintf("%.1f%%", u.memory/n),
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+func (c *AppMetrics) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.since, "since", "", "the period of the metrics, like 30m or 24h (default 1h)")
+	}
+	return c.fs
+}
@@ -0,0 +1,71 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestAppMetricsInfo(c *gocheck.C) {
+	info := (&AppMetrics{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-metrics")
+	c.Assert(info.Usage, gocheck.Equals, "app-metrics [--app appname] [--since period]")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestAppMetrics(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Unit":"bolt/0","Samples":3,"CPU":10,"Memory":40,"Disk":11},{"Unit":"bolt/0","Samples":1,"CPU":30,"Memory":54,"Disk":12},{"Unit":"bolt/1","Samples":1,"CPU":5,"Memory":30,"Disk":12}]`
+	expected := `+--------+-------+--------+-------+---------+------------+
+| Unit   | CPU   | Memory | Disk  | Avg CPU | Avg memory |
++--------+-------+--------+-------+---------+------------+
+| bolt/0 | 30.0% | 54.0%  | 12.0% | 15.0%   | 43.5%      |
+| bolt/1 | 5.0%  | 30.0%  | 12.0% | 5.0%    | 30.0%      |
++--------+-------+--------+-------+---------+------------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/bolt/metrics" && req.URL.Query().Get("since") == "24h"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppMetrics{}
+	command.Flags().Parse(true, []string{"--app", "bolt", "--since", "24h"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppMetricsWithoutSamples(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "[]", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/bolt/metrics" && req.URL.RawQuery == ""
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppMetrics{}
+	command.Flags().Parse(true, []string{"--app", "bolt"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "No metrics available for the app \"bolt\".\n")
+}
+
+func (s *S) TestAppMetricsIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppMetrics{}
+}
@@ -5,15 +5,24 @@
 package tsuru
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
 	"io"
+	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type AppRun struct {
 	GuessingCommand
+	fs       *gnuflag.FlagSet
+	unit     string
+	units    int
+	parallel bool
 }
 
 func (c *AppRun) Info() *cmd.Info {
@@ -21,11 +30,19 @@ func (c *AppRun) Info() *cmd.Info {
 Notice that you may need quotes to run your command if you want to deal with
 input and outputs redirects, and pipes.
 
+The --unit flag runs the command in the given unit, and the --units flag runs
+the command in at most the given number of units. By default, the command runs
+in one unit after the other; use --parallel to run it in all units at the same
+time. Each line of the output is prefixed by the name of the unit.
+
+The exit status of tsuru run is the highest exit status of the command among
+the units.
+
 If you don't provide the app name, tsuru will try to guess it.
 `
 	return &cmd.Info{
 		Name:    "run",
-		Usage:   `run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname]`,
+		Usage:   `run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname] [--unit unitname] [--units n] [--parallel]`,
 		Desc:    desc,
 		MinArgs: 1,
 	}
@@ -36,12 +53,26 @@ func (c *AppRun) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/run", appName))
+	query := url.Values{}
+	if c.unit != "" {
+		query.Set("unit", c.unit)
+	}
+	if c.units > 0 {
+		query.Set("units", strconv.Itoa(c.units))
+	}
+	if c.parallel {
+		query.Set("parallel", "1")
+	}
+	u := fmt.Sprintf("/apps/%s/run", appName)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	u, err = cmd.GetUrl(u)
 	if err != nil {
 		return err
 	}
 	b := strings.NewReader(strings.Join(context.Args, " "))
-	request, err := http.NewRequest("POST", url, b)
+	request, err := http.NewRequest("POST", u, b)
 	if err != nil {
 		return err
 	}
@@ -50,6 +81,67 @@ func (c *AppRun) Run(context *cmd.Context, client cmd.Doer) error {
 		return err
 	}
 	defer r.Body.Close()
-	_, err = io.Copy(context.Stdout, r.Body)
-	return err
+	w := exitStatusWriter{w: context.Stdout}
+	if _, err = io.Copy(&w, r.Body); err != nil {
+		return err
+	}
+	if status := w.Status(); status != 0 {
+		return &cmd.ExitError{Code: status}
+	}
+	return nil
+}
+
+func (c *AppRun) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.unit, "unit", "", "The unit that runs the command")
+		c.fs.StringVar(&c.unit, "u", "", "The unit that runs the command")
+		c.fs.IntVar(&c.units, "units", 0, "The maximum number of units that run the command")
+		c.fs.IntVar(&c.units, "n", 0, "The maximum number of units that run the command")
+		c.fs.BoolVar(&c.parallel, "parallel", false, "Run the command in all units at the same time")
+		c.fs.BoolVar(&c.parallel, "p", false, "Run the command in all units at the same time")
+	}
+	return c.fs
+}
+
+// runSummaryRegexp matches the lines of the summary sent by the server after
+// running the command, with the exit status of each unit.
+var runSummaryRegexp = regexp.MustCompile(`^Unit (\S+) exited with status (\d+)\.$`)
+
+// exitStatusWriter copies the output of the command to the underlying
+// writer, looking for the exit status of the units in the summary.
+type exitStatusWriter struct {
+	w      io.Writer
+	buf    []byte
+	status int
+}
+
+func (e *exitStatusWriter) Write(b []byte) (int, error) {
+	e.buf = append(e.buf, b...)
+	for {
+		i := bytes.IndexByte(e.buf, '\n')
+		if i < 0 {
+			break
+		}
+		e.parse(string(e.buf[:i]))
+		e.buf = e.buf[i+1:]
+	}
+	return e.w.Write(b)
+}
+
+func (e *exitStatusWriter) parse(line string) {
+	if m := runSummaryRegexp.FindStringSubmatch(line); m != nil {
+		if status, _ := strconv.Atoi(m[2]); status > e.status {
+			e.status = status
+		}
+	}
+}
+
+// Status returns the highest exit status found in the output.
+func (e *exitStatusWriter) Status() int {
+	if len(e.buf) > 0 {
+		e.parse(string(e.buf))
+		e.buf = nil
+	}
+	return e.status
 }
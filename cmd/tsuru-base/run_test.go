@@ -98,14 +98,75 @@ func (s *S) TestAppRunInfo(c *gocheck.C) {
 Notice that you may need quotes to run your command if you want to deal with
 input and outputs redirects, and pipes.
 
+The --unit flag runs the command in the given unit, and the --units flag runs
+the command in at most the given number of units. By default, the command runs
+in one unit after the other; use --parallel to run it in all units at the same
+time. Each line of the output is prefixed by the name of the unit.
+
+The exit status of tsuru run is the highest exit status of the command among
+the units.
+
 If you don't provide the app name, tsuru will try to guess it.
 `
 	expected := &cmd.Info{
 		Name:    "run",
-		Usage:   `run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname]`,
+		Usage:   `run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname] [--unit unitname] [--units n] [--parallel]`,
 		Desc:    desc,
 		MinArgs: 1,
 	}
 	command := AppRun{}
 	c.Assert(command.Info(), gocheck.DeepEquals, expected)
 }
+
+func (s *S) TestAppRunWithTarget(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ls"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{
+			msg:    "[ble/1] http.go\n\nUnit ble/1 exited with status 0.\n",
+			status: http.StatusOK,
+		},
+		func(req *http.Request) bool {
+			query := req.URL.Query()
+			return req.URL.Path == "/apps/ble/run" && query.Get("unit") == "ble/1" &&
+				query.Get("units") == "2" && query.Get("parallel") == "1"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRun{}
+	command.Flags().Parse(true, []string{"--app", "ble", "--unit", "ble/1", "-n", "2", "--parallel"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "[ble/1] http.go\n\nUnit ble/1 exited with status 0.\n")
+}
+
+func (s *S) TestAppRunReturnsTheHighestExitStatus(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"false"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	msg := "\nUnit ble/0 exited with status 1.\nUnit ble/1 exited with status 3.\nUnit ble/2 exited with status 0.\n"
+	trans := &transport{msg: msg, status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRun{}
+	command.Flags().Parse(true, []string{"--app", "ble"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.DeepEquals, &cmd.ExitError{Code: 3})
+	c.Assert(stdout.String(), gocheck.Equals, msg)
+}
+
+func (s *S) TestExitStatusWriter(c *gocheck.C) {
+	var buf bytes.Buffer
+	w := exitStatusWriter{w: &buf}
+	w.Write([]byte("Unit ble/0 exited"))
+	w.Write([]byte(" with status 2.\n[ble/0] Unit ble/1 exited with status 9.\n"))
+	w.Write([]byte("Unit ble/1 exited with status 1."))
+	c.Assert(w.Status(), gocheck.Equals, 2)
+	c.Assert(buf.String(), gocheck.Equals, "Unit ble/0 exited with status 2.\n[ble/0] Unit ble/1 exited with status 9.\nUnit ble/1 exited with status 1.")
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/term"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+type AppShell struct {
+	GuessingCommand
+}
+
+func (c *AppShell) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-shell",
+		Usage: "app-shell [unitname] [--app appname]",
+		Desc: `opens an interactive shell in a unit of the app.
+
+The shell runs in the directory of the app, with the environment variables of
+the app. If you don't provide the unit name, tsuru opens the shell in the first
+started unit of the app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+// terminalFd returns the file descriptor of the reader, if it's a terminal.
+func terminalFd(r io.Reader) (uintptr, bool) {
+	if f, ok := r.(*os.File); ok && term.IsTerminal(f.Fd()) {
+		return f.Fd(), true
+	}
+	return 0, false
+}
+
+func (c *AppShell) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	upgrader, ok := client.(cmd.Upgrader)
+	if !ok {
+		return errors.New("This client doesn't support interactive shells.")
+	}
+	query := url.Values{}
+	if len(context.Args) > 0 {
+		query.Set("unit", context.Args[0])
+	}
+	if t := os.Getenv("TERM"); t != "" {
+		query.Set("term", t)
+	}
+	fd, isTerminal := terminalFd(context.Stdin)
+	if isTerminal {
+		if width, height, err := term.GetSize(fd); err == nil {
+			query.Set("width", strconv.Itoa(width))
+			query.Set("height", strconv.Itoa(height))
+		}
+	}
+	u, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/shell?%s", appName, query.Encode()))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	conn, err := upgrader.Upgrade(request, term.ShellProtocol)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	input := term.NewFrameWriter(conn)
+	if isTerminal {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		defer signal.Stop(resize)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-resize:
+					if width, height, err := term.GetSize(fd); err == nil {
+						input.WriteFrame(term.ResizeFrame(width, height))
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go io.Copy(input, context.Stdin)
+	for {
+		f, err := term.ReadFrame(conn)
+		if err != nil {
+			return errors.New("Lost the connection to the tsuru server.")
+		}
+		switch f.Type {
+		case term.FrameData:
+			context.Stdout.Write(f.Payload)
+		case term.FrameExit:
+			if status, _ := f.Status(); status != 0 {
+				return &cmd.ExitError{Code: status}
+			}
+			return nil
+		}
+	}
+}
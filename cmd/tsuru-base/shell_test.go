@@ -0,0 +1,149 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/term"
+	"io"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// fakeUpgrader is a cmd.Upgrader that runs the given function as the server
+// side of upgraded connections.
+type fakeUpgrader struct {
+	requests []*http.Request
+	protocol string
+	server   func(conn net.Conn)
+}
+
+func (u *fakeUpgrader) Do(request *http.Request) (*http.Response, error) {
+	return nil, io.EOF
+}
+
+func (u *fakeUpgrader) Upgrade(request *http.Request, protocol string) (io.ReadWriteCloser, error) {
+	u.requests = append(u.requests, request)
+	u.protocol = protocol
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		u.server(server)
+	}()
+	return client, nil
+}
+
+func (s *S) TestAppShellInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-shell",
+		Usage: "app-shell [unitname] [--app appname]",
+		Desc: `opens an interactive shell in a unit of the app.
+
+The shell runs in the directory of the app, with the environment variables of
+the app. If you don't provide the unit name, tsuru opens the shell in the first
+started unit of the app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppShell{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppShell(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ble/1"},
+		Stdin:  strings.NewReader("ls\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var input string
+	upgrader := fakeUpgrader{
+		server: func(conn net.Conn) {
+			f, err := term.ReadFrame(conn)
+			if err == nil {
+				input = string(f.Payload)
+			}
+			w := term.NewFrameWriter(conn)
+			w.Write([]byte("app.conf\r\n"))
+			w.WriteFrame(term.ExitFrame(0))
+		},
+	}
+	command := AppShell{}
+	command.Flags().Parse(true, []string{"--app", "ble"})
+	err := command.Run(&context, &upgrader)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "app.conf\r\n")
+	c.Assert(input, gocheck.Equals, "ls\n")
+	c.Assert(upgrader.protocol, gocheck.Equals, term.ShellProtocol)
+	c.Assert(upgrader.requests, gocheck.HasLen, 1)
+	request := upgrader.requests[0]
+	c.Assert(request.Method, gocheck.Equals, "GET")
+	c.Assert(request.URL.Path, gocheck.Equals, "/apps/ble/shell")
+	c.Assert(request.URL.Query().Get("unit"), gocheck.Equals, "ble/1")
+}
+
+func (s *S) TestAppShellExitStatus(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdin:  strings.NewReader(""),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	upgrader := fakeUpgrader{
+		server: func(conn net.Conn) {
+			term.WriteFrame(conn, term.ExitFrame(130))
+		},
+	}
+	fake := &FakeGuesser{name: "bla"}
+	command := AppShell{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, &upgrader)
+	c.Assert(err, gocheck.DeepEquals, &cmd.ExitError{Code: 130})
+	c.Assert(upgrader.requests[0].URL.Path, gocheck.Equals, "/apps/bla/shell")
+	c.Assert(upgrader.requests[0].URL.Query().Get("unit"), gocheck.Equals, "")
+}
+
+func (s *S) TestAppShellConnectionLost(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdin:  strings.NewReader(""),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	upgrader := fakeUpgrader{
+		server: func(conn net.Conn) {
+			term.NewFrameWriter(conn).Write([]byte("$ "))
+		},
+	}
+	command := AppShell{}
+	command.Flags().Parse(true, []string{"--app", "ble"})
+	err := command.Run(&context, &upgrader)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Lost the connection to the tsuru server.")
+	c.Assert(stdout.String(), gocheck.Equals, "$ ")
+}
+
+func (s *S) TestAppShellRequiresAnUpgrader(c *gocheck.C) {
+	context := cmd.Context{Stdin: strings.NewReader("")}
+	client := cmd.NewClient(&http.Client{Transport: &transport{status: http.StatusOK}}, nil, manager)
+	command := AppShell{}
+	command.Flags().Parse(true, []string{"--app", "ble"})
+	err := command.Run(&context, &doerOnly{client})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "This client doesn't support interactive shells.")
+}
+
+// doerOnly hides the Upgrade method of the client.
+type doerOnly struct {
+	d cmd.Doer
+}
+
+func (d *doerOnly) Do(request *http.Request) (*http.Response, error) {
+	return d.d.Do(request)
+}
@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
 )
 
 type AppCreate struct {
@@ -137,13 +138,15 @@ func (c *AppRemove) Flags() *gnuflag.FlagSet {
 
 type UnitAdd struct {
 	tsuru.GuessingCommand
+	fs      *gnuflag.FlagSet
+	process string
 }
 
 func (c *UnitAdd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
-		Desc:    "add new units to an app.",
+		Usage:   "unit-add <# of units> [--app appname] [--process process]",
+		Desc:    "add new units to an app.\n\nThe default process type is web.",
 		MinArgs: 1,
 	}
 }
@@ -153,7 +156,7 @@ func (c *UnitAdd) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/units", appName))
+	url, err := cmd.GetUrl(unitsPath(appName, c.process))
 	if err != nil {
 		return err
 	}
@@ -169,15 +172,24 @@ func (c *UnitAdd) Run(context *cmd.Context, client cmd.Doer) error {
 	return nil
 }
 
+func (c *UnitAdd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = processFlags(&c.GuessingCommand, &c.process)
+	}
+	return c.fs
+}
+
 type UnitRemove struct {
 	tsuru.GuessingCommand
+	fs      *gnuflag.FlagSet
+	process string
 }
 
 func (c *UnitRemove) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "unit-remove",
-		Usage:   "unit-remove <# of units> [--app appname]",
-		Desc:    "remove units from an app.",
+		Usage:   "unit-remove <# of units> [--app appname] [--process process]",
+		Desc:    "remove units from an app.\n\nThe default process type is web.",
 		MinArgs: 1,
 	}
 }
@@ -187,7 +199,7 @@ func (c *UnitRemove) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/units", appName))
+	url, err := cmd.GetUrl(unitsPath(appName, c.process))
 	if err != nil {
 		return err
 	}
@@ -203,3 +215,29 @@ func (c *UnitRemove) Run(context *cmd.Context, client cmd.Doer) error {
 	fmt.Fprintln(context.Stdout, "Units successfully removed!")
 	return nil
 }
+
+func (c *UnitRemove) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = processFlags(&c.GuessingCommand, &c.process)
+	}
+	return c.fs
+}
+
+// processFlags returns the flags of the guessing command, adding the
+// --process flag, that sets the given process type.
+func processFlags(g *tsuru.GuessingCommand, process *string) *gnuflag.FlagSet {
+	fs := g.Flags()
+	fs.StringVar(process, "process", "", "The process type of the units, as declared in the Procfile.")
+	fs.StringVar(process, "p", "", "The process type of the units, as declared in the Procfile.")
+	return fs
+}
+
+// unitsPath returns the path of the units of the given app, filtered by the
+// process type, if any.
+func unitsPath(appName, process string) string {
+	path := fmt.Sprintf("/apps/%s/units", appName)
+	if process != "" {
+		path += "?process=" + url.QueryEscape(process)
+	}
+	return path
+}
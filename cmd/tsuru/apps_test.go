@@ -294,6 +294,30 @@ func (s *S) TestUnitAdd(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestUnitAddWithProcessType(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"3"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/radio/units" && req.Method == "PUT" &&
+				req.URL.Query().Get("process") == "worker"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitAdd{}
+	command.Flags().Parse(true, []string{"-a", "radio", "--process", "worker"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+}
+
 func (s *S) TestUnitAddFailure(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -312,8 +336,8 @@ func (s *S) TestUnitAddFailure(c *gocheck.C) {
 func (s *S) TestUnitAddInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
-		Desc:    "add new units to an app.",
+		Usage:   "unit-add <# of units> [--app appname] [--process process]",
+		Desc:    "add new units to an app.\n\nThe default process type is web.",
 		MinArgs: 1,
 	}
 	c.Assert((&UnitAdd{}).Info(), gocheck.DeepEquals, expected)
@@ -354,6 +378,30 @@ func (s *S) TestUnitRemove(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestUnitRemoveWithProcessType(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"2"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/vapor/units" && req.Method == "DELETE" &&
+				req.URL.Query().Get("process") == "clock"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitRemove{}
+	command.Flags().Parse(true, []string{"-a", "vapor", "-p", "clock"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+}
+
 func (s *S) TestUnitRemoveFailure(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -374,8 +422,8 @@ func (s *S) TestUnitRemoveFailure(c *gocheck.C) {
 func (s *S) TestUnitRemoveInfo(c *gocheck.C) {
 	expected := cmd.Info{
 		Name:    "unit-remove",
-		Usage:   "unit-remove <# of units> [--app appname]",
-		Desc:    "remove units from an app.",
+		Usage:   "unit-remove <# of units> [--app appname] [--process process]",
+		Desc:    "remove units from an app.\n\nThe default process type is web.",
 		MinArgs: 1,
 	}
 	c.Assert((&UnitRemove{}).Info(), gocheck.DeepEquals, &expected)
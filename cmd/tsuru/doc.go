@@ -44,7 +44,23 @@ The currently available commands are (grouped by subject):
 	unit-remove       remove units from an app
 	log               shows log for an app
 	run               runs a command in all units of an app
+	app-shell         opens an interactive shell in a unit of an app
+	app-cp            copies files to and from units of an app
 	restart           restarts the app's application server
+	app-stop          stops an app, keeping its units
+	app-start         starts a stopped app
+	app-maintenance   puts an app in maintenance, or takes it out of maintenance
+	deploy            deploys an app from a directory or archive, without git
+	app-deploys       lists the deploys of an app
+	app-rollback      deploys again the commit of a previous deploy of an app
+	app-deploy-strategy defines how an app is deployed (default or blue-green)
+	app-canary        shows, promotes or aborts the canary release of an app
+	app-metrics       shows the resource usage of the units of an app
+	autoscale-set     sets the autoscale rule of an app
+	autoscale-unset   removes the autoscale rule of an app
+	drain-add         adds a log drain to an app
+	drain-list        lists the log drains of an app
+	drain-remove      removes a log drain from an app
 	set-cname         defines a cname for an app
 	unset-cname       unsets the cname from an app
 
@@ -338,11 +354,16 @@ Add new units to the app
 
 Usage:
 
-	% tsuru unit-add <# of units> [--app appname]
+	% tsuru unit-add <# of units> [--app appname] [--process process]
 
 unit-add will add new units (instances) to an app. You need to have access to
 the app to be able to add new units to it.
 
+The --process flag defines the process type of the new units. Process types are
+declared in the Procfile of the app, or in the "processes" section of the
+app.conf file. The default process type is web, and only web units receive
+requests from the load balancer.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -350,11 +371,14 @@ Remove units from the app
 
 Usage:
 
-	% tsuru unit-remove <# of units> [--app appname]
+	% tsuru unit-remove <# of units> [--app appname] [--process process]
 
 unit-remove will remove units (instances) from an app. You need to have access
 to the app to be able to remove units from it.
 
+The --process flag defines the process type of the units that will be removed.
+The default process type is web.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -362,45 +386,121 @@ See app's logs
 
 Usage:
 
-	% tsuru log [--app appname] [--lines numberOfLines] [--source source]
+	% tsuru log [--app appname] [--lines numberOfLines] [--source source] [--unit unit] [--level level] [--grep regexp] [--since date] [--until date] [--follow]
 
 Log will show log entries for an app. These logs are not related to the code of
 the app itself, but to actions of the app in tsuru server (deployments,
 restarts, etc.).
 
+Each entry is prefixed by its source and, for logs sent by units, by the name
+of the unit that emitted it.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 The --lines flag is optional and by default its value is 10.
-The --source flag is optional.
+The --source and --unit flags are optional, and show only the logs of the given
+source or unit.
+The --level flag is optional, and shows only logs with the given level or a
+more severe one (levels are debug, info, warning, error and critical).
+The --grep flag is optional, and shows only logs matching the given regular
+expression.
+The --since and --until flags are optional, and accept a date in RFC 3339 format
+(2013-07-10T13:45:00Z) or a duration relative to now (10m, 2h).
+The --follow flag is optional, and keeps showing new logs as they arrive. When
+the connection is lost, tsuru reconnects without showing repeated lines.
+
+
+Forward app's logs to a drain
+
+Usage:
+
+	% tsuru drain-add <url> [--app appname]
+	% tsuru drain-list [--app appname]
+	% tsuru drain-remove <drain-id> [--app appname]
+
+Drains receive all logs of an app. drain-add adds a drain to an app, and the URL
+of the drain defines how logs are sent: syslog://host:port sends syslog
+messages (RFC 5424) over TCP, syslog+udp://host:port sends them over UDP, and
+https://host/path sends batches of logs, in JSON, in POST requests.
+
+drain-list lists the drains of an app, and drain-remove removes a drain, given
+its id.
+
+The --app flag is optional, see "Guessing app names" section for more details.
 
 
 Run an arbitrary command in the app machine
 
 Usage:
 
-	% tsuru run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname]
+	% tsuru run <command> [commandarg1] [commandarg2] ... [commandargn] [--app appname] [--unit unitname] [--units n] [--parallel]
 
 Run will run an arbitrary command in the app machine. Base directory for all
 commands is the root of the app. For example, in a Django app, "tsuru run" may
 show the following output:
 
 	% tsuru run polls ls
-	app.conf
-	brogui
-	deploy
-	foo
-	__init__.py
-	__init__.pyc
-	main.go
-	manage.py
-	settings.py
-	settings.pyc
-	templates
-	urls.py
-	urls.pyc
+	[polls/0] app.conf
+	[polls/0] brogui
+	[polls/0] deploy
+	[polls/0] foo
+	[polls/0] __init__.py
+	[polls/0] __init__.pyc
+	[polls/0] main.go
+	[polls/0] manage.py
+	[polls/0] settings.py
+	[polls/0] settings.pyc
+	[polls/0] templates
+	[polls/0] urls.py
+	[polls/0] urls.pyc
+
+	Unit polls/0 exited with status 0.
+
+By default, the command runs in all started units of the app, one unit after
+the other. The --unit flag runs the command in the given unit, the --units flag
+runs the command in at most the given number of units, and the --parallel flag
+runs the command in all units at the same time. Each line of the output is
+prefixed by the name of the unit that wrote it.
+
+The exit status of "tsuru run" is the highest exit status of the command among
+the units. Units that could not run the command report the status 255.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Open an interactive shell in a unit of the app
+
+Usage:
+
+	% tsuru app-shell [unitname] [--app appname]
+
+app-shell opens an interactive shell in a unit of the app, in the directory of
+the app and with the environment variables of the app (from apprc). If the unit
+name is omitted, the shell is opened in the first started unit of the app.
+Changes in the size of the terminal are forwarded to the shell.
+
+The exit status of "tsuru app-shell" is the exit status of the shell.
 
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
+Copy files to and from units of the app
+
+Usage:
+
+	% tsuru app-cp <source> <destination>
+
+app-cp copies files between the local machine and a unit of an app. One of the
+paths must be in a unit, in the format <appname>:<unitname>:<path>. If the unit
+name is omitted (<appname>::<path>), the first started unit of the app is used.
+Relative paths in the unit are relative to the directory of the app.
+
+The source, a file or a directory, is copied into the destination directory,
+which is created if it doesn't exist. For example, to download the log
+directory of the app "myapp" and upload the local directory "static":
+
+	% tsuru app-cp myapp::log /tmp/myapp
+	% tsuru app-cp static myapp:myapp/1:public
+
 Define a CNAME for the app
 
 Usage:
@@ -431,11 +531,121 @@ Restart the app's application server
 
 Usage:
 
-	% tsuru restart [--app appname]
+	% tsuru restart [--app appname] [--rolling batch]
 
 Restart will restart the application server (as defined in Procfile) of the
 application.
 
+With the --rolling flag, units are restarted in batches of the given size,
+instead of all at once. Each batch is taken out of the router while it
+restarts, and put back once its units pass the health check declared in the
+healthcheck section of app.conf. If a batch fails, the restart is aborted.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Stop and start the app
+
+Usage:
+
+	% tsuru app-stop [--app appname]
+	% tsuru app-start [--app appname]
+
+app-stop stops all units of the app, without destroying them: the units, the
+environment variables and the bound services are kept. Stopped units are
+displayed with the "stopped" status by "app-info" until the app is started
+again with app-start.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Put the app in maintenance
+
+Usage:
+
+	% tsuru app-maintenance <on|off> [--page file] [--app appname]
+
+app-maintenance on makes the router answer all requests to the app with a
+static page and the status 503, for example while running migrations. The units
+keep running, so "tsuru run" and "tsuru app-shell" still work. The --page flag
+defines the HTML file served during the maintenance; by default, the router
+serves its own 503 page. app-maintenance off makes the router deliver requests
+to the units again.
+
+Apps in maintenance are displayed with "Maintenance: on" by "app-info".
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Define how the app is deployed
+
+Usage:
+
+	% tsuru app-deploy-strategy <default|blue-green> [--app appname]
+
+With the default strategy, deploys update the code of the units in place and
+restart them. With the blue-green strategy, tsuru adds a new set of units
+(as many as the app has of each process type), deploys the new code in them
+and checks their health, using the health check declared in app.conf (see the
+restart command). Only then the router is switched to the new units, and the
+old units are removed. If the deploy fails, the new units are removed and the
+old units keep serving the app.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Manage canary releases
+
+Usage:
+
+	% tsuru deploy [dir|file] --canary <share%> [--app appname]
+	% tsuru app-canary <status|promote|abort> [--app appname]
+
+deploy --canary deploys the code in new web units (the canary), that receive
+roughly the given share of the requests while the other units keep running
+the current code. Like in blue/green deploys, the canary units must pass the
+health check declared in app.conf.
+
+app-canary status displays the error rate (responses with status 5xx) of the
+canary units and of the other units, as reported by the router. app-canary
+promote deploys the code of the canary in all units of the app, while
+app-canary abort discards it. Both remove the canary units and route the
+requests evenly again. The app can't be deployed while it has a canary.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Display the resource usage of an app
+
+Usage:
+
+	% tsuru app-metrics [--app appname] [--since period]
+
+app-metrics displays, for each unit of the app, the usage of CPU, memory and
+disk in the last sample collected by tsuru, and the average usage of CPU and
+memory in the given period (one hour by default, at most one week). Periods
+are given like 30m or 24h. Samples are collected only in provisioners that
+support it.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Scale apps automatically
+
+Usage:
+
+	% tsuru autoscale-set --min units --max units --metric <cpu|memory> --up threshold --down threshold [--cooldown seconds] [--app appname]
+	% tsuru autoscale-unset [--app appname]
+
+autoscale-set keeps the number of web units of the app between --min and
+--max, adding one unit when the metric is above the --up threshold and
+removing one unit when it's below the --down threshold. The cpu and memory
+metrics are percentages, averaged over the web units of the app. After each
+change, tsuru waits at least --cooldown seconds (300 by default) before
+scaling the app again. Apps with a canary release are not scaled.
+
+autoscale-unset removes the rule, keeping the current units of the app.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
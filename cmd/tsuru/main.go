@@ -18,6 +18,8 @@ const (
 func buildManager(name string) *cmd.Manager {
 	m := cmd.BuildBaseManager(name, version, header)
 	m.Register(&tsuru.AppRun{})
+	m.Register(&tsuru.AppShell{})
+	m.Register(&tsuru.AppCopy{})
 	m.Register(&tsuru.AppInfo{})
 	m.Register(&AppCreate{})
 	m.Register(&AppRemove{})
@@ -28,6 +30,20 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.AppGrant{})
 	m.Register(&tsuru.AppRevoke{})
 	m.Register(&tsuru.AppRestart{})
+	m.Register(&tsuru.AppStop{})
+	m.Register(&tsuru.AppStart{})
+	m.Register(&tsuru.AppMaintenance{})
+	m.Register(&tsuru.Deploy{})
+	m.Register(&tsuru.AppDeploys{})
+	m.Register(&tsuru.AppRollback{})
+	m.Register(&tsuru.AppDeployStrategy{})
+	m.Register(&tsuru.AppCanary{})
+	m.Register(&tsuru.AppMetrics{})
+	m.Register(&tsuru.AutoScaleSet{})
+	m.Register(&tsuru.AutoScaleUnset{})
+	m.Register(&tsuru.DrainAdd{})
+	m.Register(&tsuru.DrainList{})
+	m.Register(&tsuru.DrainRemove{})
 	m.Register(&tsuru.SetCName{})
 	m.Register(&tsuru.UnsetCName{})
 	m.Register(&tsuru.EnvGet{})
@@ -69,6 +69,20 @@ func (s *S) TestAppRunIsRegistered(c *gocheck.C) {
 	c.Assert(run, gocheck.FitsTypeOf, &tsuru.AppRun{})
 }
 
+func (s *S) TestAppShellIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	shell, ok := manager.Commands["app-shell"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(shell, gocheck.FitsTypeOf, &tsuru.AppShell{})
+}
+
+func (s *S) TestAppCopyIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	cp, ok := manager.Commands["app-cp"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(cp, gocheck.FitsTypeOf, &tsuru.AppCopy{})
+}
+
 func (s *S) TestAppRestartIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	restart, ok := manager.Commands["restart"]
@@ -76,6 +90,104 @@ func (s *S) TestAppRestartIsRegistered(c *gocheck.C) {
 	c.Assert(restart, gocheck.FitsTypeOf, &tsuru.AppRestart{})
 }
 
+func (s *S) TestAppStopIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	stop, ok := manager.Commands["app-stop"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(stop, gocheck.FitsTypeOf, &tsuru.AppStop{})
+}
+
+func (s *S) TestAppStartIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	start, ok := manager.Commands["app-start"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(start, gocheck.FitsTypeOf, &tsuru.AppStart{})
+}
+
+func (s *S) TestAppMaintenanceIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	maintenance, ok := manager.Commands["app-maintenance"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(maintenance, gocheck.FitsTypeOf, &tsuru.AppMaintenance{})
+}
+
+func (s *S) TestDeployIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	deploy, ok := manager.Commands["deploy"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(deploy, gocheck.FitsTypeOf, &tsuru.Deploy{})
+}
+
+func (s *S) TestAppDeployStrategyIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	strategy, ok := manager.Commands["app-deploy-strategy"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(strategy, gocheck.FitsTypeOf, &tsuru.AppDeployStrategy{})
+}
+
+func (s *S) TestAppCanaryIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	canary, ok := manager.Commands["app-canary"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(canary, gocheck.FitsTypeOf, &tsuru.AppCanary{})
+}
+
+func (s *S) TestAppMetricsIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	metrics, ok := manager.Commands["app-metrics"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(metrics, gocheck.FitsTypeOf, &tsuru.AppMetrics{})
+}
+
+func (s *S) TestAutoScaleSetIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	set, ok := manager.Commands["autoscale-set"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(set, gocheck.FitsTypeOf, &tsuru.AutoScaleSet{})
+}
+
+func (s *S) TestAutoScaleUnsetIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	unset, ok := manager.Commands["autoscale-unset"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(unset, gocheck.FitsTypeOf, &tsuru.AutoScaleUnset{})
+}
+
+func (s *S) TestAppDeploysIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	deploys, ok := manager.Commands["app-deploys"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(deploys, gocheck.FitsTypeOf, &tsuru.AppDeploys{})
+}
+
+func (s *S) TestAppRollbackIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	rollback, ok := manager.Commands["app-rollback"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(rollback, gocheck.FitsTypeOf, &tsuru.AppRollback{})
+}
+
+func (s *S) TestDrainAddIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	add, ok := manager.Commands["drain-add"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(add, gocheck.FitsTypeOf, &tsuru.DrainAdd{})
+}
+
+func (s *S) TestDrainListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["drain-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, &tsuru.DrainList{})
+}
+
+func (s *S) TestDrainRemoveIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	remove, ok := manager.Commands["drain-remove"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(remove, gocheck.FitsTypeOf, &tsuru.DrainRemove{})
+}
+
 func (s *S) TestEnvGetIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	get, ok := manager.Commands["env-get"]
@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo/bson"
+)
+
+// metricsSource is the source of the metrics used to scale apps (see
+// autoscale.SourceName). Apps are not scaled when it's nil.
+var metricsSource autoscale.Source
+
+// scale applies the autoscale rules of the apps (see app.App.Scale), using
+// the metrics provided by the given source. Failures to scale an app are
+// logged, and don't stop the scaling of the others.
+func scale(source autoscale.Source) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return fmt.Errorf("collector failed to connect to the database: %s", err)
+	}
+	defer conn.Close()
+	var apps []app.App
+	err = conn.Apps().Find(bson.M{"autoscale": bson.M{"$ne": nil}}).All(&apps)
+	if err != nil {
+		return fmt.Errorf("collector failed to list the apps with autoscale rules: %s", err)
+	}
+	for i := range apps {
+		a := &apps[i]
+		metrics, err := source.Metrics(a)
+		if err != nil {
+			log.Printf("collector failed to get the metrics of %s: %s", a.Name, err)
+			continue
+		}
+		if err = a.Scale(metrics); err != nil {
+			log.Printf("collector failed to scale %s: %s", a.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/autoscale"
+	ttesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestScale(c *gocheck.C) {
+	rule := app.AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := app.App{Name: "elastic", Framework: "python", AutoScale: &rule}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	units := s.provisioner.GetUnits(&a)
+	a.Units = []app.Unit{{Name: units[0].Name, State: units[0].Status.String()}}
+	other := app.App{Name: "rigid", Framework: "python"}
+	s.provisioner.Provision(&other)
+	defer s.provisioner.Destroy(&other)
+	err := s.conn.Apps().Insert(a, other)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": bson.M{"$in": []string{a.Name, other.Name}}})
+	source := ttesting.NewFakeMetricsSource()
+	source.SetMetrics(a.Name, autoscale.Metrics{CPU: 95})
+	source.SetMetrics(other.Name, autoscale.Metrics{CPU: 95})
+	scale(source)
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 2)
+	c.Assert(s.provisioner.GetUnits(&other), gocheck.HasLen, 1)
+}
+
+func (s *S) TestScaleWithoutMetrics(c *gocheck.C) {
+	rule := app.AutoScale{MinUnits: 1, MaxUnits: 3, Metric: "cpu", ScaleUp: 80, ScaleDown: 20}
+	a := app.App{Name: "elastic", Framework: "python", AutoScale: &rule}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	scale(ttesting.NewFakeMetricsSource())
+	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 1)
+}
@@ -5,12 +5,16 @@
 package main
 
 import (
+	"fmt"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"sort"
+	"sync"
+	"time"
 )
 
 // AppList is a list of apps. It's not thread safe.
@@ -39,38 +43,254 @@ func (l *AppList) Add(a *app.App, index int) {
 	}
 }
 
-func update(units []provision.Unit) {
-	log.Print("updating status from provisioner")
+// stopped reports whether the unit of the app was stopped by the user. Stopped
+// units keep their state until the app is started again, regardless of the
+// status reported by the provisioner.
+func stopped(a *app.App, unitName string) bool {
+	for _, u := range a.Units {
+		if u.Name == unitName {
+			return u.State == provision.StatusStopped.String()
+		}
+	}
+	return false
+}
+
+// version returns the version of the unit of the app, as recorded by the
+// deploys. The provisioner doesn't know about versions.
+func version(a *app.App, unitName string) string {
+	for _, u := range a.Units {
+		if u.Name == unitName {
+			return u.Version
+		}
+	}
+	return ""
+}
+
+// processType returns the process type of the unit of the app, as reported
+// by the provisioner or, when the provisioner doesn't report it, as recorded
+// when the unit was added.
+func processType(a *app.App, unit provision.Unit) string {
+	if unit.ProcessType != "" {
+		return unit.ProcessType
+	}
+	for _, u := range a.Units {
+		if u.Name == unit.Name {
+			return u.ProcessType
+		}
+	}
+	return ""
+}
+
+// keepHealth copies the results of the health checks of the unit of the app
+// (see app.CheckHealth) to u. Unhealthy units stay unhealthy while the
+// provisioner reports them as started, until they pass a health check.
+func keepHealth(a *app.App, u *app.Unit) {
+	for _, old := range a.Units {
+		if old.Name == u.Name {
+			u.HealthcheckFailures = old.HealthcheckFailures
+			u.HealthcheckError = old.HealthcheckError
+			u.LastHealthcheck = old.LastHealthcheck
+			if old.State == provision.StatusUnhealthy.String() && u.State == provision.StatusStarted.String() {
+				u.State = provision.StatusUnhealthy.String()
+			}
+			return
+		}
+	}
+}
+
+// loadApps loads, in a single query, the apps that own the given units, sorted
+// by name.
+func loadApps(conn *db.Storage, units []provision.Unit) (AppList, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, unit := range units {
+		if !seen[unit.AppName] {
+			seen[unit.AppName] = true
+			names = append(names, unit.AppName)
+		}
+	}
 	var l AppList
+	err := conn.Apps().Find(bson.M{"name": bson.M{"$in": names}}).Sort("name").All(&l)
+	return l, err
+}
+
+// states returns the state of each unit of the app, by unit name.
+func states(a *app.App) map[string]string {
+	s := make(map[string]string, len(a.Units))
+	for _, u := range a.Units {
+		s[u.Name] = u.State
+	}
+	return s
+}
+
+// transitions returns an event for each unit of the app whose state differs
+// from the given states.
+func transitions(a *app.App, old map[string]string, when time.Time) []app.UnitEvent {
+	var events []app.UnitEvent
+	for _, u := range a.Units {
+		if state, ok := old[u.Name]; !ok || state != u.State {
+			events = append(events, app.UnitEvent{
+				App:  a.Name,
+				Unit: u.Name,
+				From: state,
+				To:   u.State,
+				Time: when,
+			})
+		}
+	}
+	return events
+}
+
+// markGone sets the state of the units of the app that were not reported by
+// the provisioner to down. Stopped units keep their state, and so do pending
+// units, which may not have reached the provisioner yet.
+func markGone(a *app.App, reported map[string]bool) {
+	for i, u := range a.Units {
+		if reported[u.Name] {
+			continue
+		}
+		switch u.State {
+		case provision.StatusStopped.String(), provision.StatusPending.String(), provision.StatusDown.String():
+			continue
+		}
+		a.Units[i].State = provision.StatusDown.String()
+	}
+}
+
+// saveUnits saves the units of the app and its address. Each unit is updated
+// in place, and units that weren't stored (see states) are pushed to the app,
+// so units added or removed by the API in the meantime are kept. Only the
+// fields managed by the collector are updated.
+func saveUnits(conn *db.Storage, a *app.App, stored map[string]string) error {
+	err := conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"ip": a.Ip}})
+	if err != nil {
+		return err
+	}
+	for _, u := range a.Units {
+		if _, ok := stored[u.Name]; ok {
+			err = conn.Apps().Update(
+				bson.M{"name": a.Name, "units.name": u.Name},
+				bson.M{"$set": bson.M{
+					"units.$.type":                u.Type,
+					"units.$.machine":             u.Machine,
+					"units.$.instanceid":          u.InstanceId,
+					"units.$.ip":                  u.Ip,
+					"units.$.state":               u.State,
+					"units.$.healthcheckfailures": u.HealthcheckFailures,
+					"units.$.healthcheckerror":    u.HealthcheckError,
+					"units.$.lasthealthcheck":     u.LastHealthcheck,
+				}},
+			)
+		} else {
+			err = conn.Apps().Update(
+				bson.M{"name": a.Name, "units.name": bson.M{"$ne": u.Name}},
+				bson.M{"$push": bson.M{"units": u}},
+			)
+		}
+		// The unit was removed, or added, by the API in the meantime.
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// healthcheckWorkers is the maximum number of apps whose units are checked at
+// the same time.
+const healthcheckWorkers = 10
+
+// checkHealth checks the health of the units of the apps (see
+// app.CheckHealth), up to healthcheckWorkers apps at a time, so a slow app
+// doesn't delay the checks of the others.
+func checkHealth(l AppList) {
+	var wg sync.WaitGroup
+	sem := make(chan bool, healthcheckWorkers)
+	for _, a := range l {
+		wg.Add(1)
+		sem <- true
+		go func(a *app.App) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			a.CheckHealth()
+		}(a)
+	}
+	wg.Wait()
+}
+
+// update updates the units of the apps with the status reported by the
+// provisioner (see saveUnits). Units that are no longer reported by the
+// provisioner are marked as down (see markGone). Changes in the state of the
+// units are recorded as events (see app.UnitEvent).
+//
+// An app that fails to be saved doesn't stop the update of the others, but
+// an error is returned.
+func update(units []provision.Unit) error {
+	log.Print("updating status from provisioner")
+	conn, err := db.Conn()
+	if err != nil {
+		return fmt.Errorf("collector failed to connect to the database: %s", err)
+	}
+	defer conn.Close()
+	l, err := loadApps(conn, units)
+	if err != nil {
+		return fmt.Errorf("collector failed to load apps: %s", err)
+	}
+	old := make(map[string]map[string]string, len(l))
+	reported := make(map[string]map[string]bool, len(l))
+	for _, a := range l {
+		old[a.Name] = states(a)
+		reported[a.Name] = make(map[string]bool)
+	}
 	for _, unit := range units {
 		a, index := l.Search(unit.AppName)
 		if index > -1 {
-			err := a.Get()
-			if err != nil {
-				log.Printf("collector: app %q not found. Skipping.\n", unit.AppName)
-				continue
-			}
+			log.Printf("collector: app %q not found. Skipping.\n", unit.AppName)
+			continue
 		}
+		reported[a.Name][unit.Name] = true
 		u := app.Unit{}
 		u.Name = unit.Name
 		u.Type = unit.Type
+		u.ProcessType = processType(a, unit)
 		u.Machine = unit.Machine
 		u.InstanceId = unit.InstanceId
 		u.Ip = unit.Ip
 		u.State = string(unit.Status)
-		a.AddUnit(&u)
-		if index > -1 {
-			l.Add(a, index)
+		if stopped(a, unit.Name) {
+			u.State = provision.StatusStopped.String()
 		}
+		u.Version = version(a, unit.Name)
+		keepHealth(a, &u)
+		a.AddUnit(&u)
 	}
-	conn, err := db.Conn()
-	if err != nil {
-		log.Printf("collector failed to connect to the database: %s", err)
-		return
+	for _, a := range l {
+		markGone(a, reported[a.Name])
 	}
-	defer conn.Close()
+	checkHealth(l)
+	var (
+		events []app.UnitEvent
+		failed int
+	)
+	now := time.Now()
 	for _, a := range l {
 		a.Ip, _ = app.Provisioner.Addr(a)
-		conn.Apps().Update(bson.M{"name": a.Name}, a)
+		if err := saveUnits(conn, a, old[a.Name]); err != nil {
+			log.Printf("collector failed to update the app %s: %s", a.Name, err)
+			failed++
+			continue
+		}
+		events = append(events, transitions(a, old[a.Name], now)...)
+	}
+	if err := app.SaveUnitEvents(events); err != nil {
+		return fmt.Errorf("collector failed to save unit events: %s", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("collector failed to update %d of %d apps", failed, len(l))
 	}
+	return nil
 }
@@ -49,6 +49,78 @@ func (s *S) TestUpdate(c *gocheck.C) {
 	c.Assert(a.Ip, gocheck.Equals, addr)
 }
 
+func (s *S) TestUpdateKeepsStoppedUnits(c *gocheck.C) {
+	a := &app.App{
+		Name:  "umaappqq",
+		Units: []app.Unit{{Name: "i-00000zz8", State: provision.StatusStopped.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	out := getOutput()
+	out[0].Status = provision.StatusDown
+	update(out)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStopped.String())
+	c.Assert(a.Units[0].Ip, gocheck.Equals, "192.168.0.11")
+}
+
+func (s *S) TestUpdateKeepsUnitVersions(c *gocheck.C) {
+	a := &app.App{
+		Name:  "umaappqq",
+		Units: []app.Unit{{Name: "i-00000zz8", State: provision.StatusStarted.String(), Version: "abc123"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Version, gocheck.Equals, "abc123")
+	c.Assert(a.Units[0].Ip, gocheck.Equals, "192.168.0.11")
+}
+
+func (s *S) TestUpdateKeepsUnhealthyUnits(c *gocheck.C) {
+	a := &app.App{
+		Name: "umaappqq",
+		Units: []app.Unit{{
+			Name:                "i-00000zz8",
+			State:               provision.StatusUnhealthy.String(),
+			HealthcheckFailures: 3,
+			HealthcheckError:    "connection refused",
+		}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusUnhealthy.String())
+	c.Assert(a.Units[0].HealthcheckFailures, gocheck.Equals, 3)
+	c.Assert(a.Units[0].HealthcheckError, gocheck.Equals, "connection refused")
+}
+
+func (s *S) TestUpdateUnhealthyUnitThatIsDown(c *gocheck.C) {
+	a := &app.App{
+		Name:  "umaappqq",
+		Units: []app.Unit{{Name: "i-00000zz8", State: provision.StatusUnhealthy.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	out := getOutput()
+	out[0].Status = provision.StatusDown
+	update(out)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusDown.String())
+}
+
 func (s *S) TestUpdateWithMultipleUnits(c *gocheck.C) {
 	a := getApp(s.conn, c)
 	out := getOutput()
@@ -162,3 +234,157 @@ func (s *S) TestUpdateWithMultipleApps(c *gocheck.C) {
 		c.Assert(a.Units[0].Ip, gocheck.Equals, appDict["ip"])
 	}
 }
+
+func (s *S) TestUpdateDoesNotOverwriteOtherFields(c *gocheck.C) {
+	err := s.conn.Apps().Insert(bson.M{"name": "umaappqq", "cname": "www.umaapp.com", "extra": "kept"})
+	c.Assert(err, gocheck.IsNil)
+	update(getOutput())
+	var doc bson.M
+	err = s.conn.Apps().Find(bson.M{"name": "umaappqq"}).One(&doc)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(doc["cname"], gocheck.Equals, "www.umaapp.com")
+	c.Assert(doc["extra"], gocheck.Equals, "kept")
+	units, ok := doc["units"].([]interface{})
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(units, gocheck.HasLen, 1)
+}
+
+func (s *S) TestUpdateSkipsUnknownApps(c *gocheck.C) {
+	update(getOutput())
+	n, err := s.conn.Apps().Find(bson.M{"name": "umaappqq"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	n, err = s.conn.Events().Find(bson.M{"app": "umaappqq"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestUpdateRecordsUnitEvents(c *gocheck.C) {
+	a := &app.App{
+		Name: "umaappqq",
+		Units: []app.Unit{
+			{Name: "i-00000zz8", State: provision.StatusStarted.String()},
+			{Name: "i-00000zz7", State: provision.StatusStarted.String()},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	out := getOutput()
+	out[0].Status = provision.StatusDown
+	out = append(out,
+		provision.Unit{Name: "i-00000zz7", AppName: "umaappqq", Status: provision.StatusStarted},
+		provision.Unit{Name: "i-00000zz9", AppName: "umaappqq", Status: provision.StatusPending},
+	)
+	update(out)
+	var events []app.UnitEvent
+	err = s.conn.Events().Find(bson.M{"app": "umaappqq"}).Sort("unit").All(&events)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(events, gocheck.HasLen, 2)
+	c.Assert(events[0].Unit, gocheck.Equals, "i-00000zz8")
+	c.Assert(events[0].From, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(events[0].To, gocheck.Equals, provision.StatusDown.String())
+	c.Assert(events[1].Unit, gocheck.Equals, "i-00000zz9")
+	c.Assert(events[1].From, gocheck.Equals, "")
+	c.Assert(events[1].To, gocheck.Equals, provision.StatusPending.String())
+}
+
+func (s *S) TestUpdateMarksUnitsGoneFromTheProvisionerAsDown(c *gocheck.C) {
+	a := &app.App{
+		Name: "umaappqq",
+		Units: []app.Unit{
+			{Name: "i-00000zz8", State: provision.StatusStarted.String()},
+			{Name: "i-00000zz6", State: provision.StatusStarted.String()},
+			{Name: "i-00000zz5", State: provision.StatusPending.String()},
+			{Name: "i-00000zz4", State: provision.StatusStopped.String()},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 4)
+	c.Assert(a.Units[1].State, gocheck.Equals, provision.StatusDown.String())
+	c.Assert(a.Units[2].State, gocheck.Equals, provision.StatusPending.String())
+	c.Assert(a.Units[3].State, gocheck.Equals, provision.StatusStopped.String())
+	var events []app.UnitEvent
+	err = s.conn.Events().Find(bson.M{"app": a.Name}).All(&events)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(events, gocheck.HasLen, 1)
+	c.Assert(events[0].Unit, gocheck.Equals, "i-00000zz6")
+	c.Assert(events[0].From, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(events[0].To, gocheck.Equals, provision.StatusDown.String())
+}
+
+func (s *S) TestUpdateKeepsTheFieldsSetByTheAPI(c *gocheck.C) {
+	a := &app.App{
+		Name:  "umaappqq",
+		Units: []app.Unit{{Name: "i-00000zz8", ProcessType: "worker", Version: "abc123", State: "pending"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].ProcessType, gocheck.Equals, "worker")
+	c.Assert(a.Units[0].Version, gocheck.Equals, "abc123")
+	c.Assert(a.Units[0].State, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(a.Units[0].Ip, gocheck.Equals, "192.168.0.11")
+}
+
+func (s *S) TestSaveUnitsKeepsTheChangesMadeInTheMeantime(c *gocheck.C) {
+	stored := &app.App{
+		Name: "umaappqq",
+		Units: []app.Unit{
+			{Name: "i-1", Ip: "10.10.10.1", State: "pending"},
+			{Name: "i-2", Ip: "10.10.10.2", State: "started"},
+		},
+	}
+	err := s.conn.Apps().Insert(stored)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": stored.Name})
+	a := &app.App{
+		Name: "umaappqq",
+		Ip:   "umaappqq.tsuru.io",
+		Units: []app.Unit{
+			{Name: "i-1", Ip: "10.10.10.11", State: "started"},
+			{Name: "i-3", Ip: "10.10.10.3", State: "pending"},
+			{Name: "i-4", Ip: "10.10.10.4", State: "started"},
+		},
+	}
+	// i-2 was added and i-4 was removed by the API after the app was
+	// loaded by the collector.
+	err = saveUnits(s.conn, a, map[string]string{"i-1": "pending", "i-4": "started"})
+	c.Assert(err, gocheck.IsNil)
+	err = stored.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Ip, gocheck.Equals, "umaappqq.tsuru.io")
+	c.Assert(stored.Units, gocheck.HasLen, 3)
+	c.Assert(stored.Units[0].Name, gocheck.Equals, "i-1")
+	c.Assert(stored.Units[0].Ip, gocheck.Equals, "10.10.10.11")
+	c.Assert(stored.Units[0].State, gocheck.Equals, "started")
+	c.Assert(stored.Units[1].Name, gocheck.Equals, "i-2")
+	c.Assert(stored.Units[1].Ip, gocheck.Equals, "10.10.10.2")
+	c.Assert(stored.Units[2].Name, gocheck.Equals, "i-3")
+}
+
+func (s *S) TestLoadApps(c *gocheck.C) {
+	for _, name := range []string{"xikin", "flaviapp", "mysqlapi"} {
+		err := s.conn.Apps().Insert(app.App{Name: name})
+		c.Assert(err, gocheck.IsNil)
+	}
+	units := []provision.Unit{
+		{Name: "i-1", AppName: "xikin"},
+		{Name: "i-2", AppName: "flaviapp"},
+		{Name: "i-3", AppName: "xikin"},
+		{Name: "i-4", AppName: "unknown"},
+	}
+	l, err := loadApps(s.conn, units)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l, gocheck.HasLen, 2)
+	c.Assert(l[0].Name, gocheck.Equals, "flaviapp")
+	c.Assert(l[1].Name, gocheck.Equals, "xikin")
+}
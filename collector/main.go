@@ -5,30 +5,140 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/lease"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	_ "github.com/globocom/tsuru/provision/docker"
 	_ "github.com/globocom/tsuru/provision/juju"
 	_ "github.com/globocom/tsuru/provision/local"
 	stdlog "log"
 	"log/syslog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
+// leaseName is the name of the lease held by the collector that collects
+// status (see the lease package). Collectors that don't hold the lease wait
+// for it to expire.
+const leaseName = "collector"
+
+// defaultInterval is the interval between collections, when
+// collector:interval is not defined.
+const defaultInterval = time.Minute
+
+// owner identifies the collector process in the lease.
+var owner string
+
+func init() {
+	hostname, _ := os.Hostname()
+	owner = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// interval returns the interval between collections, defined by the
+// collector:interval setting, in seconds.
+func interval() time.Duration {
+	if v, err := config.GetInt("collector:interval"); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return defaultInterval
+}
+
+// leaseDuration is the duration of the lease, renewed before each phase of a
+// collection (see run).
+func leaseDuration() time.Duration {
+	return 3 * interval()
+}
+
 func collect(ticker <-chan time.Time) {
 	for _ = range ticker {
-		units, err := app.Provisioner.CollectStatus()
+		ok, err := lease.Acquire(leaseName, owner, leaseDuration())
 		if err != nil {
-			log.Printf("Failed to collect status within the provisioner: %s.", err)
+			log.Printf("Failed to acquire the collector lease: %s.", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := run(); err != nil {
+			log.Printf("Collection failed, keeping the lease without recording it: %s", err)
+			continue
+		}
+		if err := lease.Done(leaseName, owner, time.Now()); err != nil {
+			log.Printf("Failed to record the collection in the lease: %s.", err)
 		}
-		update(units)
 	}
 }
 
+// collectStatus updates the units of the apps with the status reported by
+// the provisioner.
+func collectStatus() error {
+	units, err := app.Provisioner.CollectStatus()
+	if err != nil {
+		return fmt.Errorf("Failed to collect status within the provisioner: %s.", err)
+	}
+	return update(units)
+}
+
+// run runs the phases of a collection, held by the lease. The lease is renewed
+// before each phase but the first, and the collection is aborted when it
+// can't be renewed, as another collector may have taken it. A failed phase
+// is logged and doesn't stop the next ones, but its error is returned.
+//
+// When run fails, the caller keeps the lease, so the collection is retried by
+// the same collector in the next tick, but doesn't record the run in it (see
+// lease.Done), so the last successful collection is still reported.
+func run() error {
+	phases := []func() error{
+		collectStatus,
+		collectMetrics,
+		func() error {
+			if metricsSource == nil {
+				return nil
+			}
+			return scale(metricsSource)
+		},
+	}
+	var failed error
+	for i, phase := range phases {
+		if i > 0 {
+			ok, err := lease.Acquire(leaseName, owner, leaseDuration())
+			if err == nil && !ok {
+				err = errors.New("the lease is held by another collector")
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to renew the collector lease, aborting the collection: %s.", err)
+			}
+		}
+		if err := phase(); err != nil {
+			log.Print(err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// releaseOnShutdown releases the lease when the collector is interrupted or
+// terminated, so another collector takes it without waiting for it to expire.
+func releaseOnShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if err := lease.Release(leaseName, owner); err != nil {
+			log.Printf("Failed to release the collector lease: %s.", err)
+		}
+		os.Exit(0)
+	}()
+}
+
 func fatal(err error) {
 	fmt.Fprintln(os.Stderr, err)
 	log.Fatal(err)
@@ -72,9 +182,16 @@ func main() {
 			fatal(err)
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
+		source := autoscale.SourceName()
+		metricsSource, err = autoscale.Get(source)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Using %q metrics source to scale apps.\n\n", source)
 
-		ticker := time.Tick(time.Minute)
-		fmt.Println("tsuru collector agent started...")
+		releaseOnShutdown()
+		ticker := time.Tick(interval())
+		fmt.Printf("tsuru collector agent started, collecting every %s as %q...\n", interval(), owner)
 		collect(ticker)
 	}
 }
@@ -5,11 +5,18 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/lease"
+	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
+	stdlog "log"
+	"strings"
 	"time"
 )
 
@@ -61,3 +68,82 @@ func (s *S) TestJujuCollect(c *gocheck.C) {
 	c.Assert(apps[0].Units[1].Ip, gocheck.Equals, "10.10.10.1")
 	c.Assert(apps[1].Units[1].Ip, gocheck.Equals, "10.10.10.2")
 }
+
+func (s *S) TestCollectRecordsTheRunInTheLease(c *gocheck.C) {
+	ch := make(chan time.Time)
+	go collect(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e9)
+	l, err := lease.Get(leaseName)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, owner)
+	c.Assert(l.Duration, gocheck.Equals, 3*defaultInterval)
+	c.Assert(l.Healthy(), gocheck.Equals, true)
+}
+
+func (s *S) TestCollectWithoutTheLease(c *gocheck.C) {
+	ok, err := lease.Acquire(leaseName, "other:1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	a := app.App{Name: "as_i_rise", Framework: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	createApp(s.conn, a.Name, string(provision.StatusPending))
+	defer destroyApps(s.conn)
+	ch := make(chan time.Time)
+	go collect(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e9)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	l, err := lease.Get(leaseName)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, "other:1")
+	c.Assert(l.LastRun.IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestCollectDoesNotRecordFailedRuns(c *gocheck.C) {
+	var buf bytes.Buffer
+	log.SetLogger(stdlog.New(&buf, "", 0))
+	s.provisioner.PrepareFailure("CollectStatus", errors.New("juju is down"))
+	ch := make(chan time.Time)
+	go collect(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e9)
+	l, err := lease.Get(leaseName)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, owner)
+	c.Assert(l.LastRun.IsZero(), gocheck.Equals, true)
+	c.Assert(strings.Contains(buf.String(), "Collection failed, keeping the lease without recording it: "), gocheck.Equals, true)
+}
+
+func (s *S) TestRunRenewsTheLease(c *gocheck.C) {
+	ok, err := lease.Acquire(leaseName, owner, time.Second)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	err = run()
+	c.Assert(err, gocheck.IsNil)
+	l, err := lease.Get(leaseName)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Duration, gocheck.Equals, leaseDuration())
+	c.Assert(l.Expires.After(time.Now().Add(time.Minute)), gocheck.Equals, true)
+}
+
+func (s *S) TestRunAbortsWhenTheLeaseIsLost(c *gocheck.C) {
+	l := lease.Lease{Name: leaseName, Owner: "other:1", Expires: time.Now().Add(time.Minute)}
+	err := s.conn.Leases().Insert(l)
+	c.Assert(err, gocheck.IsNil)
+	err = run()
+	c.Assert(err, gocheck.ErrorMatches, "Failed to renew the collector lease, aborting the collection: the lease is held by another collector.")
+}
+
+func (s *S) TestInterval(c *gocheck.C) {
+	c.Assert(interval(), gocheck.Equals, defaultInterval)
+	config.Set("collector:interval", 10)
+	defer config.Unset("collector:interval")
+	c.Assert(interval(), gocheck.Equals, 10*time.Second)
+}
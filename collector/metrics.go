@@ -0,0 +1,33 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/provision"
+	"time"
+)
+
+// collectMetrics stores the resource usage of the units, when the provisioner
+// is a MetricsCollector, and downsamples the old samples.
+func collectMetrics() error {
+	p, ok := app.Provisioner.(provision.MetricsCollector)
+	if !ok {
+		return nil
+	}
+	metrics, err := p.CollectMetrics()
+	if err != nil {
+		return fmt.Errorf("Failed to collect metrics within the provisioner: %s.", err)
+	}
+	now := time.Now()
+	if err = app.SaveMetrics(metrics, now); err != nil {
+		return fmt.Errorf("collector failed to save the metrics of the units: %s", err)
+	}
+	if err = app.DownsampleMetrics(now); err != nil {
+		return fmt.Errorf("collector failed to downsample the metrics of the units: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestCollectMetrics(c *gocheck.C) {
+	defer s.conn.Metrics().RemoveAll(bson.M{"app": "metered"})
+	s.provisioner.SetMetrics(
+		provision.UnitMetrics{AppName: "metered", Unit: "metered/0", CPU: 12, Memory: 34, Disk: 56},
+	)
+	collectMetrics()
+	var samples []app.MetricsSample
+	err := s.conn.Metrics().Find(bson.M{"app": "metered"}).All(&samples)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples, gocheck.HasLen, 1)
+	c.Assert(samples[0].Unit, gocheck.Equals, "metered/0")
+	c.Assert(samples[0].CPU, gocheck.Equals, 12.0)
+	c.Assert(samples[0].Memory, gocheck.Equals, 34.0)
+	c.Assert(samples[0].Disk, gocheck.Equals, 56.0)
+}
+
+func (s *S) TestCollectMetricsFailure(c *gocheck.C) {
+	s.provisioner.SetMetrics(provision.UnitMetrics{AppName: "metered", Unit: "metered/0"})
+	s.provisioner.PrepareFailure("CollectMetrics", errors.New("cgroups not mounted"))
+	collectMetrics()
+	n, err := s.conn.Metrics().Find(bson.M{"app": "metered"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
@@ -40,5 +40,9 @@ func (s *S) TearDownSuite(c *gocheck.C) {
 func (s *S) TearDownTest(c *gocheck.C) {
 	_, err := s.conn.Apps().RemoveAll(nil)
 	c.Assert(err, gocheck.IsNil)
+	_, err = s.conn.Events().RemoveAll(nil)
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.conn.Leases().RemoveAll(nil)
+	c.Assert(err, gocheck.IsNil)
 	s.provisioner.Reset()
 }
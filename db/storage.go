@@ -149,6 +149,65 @@ func (s *Storage) Teams() *mgo.Collection {
 	return s.Collection("teams")
 }
 
+// Deploys returns the deploys collection from MongoDB.
+func (s *Storage) Deploys() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"app", "-start"}}
+	c := s.Collection("deploys")
+	c.EnsureIndex(appIndex)
+	return c
+}
+
+// Logs returns the logs collection from MongoDB.
+//
+// Logs are indexed by app, date and source. Logs that have the expireat field
+// are removed by MongoDB after the given date.
+func (s *Storage) Logs() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"appname", "-date"}}
+	sourceIndex := mgo.Index{Key: []string{"appname", "source", "-date"}}
+	unitIndex := mgo.Index{Key: []string{"appname", "unit", "-date"}}
+	ttlIndex := mgo.Index{Key: []string{"expireat"}, ExpireAfter: time.Second}
+	c := s.Collection("logs")
+	c.EnsureIndex(appIndex)
+	c.EnsureIndex(sourceIndex)
+	c.EnsureIndex(unitIndex)
+	c.EnsureIndex(ttlIndex)
+	return c
+}
+
+// Metrics returns the metrics collection from MongoDB.
+//
+// Samples are indexed by app, unit and time, and removed by MongoDB a week
+// after their time.
+func (s *Storage) Metrics() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"app", "unit", "-time"}}
+	ttlIndex := mgo.Index{Key: []string{"time"}, ExpireAfter: 7 * 24 * time.Hour}
+	c := s.Collection("metrics")
+	c.EnsureIndex(appIndex)
+	c.EnsureIndex(ttlIndex)
+	return c
+}
+
+// Events returns the events collection from MongoDB.
+func (s *Storage) Events() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"app", "-time"}}
+	c := s.Collection("events")
+	c.EnsureIndex(appIndex)
+	return c
+}
+
+// Leases returns the leases collection from MongoDB.
+func (s *Storage) Leases() *mgo.Collection {
+	return s.Collection("leases")
+}
+
+// Drains returns the drains collection from MongoDB.
+func (s *Storage) Drains() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"app"}}
+	c := s.Collection("drains")
+	c.EnsureIndex(appIndex)
+	return c
+}
+
 func init() {
 	ticker = time.NewTicker(time.Hour)
 	go retire(ticker)
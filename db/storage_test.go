@@ -211,6 +211,88 @@ func (s *S) TestMethodTeamsShouldReturnTeamsCollection(c *gocheck.C) {
 	c.Assert(teams, gocheck.DeepEquals, teamsc)
 }
 
+func (s *S) TestDeploys(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	deploys := storage.Deploys()
+	deploysc := storage.Collection("deploys")
+	c.Assert(deploys, gocheck.DeepEquals, deploysc)
+}
+
+func (s *S) TestLogs(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	logs := storage.Logs()
+	logsc := storage.Collection("logs")
+	c.Assert(logs, gocheck.DeepEquals, logsc)
+}
+
+func (s *S) TestLogsIndexes(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	indexes, err := storage.Logs().Indexes()
+	c.Assert(err, gocheck.IsNil)
+	var keys [][]string
+	for _, index := range indexes {
+		keys = append(keys, index.Key)
+	}
+	c.Assert(keys, gocheck.DeepEquals, [][]string{
+		{"_id"},
+		{"appname", "-date"},
+		{"appname", "source", "-date"},
+		{"appname", "unit", "-date"},
+		{"expireat"},
+	})
+}
+
+func (s *S) TestMetrics(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	metrics := storage.Metrics()
+	metricsc := storage.Collection("metrics")
+	c.Assert(metrics, gocheck.DeepEquals, metricsc)
+}
+
+func (s *S) TestMetricsIndexes(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	indexes, err := storage.Metrics().Indexes()
+	c.Assert(err, gocheck.IsNil)
+	var keys [][]string
+	for _, index := range indexes {
+		keys = append(keys, index.Key)
+	}
+	c.Assert(keys, gocheck.DeepEquals, [][]string{
+		{"_id"},
+		{"app", "unit", "-time"},
+		{"time"},
+	})
+}
+
+func (s *S) TestEvents(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	events := storage.Events()
+	eventsc := storage.Collection("events")
+	c.Assert(events, gocheck.DeepEquals, eventsc)
+}
+
+func (s *S) TestLeases(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	leases := storage.Leases()
+	leasesc := storage.Collection("leases")
+	c.Assert(leases, gocheck.DeepEquals, leasesc)
+}
+
+func (s *S) TestDrains(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	drains := storage.Drains()
+	drainsc := storage.Collection("drains")
+	c.Assert(drains, gocheck.DeepEquals, drainsc)
+}
+
 func (s *S) TestRetire(c *gocheck.C) {
 	defer func() {
 		if r := recover(); !c.Failed() && r == nil {
@@ -0,0 +1,98 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lease provides leases stored in MongoDB, used to elect one process,
+// among several replicas, to do some periodic work.
+//
+// The holder of a lease must renew it, calling Acquire again, before it
+// expires. Other processes take the lease once it expires.
+package lease
+
+import (
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"time"
+)
+
+// Lease is the lease of a name by an owner, valid until Expires.
+type Lease struct {
+	Name     string `bson:"_id"`
+	Owner    string
+	Expires  time.Time
+	Duration time.Duration
+
+	// LastRun is the last time the owner reported the work done (see
+	// Done).
+	LastRun time.Time
+}
+
+// Healthy reports whether the work was done within the duration of the
+// lease.
+func (l *Lease) Healthy() bool {
+	return time.Since(l.LastRun) < l.Duration
+}
+
+// Acquire acquires or renews the lease of the given name for the owner, for
+// the given duration. It returns false when the lease is held by another
+// owner.
+func Acquire(name, owner string, d time.Duration) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	now := time.Now()
+	query := bson.M{
+		"_id": name,
+		"$or": []bson.M{{"owner": owner}, {"expires": bson.M{"$lt": now}}},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expires": now.Add(d), "duration": d}}
+	_, err = conn.Leases().Upsert(query, update)
+	if err != nil && strings.HasPrefix(err.Error(), "E11000") {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release releases the lease of the given name, if it's held by the owner.
+func Release(name, owner string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Leases().Update(
+		bson.M{"_id": name, "owner": owner},
+		bson.M{"$set": bson.M{"expires": time.Time{}}},
+	)
+}
+
+// Done records that the owner of the lease of the given name did its work at
+// the given time.
+func Done(name, owner string, when time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Leases().Update(
+		bson.M{"_id": name, "owner": owner},
+		bson.M{"$set": bson.M{"lastrun": when}},
+	)
+}
+
+// Get returns the lease of the given name.
+func Get(name string) (*Lease, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var l Lease
+	if err := conn.Leases().FindId(name).One(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lease
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo"
+	"launchpad.net/gocheck"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	conn *db.Storage
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	var err error
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_lease_test")
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Leases().Database.DropDatabase()
+	s.conn.Close()
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	s.conn.Leases().RemoveAll(nil)
+}
+
+func (s *S) TestAcquire(c *gocheck.C) {
+	ok, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	l, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, "host1")
+	c.Assert(l.Duration, gocheck.Equals, time.Minute)
+	c.Assert(l.Expires.After(time.Now()), gocheck.Equals, true)
+}
+
+func (s *S) TestAcquireHeldByAnotherOwner(c *gocheck.C) {
+	ok, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	ok, err = Acquire("collector", "host2", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, false)
+	l, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, "host1")
+}
+
+func (s *S) TestAcquireRenews(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	before, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	ok, err := Acquire("collector", "host1", time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	after, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(after.Expires.After(before.Expires), gocheck.Equals, true)
+}
+
+func (s *S) TestAcquireExpired(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", -time.Second)
+	c.Assert(err, gocheck.IsNil)
+	ok, err := Acquire("collector", "host2", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+	l, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.Owner, gocheck.Equals, "host2")
+}
+
+func (s *S) TestRelease(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	err = Release("collector", "host1")
+	c.Assert(err, gocheck.IsNil)
+	ok, err := Acquire("collector", "host2", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestReleaseByAnotherOwner(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	err = Release("collector", "host2")
+	c.Assert(err, gocheck.Equals, mgo.ErrNotFound)
+	ok, err := Acquire("collector", "host2", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestDone(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	now := time.Now().Truncate(time.Second)
+	err = Done("collector", "host1", now)
+	c.Assert(err, gocheck.IsNil)
+	l, err := Get("collector")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l.LastRun.Equal(now), gocheck.Equals, true)
+	c.Assert(l.Healthy(), gocheck.Equals, true)
+}
+
+func (s *S) TestDoneByAnotherOwner(c *gocheck.C) {
+	_, err := Acquire("collector", "host1", time.Minute)
+	c.Assert(err, gocheck.IsNil)
+	err = Done("collector", "host2", time.Now())
+	c.Assert(err, gocheck.Equals, mgo.ErrNotFound)
+}
+
+func (s *S) TestGetNotFound(c *gocheck.C) {
+	_, err := Get("collector")
+	c.Assert(err, gocheck.Equals, mgo.ErrNotFound)
+}
+
+func (s *S) TestHealthy(c *gocheck.C) {
+	l := Lease{Duration: time.Minute, LastRun: time.Now().Add(-30 * time.Second)}
+	c.Assert(l.Healthy(), gocheck.Equals, true)
+	l.LastRun = time.Now().Add(-2 * time.Minute)
+	c.Assert(l.Healthy(), gocheck.Equals, false)
+	l = Lease{Duration: time.Minute}
+	c.Assert(l.Healthy(), gocheck.Equals, false)
+}
@@ -0,0 +1,197 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// container represents a docker container, identified by its id.
+type container struct {
+	Id          string `bson:"_id"`
+	AppName     string
+	Type        string
+	ProcessType string
+	Ip          string
+	Status      string
+}
+
+// containerConfig is the configuration sent to the docker API when creating
+// a new container.
+type containerConfig struct {
+	Image        string
+	Cmd          []string
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+}
+
+// containerInfo is the subset of the information returned by the docker API
+// when inspecting a container that tsuru cares about.
+type containerInfo struct {
+	Id    string
+	State struct {
+		Running  bool
+		ExitCode int
+	}
+	NetworkSettings struct {
+		IPAddress string
+	}
+}
+
+// dockerError is returned when the docker API responds with an unexpected
+// status code.
+type dockerError struct {
+	code int
+	body string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.code, strings.TrimSpace(e.body))
+}
+
+// dockerServer returns the address of the docker remote API, as defined in
+// the docker:server setting.
+func dockerServer() (string, error) {
+	server, err := config.GetString("docker:server")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(server, "/"), nil
+}
+
+// do sends a request to the docker API and decodes the JSON response in
+// result, if result is not nil.
+func do(method, path string, body interface{}, result interface{}) error {
+	server, err := dockerServer()
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	request, err := http.NewRequest(method, server+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return &dockerError{code: response.StatusCode, body: string(data)}
+	}
+	if result != nil && len(data) > 0 {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+// image returns the name of the image used for containers of the given
+// framework. It's composed by the docker:repository-namespace setting and the
+// name of the framework.
+func image(framework string) string {
+	namespace, err := config.GetString("docker:repository-namespace")
+	if err != nil {
+		namespace = "tsuru"
+	}
+	return namespace + "/" + framework
+}
+
+// runCmd returns the command that will be executed in new containers, as
+// defined in the docker:run-cmd:bin setting.
+func runCmd() ([]string, error) {
+	bin, err := config.GetString("docker:run-cmd:bin")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(bin), nil
+}
+
+// newContainer creates and starts a new container of the given process type
+// for the app, returning the container with its id and ip filled. Containers
+// of process types other than web receive the process type as the last
+// argument of the run command.
+func newContainer(appName, framework, process string) (*container, error) {
+	cmd, err := runCmd()
+	if err != nil {
+		return nil, err
+	}
+	if process == "" {
+		process = provision.WebProcess
+	} else if process != provision.WebProcess {
+		cmd = append(cmd, process)
+	}
+	cfg := containerConfig{Image: image(framework), Cmd: cmd}
+	if port, err := config.GetString("docker:run-cmd:port"); err == nil {
+		cfg.ExposedPorts = map[string]struct{}{port + "/tcp": {}}
+	}
+	var created struct {
+		Id string
+	}
+	if err := do("POST", "/containers/create", cfg, &created); err != nil {
+		return nil, err
+	}
+	c := container{Id: created.Id, AppName: appName, Type: framework, ProcessType: process}
+	if err := c.start(); err != nil {
+		return &c, err
+	}
+	info, err := c.inspect()
+	if err != nil {
+		return &c, err
+	}
+	c.Ip = info.NetworkSettings.IPAddress
+	return &c, nil
+}
+
+// inspect returns information about the container.
+func (c *container) inspect() (*containerInfo, error) {
+	var info containerInfo
+	err := do("GET", "/containers/"+c.Id+"/json", nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// start starts the container.
+func (c *container) start() error {
+	return do("POST", "/containers/"+c.Id+"/start", nil, nil)
+}
+
+// stop stops the container.
+func (c *container) stop() error {
+	return do("POST", "/containers/"+c.Id+"/stop?t=10", nil, nil)
+}
+
+// restart restarts the container.
+func (c *container) restart() error {
+	return do("POST", "/containers/"+c.Id+"/restart?t=10", nil, nil)
+}
+
+// remove stops and removes the container.
+func (c *container) remove() error {
+	c.stop()
+	return do("DELETE", "/containers/"+c.Id, nil, nil)
+}
@@ -0,0 +1,78 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/globocom/config"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestImage(c *gocheck.C) {
+	c.Assert(image("python"), gocheck.Equals, "tsuru/python")
+}
+
+func (s *S) TestImageWithoutNamespace(c *gocheck.C) {
+	old, _ := config.GetString("docker:repository-namespace")
+	defer config.Set("docker:repository-namespace", old)
+	config.Unset("docker:repository-namespace")
+	c.Assert(image("ruby"), gocheck.Equals, "tsuru/ruby")
+}
+
+func (s *S) TestNewContainer(c *gocheck.C) {
+	cont, err := newContainer("myapp", "python", "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.AppName, gocheck.Equals, "myapp")
+	c.Assert(cont.Type, gocheck.Equals, "python")
+	c.Assert(cont.ProcessType, gocheck.Equals, "web")
+	c.Assert(cont.Ip, gocheck.Equals, "172.16.42.1")
+	fake := s.server.container(cont.Id)
+	c.Assert(fake, gocheck.NotNil)
+	c.Assert(fake.image, gocheck.Equals, "tsuru/python")
+	c.Assert(fake.cmd, gocheck.DeepEquals, []string{"/var/lib/tsuru/start"})
+	c.Assert(fake.running, gocheck.Equals, true)
+}
+
+func (s *S) TestNewContainerWithProcessType(c *gocheck.C) {
+	cont, err := newContainer("myapp", "python", "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.ProcessType, gocheck.Equals, "worker")
+	fake := s.server.container(cont.Id)
+	c.Assert(fake, gocheck.NotNil)
+	c.Assert(fake.cmd, gocheck.DeepEquals, []string{"/var/lib/tsuru/start", "worker"})
+}
+
+func (s *S) TestContainerIsWeb(c *gocheck.C) {
+	c.Assert((&container{}).isWeb(), gocheck.Equals, true)
+	c.Assert((&container{ProcessType: "web"}).isWeb(), gocheck.Equals, true)
+	c.Assert((&container{ProcessType: "clock"}).isWeb(), gocheck.Equals, false)
+}
+
+func (s *S) TestContainerStopAndStart(c *gocheck.C) {
+	cont, err := newContainer("myapp", "python", "")
+	c.Assert(err, gocheck.IsNil)
+	err = cont.stop()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.server.container(cont.Id).running, gocheck.Equals, false)
+	err = cont.start()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.server.container(cont.Id).running, gocheck.Equals, true)
+}
+
+func (s *S) TestContainerRemove(c *gocheck.C) {
+	cont, err := newContainer("myapp", "python", "")
+	c.Assert(err, gocheck.IsNil)
+	err = cont.remove()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.server.container(cont.Id), gocheck.IsNil)
+}
+
+func (s *S) TestContainerInspectNotFound(c *gocheck.C) {
+	cont := container{Id: "unknown"}
+	_, err := cont.inspect()
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*dockerError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.code, gocheck.Equals, 404)
+}
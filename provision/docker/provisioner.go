@@ -0,0 +1,584 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package docker provides a provisioner implementation that runs tsuru apps
+// in docker containers, managed through the docker remote API.
+//
+// In order to use the provisioner, just import tsuru's provision package and
+// docker provision package. Then call provision.Get("docker") to get an
+// instance of DockerProvisioner.
+//
+// Requests are delivered to the containers through the router defined by the
+// docker:router setting (nginx by default).
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/nginx"
+	"io"
+	"io/ioutil"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"os/exec"
+	"time"
+)
+
+func init() {
+	provision.Register("docker", &DockerProvisioner{})
+}
+
+// DockerProvisioner is an implementation for the Provisioner interface that
+// uses docker containers as units. Units are stored in the collection
+// defined by the docker:collection setting.
+type DockerProvisioner struct{}
+
+func (p *DockerProvisioner) collection() *mgo.Collection {
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		log.Fatalf("FATAL: %s.", err)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Printf("Failed to connect to the database: %s", err)
+	}
+	return conn.Collection(name)
+}
+
+func (p *DockerProvisioner) router() (router.Router, error) {
+	name, err := config.GetString("docker:router")
+	if err != nil {
+		name = "nginx"
+	}
+	return router.Get(name)
+}
+
+// containers returns all containers of the given app.
+func (p *DockerProvisioner) containers(app provision.App) ([]container, error) {
+	var containers []container
+	err := p.collection().Find(bson.M{"appname": app.GetName()}).All(&containers)
+	return containers, err
+}
+
+// addContainer creates a container of the given process type for the app and
+// stores it in the database. Only web containers are added to the router, and
+// only when route is true.
+func (p *DockerProvisioner) addContainer(app provision.App, process string, route bool) (*container, error) {
+	c, err := newContainer(app.GetName(), app.GetFramework(), process)
+	if err != nil {
+		log.Printf("[docker] Failed to create container for the app %q: %s", app.GetName(), err)
+		if c != nil {
+			c.remove()
+		}
+		return nil, err
+	}
+	c.Status = provision.StatusStarted.String()
+	if err = p.collection().Insert(c); err != nil {
+		c.remove()
+		return nil, err
+	}
+	if !route || !c.isWeb() {
+		return c, nil
+	}
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.AddRoute(app.GetName(), c.Ip); err != nil {
+		log.Printf("[docker] Failed to add route to the container %q: %s", c.Id, err)
+	}
+	return c, nil
+}
+
+func (p *DockerProvisioner) Provision(app provision.App) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if err = r.AddBackend(app.GetName()); err != nil {
+		return err
+	}
+	_, err = p.addContainer(app, provision.WebProcess, true)
+	if err != nil {
+		app.Log("Failed to create container: "+err.Error(), "tsuru")
+		r.RemoveBackend(app.GetName())
+	}
+	return err
+}
+
+func (p *DockerProvisioner) Restart(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := c.restart(); err != nil {
+			msg := fmt.Sprintf("Failed to restart the app (%s)", err)
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: msg, Err: err}
+		}
+	}
+	return nil
+}
+
+// Stop stops the containers of the app, keeping them in the database with
+// the stopped status. The routes to web containers are removed from the
+// router, and added back by Start.
+func (p *DockerProvisioner) Stop(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := c.stop(); err != nil {
+			msg := fmt.Sprintf("Failed to stop the app (%s)", err)
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: msg, Err: err}
+		}
+		if r, err := p.router(); err == nil && c.isWeb() {
+			if err := r.RemoveRoute(app.GetName(), c.Ip); err != nil {
+				log.Printf("[docker] Failed to remove route to the container %q: %s", c.Id, err)
+			}
+		}
+		c.Status = provision.StatusStopped.String()
+		p.collection().UpdateId(c.Id, c)
+	}
+	return nil
+}
+
+// Start starts the containers of the app, adding the routes to web
+// containers back to the router. Containers may get a new IP when started, so
+// the routes use the IP reported by docker.
+func (p *DockerProvisioner) Start(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := c.start(); err != nil {
+			msg := fmt.Sprintf("Failed to start the app (%s)", err)
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: msg, Err: err}
+		}
+		ip := c.Ip
+		if info, err := c.inspect(); err == nil {
+			ip = info.NetworkSettings.IPAddress
+		}
+		p.updateRoute(&c, ip)
+		c.Status = provision.StatusStarted.String()
+		p.collection().UpdateId(c.Id, c)
+	}
+	return nil
+}
+
+// RestartUnit restarts the container of the given unit. The route to the
+// container is not touched, even if the container gets a new IP: the new
+// route is added by EnableUnit.
+func (p *DockerProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	c, err := p.getContainer(app, unit.GetName())
+	if err != nil {
+		return err
+	}
+	if err = c.restart(); err != nil {
+		msg := fmt.Sprintf("Failed to restart the unit %s (%s)", unit.GetName(), err)
+		app.Log(msg, "tsuru-provisioner")
+		return &provision.Error{Reason: msg, Err: err}
+	}
+	if info, err := c.inspect(); err == nil && info.NetworkSettings.IPAddress != c.Ip {
+		c.Ip = info.NetworkSettings.IPAddress
+		p.collection().UpdateId(c.Id, c)
+	}
+	return nil
+}
+
+// DisableUnit removes the route to the container of the given unit.
+func (p *DockerProvisioner) DisableUnit(app provision.App, unit provision.AppUnit) error {
+	return p.setUnitRoute(app, unit, false)
+}
+
+// EnableUnit adds the route to the container of the given unit back to the
+// router.
+func (p *DockerProvisioner) EnableUnit(app provision.App, unit provision.AppUnit) error {
+	return p.setUnitRoute(app, unit, true)
+}
+
+func (p *DockerProvisioner) setUnitRoute(app provision.App, unit provision.AppUnit, enabled bool) error {
+	c, err := p.getContainer(app, unit.GetName())
+	if err != nil {
+		return err
+	}
+	if !c.isWeb() {
+		return nil
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return r.AddRoute(app.GetName(), c.Ip)
+	}
+	return r.RemoveRoute(app.GetName(), c.Ip)
+}
+
+// updateRoute changes the IP of the container, replacing its route in the
+// router when it's a web container.
+func (p *DockerProvisioner) updateRoute(c *container, ip string) {
+	old := c.Ip
+	c.Ip = ip
+	if !c.isWeb() {
+		return
+	}
+	r, err := p.router()
+	if err != nil {
+		return
+	}
+	if old != "" {
+		r.RemoveRoute(c.AppName, old)
+	}
+	if err = r.AddRoute(c.AppName, ip); err != nil {
+		log.Printf("[docker] Failed to add route to the container %q: %s", c.Id, err)
+	}
+}
+
+func (p *DockerProvisioner) Destroy(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	go func(c []container) {
+		for _, cont := range c {
+			if err := cont.remove(); err != nil {
+				log.Printf("[docker] Failed to remove container %q: %s", cont.Id, err)
+			}
+		}
+	}(containers)
+	_, err = p.collection().RemoveAll(bson.M{"appname": app.GetName()})
+	if err != nil {
+		return err
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return r.RemoveBackend(app.GetName())
+}
+
+func (p *DockerProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+	return p.AddProcessUnits(app, n, provision.WebProcess)
+}
+
+// AddProcessUnits adds n containers of the given process type to the app.
+func (p *DockerProvisioner) AddProcessUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	return p.addContainers(app, n, process, true)
+}
+
+// AddStandbyUnits adds n containers of the given process type to the app,
+// without adding them to the router.
+func (p *DockerProvisioner) AddStandbyUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	return p.addContainers(app, n, process, false)
+}
+
+func (p *DockerProvisioner) addContainers(app provision.App, n uint, process string, route bool) ([]provision.Unit, error) {
+	if n < 1 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	units := make([]provision.Unit, n)
+	for i := uint(0); i < n; i++ {
+		c, err := p.addContainer(app, process, route)
+		if err != nil {
+			return units[:i], err
+		}
+		units[i] = c.asUnit()
+	}
+	return units, nil
+}
+
+// SwitchUnits replaces the routes to the old web containers with routes to
+// the standby web containers.
+func (p *DockerProvisioner) SwitchUnits(app provision.App, standby, old []provision.AppUnit) error {
+	add, err := p.webAddresses(app, standby)
+	if err != nil {
+		return err
+	}
+	remove, err := p.webAddresses(app, old)
+	if err != nil {
+		return err
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return router.Switch(r, app.GetName(), add, remove)
+}
+
+// webAddresses returns the IPs of the web containers of the given units.
+func (p *DockerProvisioner) webAddresses(app provision.App, units []provision.AppUnit) ([]string, error) {
+	var addresses []string
+	for _, u := range units {
+		c, err := p.getContainer(app, u.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if c.isWeb() {
+			addresses = append(addresses, c.Ip)
+		}
+	}
+	return addresses, nil
+}
+
+// getContainer returns the container of the given unit of the app.
+func (p *DockerProvisioner) getContainer(app provision.App, unitName string) (*container, error) {
+	var c container
+	err := p.collection().Find(bson.M{"_id": unitName, "appname": app.GetName()}).One(&c)
+	if err != nil {
+		return nil, fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), unitName)
+	}
+	return &c, nil
+}
+
+func (p *DockerProvisioner) RemoveUnit(app provision.App, unitName string) error {
+	c, err := p.getContainer(app, unitName)
+	if err != nil {
+		return err
+	}
+	if err = c.remove(); err != nil {
+		return err
+	}
+	if r, err := p.router(); err == nil && c.isWeb() {
+		if err := r.RemoveRoute(app.GetName(), c.Ip); err != nil {
+			log.Printf("[docker] Failed to remove route to the container %q: %s", c.Id, err)
+		}
+	}
+	return p.collection().RemoveId(c.Id)
+}
+
+func (p *DockerProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("App %q has no units.", app.GetName())
+	}
+	for _, c := range containers {
+		if err := ssh(nil, stdout, stderr, c.Ip, cmd, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecuteCommandOnUnit runs a command in the container of the given unit,
+// using ssh.
+func (p *DockerProvisioner) ExecuteCommandOnUnit(stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return provision.WrapExitError(ssh(nil, stdout, stderr, unit.GetIp(), cmd, args...))
+}
+
+// ExecuteCommandOnUnitWithInput runs a command in the container of the given
+// unit, using ssh, sending stdin to the standard input of the command.
+func (p *DockerProvisioner) ExecuteCommandOnUnitWithInput(stdin io.Reader, stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return provision.WrapExitError(ssh(stdin, stdout, stderr, unit.GetIp(), cmd, args...))
+}
+
+// ssh runs a command in the container with the given IP.
+func ssh(stdin io.Reader, stdout, stderr io.Writer, ip, cmd string, args ...string) error {
+	arguments := []string{"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", ip, cmd}
+	arguments = append(arguments, args...)
+	command := exec.Command("ssh", arguments...)
+	command.Stdin = stdin
+	command.Stdout = stdout
+	command.Stderr = stderr
+	return command.Run()
+}
+
+// Shell opens an interactive shell in the given unit, using ssh.
+func (p *DockerProvisioner) Shell(opts provision.ShellOptions) error {
+	cmd := exec.Command("ssh", "-t", "-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", opts.Unit.GetIp(), opts.Cmd)
+	return provision.RunShell(cmd, opts)
+}
+
+// Upload extracts the archive in the given path of each container of the app,
+// using ssh.
+func (p *DockerProvisioner) Upload(app provision.App, archive io.Reader, path string, w io.Writer) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("App %q has no units.", app.GetName())
+	}
+	content, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	cmd := provision.ExtractCommand(path)
+	for _, c := range containers {
+		command := exec.Command("ssh", "-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", c.Ip, cmd)
+		command.Stdin = bytes.NewReader(content)
+		command.Stdout = w
+		command.Stderr = w
+		if err := command.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *DockerProvisioner) CollectStatus() ([]provision.Unit, error) {
+	var containers []container
+	err := p.collection().Find(nil).All(&containers)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]provision.Unit, len(containers))
+	for i, c := range containers {
+		if c.Status == provision.StatusStopped.String() {
+			units[i] = c.asUnit()
+			continue
+		}
+		status := provision.StatusDown
+		info, err := c.inspect()
+		if err != nil {
+			status = provision.StatusError
+		} else if info.State.Running {
+			status = provision.StatusStarted
+			c.Ip = info.NetworkSettings.IPAddress
+		}
+		if c.Status != status.String() {
+			c.Status = status.String()
+			p.collection().UpdateId(c.Id, c)
+		}
+		units[i] = c.asUnit()
+	}
+	return units, nil
+}
+
+// maintenanceRouter returns the router of the provisioner, when it supports
+// maintenance mode.
+func (p *DockerProvisioner) maintenanceRouter() (router.MaintenanceRouter, error) {
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	mr, ok := r.(router.MaintenanceRouter)
+	if !ok {
+		return nil, provision.ErrMaintenanceNotSupported
+	}
+	return mr, nil
+}
+
+// StartMaintenance makes the router serve the given page to all requests to
+// the app.
+func (p *DockerProvisioner) StartMaintenance(app provision.App, page []byte) error {
+	r, err := p.maintenanceRouter()
+	if err != nil {
+		return err
+	}
+	return r.StartMaintenance(app.GetName(), page)
+}
+
+// StopMaintenance makes the router deliver requests to the units of the app
+// again.
+func (p *DockerProvisioner) StopMaintenance(app provision.App) error {
+	r, err := p.maintenanceRouter()
+	if err != nil {
+		return err
+	}
+	return r.StopMaintenance(app.GetName())
+}
+
+// canaryRouter returns the router of the provisioner, when it supports
+// weighted routes and statistics.
+func (p *DockerProvisioner) canaryRouter() (router.CanaryRouter, error) {
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	cr, ok := r.(router.CanaryRouter)
+	if !ok {
+		return nil, provision.ErrCanaryNotSupported
+	}
+	return cr, nil
+}
+
+// SetUnitsWeight sets the weight of the routes to the given web containers.
+func (p *DockerProvisioner) SetUnitsWeight(app provision.App, units []provision.AppUnit, weight int) error {
+	addresses, err := p.webAddresses(app, units)
+	if err != nil {
+		return err
+	}
+	r, err := p.canaryRouter()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addresses {
+		if err := r.SetRouteWeight(app.GetName(), addr, weight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnitsStats returns the statistics of the routes to the given web containers
+// since the given time.
+func (p *DockerProvisioner) UnitsStats(app provision.App, units []provision.AppUnit, since time.Time) (map[string]provision.UnitStats, error) {
+	names := make(map[string]string, len(units))
+	for _, u := range units {
+		c, err := p.getContainer(app, u.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if c.isWeb() {
+			names[c.Ip] = u.GetName()
+		}
+	}
+	r, err := p.canaryRouter()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := r.RouteStats(app.GetName(), since)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]provision.UnitStats, len(names))
+	for addr, name := range names {
+		s := routes[addr]
+		stats[name] = provision.UnitStats{Requests: s.Requests, Errors: s.Errors}
+	}
+	return stats, nil
+}
+
+func (p *DockerProvisioner) Addr(app provision.App) (string, error) {
+	r, err := p.router()
+	if err != nil {
+		return "", err
+	}
+	return r.Addr(app.GetName())
+}
+
+// asUnit converts the container to a provision.Unit.
+func (c *container) asUnit() provision.Unit {
+	return provision.Unit{
+		Name:        c.Id,
+		AppName:     c.AppName,
+		Type:        c.Type,
+		ProcessType: c.ProcessType,
+		InstanceId:  c.Id,
+		Ip:          c.Ip,
+		Status:      provision.Status(c.Status),
+	}
+}
+
+// isWeb reports whether the container runs the web process of the app.
+// Containers created before the introduction of process types are web
+// containers.
+func (c *container) isWeb() bool {
+	return c.ProcessType == "" || c.ProcessType == provision.WebProcess
+}
@@ -0,0 +1,464 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	rtesting "github.com/globocom/tsuru/router/testing"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"strings"
+	"time"
+)
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	p, err := provision.Get("docker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p, gocheck.FitsTypeOf, &DockerProvisioner{})
+}
+
+func (s *S) TestProvisionerProvision(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.IsNil)
+	var containers []container
+	err = s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).All(&containers)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 1)
+	c.Assert(containers[0].Type, gocheck.Equals, "python")
+	c.Assert(containers[0].Ip, gocheck.Equals, "172.16.42.1")
+	c.Assert(containers[0].Status, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, true)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "172.16.42.1"), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerProvisionFailure(c *gocheck.C) {
+	s.server.Close()
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.NotNil)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
+}
+
+func (s *S) TestProvisionerAddUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.AppName, gocheck.Equals, "myapp")
+		c.Assert(u.Status, gocheck.Equals, provision.StatusStarted)
+		c.Assert(s.server.container(u.Name), gocheck.NotNil)
+	}
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestProvisionerAddProcessUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	units, err := p.AddProcessUnits(app, 2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.ProcessType, gocheck.Equals, "worker")
+		c.Assert(s.server.container(u.Name).cmd, gocheck.DeepEquals, []string{"/var/lib/tsuru/start", "worker"})
+	}
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.HasLen, 0)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp", "processtype": "worker"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestDockerProvisionerIsAProcessProvisioner(c *gocheck.C) {
+	var _ provision.ProcessProvisioner = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerAddZeroUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 0)
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "Cannot add zero units.")
+}
+
+func (s *S) TestProvisionerRemoveUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	units, err := p.AddUnits(app, 2)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.HasLen, 2)
+	err = p.RemoveUnit(app, units[0].Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.HasLen, 1)
+	c.Assert(s.server.container(units[0].Name), gocheck.IsNil)
+	c.Assert(s.server.container(units[1].Name), gocheck.NotNil)
+	n, err := s.conn.Collection(s.collName).FindId(units[0].Name).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestProvisionerRemoveUnknownUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RemoveUnit(app, "unknown")
+	c.Assert(err, gocheck.ErrorMatches, `App "myapp" does not have a unit named "unknown".`)
+}
+
+func (s *S) TestProvisionerRestart(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	err = p.Restart(app)
+	c.Assert(err, gocheck.IsNil)
+	requests := s.server.Requests()
+	c.Assert(requests[len(requests)-1], gocheck.Equals, "POST /containers/"+units[0].Name+"/restart")
+}
+
+func (s *S) TestDockerProvisionerIsARollingRestarter(c *gocheck.C) {
+	var _ provision.RollingRestarter = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerRestartUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2)
+	c.Assert(err, gocheck.IsNil)
+	err = p.RestartUnit(app, &testing.FakeUnit{Name: units[1].Name})
+	c.Assert(err, gocheck.IsNil)
+	requests := strings.Join(s.server.Requests(), "\n")
+	c.Assert(strings.Contains(requests, "POST /containers/"+units[1].Name+"/restart"), gocheck.Equals, true)
+	c.Assert(strings.Contains(requests, "POST /containers/"+units[0].Name+"/restart"), gocheck.Equals, false)
+}
+
+func (s *S) TestProvisionerRestartUnitNotFound(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RestartUnit(app, &testing.FakeUnit{Name: "myapp/9"})
+	c.Assert(err, gocheck.ErrorMatches, `App "myapp" does not have a unit named "myapp/9".`)
+}
+
+func (s *S) TestProvisionerDisableAndEnableUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	units, err := p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	unit := &testing.FakeUnit{Name: units[0].Name}
+	err = p.DisableUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", units[0].Ip), gocheck.Equals, false)
+	err = p.EnableUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", units[0].Ip), gocheck.Equals, true)
+}
+
+func (s *S) TestDockerProvisionerIsABlueGreenProvisioner(c *gocheck.C) {
+	var _ provision.BlueGreenProvisioner = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerAddStandbyUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	units, err := p.AddStandbyUnits(app, 2, provision.WebProcess)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.Status, gocheck.Equals, provision.StatusStarted)
+		c.Assert(s.server.container(u.Name), gocheck.NotNil)
+	}
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.HasLen, 0)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestProvisionerSwitchUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	old, err := p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	standby, err := p.AddStandbyUnits(app, 1, provision.WebProcess)
+	c.Assert(err, gocheck.IsNil)
+	worker, err := p.AddStandbyUnits(app, 1, "worker")
+	c.Assert(err, gocheck.IsNil)
+	err = p.SwitchUnits(app,
+		[]provision.AppUnit{&testing.FakeUnit{Name: standby[0].Name}, &testing.FakeUnit{Name: worker[0].Name}},
+		[]provision.AppUnit{&testing.FakeUnit{Name: old[0].Name}},
+	)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{standby[0].Ip})
+}
+
+func (s *S) TestDockerProvisionerIsACanaryProvisioner(c *gocheck.C) {
+	var _ provision.CanaryProvisioner = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerSetUnitsWeight(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	canary, err := p.AddStandbyUnits(app, 1, provision.WebProcess)
+	c.Assert(err, gocheck.IsNil)
+	worker, err := p.AddStandbyUnits(app, 1, "worker")
+	c.Assert(err, gocheck.IsNil)
+	units := []provision.AppUnit{&testing.FakeUnit{Name: canary[0].Name}, &testing.FakeUnit{Name: worker[0].Name}}
+	err = p.SetUnitsWeight(app, units, 3)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{canary[0].Ip})
+	c.Assert(rtesting.FakeRouter.Weight("myapp", canary[0].Ip), gocheck.Equals, 3)
+}
+
+func (s *S) TestProvisionerUnitsStats(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	added, err := p.AddUnits(app, 2)
+	c.Assert(err, gocheck.IsNil)
+	rtesting.FakeRouter.SetStats("myapp", added[0].Ip, router.RouteStats{Requests: 10, Errors: 2})
+	units := []provision.AppUnit{&testing.FakeUnit{Name: added[0].Name}, &testing.FakeUnit{Name: added[1].Name}}
+	stats, err := p.UnitsStats(app, units, time.Now())
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]provision.UnitStats{
+		added[0].Name: {Requests: 10, Errors: 2},
+		added[1].Name: {},
+	}
+	c.Assert(stats, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDockerProvisionerIsAMaintenanceProvisioner(c *gocheck.C) {
+	var _ provision.MaintenanceProvisioner = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerMaintenance(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	err := p.StartMaintenance(app, []byte("closed"))
+	c.Assert(err, gocheck.IsNil)
+	ok, page := rtesting.FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(string(page), gocheck.Equals, "closed")
+	err = p.StopMaintenance(app)
+	c.Assert(err, gocheck.IsNil)
+	ok, _ = rtesting.FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestDockerProvisionerIsAStartStopper(c *gocheck.C) {
+	var _ provision.StartStopper = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerStop(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	units, err := p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", units[0].Ip), gocheck.Equals, true)
+	err = p.Stop(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.HasLen, 0)
+	c.Assert(s.server.container(units[0].Name).running, gocheck.Equals, false)
+	var cont container
+	err = s.conn.Collection(s.collName).FindId(units[0].Name).One(&cont)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusStopped.String())
+	collected, err := p.CollectStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(collected, gocheck.HasLen, 1)
+	c.Assert(collected[0].Status, gocheck.Equals, provision.StatusStopped)
+}
+
+func (s *S) TestProvisionerStart(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	rtesting.FakeRouter.AddBackend("myapp")
+	defer rtesting.FakeRouter.RemoveBackend("myapp")
+	units, err := p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	err = p.Stop(app)
+	c.Assert(err, gocheck.IsNil)
+	err = p.Start(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.server.container(units[0].Name).running, gocheck.Equals, true)
+	var cont container
+	err = s.conn.Collection(s.collName).FindId(units[0].Name).One(&cont)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", cont.Ip), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerDestroy(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.IsNil)
+	_, err = p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	err = p.Destroy(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("myapp", "python", 0)
+	_, err = p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	err = p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
+	c.Assert(buf.String(), gocheck.Equals, "-l ubuntu -q -o StrictHostKeyChecking no 172.16.42.1 ls -lh")
+}
+
+func (s *S) TestProvisionerExecuteCommandNoUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.ExecuteCommand(&buf, &buf, app, "ls")
+	c.Assert(err, gocheck.ErrorMatches, `App "myapp" has no units.`)
+}
+
+func (s *S) TestDockerProvisionerIsAUnitCommandExecutor(c *gocheck.C) {
+	var _ provision.UnitCommandExecutor = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerExecuteCommandOnUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err = p.ExecuteCommandOnUnit(&buf, &buf, app, app.ProvisionUnits()[0], "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "-l ubuntu -q -o StrictHostKeyChecking no 10.10.10.1 ls -lh")
+}
+
+func (s *S) TestDockerProvisionerIsAnInputCommandExecutor(c *gocheck.C) {
+	var _ provision.InputCommandExecutor = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerExecuteCommandOnUnitWithInput(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err = p.ExecuteCommandOnUnitWithInput(strings.NewReader("archive"), &buf, &buf, app, app.ProvisionUnits()[0], "tar", "-xzf", "-")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "-l ubuntu -q -o StrictHostKeyChecking no 10.10.10.1 tar -xzf -")
+}
+
+func (s *S) TestDockerProvisionerIsAShellProvisioner(c *gocheck.C) {
+	var _ provision.ShellProvisioner = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerShell(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("myapp", "python", 1)
+	opts := provision.ShellOptions{App: app, Unit: app.ProvisionUnits()[0], Cmd: "bash -l", Stdout: &buf}
+	err = p.Shell(opts)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, "-t -l ubuntu -q -o StrictHostKeyChecking no 10.10.10.1 bash -l")
+}
+
+func (s *S) TestDockerProvisionerIsAnUploader(c *gocheck.C) {
+	var _ provision.Uploader = &DockerProvisioner{}
+}
+
+func (s *S) TestProvisionerUpload(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("myapp", "python", 0)
+	_, err = p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	err = p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.IsNil)
+	cmd := provision.ExtractCommand("/home/application/current")
+	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
+	c.Assert(buf.String(), gocheck.Equals, "-l ubuntu -q -o StrictHostKeyChecking no 172.16.42.1 "+cmd)
+}
+
+func (s *S) TestProvisionerUploadNoUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	var buf bytes.Buffer
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.ErrorMatches, `App "myapp" has no units.`)
+}
+
+func (s *S) TestProvisionerCollectStatus(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2)
+	c.Assert(err, gocheck.IsNil)
+	cont := container{Id: units[1].Name}
+	err = cont.stop()
+	c.Assert(err, gocheck.IsNil)
+	collected, err := p.CollectStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(collected, gocheck.HasLen, 2)
+	statuses := map[string]provision.Status{}
+	for _, u := range collected {
+		statuses[u.Name] = u.Status
+	}
+	c.Assert(statuses[units[0].Name], gocheck.Equals, provision.StatusStarted)
+	c.Assert(statuses[units[1].Name], gocheck.Equals, provision.StatusDown)
+}
+
+func (s *S) TestProvisionerAddr(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	rtesting.FakeRouter.AddBackend("myapp")
+	addr, err := p.Addr(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestProvisionerAddrWithoutBackend(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	_, err := p.Addr(app)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
@@ -0,0 +1,147 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	rtesting "github.com/globocom/tsuru/router/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	collName string
+	conn     *db.Storage
+	server   *fakeDockerServer
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	s.collName = "docker_unit"
+	config.Set("docker:collection", s.collName)
+	config.Set("docker:repository-namespace", "tsuru")
+	config.Set("docker:run-cmd:bin", "/var/lib/tsuru/start")
+	config.Set("docker:run-cmd:port", "8888")
+	config.Set("docker:router", "fake")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "docker_provision_tests_s")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) SetUpTest(c *gocheck.C) {
+	s.server = newFakeDockerServer()
+	config.Set("docker:server", s.server.URL)
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	s.server.Close()
+	s.conn.Collection(s.collName).RemoveAll(nil)
+	rtesting.FakeRouter.Reset()
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Collection(s.collName).Database.DropDatabase()
+}
+
+// fakeDockerServer is a minimal implementation of the docker remote API,
+// keeping containers in memory.
+type fakeDockerServer struct {
+	*httptest.Server
+	mut        sync.Mutex
+	containers map[string]*fakeContainer
+	requests   []string
+	last       int
+}
+
+type fakeContainer struct {
+	image   string
+	cmd     []string
+	running bool
+	ip      string
+}
+
+func newFakeDockerServer() *fakeDockerServer {
+	s := fakeDockerServer{containers: make(map[string]*fakeContainer)}
+	s.Server = httptest.NewServer(&s)
+	return &s
+}
+
+func (s *fakeDockerServer) Requests() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.requests
+}
+
+func (s *fakeDockerServer) container(id string) *fakeContainer {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.containers[id]
+}
+
+func (s *fakeDockerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	if r.Method == "POST" && r.URL.Path == "/containers/create" {
+		var cfg containerConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.last++
+		id := fmt.Sprintf("c%011d", s.last)
+		s.containers[id] = &fakeContainer{
+			image: cfg.Image,
+			cmd:   cfg.Cmd,
+			ip:    fmt.Sprintf("172.16.42.%d", s.last),
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"Id":"%s"}`, id)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "containers" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	cont, ok := s.containers[parts[1]]
+	if !ok {
+		http.Error(w, "No such container: "+parts[1], http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == "DELETE" && len(parts) == 2:
+		delete(s.containers, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && parts[2] == "json":
+		var info containerInfo
+		info.Id = parts[1]
+		info.State.Running = cont.running
+		if cont.running {
+			info.NetworkSettings.IPAddress = cont.ip
+		}
+		json.NewEncoder(w).Encode(info)
+	case r.Method == "POST" && (parts[2] == "start" || parts[2] == "restart"):
+		cont.running = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && parts[2] == "stop":
+		cont.running = false
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
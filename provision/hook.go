@@ -0,0 +1,41 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RunHook runs the given hook in all units of the app, stopping at the first
+// failure. Units of process types other than web receive the process type as
+// argument.
+func RunHook(e UnitCommandExecutor, app App, hook string) error {
+	for _, unit := range app.ProvisionUnits() {
+		if err := RunUnitHook(e, app, unit, hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunUnitHook runs the given hook in the unit of the app, logging the output
+// of the hook in the app when it fails.
+func RunUnitHook(e UnitCommandExecutor, app App, unit AppUnit, hook string) error {
+	var (
+		buf  bytes.Buffer
+		args []string
+	)
+	if process := unit.GetProcessType(); process != WebProcess {
+		args = append(args, process)
+	}
+	err := e.ExecuteCommandOnUnit(&buf, &buf, app, unit, "/var/lib/tsuru/hooks/"+hook, args...)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to %s the app (%s): %s", hook, err, buf.String())
+		app.Log(msg, "tsuru-provisioner")
+		return &Error{Reason: buf.String(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type hookUnit struct {
+	name    string
+	process string
+}
+
+func (u *hookUnit) GetName() string        { return u.name }
+func (u *hookUnit) GetMachine() int        { return 0 }
+func (u *hookUnit) GetStatus() Status      { return StatusStarted }
+func (u *hookUnit) GetIp() string          { return "" }
+func (u *hookUnit) GetInstanceId() string  { return "" }
+func (u *hookUnit) GetProcessType() string { return u.process }
+
+type hookApp struct {
+	units []AppUnit
+	logs  []string
+}
+
+func (a *hookApp) GetName() string           { return "myapp" }
+func (a *hookApp) GetFramework() string      { return "python" }
+func (a *hookApp) ProvisionUnits() []AppUnit { return a.units }
+func (a *hookApp) Log(message, source string) error {
+	a.logs = append(a.logs, message)
+	return nil
+}
+
+type hookExecutor struct {
+	cmds []string
+	fail string
+}
+
+func (e *hookExecutor) ExecuteCommandOnUnit(stdout, stderr io.Writer, app App, unit AppUnit, cmd string, args ...string) error {
+	e.cmds = append(e.cmds, unit.GetName()+" "+strings.Join(append([]string{cmd}, args...), " "))
+	if unit.GetName() == e.fail {
+		stderr.Write([]byte("hook failed"))
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func TestRunHook(t *testing.T) {
+	app := hookApp{units: []AppUnit{&hookUnit{"myapp/0", "web"}, &hookUnit{"myapp/1", "worker"}}}
+	var e hookExecutor
+	if err := RunHook(&e, &app, "start"); err != nil {
+		t.Fatalf("RunHook: unexpected error: %s", err)
+	}
+	expected := []string{"myapp/0 /var/lib/tsuru/hooks/start", "myapp/1 /var/lib/tsuru/hooks/start worker"}
+	if !reflect.DeepEqual(e.cmds, expected) {
+		t.Errorf("RunHook: Want %#v. Got %#v.", expected, e.cmds)
+	}
+}
+
+func TestRunHookFailure(t *testing.T) {
+	app := hookApp{units: []AppUnit{&hookUnit{"myapp/0", "web"}, &hookUnit{"myapp/1", "web"}}}
+	e := hookExecutor{fail: "myapp/0"}
+	err := RunHook(&e, &app, "stop")
+	perr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("RunHook: Want *Error. Got %#v.", err)
+	}
+	if perr.Reason != "hook failed" {
+		t.Errorf("RunHook: Want reason %q. Got %q.", "hook failed", perr.Reason)
+	}
+	if len(e.cmds) != 1 {
+		t.Errorf("RunHook: should stop at the first failure, ran %d commands.", len(e.cmds))
+	}
+	expected := []string{"Failed to stop the app (exit status 1): hook failed"}
+	if !reflect.DeepEqual(app.logs, expected) {
+		t.Errorf("RunHook: Want logs %#v. Got %#v.", expected, app.logs)
+	}
+}
@@ -61,27 +61,13 @@ func (s *ELBSuite) TearDownSuite(c *gocheck.C) {
 	queue.Preempt()
 }
 
-func (s *ELBSuite) TestGetCollection(c *gocheck.C) {
-	manager := ELBManager{}
-	coll := manager.collection()
-	other := s.conn.Collection(s.cName)
-	c.Assert(coll.FullName, gocheck.Equals, other.FullName)
-}
-
-func (s *ELBSuite) TestGetELBClient(c *gocheck.C) {
-	manager := ELBManager{}
-	elb := manager.elb()
-	c.Assert(elb.ELBEndpoint, gocheck.Equals, s.server.URL())
-}
-
 func (s *ELBSuite) TestCreateELB(c *gocheck.C) {
 	app := testing.NewFakeApp("together", "gotthard", 1)
 	manager := ELBManager{}
-	manager.e = s.client
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer s.client.DeleteLoadBalancer(app.GetName())
-	defer manager.collection().Remove(bson.M{"name": app.GetName()})
+	defer s.conn.Collection(s.cName).Remove(bson.M{"name": app.GetName()})
 	resp, err := s.client.DescribeLoadBalancers("together")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
@@ -93,7 +79,7 @@ func (s *ELBSuite) TestCreateELB(c *gocheck.C) {
 	c.Assert(listener.Protocol, gocheck.Equals, "HTTP")
 	c.Assert(listener.SSLCertificateId, gocheck.Equals, "")
 	dnsName := resp.LoadBalancerDescriptions[0].DNSName
-	var lb loadBalancer
+	var lb struct{ DNSName string }
 	err = s.conn.Collection(s.cName).Find(bson.M{"name": app.GetName()}).One(&lb)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(lb.DNSName, gocheck.Equals, dnsName)
@@ -116,7 +102,7 @@ func (s *ELBSuite) TestCreateELBUsingVPC(c *gocheck.C) {
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer s.client.DeleteLoadBalancer(app.GetName())
-	defer manager.collection().Remove(bson.M{"name": app.GetName()})
+	defer s.conn.Collection(s.cName).Remove(bson.M{"name": app.GetName()})
 	resp, err := s.client.DescribeLoadBalancers(app.GetName())
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
@@ -130,17 +116,16 @@ func (s *ELBSuite) TestCreateELBUsingVPC(c *gocheck.C) {
 func (s *ELBSuite) TestDestroyELB(c *gocheck.C) {
 	app := testing.NewFakeApp("blue", "who", 1)
 	manager := ELBManager{}
-	manager.e = s.client
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
-	defer s.client.DeleteLoadBalancer(app.GetName())                 // sanity
-	defer manager.collection().Remove(bson.M{"name": app.GetName()}) // sanity
+	defer s.client.DeleteLoadBalancer(app.GetName())                       // sanity
+	defer s.conn.Collection(s.cName).Remove(bson.M{"name": app.GetName()}) // sanity
 	err = manager.Destroy(app)
 	c.Assert(err, gocheck.IsNil)
 	_, err = s.client.DescribeLoadBalancers(app.GetName())
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err, gocheck.ErrorMatches, `^.*\(LoadBalancerNotFound\)$`)
-	n, err := manager.collection().Find(bson.M{"name": app.GetName()}).Count()
+	n, err := s.conn.Collection(s.cName).Find(bson.M{"name": app.GetName()}).Count()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(n, gocheck.Equals, 0)
 }
@@ -152,7 +137,6 @@ func (s *ELBSuite) TestRegisterUnit(c *gocheck.C) {
 	defer s.server.RemoveInstance(id2)
 	app := testing.NewFakeApp("fooled", "who", 1)
 	manager := ELBManager{}
-	manager.e = s.client
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer manager.Destroy(app)
@@ -179,7 +163,6 @@ func (s *ELBSuite) TestDeregisterUnit(c *gocheck.C) {
 	unit2 := provision.Unit{InstanceId: id2}
 	app := testing.NewFakeApp("dirty", "who", 1)
 	manager := ELBManager{}
-	manager.e = s.client
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer manager.Destroy(app)
@@ -193,15 +176,61 @@ func (s *ELBSuite) TestDeregisterUnit(c *gocheck.C) {
 	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
 }
 
+func (s *ELBSuite) TestMaintenance(c *gocheck.C) {
+	id := s.server.NewInstance()
+	defer s.server.RemoveInstance(id)
+	app := testing.NewFakeApp("closed", "who", 1)
+	manager := ELBManager{}
+	err := manager.Create(app)
+	c.Assert(err, gocheck.IsNil)
+	defer manager.Destroy(app)
+	err = manager.Register(app, provision.Unit{InstanceId: id})
+	c.Assert(err, gocheck.IsNil)
+	p := JujuProvisioner{}
+	err = p.StartMaintenance(app, nil)
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+	err = p.StopMaintenance(app)
+	c.Assert(err, gocheck.IsNil)
+	resp, err = s.client.DescribeLoadBalancers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 1)
+}
+
+func (s *ELBSuite) TestDisableAndEnableUnit(c *gocheck.C) {
+	id := s.server.NewInstance()
+	defer s.server.RemoveInstance(id)
+	app := testing.NewFakeApp("rolling", "who", 1)
+	app.ProvisionUnits()[0].(*testing.FakeUnit).InstanceId = id
+	manager := ELBManager{}
+	err := manager.Create(app)
+	c.Assert(err, gocheck.IsNil)
+	defer manager.Destroy(app)
+	err = manager.Register(app, provision.Unit{InstanceId: id})
+	c.Assert(err, gocheck.IsNil)
+	p := JujuProvisioner{}
+	err = p.DisableUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+	err = p.EnableUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.IsNil)
+	resp, err = s.client.DescribeLoadBalancers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 1)
+}
+
 func (s *ELBSuite) TestAddr(c *gocheck.C) {
 	app := testing.NewFakeApp("enough", "who", 1)
 	manager := ELBManager{}
-	manager.e = s.client
 	err := manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer manager.Destroy(app)
-	var lb loadBalancer
-	err = manager.collection().Find(bson.M{"name": app.GetName()}).One(&lb)
+	var lb struct{ DNSName string }
+	err = s.conn.Collection(s.cName).Find(bson.M{"name": app.GetName()}).One(&lb)
 	c.Assert(err, gocheck.IsNil)
 	addr, err := manager.Addr(app)
 	c.Assert(err, gocheck.IsNil)
@@ -13,6 +13,7 @@ import (
 	"github.com/globocom/tsuru/heal"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	elbrouter "github.com/globocom/tsuru/router/elb"
 	"launchpad.net/goamz/aws"
 	"launchpad.net/goamz/ec2"
 	"launchpad.net/goamz/s3"
@@ -375,7 +376,7 @@ func (h elbInstanceHealer) Heal() error {
 			if err := a.RemoveUnit(instance.id); err != nil {
 				return err
 			}
-			if err := a.AddUnits(1); err != nil {
+			if err := a.AddUnits(1, provision.WebProcess); err != nil {
 				return err
 			}
 		}
@@ -438,7 +439,7 @@ func (h elbInstanceHealer) getUnhealthyApps() map[string]app.App {
 }
 
 func (h elbInstanceHealer) describeLoadBalancers(names []string) ([]string, error) {
-	resp, err := getELBEndpoint().DescribeLoadBalancers(names...)
+	resp, err := elbrouter.Endpoint().DescribeLoadBalancers(names...)
 	if err != nil {
 		return nil, err
 	}
@@ -450,7 +451,7 @@ func (h elbInstanceHealer) describeLoadBalancers(names []string) ([]string, erro
 }
 
 func (h elbInstanceHealer) describeInstancesHealth(lb string) ([]elbInstance, error) {
-	resp, err := getELBEndpoint().DescribeInstanceHealth(lb)
+	resp, err := elbrouter.Endpoint().DescribeInstanceHealth(lb)
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +18,7 @@ import (
 	"github.com/globocom/tsuru/repository"
 	"github.com/globocom/tsuru/safe"
 	"io"
+	"io/ioutil"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/goyaml"
@@ -117,6 +118,40 @@ func (p *JujuProvisioner) Restart(app provision.App) error {
 	return nil
 }
 
+// Start starts the app, running the start hook in each unit.
+func (p *JujuProvisioner) Start(app provision.App) error {
+	return provision.RunHook(p, app, "start")
+}
+
+// Stop stops the app, running the stop hook in each unit. Units are kept, and
+// may be started again with Start.
+func (p *JujuProvisioner) Stop(app provision.App) error {
+	return provision.RunHook(p, app, "stop")
+}
+
+// RestartUnit restarts the given unit, running the restart hook in it.
+func (p *JujuProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	return provision.RunUnitHook(p, app, unit, "restart")
+}
+
+// DisableUnit deregisters the instance of the unit from the load balancer
+// of the app. It does nothing when ELB support is disabled.
+func (p *JujuProvisioner) DisableUnit(app provision.App, unit provision.AppUnit) error {
+	if !p.elbSupport() || unit.GetProcessType() != provision.WebProcess {
+		return nil
+	}
+	return p.LoadBalancer().Deregister(app, provision.Unit{InstanceId: unit.GetInstanceId()})
+}
+
+// EnableUnit registers the instance of the unit in the load balancer of the
+// app again.
+func (p *JujuProvisioner) EnableUnit(app provision.App, unit provision.AppUnit) error {
+	if !p.elbSupport() || unit.GetProcessType() != provision.WebProcess {
+		return nil
+	}
+	return p.LoadBalancer().Register(app, provision.Unit{InstanceId: unit.GetInstanceId()})
+}
+
 func (p *JujuProvisioner) destroyService(app provision.App) error {
 	var (
 		err error
@@ -194,6 +229,70 @@ func setOption(serviceName, key, value string) error {
 }
 
 func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+	return p.addUnits(app, n, true)
+}
+
+// AddStandbyUnits adds n web units to the app, without registering them in
+// the load balancer. Blue/green deploys require ELB support, and juju runs
+// only web units.
+func (p *JujuProvisioner) AddStandbyUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if !p.elbSupport() {
+		return nil, errors.New("Blue/green deploys require ELB support (juju:use-elb).")
+	}
+	if process != provision.WebProcess {
+		return nil, fmt.Errorf("Juju doesn't support %q units.", process)
+	}
+	units, err := p.addUnits(app, n, false)
+	if err != nil {
+		return nil, err
+	}
+	coll := p.unitsCollection()
+	for _, u := range units {
+		err = coll.Insert(instance{UnitName: u.Name, InstanceId: "pending", Standby: true})
+		if err != nil {
+			return units, err
+		}
+	}
+	return units, nil
+}
+
+// SwitchUnits registers the instances of the standby units in the load
+// balancer of the app, then deregisters the instances of the old units. The
+// standby units are regular units from then on, so heal keeps their instances
+// registered.
+func (p *JujuProvisioner) SwitchUnits(app provision.App, standby, old []provision.AppUnit) error {
+	if !p.elbSupport() {
+		return nil
+	}
+	if add := webInstances(standby); len(add) > 0 {
+		if err := p.LoadBalancer().Register(app, add...); err != nil {
+			return err
+		}
+	}
+	coll := p.unitsCollection()
+	for _, u := range standby {
+		err := coll.UpdateId(u.GetName(), bson.M{"$unset": bson.M{"standby": 1}})
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	if remove := webInstances(old); len(remove) > 0 {
+		return p.LoadBalancer().Deregister(app, remove...)
+	}
+	return nil
+}
+
+func webInstances(units []provision.AppUnit) []provision.Unit {
+	var instances []provision.Unit
+	for _, u := range units {
+		if u.GetProcessType() == provision.WebProcess {
+			instances = append(instances, provision.Unit{InstanceId: u.GetInstanceId()})
+		}
+	}
+	return instances
+}
+
+func (p *JujuProvisioner) addUnits(app provision.App, n uint, register bool) ([]provision.Unit, error) {
 	if n < 1 {
 		return nil, errors.New("Cannot add zero units.")
 	}
@@ -226,7 +325,7 @@ func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	if err != io.EOF {
 		return nil, &provision.Error{Reason: buf.String(), Err: err}
 	}
-	if p.elbSupport() {
+	if register && p.elbSupport() {
 		p.enqueueUnits(app.GetName(), names...)
 	}
 	return units, nil
@@ -280,7 +379,6 @@ func (p *JujuProvisioner) RemoveUnit(app provision.App, name string) error {
 }
 
 func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
-	arguments := []string{"ssh", "-o", "StrictHostKeyChecking no", "-q"}
 	units := app.ProvisionUnits()
 	length := len(units)
 	for i, unit := range units {
@@ -295,11 +393,7 @@ func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 				continue
 			}
 		}
-		var cmdargs []string
-		cmdargs = append(cmdargs, arguments...)
-		cmdargs = append(cmdargs, strconv.Itoa(unit.GetMachine()), cmd)
-		cmdargs = append(cmdargs, args...)
-		err := runCmd(true, stdout, stderr, cmdargs...)
+		err := p.ExecuteCommandOnUnit(stdout, stderr, app, unit, cmd, args...)
 		fmt.Fprintln(stdout)
 		if err != nil {
 			return err
@@ -308,6 +402,54 @@ func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 	return nil
 }
 
+// ExecuteCommandOnUnit runs a command in the given unit of the app, using
+// "juju ssh".
+func (p *JujuProvisioner) ExecuteCommandOnUnit(stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return p.ExecuteCommandOnUnitWithInput(nil, stdout, stderr, app, unit, cmd, args...)
+}
+
+// ExecuteCommandOnUnitWithInput runs a command in the given unit, using "juju
+// ssh", sending stdin to the standard input of the command.
+func (p *JujuProvisioner) ExecuteCommandOnUnitWithInput(stdin io.Reader, stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	cmdargs := []string{"ssh", "-o", "StrictHostKeyChecking no", "-q", strconv.Itoa(unit.GetMachine()), cmd}
+	cmdargs = append(cmdargs, args...)
+	command := exec.Command("juju", cmdargs...)
+	command.Stdin = stdin
+	command.Stdout = &Writer{stdout}
+	command.Stderr = &Writer{stderr}
+	return provision.WrapExitError(command.Run())
+}
+
+// Shell opens an interactive shell in the given unit, using "juju ssh".
+func (p *JujuProvisioner) Shell(opts provision.ShellOptions) error {
+	cmd := exec.Command("juju", "ssh", "-o", "StrictHostKeyChecking no", "-q", "-t", strconv.Itoa(opts.Unit.GetMachine()), opts.Cmd)
+	return provision.RunShell(cmd, opts)
+}
+
+// Upload extracts the archive in the given path of each started unit of the
+// app, using "juju ssh".
+func (p *JujuProvisioner) Upload(app provision.App, archive io.Reader, path string, w io.Writer) error {
+	content, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	cmd := provision.ExtractCommand(path)
+	for _, unit := range app.ProvisionUnits() {
+		if status := unit.GetStatus(); status != provision.StatusStarted {
+			fmt.Fprintf(w, "Skipping unit %q: its state is %q.\n", unit.GetName(), status)
+			continue
+		}
+		command := exec.Command("juju", "ssh", "-o", "StrictHostKeyChecking no", "-q", strconv.Itoa(unit.GetMachine()), cmd)
+		command.Stdin = bytes.NewReader(content)
+		command.Stdout = &Writer{w}
+		command.Stderr = &Writer{w}
+		if err = command.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *JujuProvisioner) getOutput() (jujuOutput, error) {
 	output, err := execWithTimeout(30e9, "juju", "status")
 	if err != nil {
@@ -368,10 +510,13 @@ func (p *JujuProvisioner) collectStatus() ([]provision.Unit, error) {
 	return units, err
 }
 
+// heal keeps the load balancer in sync with the instances of the units,
+// replacing instances that changed. Standby units are not registered in the
+// load balancer: they're registered by SwitchUnits.
 func (p *JujuProvisioner) heal(units []provision.Unit) {
-	var inst instance
 	coll := p.unitsCollection()
 	for _, unit := range units {
+		var inst instance
 		err := coll.FindId(unit.Name).One(&inst)
 		if err != nil {
 			coll.Insert(instance{UnitName: unit.Name, InstanceId: unit.InstanceId})
@@ -380,7 +525,7 @@ func (p *JujuProvisioner) heal(units []provision.Unit) {
 		} else {
 			format := "[juju] instance-id of unit %q changed from %q to %q. Healing."
 			log.Printf(format, unit.Name, inst.InstanceId, unit.InstanceId)
-			if p.elbSupport() {
+			if p.elbSupport() && !inst.Standby {
 				a := qApp{unit.AppName}
 				manager := p.LoadBalancer()
 				manager.Deregister(&a, provision.Unit{InstanceId: inst.InstanceId})
@@ -424,6 +569,23 @@ func (p *JujuProvisioner) Addr(app provision.App) (string, error) {
 	return units[0].GetIp(), nil
 }
 
+// StartMaintenance puts the app in maintenance. It's supported only when the
+// provisioner uses ELB.
+func (p *JujuProvisioner) StartMaintenance(app provision.App, page []byte) error {
+	if !p.elbSupport() {
+		return provision.ErrMaintenanceNotSupported
+	}
+	return p.LoadBalancer().StartMaintenance(app, page)
+}
+
+// StopMaintenance ends the maintenance of the app.
+func (p *JujuProvisioner) StopMaintenance(app provision.App) error {
+	if !p.elbSupport() {
+		return provision.ErrMaintenanceNotSupported
+	}
+	return p.LoadBalancer().StopMaintenance(app)
+}
+
 func (p *JujuProvisioner) LoadBalancer() *ELBManager {
 	if p.elbSupport() {
 		return &ELBManager{}
@@ -431,10 +593,12 @@ func (p *JujuProvisioner) LoadBalancer() *ELBManager {
 	return nil
 }
 
-// instance represents a unit in the database.
+// instance represents a unit in the database. Standby units, added by blue/green
+// deploys, stay out of the load balancer until they're switched in.
 type instance struct {
 	UnitName   string `bson:"_id"`
 	InstanceId string
+	Standby    bool `bson:",omitempty"`
 }
 
 type unit struct {
@@ -120,6 +120,92 @@ func (s *S) TestRestartFailure(c *gocheck.C) {
 	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
 }
 
+func (s *S) TestJujuProvisionerIsAMaintenanceProvisioner(c *gocheck.C) {
+	var _ provision.MaintenanceProvisioner = &JujuProvisioner{}
+}
+
+func (s *S) TestMaintenanceWithoutELB(c *gocheck.C) {
+	app := testing.NewFakeApp("closed", "python", 1)
+	p := JujuProvisioner{}
+	err := p.StartMaintenance(app, nil)
+	c.Assert(err, gocheck.Equals, provision.ErrMaintenanceNotSupported)
+	err = p.StopMaintenance(app)
+	c.Assert(err, gocheck.Equals, provision.ErrMaintenanceNotSupported)
+}
+
+func (s *S) TestJujuProvisionerIsAStartStopper(c *gocheck.C) {
+	var _ provision.StartStopper = &JujuProvisioner{}
+}
+
+func (s *S) TestStop(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", "stopped")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 2)
+	app.ProvisionUnits()[1].(*testing.FakeUnit).ProcessType = "worker"
+	p := JujuProvisioner{}
+	err = p.Stop(app)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "1", "/var/lib/tsuru/hooks/stop",
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "2", "/var/lib/tsuru/hooks/stop", "worker",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestStart(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", "started")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := JujuProvisioner{}
+	err = p.Start(app)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "1", "/var/lib/tsuru/hooks/start",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestStopFailure(c *gocheck.C) {
+	tmpdir, err := commandmocker.Error("juju", "juju failed to run command", 25)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := JujuProvisioner{}
+	err = p.Stop(app)
+	c.Assert(err, gocheck.NotNil)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(pErr.Reason, gocheck.Equals, "juju failed to run command\n")
+	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
+}
+
+func (s *S) TestJujuProvisionerIsARollingRestarter(c *gocheck.C) {
+	var _ provision.RollingRestarter = &JujuProvisioner{}
+}
+
+func (s *S) TestRestartUnit(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", "restarted")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 2)
+	p := JujuProvisioner{}
+	err = p.RestartUnit(app, app.ProvisionUnits()[1])
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "2", "/var/lib/tsuru/hooks/restart",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDisableAndEnableUnitWithoutELB(c *gocheck.C) {
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := JujuProvisioner{}
+	c.Assert(p.DisableUnit(app, app.ProvisionUnits()[0]), gocheck.IsNil)
+	c.Assert(p.EnableUnit(app, app.ProvisionUnits()[0]), gocheck.IsNil)
+}
+
 func (s *S) TestDestroy(c *gocheck.C) {
 	tmpdir, err := commandmocker.Add("juju", "$*")
 	c.Assert(err, gocheck.IsNil)
@@ -203,6 +289,18 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 }
 
+func (s *S) TestJujuProvisionerIsABlueGreenProvisioner(c *gocheck.C) {
+	var _ provision.BlueGreenProvisioner = &JujuProvisioner{}
+}
+
+func (s *S) TestAddStandbyUnitsWithoutELB(c *gocheck.C) {
+	app := testing.NewFakeApp("resist", "rush", 0)
+	p := JujuProvisioner{}
+	units, err := p.AddStandbyUnits(app, 1, provision.WebProcess)
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `Blue/green deploys require ELB support \(juju:use-elb\).`)
+}
+
 func (s *S) TestAddZeroUnits(c *gocheck.C) {
 	p := JujuProvisioner{}
 	units, err := p.AddUnits(nil, 0)
@@ -344,6 +442,123 @@ func (s *S) TestExecuteCommandOneUnit(c *gocheck.C) {
 	c.Assert(buf.String(), gocheck.Equals, output+"\n")
 }
 
+func (s *S) TestJujuProvisionerIsAUnitCommandExecutor(c *gocheck.C) {
+	var _ provision.UnitCommandExecutor = &JujuProvisioner{}
+}
+
+func (s *S) TestExecuteCommandOnUnit(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	p := JujuProvisioner{}
+	err = p.ExecuteCommandOnUnit(&buf, &buf, app, app.ProvisionUnits()[1], "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	output := "ssh -o StrictHostKeyChecking no -q 2 ls -lh"
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, output)
+	c.Assert(buf.String(), gocheck.Equals, output)
+}
+
+func (s *S) TestExecuteCommandOnUnitExitStatus(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Error("juju", "failed", 2)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("frases", "static", 1)
+	p := JujuProvisioner{}
+	err = p.ExecuteCommandOnUnit(&buf, &buf, app, app.ProvisionUnits()[0], "ls", "-l")
+	c.Assert(err, gocheck.DeepEquals, &provision.ExitError{Status: 2})
+	c.Assert(buf.String(), gocheck.Equals, "failed\n")
+}
+
+func (s *S) TestJujuProvisionerIsAnInputCommandExecutor(c *gocheck.C) {
+	var _ provision.InputCommandExecutor = &JujuProvisioner{}
+}
+
+func (s *S) TestExecuteCommandOnUnitWithInput(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	p := JujuProvisioner{}
+	err = p.ExecuteCommandOnUnitWithInput(strings.NewReader("archive"), &buf, &buf, app, app.ProvisionUnits()[1], "tar", "-xzf", "-")
+	c.Assert(err, gocheck.IsNil)
+	output := "ssh -o StrictHostKeyChecking no -q 2 tar -xzf -"
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, output)
+	c.Assert(buf.String(), gocheck.Equals, output)
+}
+
+func (s *S) TestJujuProvisionerIsAShellProvisioner(c *gocheck.C) {
+	var _ provision.ShellProvisioner = &JujuProvisioner{}
+}
+
+func (s *S) TestShell(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	p := JujuProvisioner{}
+	opts := provision.ShellOptions{
+		App:    app,
+		Unit:   app.ProvisionUnits()[1],
+		Cmd:    "bash -l",
+		Stdout: &buf,
+	}
+	err = p.Shell(opts)
+	c.Assert(err, gocheck.IsNil)
+	output := "ssh -o StrictHostKeyChecking no -q -t 2 bash -l"
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, output)
+	c.Assert(strings.Contains(buf.String(), output), gocheck.Equals, true)
+}
+
+func (s *S) TestJujuProvisionerIsAnUploader(c *gocheck.C) {
+	var _ provision.Uploader = &JujuProvisioner{}
+}
+
+func (s *S) TestUpload(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	p := JujuProvisioner{}
+	err = p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.IsNil)
+	cmd := provision.ExtractCommand("/home/application/current")
+	expected := "ssh -o StrictHostKeyChecking no -q 1 " + cmd + "ssh -o StrictHostKeyChecking no -q 2 " + cmd
+	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
+}
+
+func (s *S) TestUploadSkipsUnitsThatAreNotStarted(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.SetUnitStatus(provision.StatusDown, 0)
+	p := JujuProvisioner{}
+	err = p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Matches, "ssh -o StrictHostKeyChecking no -q 2 .*")
+	c.Assert(buf.String(), gocheck.Matches, `(?s)Skipping unit "almah/0": its state is "down".\n.*`)
+}
+
+func (s *S) TestUploadFailure(c *gocheck.C) {
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Error("juju", "failed", 2)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("frases", "static", 1)
+	p := JujuProvisioner{}
+	err = p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "exit status 2")
+}
+
 func (s *S) TestExecuteCommandUnitDown(c *gocheck.C) {
 	var buf bytes.Buffer
 	tmpdir, err := commandmocker.Add("juju", "$*")
@@ -773,6 +988,69 @@ func (s *ELBSuite) TestAddUnitsWithELB(c *gocheck.C) {
 	c.Assert(msg.Args, gocheck.DeepEquals, expected)
 }
 
+func (s *ELBSuite) TestAddStandbyUnitsWithELB(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", addUnitsOutput)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("resist", "rush", 0)
+	p := JujuProvisioner{}
+	units, err := p.AddStandbyUnits(app, 4, provision.WebProcess)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 4)
+	q := bson.M{"_id": bson.M{"$in": []string{"resist/3", "resist/4", "resist/5", "resist/6"}}}
+	defer p.unitsCollection().RemoveAll(q)
+	var instances []instance
+	err = p.unitsCollection().Find(q).All(&instances)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instances, gocheck.HasLen, 4)
+	for _, inst := range instances {
+		c.Check(inst.Standby, gocheck.Equals, true)
+		c.Check(inst.InstanceId, gocheck.Equals, "pending")
+	}
+	_, err = getQueue(queueName).Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *ELBSuite) TestAddStandbyUnitsWorker(c *gocheck.C) {
+	app := testing.NewFakeApp("resist", "rush", 0)
+	p := JujuProvisioner{}
+	units, err := p.AddStandbyUnits(app, 1, "worker")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `Juju doesn't support "worker" units.`)
+}
+
+func (s *ELBSuite) TestSwitchUnitsWithELB(c *gocheck.C) {
+	app := testing.NewFakeApp("switch", "rush", 2)
+	units := app.ProvisionUnits()
+	for _, u := range units {
+		id := s.server.NewInstance()
+		defer s.server.RemoveInstance(id)
+		u.(*testing.FakeUnit).InstanceId = id
+	}
+	manager := ELBManager{}
+	err := manager.Create(app)
+	c.Assert(err, gocheck.IsNil)
+	defer manager.Destroy(app)
+	err = manager.Register(app, provision.Unit{InstanceId: units[0].GetInstanceId()})
+	c.Assert(err, gocheck.IsNil)
+	p := JujuProvisioner{}
+	standby := instance{UnitName: units[1].GetName(), InstanceId: units[1].GetInstanceId(), Standby: true}
+	err = p.unitsCollection().Insert(standby)
+	c.Assert(err, gocheck.IsNil)
+	defer p.unitsCollection().RemoveId(standby.UnitName)
+	err = p.SwitchUnits(app, units[1:], units[:1])
+	c.Assert(err, gocheck.IsNil)
+	var inst instance
+	err = p.unitsCollection().FindId(standby.UnitName).One(&inst)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(inst.Standby, gocheck.Equals, false)
+	resp, err := s.client.DescribeLoadBalancers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	instances := resp.LoadBalancerDescriptions[0].Instances
+	c.Assert(instances, gocheck.HasLen, 1)
+	c.Assert(instances[0].InstanceId, gocheck.Equals, units[1].GetInstanceId())
+}
+
 func (s *ELBSuite) TestRemoveUnitWithELB(c *gocheck.C) {
 	instIds := make([]string, 4)
 	units := make([]provision.Unit, len(instIds))
@@ -790,7 +1068,6 @@ func (s *ELBSuite) TestRemoveUnitWithELB(c *gocheck.C) {
 	defer commandmocker.Remove(tmpdir)
 	app := testing.NewFakeApp("radio", "rush", 4)
 	manager := ELBManager{}
-	manager.e = s.client
 	err = manager.Create(app)
 	c.Assert(err, gocheck.IsNil)
 	defer manager.Destroy(app)
@@ -860,6 +1137,49 @@ func (s *ELBSuite) TestCollectStatusWithELBAndIDChange(c *gocheck.C) {
 	c.Assert(instances[1].InstanceId, gocheck.Equals, id1)
 }
 
+func (s *ELBSuite) TestCollectStatusWithELBDoesNotRegisterStandbyUnits(c *gocheck.C) {
+	a := testing.NewFakeApp("symfonia", "symfonia", 0)
+	p := JujuProvisioner{}
+	lb := p.LoadBalancer()
+	err := lb.Create(a)
+	c.Assert(err, gocheck.IsNil)
+	defer lb.Destroy(a)
+	id1 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id1)
+	err = p.unitsCollection().Insert(instance{UnitName: "symfonia/0", InstanceId: "pending", Standby: true})
+	c.Assert(err, gocheck.IsNil)
+	q := bson.M{"_id": bson.M{"$in": []string{"symfonia/0", "symfonia/1", "symfonia/2", "raise/0"}}}
+	defer p.unitsCollection().Remove(q)
+	output := strings.Replace(simpleCollectOutput, "i-00004444", id1, 1)
+	tmpdir, err := commandmocker.Add("juju", output)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	_, err = p.CollectStatus()
+	c.Assert(err, gocheck.IsNil)
+	done := make(chan int8)
+	go func() {
+		for {
+			q := bson.M{"_id": "symfonia/0", "instanceid": id1, "standby": true}
+			ct, err := p.unitsCollection().Find(q).Count()
+			c.Assert(err, gocheck.IsNil)
+			if ct == 1 {
+				done <- 1
+				return
+			}
+			time.Sleep(1e3)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5e9):
+		c.Fatal("Did not save the unit after 5 seconds.")
+	}
+	resp, err := s.client.DescribeLoadBalancers(a.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+}
+
 func (s *ELBSuite) TestAddrWithELB(c *gocheck.C) {
 	app := testing.NewFakeApp("jimmy", "who", 0)
 	p := JujuProvisioner{}
@@ -10,6 +10,7 @@ import (
 	"github.com/globocom/tsuru/log"
 	"io/ioutil"
 	"os/exec"
+	"path"
 	"strings"
 	"time"
 )
@@ -28,6 +29,21 @@ type container struct {
 	name string
 }
 
+// lxcPath returns the directory where lxc stores the containers, defined in
+// the local:lxc-path setting. It defaults to /var/lib/lxc.
+func lxcPath() string {
+	p, err := config.GetString("local:lxc-path")
+	if err != nil {
+		return "/var/lib/lxc"
+	}
+	return p
+}
+
+// rootfs returns the path of the root filesystem of the container.
+func (c *container) rootfs() string {
+	return path.Join(lxcPath(), c.name, "rootfs")
+}
+
 // runCmd executes commands and log the given stdout and stderror.
 func runCmd(cmd string, args ...string) error {
 	command := exec.Command(cmd, args...)
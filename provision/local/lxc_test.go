@@ -80,3 +80,11 @@ func (s *S) TestContainerIP(c *gocheck.C) {
 	cont = container{name: "notfound"}
 	c.Assert(cont.ip(), gocheck.Equals, "")
 }
+
+func (s *S) TestContainerRootfs(c *gocheck.C) {
+	cont := container{name: "container"}
+	c.Assert(cont.rootfs(), gocheck.Equals, "/var/lib/lxc/container/rootfs")
+	config.Set("local:lxc-path", "/mnt/lxc")
+	defer config.Unset("local:lxc-path")
+	c.Assert(cont.rootfs(), gocheck.Equals, "/mnt/lxc/container/rootfs")
+}
@@ -0,0 +1,150 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cgroupPath is the mount point of the cgroup hierarchies, where lxc creates
+// a cgroup for each container.
+var cgroupPath = "/sys/fs/cgroup"
+
+// statfs returns the statistics of a filesystem. It's a variable so tests
+// can replace it.
+var statfs = syscall.Statfs
+
+// cpuUsage is the CPU time used by a container, in nanoseconds, at the given
+// time. The last usage of each container is kept in cpuUsages, until the
+// container is not seen in a collection.
+type cpuUsage struct {
+	usage uint64
+	time  time.Time
+}
+
+var (
+	cpuMut    sync.Mutex
+	cpuUsages = make(map[string]cpuUsage)
+)
+
+// CollectMetrics returns a sample of the resource usage of each started unit,
+// read from the cgroups and the root filesystem of its container. The usage
+// of the CPU is measured between two samples, so the first sample of each
+// unit reports no CPU usage.
+func (p *LocalProvisioner) CollectMetrics() ([]provision.UnitMetrics, error) {
+	var units []provision.Unit
+	err := p.collection().Find(bson.M{"status": provision.StatusStarted}).All(&units)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	seen := make(map[string]bool, len(units))
+	metrics := make([]provision.UnitMetrics, 0, len(units))
+	for _, u := range units {
+		c := container{name: containerName(u.Name)}
+		seen[c.name] = true
+		m, err := c.metrics(now)
+		if err != nil {
+			log.Printf("Failed to collect the metrics of the unit %s: %s", u.Name, err)
+			continue
+		}
+		m.AppName = u.AppName
+		m.Unit = u.Name
+		metrics = append(metrics, m)
+	}
+	cpuMut.Lock()
+	for name := range cpuUsages {
+		if !seen[name] {
+			delete(cpuUsages, name)
+		}
+	}
+	cpuMut.Unlock()
+	return metrics, nil
+}
+
+// metrics returns the resource usage of the container at the given time.
+func (c *container) metrics(now time.Time) (provision.UnitMetrics, error) {
+	var m provision.UnitMetrics
+	usage, err := c.cgroupValue("cpuacct", "cpuacct.usage")
+	if err != nil {
+		return m, err
+	}
+	cpuMut.Lock()
+	if last, ok := cpuUsages[c.name]; ok && now.After(last.time) && usage >= last.usage {
+		m.CPU = float64(usage-last.usage) * 100 / float64(now.Sub(last.time))
+	}
+	cpuUsages[c.name] = cpuUsage{usage: usage, time: now}
+	cpuMut.Unlock()
+	memory, err := c.cgroupValue("memory", "memory.usage_in_bytes")
+	if err != nil {
+		return m, err
+	}
+	limit, err := c.cgroupValue("memory", "memory.limit_in_bytes")
+	if err != nil {
+		return m, err
+	}
+	if total, err := totalMemory(); err == nil && total < limit {
+		limit = total
+	}
+	if limit > 0 {
+		m.Memory = float64(memory) * 100 / float64(limit)
+	}
+	var fs syscall.Statfs_t
+	if err = statfs(c.rootfs(), &fs); err != nil {
+		return m, err
+	}
+	if used := fs.Blocks - fs.Bfree; used+fs.Bavail > 0 {
+		m.Disk = float64(used) * 100 / float64(used+fs.Bavail)
+	}
+	return m, nil
+}
+
+// cgroupValue reads the numeric value of a file in the cgroup of the
+// container, in the given hierarchy.
+func (c *container) cgroupValue(hierarchy, file string) (uint64, error) {
+	f, err := filesystem().Open(path.Join(cgroupPath, hierarchy, "lxc", c.name, file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// totalMemory returns the memory of the host, in bytes. Containers without a
+// memory limit may use all of it.
+func totalMemory() (uint64, error) {
+	f, err := filesystem().Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024, err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
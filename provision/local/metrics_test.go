@@ -0,0 +1,167 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"github.com/globocom/config"
+	fstesting "github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"syscall"
+	"time"
+)
+
+// fakeCgroup writes the given files in the cgroup of the container, in the
+// recording filesystem.
+func fakeCgroup(rfs *fstesting.RecordingFs, name string, files map[string]string) {
+	for file, content := range files {
+		hierarchy := "memory"
+		if file == "cpuacct.usage" {
+			hierarchy = "cpuacct"
+		}
+		f, _ := rfs.Create(cgroupPath + "/" + hierarchy + "/lxc/" + name + "/" + file)
+		f.Write([]byte(content))
+		f.Close()
+	}
+}
+
+func fakeStatfs(path string, buf *syscall.Statfs_t) error {
+	buf.Blocks = 1000
+	buf.Bfree = 750
+	buf.Bavail = 700
+	return nil
+}
+
+func (s *S) TestContainerMetrics(c *gocheck.C) {
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	statfs = fakeStatfs
+	defer func() {
+		fsystem = nil
+		statfs = syscall.Statfs
+	}()
+	fakeCgroup(rfs, "metrics-0", map[string]string{
+		"cpuacct.usage":         "1000000000\n",
+		"memory.usage_in_bytes": "268435456\n",
+		"memory.limit_in_bytes": "1073741824\n",
+	})
+	f, _ := rfs.Create("/proc/meminfo")
+	f.Write([]byte("MemTotal:        4194304 kB\nMemFree:         1048576 kB\n"))
+	f.Close()
+	cont := container{name: "metrics-0"}
+	now := time.Now()
+	m, err := cont.metrics(now)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(m.CPU, gocheck.Equals, 0.0)
+	c.Assert(m.Memory, gocheck.Equals, 25.0)
+	c.Assert(m.Disk, gocheck.Equals, 250.0*100/950)
+	fakeCgroup(rfs, "metrics-0", map[string]string{"cpuacct.usage": "1500000000\n"})
+	m, err = cont.metrics(now.Add(2 * time.Second))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(m.CPU, gocheck.Equals, 25.0)
+}
+
+func (s *S) TestContainerMetricsWithoutMemoryLimit(c *gocheck.C) {
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	statfs = fakeStatfs
+	defer func() {
+		fsystem = nil
+		statfs = syscall.Statfs
+	}()
+	fakeCgroup(rfs, "metrics-1", map[string]string{
+		"cpuacct.usage":         "1000\n",
+		"memory.usage_in_bytes": "1073741824\n",
+		"memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	f, _ := rfs.Create("/proc/meminfo")
+	f.Write([]byte("MemTotal:        4194304 kB\n"))
+	f.Close()
+	cont := container{name: "metrics-1"}
+	m, err := cont.metrics(time.Now())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(m.Memory, gocheck.Equals, 25.0)
+}
+
+func (s *S) TestContainerMetricsWithoutCgroup(c *gocheck.C) {
+	fsystem = &fstesting.RecordingFs{}
+	defer func() {
+		fsystem = nil
+	}()
+	cont := container{name: "metrics-2"}
+	_, err := cont.metrics(time.Now())
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestCollectMetrics(c *gocheck.C) {
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	statfs = fakeStatfs
+	defer func() {
+		fsystem = nil
+		statfs = syscall.Statfs
+	}()
+	fakeCgroup(rfs, "metrics-3", map[string]string{
+		"cpuacct.usage":         "1000\n",
+		"memory.usage_in_bytes": "536870912\n",
+		"memory.limit_in_bytes": "1073741824\n",
+	})
+	var p LocalProvisioner
+	units := []provision.Unit{
+		{Name: "metrics/3", AppName: "metrics", Status: provision.StatusStarted},
+		{Name: "metrics/4", AppName: "metrics", Status: provision.StatusStopped},
+		{Name: "metrics/5", AppName: "metrics", Status: provision.StatusStarted},
+	}
+	for _, u := range units {
+		err := p.collection().Insert(u)
+		c.Assert(err, gocheck.IsNil)
+	}
+	defer p.collection().Remove(bson.M{"appname": "metrics"})
+	cpuMut.Lock()
+	cpuUsages["metrics-gone"] = cpuUsage{usage: 1000, time: time.Now()}
+	cpuMut.Unlock()
+	metrics, err := p.CollectMetrics()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(metrics, gocheck.HasLen, 1)
+	c.Assert(metrics[0].AppName, gocheck.Equals, "metrics")
+	c.Assert(metrics[0].Unit, gocheck.Equals, "metrics/3")
+	c.Assert(metrics[0].Memory, gocheck.Equals, 50.0)
+	cpuMut.Lock()
+	defer cpuMut.Unlock()
+	_, ok := cpuUsages["metrics-3"]
+	c.Assert(ok, gocheck.Equals, true)
+	_, ok = cpuUsages["metrics-gone"]
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestContainerMetricsReadsTheRootfsInTheLxcPath(c *gocheck.C) {
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	var statted string
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		statted = path
+		return fakeStatfs(path, buf)
+	}
+	config.Set("local:lxc-path", "/mnt/lxc")
+	defer func() {
+		fsystem = nil
+		statfs = syscall.Statfs
+		config.Unset("local:lxc-path")
+	}()
+	fakeCgroup(rfs, "metrics-6", map[string]string{
+		"cpuacct.usage":         "1000\n",
+		"memory.usage_in_bytes": "536870912\n",
+		"memory.limit_in_bytes": "1073741824\n",
+	})
+	cont := container{name: "metrics-6"}
+	_, err := cont.metrics(time.Now())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(statted, gocheck.Equals, "/mnt/lxc/metrics-6/rootfs")
+}
+
+func (s *S) TestLocalProvisionerIsAMetricsCollector(c *gocheck.C) {
+	var _ provision.MetricsCollector = &LocalProvisioner{}
+}
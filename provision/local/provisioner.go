@@ -6,15 +6,21 @@ package local
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/nginx"
 	"io"
+	"io/ioutil"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"os/exec"
+	"strings"
+	"time"
 )
 
 func init() {
@@ -23,6 +29,16 @@ func init() {
 
 type LocalProvisioner struct{}
 
+// router returns the router defined by the local:router setting, defaulting
+// to nginx.
+func (p *LocalProvisioner) router() (router.Router, error) {
+	name, err := config.GetString("local:router")
+	if err != nil {
+		name = "nginx"
+	}
+	return router.Get(name)
+}
+
 func (p *LocalProvisioner) setup(ip, framework string) error {
 	formulasPath, err := config.GetString("local:formulas-path")
 	if err != nil {
@@ -68,77 +84,148 @@ func (p *LocalProvisioner) install(ip string) error {
 	return nil
 }
 
-func (p *LocalProvisioner) start(ip string) error {
-	cmd := exec.Command("ssh", "-q", "-o", "StrictHostKeyChecking no", "-l", "ubuntu", ip, "sudo /var/lib/tsuru/hooks/start")
+// start executes the start hook in the given ip. The hook receives the
+// process type as argument, unless it's a web unit.
+func (p *LocalProvisioner) start(ip, process string) error {
+	hook := "sudo /var/lib/tsuru/hooks/start"
+	if process != "" && process != provision.WebProcess {
+		hook += " " + process
+	}
+	cmd := exec.Command("ssh", "-q", "-o", "StrictHostKeyChecking no", "-l", "ubuntu", ip, hook)
 	return cmd.Run()
 }
 
-func (p *LocalProvisioner) Provision(app provision.App) error {
-	go func(p *LocalProvisioner, app provision.App) {
-		c := container{name: app.GetName()}
-		log.Printf("creating container %s", c.name)
-		u := provision.Unit{
-			Name:       app.GetName(),
-			AppName:    app.GetName(),
-			Type:       app.GetFramework(),
-			Machine:    0,
-			InstanceId: app.GetName(),
-			Status:     provision.StatusCreating,
-			Ip:         "",
-		}
-		log.Printf("inserting container unit %s in the database", app.GetName())
-		err := p.collection().Insert(u)
-		if err != nil {
-			log.Print(err)
-		}
-		err = c.create()
-		if err != nil {
-			log.Printf("error on create container %s", app.GetName())
-			log.Print(err)
-		}
-		err = c.start()
-		if err != nil {
-			log.Printf("error on start container %s", app.GetName())
-			log.Print(err)
-		}
-		ip := c.ip()
-		u.Ip = ip
-		u.Status = provision.StatusInstalling
-		err = p.collection().Update(bson.M{"name": u.Name}, u)
-		if err != nil {
-			log.Print(err)
-		}
-		err = p.setup(ip, app.GetFramework())
-		if err != nil {
-			log.Printf("error on setup container %s", app.GetName())
-			log.Print(err)
-		}
-		err = p.install(ip)
-		if err != nil {
-			log.Printf("error on install container %s", app.GetName())
-			log.Print(err)
-		}
-		err = p.start(ip)
-		if err != nil {
-			log.Printf("error on start app for container %s", app.GetName())
-			log.Print(err)
+// isWeb reports whether the unit is a web unit. Only web units are added to
+// the router.
+func isWeb(u provision.Unit) bool {
+	return u.ProcessType == "" || u.ProcessType == provision.WebProcess
+}
+
+// unitName returns the name of the nth unit of the given app.
+func unitName(appName string, n int) string {
+	return fmt.Sprintf("%s/%d", appName, n)
+}
+
+// containerName returns the name of the lxc container that holds the given
+// unit. lxc does not accept slashes in container names.
+func containerName(unitName string) string {
+	return strings.Replace(unitName, "/", "-", -1)
+}
+
+// units returns all units of the given app, as stored in the database.
+func (p *LocalProvisioner) units(appName string) ([]provision.Unit, error) {
+	var units []provision.Unit
+	err := p.collection().Find(bson.M{"appname": appName}).Sort("machine").All(&units)
+	return units, err
+}
+
+// nextMachine returns the number that should be used for the next unit of the
+// given app.
+func (p *LocalProvisioner) nextMachine(appName string) (int, error) {
+	var u provision.Unit
+	err := p.collection().Find(bson.M{"appname": appName}).Sort("-machine").One(&u)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return u.Machine + 1, nil
+}
+
+// newUnits inserts n new units of the given process type in the database,
+// with the status "creating". It's up to the caller to create the containers.
+func (p *LocalProvisioner) newUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	next, err := p.nextMachine(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	units := make([]provision.Unit, n)
+	for i := range units {
+		name := unitName(app.GetName(), next+i)
+		units[i] = provision.Unit{
+			Name:        name,
+			AppName:     app.GetName(),
+			Type:        app.GetFramework(),
+			ProcessType: process,
+			Machine:     next + i,
+			InstanceId:  containerName(name),
+			Status:      provision.StatusCreating,
+			Ip:          "",
 		}
-		err = AddRoute(app.GetName(), ip)
-		if err != nil {
-			log.Printf("error on add route for %s with ip %s", app.GetName(), ip)
-			log.Print(err)
+		log.Printf("inserting container unit %s in the database", name)
+		if err := p.collection().Insert(units[i]); err != nil {
+			return nil, err
 		}
-		err = RestartRouter()
-		if err != nil {
-			log.Printf("error on restart router")
+	}
+	return units, nil
+}
+
+// createUnit creates, starts and installs the container of the given unit,
+// updating its status in the database. Web units are added to the router
+// only when route is true.
+func (p *LocalProvisioner) createUnit(app provision.App, u provision.Unit, route bool) {
+	c := container{name: containerName(u.Name)}
+	log.Printf("creating container %s", c.name)
+	err := c.create()
+	if err != nil {
+		log.Printf("error on create container %s", c.name)
+		log.Print(err)
+	}
+	err = c.start()
+	if err != nil {
+		log.Printf("error on start container %s", c.name)
+		log.Print(err)
+	}
+	u.Ip = c.ip()
+	u.Status = provision.StatusInstalling
+	err = p.collection().Update(bson.M{"name": u.Name}, u)
+	if err != nil {
+		log.Print(err)
+	}
+	err = p.setup(u.Ip, app.GetFramework())
+	if err != nil {
+		log.Printf("error on setup container %s", c.name)
+		log.Print(err)
+	}
+	err = p.install(u.Ip)
+	if err != nil {
+		log.Printf("error on install container %s", c.name)
+		log.Print(err)
+	}
+	err = p.start(u.Ip, u.ProcessType)
+	if err != nil {
+		log.Printf("error on start app for container %s", c.name)
+		log.Print(err)
+	}
+	if route && isWeb(u) {
+		if r, err := p.router(); err != nil {
 			log.Print(err)
-		}
-		u.Status = provision.StatusStarted
-		err = p.collection().Update(bson.M{"name": u.Name}, u)
-		if err != nil {
+		} else if err = r.AddRoute(app.GetName(), u.Ip); err != nil {
+			log.Printf("error on add route for %s with ip %s", app.GetName(), u.Ip)
 			log.Print(err)
 		}
-	}(p, app)
+	}
+	u.Status = provision.StatusStarted
+	err = p.collection().Update(bson.M{"name": u.Name}, u)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (p *LocalProvisioner) Provision(app provision.App) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	err = r.AddBackend(app.GetName())
+	if err != nil {
+		return err
+	}
+	units, err := p.newUnits(app, 1, provision.WebProcess)
+	if err != nil {
+		return err
+	}
+	go p.createUnit(app, units[0], true)
 	return nil
 }
 
@@ -153,46 +240,311 @@ func (p *LocalProvisioner) Restart(app provision.App) error {
 	return nil
 }
 
+// Start starts the app, running the start hook in each unit.
+func (p *LocalProvisioner) Start(app provision.App) error {
+	return provision.RunHook(p, app, "start")
+}
+
+// Stop stops the app, running the stop hook in each unit. Units are kept, and
+// may be started again with Start.
+func (p *LocalProvisioner) Stop(app provision.App) error {
+	return provision.RunHook(p, app, "stop")
+}
+
+// RestartUnit restarts the given unit, running the restart hook in it.
+func (p *LocalProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	return provision.RunUnitHook(p, app, unit, "restart")
+}
+
+// DisableUnit removes the route to the given unit from the router.
+func (p *LocalProvisioner) DisableUnit(app provision.App, unit provision.AppUnit) error {
+	if unit.GetProcessType() != provision.WebProcess {
+		return nil
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return r.RemoveRoute(app.GetName(), unit.GetIp())
+}
+
+// EnableUnit adds the route to the given unit back to the router.
+func (p *LocalProvisioner) EnableUnit(app provision.App, unit provision.AppUnit) error {
+	if unit.GetProcessType() != provision.WebProcess {
+		return nil
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return r.AddRoute(app.GetName(), unit.GetIp())
+}
+
+// destroyContainer stops and destroys the container of the given unit, and
+// removes the unit from the database and from the router.
+func (p *LocalProvisioner) destroyContainer(u provision.Unit) {
+	if r, err := p.router(); err == nil && u.Ip != "" && isWeb(u) {
+		log.Printf("removing route to %s", u.Ip)
+		r.RemoveRoute(u.AppName, u.Ip)
+	}
+	c := container{name: containerName(u.Name)}
+	log.Printf("stoping container %s", c.name)
+	c.stop()
+
+	log.Printf("destroying container %s", c.name)
+	c.destroy()
+
+	log.Printf("removing container %s from the database", c.name)
+	p.collection().Remove(bson.M{"name": u.Name})
+}
+
 func (p *LocalProvisioner) Destroy(app provision.App) error {
-	c := container{name: app.GetName()}
-	go func(c container) {
-		log.Printf("stoping container %s", c.name)
-		c.stop()
+	units, err := p.units(app.GetName())
+	if err != nil {
+		return err
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	go func(units []provision.Unit) {
+		for _, u := range units {
+			p.destroyContainer(u)
+		}
+		if err := r.RemoveBackend(app.GetName()); err != nil {
+			log.Printf("error on remove backend for %s", app.GetName())
+			log.Print(err)
+		}
+	}(units)
+	return nil
+}
+
+// maintenanceRouter returns the router of the provisioner, when it supports
+// maintenance mode.
+func (p *LocalProvisioner) maintenanceRouter() (router.MaintenanceRouter, error) {
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	mr, ok := r.(router.MaintenanceRouter)
+	if !ok {
+		return nil, provision.ErrMaintenanceNotSupported
+	}
+	return mr, nil
+}
+
+// StartMaintenance makes the router serve the given page to all requests to
+// the app.
+func (p *LocalProvisioner) StartMaintenance(app provision.App, page []byte) error {
+	r, err := p.maintenanceRouter()
+	if err != nil {
+		return err
+	}
+	return r.StartMaintenance(app.GetName(), page)
+}
+
+// StopMaintenance makes the router deliver requests to the units of the app
+// again.
+func (p *LocalProvisioner) StopMaintenance(app provision.App) error {
+	r, err := p.maintenanceRouter()
+	if err != nil {
+		return err
+	}
+	return r.StopMaintenance(app.GetName())
+}
 
-		log.Printf("destroying container %s", c.name)
-		c.destroy()
+// canaryRouter returns the router of the provisioner, when it supports
+// weighted routes and statistics.
+func (p *LocalProvisioner) canaryRouter() (router.CanaryRouter, error) {
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	cr, ok := r.(router.CanaryRouter)
+	if !ok {
+		return nil, provision.ErrCanaryNotSupported
+	}
+	return cr, nil
+}
 
-		log.Printf("removing container %s from the database", c.name)
-		p.collection().Remove(bson.M{"name": c.name})
-	}(c)
+// SetUnitsWeight sets the weight of the routes to the given web units.
+func (p *LocalProvisioner) SetUnitsWeight(app provision.App, units []provision.AppUnit, weight int) error {
+	r, err := p.canaryRouter()
+	if err != nil {
+		return err
+	}
+	for _, addr := range webAddresses(units) {
+		if err := r.SetRouteWeight(app.GetName(), addr, weight); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (*LocalProvisioner) Addr(app provision.App) (string, error) {
-	units := app.ProvisionUnits()
-	return units[0].GetIp(), nil
+// UnitsStats returns the statistics of the routes to the given web units
+// since the given time.
+func (p *LocalProvisioner) UnitsStats(app provision.App, units []provision.AppUnit, since time.Time) (map[string]provision.UnitStats, error) {
+	names := make(map[string]string, len(units))
+	for _, u := range units {
+		if u.GetProcessType() == provision.WebProcess {
+			names[u.GetIp()] = u.GetName()
+		}
+	}
+	r, err := p.canaryRouter()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := r.RouteStats(app.GetName(), since)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]provision.UnitStats, len(names))
+	for addr, name := range names {
+		s := routes[addr]
+		stats[name] = provision.UnitStats{Requests: s.Requests, Errors: s.Errors}
+	}
+	return stats, nil
+}
+
+func (p *LocalProvisioner) Addr(app provision.App) (string, error) {
+	r, err := p.router()
+	if err != nil {
+		return "", err
+	}
+	return r.Addr(app.GetName())
+}
+
+func (p *LocalProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+	return p.AddProcessUnits(app, n, provision.WebProcess)
+}
+
+// AddProcessUnits adds n units of the given process type to the app. Units
+// are created in background, only web units are added to the router.
+func (p *LocalProvisioner) AddProcessUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	return p.addUnits(app, n, process, true)
+}
+
+// AddStandbyUnits adds n units of the given process type to the app, without
+// adding them to the router. The containers are created in background, like
+// in AddProcessUnits.
+func (p *LocalProvisioner) AddStandbyUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	return p.addUnits(app, n, process, false)
+}
+
+func (p *LocalProvisioner) addUnits(app provision.App, n uint, process string, route bool) ([]provision.Unit, error) {
+	if n < 1 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	units, err := p.newUnits(app, n, process)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range units {
+		go p.createUnit(app, u, route)
+	}
+	return units, nil
+}
+
+// SwitchUnits replaces the routes to the old web units with routes to the
+// standby web units.
+func (p *LocalProvisioner) SwitchUnits(app provision.App, standby, old []provision.AppUnit) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return router.Switch(r, app.GetName(), webAddresses(standby), webAddresses(old))
+}
+
+// webAddresses returns the IPs of the web units in the given list.
+func webAddresses(units []provision.AppUnit) []string {
+	var addresses []string
+	for _, u := range units {
+		if u.GetProcessType() == provision.WebProcess {
+			addresses = append(addresses, u.GetIp())
+		}
+	}
+	return addresses
 }
 
-func (*LocalProvisioner) AddUnits(app provision.App, units uint) ([]provision.Unit, error) {
-	return []provision.Unit{}, nil
+func (p *LocalProvisioner) RemoveUnit(app provision.App, name string) error {
+	var u provision.Unit
+	err := p.collection().Find(bson.M{"name": name, "appname": app.GetName()}).One(&u)
+	if err != nil {
+		return fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), name)
+	}
+	go p.destroyContainer(u)
+	return nil
 }
 
-func (*LocalProvisioner) RemoveUnit(app provision.App, unitName string) error {
+func (p *LocalProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	units := app.ProvisionUnits()
+	length := len(units)
+	for i, unit := range units {
+		if length > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "Output from unit %q:\n\n", unit.GetName())
+			if status := unit.GetStatus(); status != provision.StatusStarted {
+				fmt.Fprintf(stdout, "Unit state is %q, it must be %q for running commands.\n",
+					status, provision.StatusStarted)
+				continue
+			}
+		}
+		err := p.ExecuteCommandOnUnit(stdout, stderr, app, unit, cmd, args...)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (*LocalProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+// ExecuteCommandOnUnit runs a command in the given unit of the app, using ssh.
+func (p *LocalProvisioner) ExecuteCommandOnUnit(stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return p.ExecuteCommandOnUnitWithInput(nil, stdout, stderr, app, unit, cmd, args...)
+}
+
+// ExecuteCommandOnUnitWithInput runs a command in the given unit, using ssh,
+// sending stdin to the standard input of the command.
+func (p *LocalProvisioner) ExecuteCommandOnUnitWithInput(stdin io.Reader, stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
 	arguments := []string{"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no"}
-	arguments = append(arguments, app.ProvisionUnits()[0].GetIp())
+	arguments = append(arguments, unit.GetIp())
 	arguments = append(arguments, cmd)
 	arguments = append(arguments, args...)
 	c := exec.Command("ssh", arguments...)
+	c.Stdin = stdin
 	c.Stdout = stdout
 	c.Stderr = stderr
-	err := c.Run()
+	return provision.WrapExitError(c.Run())
+}
+
+// Shell opens an interactive shell in the given unit, using ssh.
+func (p *LocalProvisioner) Shell(opts provision.ShellOptions) error {
+	cmd := exec.Command("ssh", "-t", "-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", opts.Unit.GetIp(), opts.Cmd)
+	return provision.RunShell(cmd, opts)
+}
+
+// Upload extracts the archive in the given path of each started unit of the
+// app, using ssh.
+func (p *LocalProvisioner) Upload(app provision.App, archive io.Reader, path string, w io.Writer) error {
+	content, err := ioutil.ReadAll(archive)
 	if err != nil {
 		return err
 	}
+	cmd := provision.ExtractCommand(path)
+	for _, unit := range app.ProvisionUnits() {
+		if status := unit.GetStatus(); status != provision.StatusStarted {
+			fmt.Fprintf(w, "Skipping unit %q: its state is %q.\n", unit.GetName(), status)
+			continue
+		}
+		c := exec.Command("ssh", "-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", unit.GetIp(), cmd)
+		c.Stdin = bytes.NewReader(content)
+		c.Stdout = w
+		c.Stderr = w
+		if err = c.Run(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
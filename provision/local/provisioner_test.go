@@ -11,11 +11,14 @@ import (
 	"github.com/globocom/config"
 	fstesting "github.com/globocom/tsuru/fs/testing"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	rtesting "github.com/globocom/tsuru/router/testing"
 	"github.com/globocom/tsuru/testing"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -50,13 +53,13 @@ func (s *S) TestProvisionerProvision(c *gocheck.C) {
 	defer commandmocker.Remove(scpTempDir)
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
-	defer p.collection().Remove(bson.M{"name": "myapp"})
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
 	c.Assert(p.Provision(app), gocheck.IsNil)
 	ok := make(chan bool, 1)
 	go func() {
 		for {
 			coll := s.conn.Collection(s.collName)
-			ct, err := coll.Find(bson.M{"name": "myapp", "status": provision.StatusStarted}).Count()
+			ct, err := coll.Find(bson.M{"name": "myapp/0", "status": provision.StatusStarted}).Count()
 			if err != nil {
 				c.Fatal(err)
 			}
@@ -73,14 +76,17 @@ func (s *S) TestProvisionerProvision(c *gocheck.C) {
 		c.Fatal("Timed out waiting for the container to be provisioned (10 seconds)")
 	}
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
-	expected := "lxc-create -t ubuntu -n myapp -- -S somepath"
-	expected += "lxc-start --daemon -n myapp"
-	expected += "service nginx restart"
+	expected := "lxc-create -t ubuntu -n myapp-0 -- -S somepath"
+	expected += "lxc-start --daemon -n myapp-0"
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
 	var unit provision.Unit
-	err = s.conn.Collection(s.collName).Find(bson.M{"name": "myapp"}).One(&unit)
+	err = s.conn.Collection(s.collName).Find(bson.M{"name": "myapp/0"}).One(&unit)
 	c.Assert(err, gocheck.IsNil)
+	c.Assert(unit.AppName, gocheck.Equals, "myapp")
+	c.Assert(unit.InstanceId, gocheck.Equals, "myapp-0")
+	c.Assert(unit.Machine, gocheck.Equals, 0)
 	c.Assert(unit.Ip, gocheck.Equals, "10.10.10.15")
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.15"), gocheck.Equals, true)
 }
 
 func (s *S) TestProvisionerRestart(c *gocheck.C) {
@@ -113,6 +119,98 @@ func (s *S) TestProvisionerRestartFailure(c *gocheck.C) {
 	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
 }
 
+func (s *S) TestLocalProvisionerIsAStartStopper(c *gocheck.C) {
+	var _ provision.StartStopper = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerStop(c *gocheck.C) {
+	var p LocalProvisioner
+	tmpdir, err := commandmocker.Add("ssh", "ok")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.ProvisionUnits()[1].(*testing.FakeUnit).ProcessType = "worker"
+	err = p.Stop(app)
+	c.Assert(err, gocheck.IsNil)
+	units := app.ProvisionUnits()
+	expected := []string{
+		"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", units[0].GetIp(), "/var/lib/tsuru/hooks/stop",
+		"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", units[1].GetIp(), "/var/lib/tsuru/hooks/stop", "worker",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerStart(c *gocheck.C) {
+	var p LocalProvisioner
+	tmpdir, err := commandmocker.Add("ssh", "ok")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 1)
+	err = p.Start(app)
+	c.Assert(err, gocheck.IsNil)
+	ip := app.ProvisionUnits()[0].GetIp()
+	expected := []string{
+		"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", ip, "/var/lib/tsuru/hooks/start",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerStopFailure(c *gocheck.C) {
+	tmpdir, err := commandmocker.Error("ssh", "fatal unexpected failure", 25)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := LocalProvisioner{}
+	err = p.Stop(app)
+	c.Assert(err, gocheck.NotNil)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(pErr.Reason, gocheck.Equals, "fatal unexpected failure")
+	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
+}
+
+func (s *S) TestLocalProvisionerIsARollingRestarter(c *gocheck.C) {
+	var _ provision.RollingRestarter = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerRestartUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	tmpdir, err := commandmocker.Add("ssh", "ok")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	unit := app.ProvisionUnits()[1]
+	err = p.RestartUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", unit.GetIp(), "/var/lib/tsuru/hooks/restart",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerDisableAndEnableUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("almah", "static", 1)
+	unit := app.ProvisionUnits()[0]
+	rtesting.FakeRouter.AddBackend("almah")
+	defer rtesting.FakeRouter.RemoveBackend("almah")
+	rtesting.FakeRouter.AddRoute("almah", unit.GetIp())
+	err := p.DisableUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("almah", unit.GetIp()), gocheck.Equals, false)
+	err = p.EnableUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("almah", unit.GetIp()), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerDisableUnitIgnoresWorkers(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("almah", "static", 1)
+	app.ProvisionUnits()[0].(*testing.FakeUnit).ProcessType = "worker"
+	err := p.DisableUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.IsNil)
+}
+
 func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	config.Set("local:authorized-key-path", "somepath")
 	rfs := &fstesting.RecordingFs{}
@@ -144,38 +242,245 @@ func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	c.Assert(p.Destroy(app), gocheck.IsNil)
 	time.Sleep(5 * time.Second)
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
-	expected := "lxc-create -t ubuntu -n myapp -- -S somepath"
-	expected += "lxc-start --daemon -n myapp"
-	expected += "service nginx restart"
-	expected += "lxc-stop -n myapp"
-	expected += "lxc-destroy -n myapp"
+	expected := "lxc-create -t ubuntu -n myapp-0 -- -S somepath"
+	expected += "lxc-start --daemon -n myapp-0"
+	expected += "lxc-stop -n myapp-0"
+	expected += "lxc-destroy -n myapp-0"
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
-	length, err := p.collection().Find(bson.M{"name": "myapp"}).Count()
+	length, err := p.collection().Find(bson.M{"appname": "myapp"}).Count()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(length, gocheck.Equals, 0)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
+}
+
+func (s *S) TestLocalProvisionerIsAMaintenanceProvisioner(c *gocheck.C) {
+	var _ provision.MaintenanceProvisioner = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerMaintenance(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	rtesting.FakeRouter.AddBackend("myapp")
+	err := p.StartMaintenance(app, nil)
+	c.Assert(err, gocheck.IsNil)
+	ok, _ := rtesting.FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, true)
+	err = p.StopMaintenance(app)
+	c.Assert(err, gocheck.IsNil)
+	ok, _ = rtesting.FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, false)
 }
 
 func (s *S) TestProvisionerAddr(c *gocheck.C) {
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 1)
+	rtesting.FakeRouter.AddBackend("myapp")
 	addr, err := p.Addr(app)
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(addr, gocheck.Equals, app.ProvisionUnits()[0].GetIp())
+	c.Assert(addr, gocheck.Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestProvisionerAddrWithoutBackend(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	_, err := p.Addr(app)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
 }
 
 func (s *S) TestProvisionerAddUnits(c *gocheck.C) {
+	config.Set("local:authorized-key-path", "somepath")
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	sshTempDir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(sshTempDir)
+	scpTempDir, err := commandmocker.Add("scp", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(scpTempDir)
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err = p.collection().Insert(provision.Unit{Name: "myapp/0", AppName: "myapp", Machine: 0})
+	c.Assert(err, gocheck.IsNil)
 	units, err := p.AddUnits(app, 2)
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(units, gocheck.DeepEquals, []provision.Unit{})
+	c.Assert(units, gocheck.HasLen, 2)
+	c.Assert(units[0].Name, gocheck.Equals, "myapp/1")
+	c.Assert(units[0].InstanceId, gocheck.Equals, "myapp-1")
+	c.Assert(units[0].Machine, gocheck.Equals, 1)
+	c.Assert(units[0].Status, gocheck.Equals, provision.StatusCreating)
+	c.Assert(units[1].Name, gocheck.Equals, "myapp/2")
+	c.Assert(units[1].Machine, gocheck.Equals, 2)
+	n, err := p.collection().Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 3)
+}
+
+func (s *S) TestLocalProvisionerIsABlueGreenProvisioner(c *gocheck.C) {
+	var _ provision.BlueGreenProvisioner = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerAddStandbyUnits(c *gocheck.C) {
+	config.Set("local:authorized-key-path", "somepath")
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	sshTempDir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(sshTempDir)
+	scpTempDir, err := commandmocker.Add("scp", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(scpTempDir)
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err = p.collection().Insert(provision.Unit{Name: "myapp/0", AppName: "myapp", Machine: 0})
+	c.Assert(err, gocheck.IsNil)
+	units, err := p.AddStandbyUnits(app, 1, provision.WebProcess)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].Name, gocheck.Equals, "myapp/1")
+	c.Assert(units[0].Status, gocheck.Equals, provision.StatusCreating)
+	n, err := p.collection().Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestProvisionerSwitchUnits(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("almah", "static", 3)
+	units := app.ProvisionUnits()
+	units[2].(*testing.FakeUnit).ProcessType = "worker"
+	rtesting.FakeRouter.AddBackend("almah")
+	defer rtesting.FakeRouter.RemoveBackend("almah")
+	rtesting.FakeRouter.AddRoute("almah", units[0].GetIp())
+	err := p.SwitchUnits(app, units[1:], units[:1])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("almah"), gocheck.DeepEquals, []string{units[1].GetIp()})
+}
+
+func (s *S) TestLocalProvisionerIsACanaryProvisioner(c *gocheck.C) {
+	var _ provision.CanaryProvisioner = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerSetUnitsWeight(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("almah", "static", 2)
+	units := app.ProvisionUnits()
+	units[1].(*testing.FakeUnit).ProcessType = "worker"
+	rtesting.FakeRouter.AddBackend("almah")
+	defer rtesting.FakeRouter.RemoveBackend("almah")
+	err := p.SetUnitsWeight(app, units, 4)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.Routes("almah"), gocheck.DeepEquals, []string{units[0].GetIp()})
+	c.Assert(rtesting.FakeRouter.Weight("almah", units[0].GetIp()), gocheck.Equals, 4)
+}
+
+func (s *S) TestProvisionerUnitsStats(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("almah", "static", 2)
+	units := app.ProvisionUnits()
+	rtesting.FakeRouter.AddBackend("almah")
+	defer rtesting.FakeRouter.RemoveBackend("almah")
+	rtesting.FakeRouter.AddRoute("almah", units[0].GetIp())
+	rtesting.FakeRouter.SetStats("almah", units[0].GetIp(), router.RouteStats{Requests: 5, Errors: 1})
+	stats, err := p.UnitsStats(app, units, time.Now())
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]provision.UnitStats{
+		units[0].GetName(): {Requests: 5, Errors: 1},
+		units[1].GetName(): {},
+	}
+	c.Assert(stats, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerAddProcessUnits(c *gocheck.C) {
+	config.Set("local:authorized-key-path", "somepath")
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	sshTempDir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(sshTempDir)
+	scpTempDir, err := commandmocker.Add("scp", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(scpTempDir)
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	units, err := p.AddProcessUnits(app, 2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.ProcessType, gocheck.Equals, "worker")
+	}
+	n, err := p.collection().Find(bson.M{"appname": "myapp", "processtype": "worker"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestLocalProvisionerIsAProcessProvisioner(c *gocheck.C) {
+	var _ provision.ProcessProvisioner = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerAddZeroUnits(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 0)
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "Cannot add zero units.")
 }
 
 func (s *S) TestProvisionerRemoveUnit(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
-	err := p.RemoveUnit(app, "")
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err = p.collection().Insert(
+		provision.Unit{Name: "myapp/0", AppName: "myapp", Machine: 0, Ip: "10.10.10.1"},
+		provision.Unit{Name: "myapp/1", AppName: "myapp", Machine: 1, Ip: "10.10.10.2"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	rtesting.FakeRouter.AddBackend("myapp")
+	rtesting.FakeRouter.AddRoute("myapp", "10.10.10.1")
+	rtesting.FakeRouter.AddRoute("myapp", "10.10.10.2")
+	err = p.RemoveUnit(app, "myapp/1")
+	c.Assert(err, gocheck.IsNil)
+	time.Sleep(1e9)
+	c.Assert(rtesting.FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{"10.10.10.1"})
+	expected := "lxc-stop -n myapp-1"
+	expected += "lxc-destroy -n myapp-1"
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
+	n, err := p.collection().Find(bson.M{"name": "myapp/1"}).Count()
 	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	n, err = p.collection().Find(bson.M{"name": "myapp/0"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestProvisionerRemoveUnknownUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RemoveUnit(app, "myapp/9")
+	c.Assert(err, gocheck.ErrorMatches, `App "myapp" does not have a unit named "myapp/9".`)
 }
 
 func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
@@ -184,7 +489,7 @@ func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
 	tmpdir, err := commandmocker.Add("ssh", "$*")
 	c.Assert(err, gocheck.IsNil)
 	defer commandmocker.Remove(tmpdir)
-	app := testing.NewFakeApp("almah", "static", 2)
+	app := testing.NewFakeApp("almah", "static", 1)
 	err = p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
 	c.Assert(err, gocheck.IsNil)
 	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", app.ProvisionUnits()[0].GetIp())
@@ -192,6 +497,112 @@ func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
 }
 
+func (s *S) TestLocalProvisionerIsAUnitCommandExecutor(c *gocheck.C) {
+	var _ provision.UnitCommandExecutor = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerExecuteCommandOnUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	unit := app.ProvisionUnits()[1]
+	err = p.ExecuteCommandOnUnit(&buf, &buf, app, unit, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", unit.GetIp())
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+}
+
+func (s *S) TestProvisionerExecuteCommandOnUnitExitStatus(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Error("ssh", "failed", 3)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 1)
+	err = p.ExecuteCommandOnUnit(&buf, &buf, app, app.ProvisionUnits()[0], "ls")
+	c.Assert(err, gocheck.DeepEquals, &provision.ExitError{Status: 3})
+}
+
+func (s *S) TestLocalProvisionerIsAnInputCommandExecutor(c *gocheck.C) {
+	var _ provision.InputCommandExecutor = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerExecuteCommandOnUnitWithInput(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	unit := app.ProvisionUnits()[1]
+	err = p.ExecuteCommandOnUnitWithInput(strings.NewReader("archive"), &buf, &buf, app, unit, "tar", "-xzf", "-")
+	c.Assert(err, gocheck.IsNil)
+	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s tar -xzf -", unit.GetIp())
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+}
+
+func (s *S) TestLocalProvisionerIsAShellProvisioner(c *gocheck.C) {
+	var _ provision.ShellProvisioner = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerShell(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	unit := app.ProvisionUnits()[1]
+	opts := provision.ShellOptions{App: app, Unit: unit, Cmd: "bash -l", Stdout: &buf}
+	err = p.Shell(opts)
+	c.Assert(err, gocheck.IsNil)
+	cmdOutput := fmt.Sprintf("-t -l ubuntu -q -o StrictHostKeyChecking no %s bash -l", unit.GetIp())
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+}
+
+func (s *S) TestLocalProvisionerIsAnUploader(c *gocheck.C) {
+	var _ provision.Uploader = &LocalProvisioner{}
+}
+
+func (s *S) TestProvisionerUpload(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.SetUnitStatus(provision.StatusCreating, 1)
+	err = p.Upload(app, strings.NewReader("archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.IsNil)
+	cmd := provision.ExtractCommand("/home/application/current")
+	expected := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s %s", app.ProvisionUnits()[0].GetIp(), cmd)
+	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
+	c.Assert(buf.String(), gocheck.Matches, `(?s).*Skipping unit "almah/1": its state is "creating".\n$`)
+}
+
+func (s *S) TestProvisionerExecuteCommandMultipleUnits(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 3)
+	app.SetUnitStatus(provision.StatusCreating, 2)
+	err = p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	units := app.ProvisionUnits()
+	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", units[0].GetIp())
+	cmdOutput += fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", units[1].GetIp())
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+	out := buf.String()
+	c.Assert(out, gocheck.Matches, `(?s)Output from unit "almah/0":.*Output from unit "almah/1":.*`)
+	c.Assert(out, gocheck.Matches, `(?s).*Output from unit "almah/2":\n\nUnit state is "creating", it must be "started" for running commands.\n`)
+}
+
 func (s *S) TestCollectStatus(c *gocheck.C) {
 	var p LocalProvisioner
 	expected := []provision.Unit{
@@ -254,7 +665,7 @@ func (s *S) TestProvisionStart(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer commandmocker.Remove(tmpdir)
 	p := LocalProvisioner{}
-	err = p.start("10.10.10.10")
+	err = p.start("10.10.10.10", "web")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
 	cmds := []string{
@@ -269,6 +680,23 @@ func (s *S) TestProvisionStart(c *gocheck.C) {
 	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, cmds)
 }
 
+func (s *S) TestProvisionStartProcessType(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	p := LocalProvisioner{}
+	err = p.start("10.10.10.10", "worker")
+	c.Assert(err, gocheck.IsNil)
+	params := commandmocker.Parameters(tmpdir)
+	c.Assert(params[len(params)-1], gocheck.Equals, "sudo /var/lib/tsuru/hooks/start worker")
+}
+
+func (s *S) TestIsWeb(c *gocheck.C) {
+	c.Assert(isWeb(provision.Unit{}), gocheck.Equals, true)
+	c.Assert(isWeb(provision.Unit{ProcessType: "web"}), gocheck.Equals, true)
+	c.Assert(isWeb(provision.Unit{ProcessType: "worker"}), gocheck.Equals, false)
+}
+
 func (s *S) TestProvisionSetup(c *gocheck.C) {
 	tmpdir, err := commandmocker.Add("scp", "$*")
 	c.Assert(err, gocheck.IsNil)
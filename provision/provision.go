@@ -7,8 +7,12 @@
 package provision
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os/exec"
+	"syscall"
+	"time"
 )
 
 type Status string
@@ -24,18 +28,29 @@ const (
 	StatusError      = Status("error")
 	StatusInstalling = Status("installing")
 	StatusCreating   = Status("creating")
+	StatusStopped    = Status("stopped")
+
+	// StatusUnhealthy is the status of started units that keep failing the
+	// health check of the app. It's set by the collector.
+	StatusUnhealthy = Status("unhealthy")
 )
 
+// WebProcess is the process type of units that serve the app. Only web units
+// are registered in the load balancer. Units without a process type are web
+// units.
+const WebProcess = "web"
+
 // Unit represents a provision unit. Can be a machine, container or anything
 // IP-addressable.
 type Unit struct {
-	Name       string
-	AppName    string
-	Type       string
-	InstanceId string
-	Machine    int
-	Ip         string
-	Status     Status
+	Name        string
+	AppName     string
+	Type        string
+	ProcessType string
+	InstanceId  string
+	Machine     int
+	Ip          string
+	Status      Status
 }
 
 // Named is something that has a name, providing the GetName method.
@@ -58,6 +73,10 @@ type AppUnit interface {
 
 	// Returns the instance id of the unit.
 	GetInstanceId() string
+
+	// Returns the process type of the unit, as declared in the Procfile
+	// of the app (for example, web or worker).
+	GetProcessType() string
 }
 
 // App represents a tsuru app.
@@ -120,6 +139,271 @@ type Provisioner interface {
 	Addr(App) (string, error)
 }
 
+// Deployer is a provisioner that is able to deploy apps using its own
+// strategy (for example, building an image with the new code and replacing
+// the units).
+//
+// Implementing this interface is optional. When the provisioner is not a
+// Deployer, tsuru deploys apps by pulling the code from the git server in
+// each unit, then installing dependencies and restarting the app.
+type Deployer interface {
+	// Deploy deploys the given version of the app, writing the progress of
+	// the deploy to w. The version is a commit in the app repository. An
+	// empty version means the latest commit.
+	Deploy(app App, version string, w io.Writer) error
+}
+
+// ProcessProvisioner is a provisioner that is able to run units of process
+// types other than web (for example, worker and clock), as declared in the
+// Procfile of the app.
+//
+// The start hook of these units receives the process type as its first
+// argument. Units added with the AddUnits method of the Provisioner are web
+// units.
+//
+// Implementing this interface is optional. Provisioners that are not
+// ProcessProvisioners run only web units.
+type ProcessProvisioner interface {
+	// AddProcessUnits adds n units of the given process type to the app,
+	// returning the added units.
+	AddProcessUnits(app App, n uint, process string) ([]Unit, error)
+}
+
+// Uploader is a provisioner that is able to send an archive with the code of
+// the app to all its units.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not Uploaders can only be deployed from the git repository.
+type Uploader interface {
+	// Upload extracts the given gzipped tar archive in the directory path of
+	// each unit of the app, replacing the previous content of the directory
+	// but its git checkout (see ExtractCommand). The output of the
+	// extraction is written to w.
+	Upload(app App, archive io.Reader, path string, w io.Writer) error
+}
+
+// UnitCommandExecutor is a provisioner that is able to run commands in a
+// single unit of an app.
+//
+// Implementing this interface is optional. When the provisioner is not a
+// UnitCommandExecutor, tsuru runs commands in all units of the app, using
+// the ExecuteCommand method of the Provisioner.
+type UnitCommandExecutor interface {
+	// ExecuteCommandOnUnit runs a command in the given unit of the app. If
+	// the command exits with a non-zero status, the returned error is an
+	// *ExitError.
+	ExecuteCommandOnUnit(stdout, stderr io.Writer, app App, unit AppUnit, cmd string, args ...string) error
+}
+
+// InputCommandExecutor is a UnitCommandExecutor that is also able to send
+// data to the standard input of the commands.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not InputCommandExecutors can't receive files from tsuru app-cp.
+type InputCommandExecutor interface {
+	UnitCommandExecutor
+
+	// ExecuteCommandOnUnitWithInput is like ExecuteCommandOnUnit, but the
+	// command reads its standard input from stdin.
+	ExecuteCommandOnUnitWithInput(stdin io.Reader, stdout, stderr io.Writer, app App, unit AppUnit, cmd string, args ...string) error
+}
+
+// StartStopper is a provisioner that is able to stop the units of an app,
+// keeping them (and their configuration) until they are started again.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not StartStoppers can't be stopped, only restarted or destroyed.
+type StartStopper interface {
+	// Start starts the stopped units of the app.
+	Start(App) error
+
+	// Stop stops all units of the app, without destroying them.
+	Stop(App) error
+}
+
+// MaintenanceProvisioner is a provisioner that is able to put apps in
+// maintenance: the router answers all requests to the app with a static page
+// and the status 503, while the units keep running (for example, for running
+// migrations with tsuru run).
+//
+// Implementing this interface is optional.
+type MaintenanceProvisioner interface {
+	// StartMaintenance puts the app in maintenance. The page is the
+	// content (HTML) served to the clients of the app; an empty page means
+	// the default 503 page of the router.
+	StartMaintenance(app App, page []byte) error
+
+	// StopMaintenance makes the router deliver requests to the units of
+	// the app again.
+	StopMaintenance(app App) error
+}
+
+// ErrMaintenanceNotSupported is returned by MaintenanceProvisioners when the
+// router of the app doesn't support maintenance mode.
+var ErrMaintenanceNotSupported = errors.New("The router of the app doesn't support maintenance mode.")
+
+// RollingRestarter is a provisioner that is able to restart the units of an
+// app one by one, taking them out of the router while they restart.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not RollingRestarters can only be restarted all at once.
+type RollingRestarter interface {
+	// RestartUnit restarts the given unit of the app.
+	RestartUnit(app App, unit AppUnit) error
+
+	// DisableUnit removes the unit from the router, so it stops receiving
+	// requests. Units that are not in the router are left alone.
+	DisableUnit(app App, unit AppUnit) error
+
+	// EnableUnit adds the unit back to the router.
+	EnableUnit(app App, unit AppUnit) error
+}
+
+// BlueGreenProvisioner is a provisioner that is able to deploy apps in a new
+// set of units, switching the router to them only after they're deployed
+// and healthy, then destroying the old units.
+//
+// Implementing this interface is optional. Besides adding standby units and
+// switching the router, tsuru runs commands and restarts the new units one
+// by one, so BlueGreenProvisioners must also be UnitCommandExecutors and
+// RollingRestarters.
+type BlueGreenProvisioner interface {
+	UnitCommandExecutor
+	RollingRestarter
+
+	// AddStandbyUnits adds n units of the given process type to the app,
+	// without adding them to the router. The units may still be pending
+	// when the method returns.
+	AddStandbyUnits(app App, n uint, process string) ([]Unit, error)
+
+	// SwitchUnits adds the standby units to the router and removes the old
+	// units from it, in a single operation when the router supports it.
+	// Units that are not in the router (for example, workers) are left
+	// alone.
+	SwitchUnits(app App, standby, old []AppUnit) error
+}
+
+// UnitStats contains the number of requests answered by a unit, and how many
+// of them failed (status 5xx).
+type UnitStats struct {
+	Requests int
+	Errors   int
+}
+
+// CanaryProvisioner is a BlueGreenProvisioner that is also able to split the
+// traffic of the app among its units, so a new version of the app can be
+// deployed to some units (the canary) and receive a share of the requests.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not CanaryProvisioners can't be deployed with tsuru deploy --canary.
+type CanaryProvisioner interface {
+	BlueGreenProvisioner
+
+	// SetUnitsWeight sets the weight of the given web units in the
+	// router, adding them to the router if needed. Units have weight 1 by
+	// default, and receive a share of the requests proportional to their
+	// weight.
+	SetUnitsWeight(app App, units []AppUnit, weight int) error
+
+	// UnitsStats returns the statistics of the requests answered by the
+	// given web units after the given time, as reported by the router. The
+	// map is keyed by the name of the unit.
+	UnitsStats(app App, units []AppUnit, since time.Time) (map[string]UnitStats, error)
+}
+
+// ErrCanaryNotSupported is returned by CanaryProvisioners when the router of
+// the app doesn't support weighted routes.
+var ErrCanaryNotSupported = errors.New("The router of the app doesn't support weighted routes.")
+
+// UnitMetrics is a sample of the resource usage of a unit.
+type UnitMetrics struct {
+	AppName string
+	Unit    string
+
+	// CPU is the percentage of one CPU used by the unit since the previous
+	// sample.
+	CPU float64
+
+	// Memory and Disk are the percentages of the memory and of the disk
+	// available to the unit that are in use.
+	Memory float64
+	Disk   float64
+}
+
+// MetricsCollector is a provisioner that is able to report the resource usage
+// of units.
+//
+// Implementing this interface is optional. The collector stores the samples
+// of MetricsCollectors, and they're displayed by tsuru app-metrics.
+type MetricsCollector interface {
+	// CollectMetrics returns a sample of the resource usage of each
+	// started unit.
+	CollectMetrics() ([]UnitMetrics, error)
+}
+
+// ShellProvisioner is a provisioner that is able to open interactive shells
+// in the units of an app.
+//
+// Implementing this interface is optional. Apps running in provisioners that
+// are not ShellProvisioners don't support tsuru app-shell.
+type ShellProvisioner interface {
+	// Shell runs the command of the options in a terminal in the given
+	// unit, returning when the command exits. If the command exits with a
+	// non-zero status, the returned error is an *ExitError.
+	Shell(opts ShellOptions) error
+}
+
+// WindowSize is the size of a terminal, in columns and rows.
+type WindowSize struct {
+	Width  int
+	Height int
+}
+
+// ShellOptions are the options of an interactive shell.
+type ShellOptions struct {
+	App  App
+	Unit AppUnit
+
+	// Cmd is the command line that runs in the terminal.
+	Cmd string
+
+	// Stdin is the input of the terminal, and Stdout receives its
+	// output.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Term is the type of the terminal (the TERM environment variable).
+	Term string
+
+	// Size is the initial size of the terminal. Zero means the default
+	// size of the provisioner.
+	Size WindowSize
+
+	// Resize receives the new size of the terminal whenever it changes.
+	Resize <-chan WindowSize
+}
+
+// ExitError is the error returned when a command exits with a non-zero
+// status.
+type ExitError struct {
+	Status int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+// WrapExitError converts errors returned by exec.Cmd when the command exits
+// with a non-zero status to *ExitError. Other errors are returned unchanged.
+func WrapExitError(err error) error {
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+			return &ExitError{Status: status.ExitStatus()}
+		}
+	}
+	return err
+}
+
 var provisioners = make(map[string]Provisioner)
 
 // Register registers a new provisioner in the Provisioner registry.
@@ -6,6 +6,7 @@ package provision
 
 import (
 	"errors"
+	"os/exec"
 	"reflect"
 	"testing"
 )
@@ -54,3 +55,28 @@ func TestStatusString(t *testing.T) {
 		t.Errorf("Status.String(). want \"pending\". Got %q.", got)
 	}
 }
+
+func TestExitError(t *testing.T) {
+	err := &ExitError{Status: 2}
+	if err.Error() != "exit status 2" {
+		t.Errorf("ExitError.Error(): want %q. Got %q.", "exit status 2", err.Error())
+	}
+}
+
+func TestWrapExitError(t *testing.T) {
+	err := WrapExitError(exec.Command("sh", "-c", "exit 3").Run())
+	e, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("WrapExitError: want *ExitError. Got %#v.", err)
+	}
+	if e.Status != 3 {
+		t.Errorf("WrapExitError: want status 3. Got %d.", e.Status)
+	}
+	if err := WrapExitError(nil); err != nil {
+		t.Errorf("WrapExitError(nil): want nil. Got %#v.", err)
+	}
+	other := errors.New("something went wrong")
+	if err := WrapExitError(other); err != other {
+		t.Errorf("WrapExitError: want %#v. Got %#v.", other, err)
+	}
+}
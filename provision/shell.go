@@ -0,0 +1,64 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"github.com/globocom/tsuru/pty"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// RunShell runs the command in a pseudo-terminal, connected to the input and
+// output of the options. Changes in the size of the terminal are forwarded
+// to the command.
+//
+// Provisioners that open shells using ssh should use this function to run
+// the ssh client, so the window size is forwarded to the remote terminal.
+func RunShell(cmd *exec.Cmd, opts ShellOptions) error {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	if opts.Size.Width > 0 && opts.Size.Height > 0 {
+		pty.SetSize(master.Fd(), opts.Size.Width, opts.Size.Height)
+	}
+	if opts.Term != "" {
+		cmd.Env = append(os.Environ(), "TERM="+opts.Term)
+	}
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case size, ok := <-opts.Resize:
+				if !ok {
+					return
+				}
+				pty.SetSize(master.Fd(), size.Width, size.Height)
+			case <-done:
+				return
+			}
+		}
+	}()
+	if opts.Stdin != nil {
+		go io.Copy(master, opts.Stdin)
+	}
+	// Reading from the master fails when the command exits and the slave
+	// is closed.
+	io.Copy(opts.Stdout, master)
+	return WrapExitError(cmd.Wait())
+}
@@ -0,0 +1,48 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package provision
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunShell(t *testing.T) {
+	var buf bytes.Buffer
+	opts := ShellOptions{
+		Stdin:  strings.NewReader(""),
+		Stdout: &buf,
+		Term:   "vt100",
+		Size:   WindowSize{Width: 100, Height: 40},
+	}
+	err := RunShell(exec.Command("sh", "-c", "stty size; echo $TERM; exit 3"), opts)
+	e, ok := err.(*ExitError)
+	if !ok || e.Status != 3 {
+		t.Fatalf("RunShell: want exit status 3. Got %#v.", err)
+	}
+	expected := "40 100\r\nvt100\r\n"
+	if buf.String() != expected {
+		t.Errorf("RunShell: want output %q. Got %q.", expected, buf.String())
+	}
+}
+
+func TestRunShellInput(t *testing.T) {
+	var buf bytes.Buffer
+	opts := ShellOptions{
+		Stdin:  strings.NewReader("exit 0\n"),
+		Stdout: &buf,
+	}
+	err := RunShell(exec.Command("sh"), opts)
+	if err != nil {
+		t.Fatalf("RunShell: unexpected error: %s", err)
+	}
+	if !strings.Contains(buf.String(), "exit 0") {
+		t.Errorf("RunShell: want the input echoed in the output. Got %q.", buf.String())
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import "fmt"
+
+// ExtractCommand returns the shell command used by Uploaders to extract the
+// gzipped tar archive read from the standard input in the directory path.
+//
+// The archive is extracted in a temporary directory that replaces path,
+// keeping the git checkout of the app (path/.git), so the app can still be
+// deployed with git push after being deployed from an archive.
+func ExtractCommand(path string) string {
+	tmp := path + ".upload"
+	old := path + ".old"
+	return fmt.Sprintf(
+		"rm -rf %s %s && mkdir -p %s %s && tar -xzf - -C %s && rm -rf %s/.git && "+
+			"if [ -d %s/.git ]; then mv %s/.git %s/; fi && mv %s %s && mv %s %s && rm -rf %s",
+		tmp, old, path, tmp, tmp, tmp,
+		path, path, tmp, path, old, tmp, path, old,
+	)
+}
@@ -0,0 +1,78 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractCommandKeepsTheGitCheckout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "current")
+	os.MkdirAll(filepath.Join(path, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(path, ".git", "HEAD"), []byte("ref: refs/heads/master\n"), 0644)
+	ioutil.WriteFile(filepath.Join(path, "old.py"), []byte("old"), 0644)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("print 'new'")
+	tw.WriteHeader(&tar.Header{Name: "new.py", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	cmd := exec.Command("/bin/sh", "-c", ExtractCommand(path))
+	cmd.Stdin = &buf
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %s. Output: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(path, "old.py")); !os.IsNotExist(err) {
+		t.Errorf("Expected the previous code to be removed.")
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(path, "new.py")); string(got) != string(content) {
+		t.Errorf("Expected the archive to be extracted. Got %q.", got)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(path, ".git", "HEAD")); string(got) != "ref: refs/heads/master\n" {
+		t.Errorf("Expected the git checkout to be kept. Got %q.", got)
+	}
+	for _, p := range []string{path + ".upload", path + ".old"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed.", p)
+		}
+	}
+}
+
+func TestExtractCommandWithoutGitCheckout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "current")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "app.py", Mode: 0644})
+	tw.Close()
+	gz.Close()
+	cmd := exec.Command("/bin/sh", "-c", ExtractCommand(path))
+	cmd.Stdin = &buf
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %s. Output: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(path, "app.py")); err != nil {
+		t.Errorf("Expected the archive to be extracted: %s.", err)
+	}
+}
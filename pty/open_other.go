@@ -0,0 +1,17 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package pty
+
+import (
+	"errors"
+	"os"
+)
+
+// Open opens a new pseudo-terminal, returning its master and slave sides.
+func Open() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("Pseudo-terminals are supported only in Linux.")
+}
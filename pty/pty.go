@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pty provides functions for opening pseudo-terminals and handling
+// the size of terminals.
+//
+// It's used both by the server, to run interactive shells in the units of
+// apps, and by the clients, to forward the size of the user's terminal.
+package pty
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// GetSize returns the number of columns and rows of the terminal.
+func GetSize(fd uintptr) (width, height int, err error) {
+	var ws winsize
+	if err = ioctl(fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// SetSize defines the number of columns and rows of the terminal. When the
+// file descriptor is the master side of a pseudo-terminal, the processes
+// running in the terminal receive a SIGWINCH.
+func SetSize(fd uintptr, width, height int) error {
+	ws := winsize{Row: uint16(height), Col: uint16(width)}
+	return ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
@@ -0,0 +1,30 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package pty
+
+import (
+	"testing"
+)
+
+func TestSetSizeOfTheMasterIsSeenByTheSlave(t *testing.T) {
+	master, slave, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	if err = SetSize(master.Fd(), 100, 40); err != nil {
+		t.Fatal(err)
+	}
+	width, height, err := GetSize(slave.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 100 || height != 40 {
+		t.Errorf("GetSize: want 100x40. Got %dx%d.", width, height)
+	}
+}
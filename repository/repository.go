@@ -10,8 +10,11 @@ import (
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/log"
 	"io"
+	"regexp"
 )
 
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
 // Unit interface represents a unit of execution.
 //
 // It must provide two methods:
@@ -43,16 +46,18 @@ func clone(u Unit) ([]byte, error) {
 	return b, err
 }
 
-// Pull runs a git pull to update the code in a unit.
+// Pull updates the code in a unit to the master branch of the app bare
+// repository.
 //
-// It works like Clone, pulling from the app bare repository.
+// Local changes are discarded, so units whose code was replaced by a deploy
+// from an archive (see provision.Uploader) can still be deployed with git.
 func pull(u Unit) ([]byte, error) {
 	var buf bytes.Buffer
 	p, err := GetPath()
 	if err != nil {
 		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
 	}
-	cmd := fmt.Sprintf("cd %s && git pull origin master", p)
+	cmd := fmt.Sprintf("cd %s && git fetch -q origin master && git reset -q --hard FETCH_HEAD", p)
 	err = u.Command(&buf, &buf, cmd)
 	b := buf.Bytes()
 	log.Printf(`"git pull" output: %s`, b)
@@ -71,6 +76,28 @@ func CloneOrPull(u Unit) ([]byte, error) {
 	return b, err
 }
 
+// Checkout checks out the given commit in a unit of the app.
+//
+// Units are cloned with --depth 1, so Checkout fetches the whole history from
+// the bare repository before checking out the commit. It's used for
+// deploying specific versions of the app (for example, when rolling back to a
+// previous deploy).
+func Checkout(u Unit, commit string) ([]byte, error) {
+	if !commitRegexp.MatchString(commit) {
+		return nil, fmt.Errorf("Invalid commit: %q.", commit)
+	}
+	var buf bytes.Buffer
+	p, err := GetPath()
+	if err != nil {
+		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	cmd := fmt.Sprintf("cd %s && (git fetch -q --unshallow origin || git fetch -q origin) && git checkout -q %s", p, commit)
+	err = u.Command(&buf, &buf, cmd)
+	b := buf.Bytes()
+	log.Printf(`"git checkout" output: %s`, b)
+	return b, err
+}
+
 // getGitServer returns the git server defined in the tsuru.conf file.
 //
 // If git:host configuration is not defined, this function panics.
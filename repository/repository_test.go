@@ -70,7 +70,7 @@ func (s *S) TestPullRepository(c *gocheck.C) {
 	u := FakeUnit{name: "your-unit"}
 	_, err := pull(&u)
 	c.Assert(err, gocheck.IsNil)
-	expectedCommand := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	expectedCommand := fmt.Sprintf("cd /home/application/current && git fetch -q origin master && git reset -q --hard FETCH_HEAD")
 	c.Assert(u.RanCommand(expectedCommand), gocheck.Equals, true)
 }
 
@@ -89,7 +89,7 @@ func (s *S) TestCloneOrPullRepositoryRunsClone(c *gocheck.C) {
 	_, err := CloneOrPull(&u)
 	c.Assert(err, gocheck.IsNil)
 	clone := fmt.Sprintf("git clone %s /home/application/current --depth 1", GetReadOnlyUrl(u.GetName()))
-	pull := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	pull := fmt.Sprintf("cd /home/application/current && git fetch -q origin master && git reset -q --hard FETCH_HEAD")
 	c.Assert(u.RanCommand(clone), gocheck.Equals, true)
 	c.Assert(u.RanCommand(pull), gocheck.Equals, false)
 }
@@ -99,11 +99,35 @@ func (s *S) TestCloneOrPullRepositoryRunsPullIfCloneFail(c *gocheck.C) {
 	_, err := CloneOrPull(&u)
 	c.Assert(err, gocheck.IsNil)
 	clone := fmt.Sprintf("git clone %s /home/application/current --depth 1", GetReadOnlyUrl(u.GetName()))
-	pull := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	pull := fmt.Sprintf("cd /home/application/current && git fetch -q origin master && git reset -q --hard FETCH_HEAD")
 	c.Assert(u.RanCommand(clone), gocheck.Equals, true)
 	c.Assert(u.RanCommand(pull), gocheck.Equals, true)
 }
 
+func (s *S) TestCheckout(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "a9b1e3f")
+	c.Assert(err, gocheck.IsNil)
+	expected := "cd /home/application/current && (git fetch -q --unshallow origin || git fetch -q origin) && git checkout -q a9b1e3f"
+	c.Assert(u.RanCommand(expected), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckoutInvalidCommit(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "master; rm -rf /")
+	c.Assert(err, gocheck.ErrorMatches, `Invalid commit: "master; rm -rf /".`)
+	c.Assert(u.commands, gocheck.HasLen, 0)
+}
+
+func (s *S) TestCheckoutUndefinedPath(c *gocheck.C) {
+	old, _ := config.Get("git:unit-repo")
+	config.Unset("git:unit-repo")
+	defer config.Set("git:unit-repo", old)
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "a9b1e3f")
+	c.Assert(err, gocheck.ErrorMatches, `Tsuru is misconfigured: key "git:unit-repo" not found`)
+}
+
 func (s *S) TestGetRepositoryUrl(c *gocheck.C) {
 	url := GetUrl("foobar")
 	expected := "git@mygithost:foobar.git"
@@ -0,0 +1,250 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package elb provides a router implementation that manages load balancers
+// within Amazon Elastic Load Balancing. Each backend is a load balancer, and
+// each route is an EC2 instance registered in that load balancer.
+//
+// The router stores the DNS name of the load balancers in the database, in
+// the collection defined by the juju:elb-collection setting. It shares all
+// ELB settings (juju:elb-*) with the juju provisioner.
+package elb
+
+import (
+	"github.com/flaviamissi/go-elb/aws"
+	"github.com/flaviamissi/go-elb/elb"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+func init() {
+	router.Register("elb", &elbRouter{})
+}
+
+// loadBalancer represents an ELB instance.
+type loadBalancer struct {
+	Name    string
+	DNSName string
+
+	// Maintenance indicates whether the load balancer is in maintenance.
+	// The instances removed from the load balancer during the maintenance
+	// are kept in Instances, and registered again when it ends.
+	Maintenance bool
+	Instances   []string
+}
+
+type elbRouter struct{}
+
+func (r *elbRouter) collection() (*mgo.Collection, error) {
+	name, err := config.GetString("juju:elb-collection")
+	if err != nil {
+		log.Fatal("juju:elb-collection is undefined on config file.")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Printf("[elb] Failed to connect to the database: %s", err)
+		return nil, err
+	}
+	return conn.Collection(name), nil
+}
+
+func (r *elbRouter) elb() *elb.ELB {
+	return Endpoint()
+}
+
+func (r *elbRouter) vpc() bool {
+	vpc, _ := config.GetBool("juju:elb-use-vpc")
+	return vpc
+}
+
+// AddBackend creates a new Elastic Load Balancing instance with the given
+// name.
+func (r *elbRouter) AddBackend(name string) error {
+	options := elb.CreateLoadBalancer{
+		Name: name,
+		Listeners: []elb.Listener{
+			{
+				InstancePort:     80,
+				InstanceProtocol: "HTTP",
+				LoadBalancerPort: 80,
+				Protocol:         "HTTP",
+			},
+		},
+	}
+	var err error
+	if r.vpc() {
+		options.Subnets, err = config.GetList("juju:elb-vpc-subnets")
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.SecurityGroups, err = config.GetList("juju:elb-vpc-secgroups")
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.Scheme = "internal"
+	} else {
+		options.AvailZones, err = config.GetList("juju:elb-avail-zones")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	resp, err := r.elb().CreateLoadBalancer(&options)
+	if err != nil {
+		return err
+	}
+	coll, err := r.collection()
+	if err != nil {
+		return err
+	}
+	lb := loadBalancer{Name: name, DNSName: resp.DNSName}
+	return coll.Insert(lb)
+}
+
+// RemoveBackend destroys the Elastic Load Balancing instance with the given
+// name.
+func (r *elbRouter) RemoveBackend(name string) error {
+	_, err := r.elb().DeleteLoadBalancer(name)
+	if err != nil {
+		return err
+	}
+	coll, err := r.collection()
+	if err != nil {
+		return err
+	}
+	return coll.Remove(bson.M{"name": name})
+}
+
+// find returns the load balancer with the given name.
+func (r *elbRouter) find(name string) (*loadBalancer, error) {
+	coll, err := r.collection()
+	if err != nil {
+		return nil, err
+	}
+	var lb loadBalancer
+	err = coll.Find(bson.M{"name": name}).One(&lb)
+	if err != nil {
+		return nil, err
+	}
+	return &lb, nil
+}
+
+// updateLoadBalancer applies the given update to the load balancer with the
+// given name, in the database.
+func (r *elbRouter) updateLoadBalancer(name string, update bson.M) error {
+	coll, err := r.collection()
+	if err != nil {
+		return err
+	}
+	return coll.Update(bson.M{"name": name}, update)
+}
+
+// AddRoute registers the EC2 instance identified by address in the load
+// balancer. When the load balancer is in maintenance, the instance is
+// registered only when the maintenance ends.
+func (r *elbRouter) AddRoute(name, address string) error {
+	if lb, err := r.find(name); err == nil && lb.Maintenance {
+		return r.updateLoadBalancer(name, bson.M{"$addToSet": bson.M{"instances": address}})
+	}
+	_, err := r.elb().RegisterInstancesWithLoadBalancer([]string{address}, name)
+	return err
+}
+
+// RemoveRoute deregisters the EC2 instance identified by address from the
+// load balancer.
+func (r *elbRouter) RemoveRoute(name, address string) error {
+	if lb, err := r.find(name); err == nil && lb.Maintenance {
+		return r.updateLoadBalancer(name, bson.M{"$pull": bson.M{"instances": address}})
+	}
+	_, err := r.elb().DeregisterInstancesFromLoadBalancer([]string{address}, name)
+	return err
+}
+
+// StartMaintenance deregisters all instances from the load balancer, so it
+// answers all requests with its own 503 page. ELB doesn't serve custom
+// pages, so the page is ignored.
+func (r *elbRouter) StartMaintenance(name string, page []byte) error {
+	lb, err := r.find(name)
+	if err != nil {
+		return err
+	}
+	if lb.Maintenance {
+		return nil
+	}
+	resp, err := r.elb().DescribeLoadBalancers(name)
+	if err != nil {
+		return err
+	}
+	var instances []string
+	for _, desc := range resp.LoadBalancerDescriptions {
+		for _, instance := range desc.Instances {
+			instances = append(instances, instance.InstanceId)
+		}
+	}
+	err = r.updateLoadBalancer(name, bson.M{"$set": bson.M{"maintenance": true, "instances": instances}})
+	if err != nil || len(instances) == 0 {
+		return err
+	}
+	_, err = r.elb().DeregisterInstancesFromLoadBalancer(instances, name)
+	return err
+}
+
+// StopMaintenance registers again the instances removed from the load
+// balancer by StartMaintenance.
+func (r *elbRouter) StopMaintenance(name string) error {
+	lb, err := r.find(name)
+	if err != nil {
+		return err
+	}
+	if !lb.Maintenance {
+		return nil
+	}
+	if len(lb.Instances) > 0 {
+		_, err = r.elb().RegisterInstancesWithLoadBalancer(lb.Instances, name)
+		if err != nil {
+			return err
+		}
+	}
+	return r.updateLoadBalancer(name, bson.M{"$set": bson.M{"maintenance": false, "instances": []string{}}})
+}
+
+// SetCName is a no-op: a cname pointing to the DNS name of the load balancer
+// is enough for ELB to deliver requests to the app.
+func (r *elbRouter) SetCName(cname, name string) error {
+	return nil
+}
+
+// Addr returns the dns-name of the load balancer, which is also the DNS name
+// of the app.
+func (r *elbRouter) Addr(name string) (string, error) {
+	lb, err := r.find(name)
+	if err != nil {
+		return "", err
+	}
+	return lb.DNSName, nil
+}
+
+// Endpoint returns a client of the ELB API, configured with the AWS
+// credentials (aws:access-key-id and aws:secret-access-key) and the
+// juju:elb-endpoint setting. It's shared with the juju provisioner.
+func Endpoint() *elb.ELB {
+	access, err := config.GetString("aws:access-key-id")
+	if err != nil {
+		log.Fatal(err)
+	}
+	secret, err := config.GetString("aws:secret-access-key")
+	if err != nil {
+		log.Fatal(err)
+	}
+	endpoint, err := config.GetString("juju:elb-endpoint")
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth := aws.Auth{AccessKey: access, SecretKey: secret}
+	region := aws.Region{ELBEndpoint: endpoint}
+	return elb.New(auth, region)
+}
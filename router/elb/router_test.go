@@ -0,0 +1,205 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elb
+
+import (
+	"github.com/flaviamissi/go-elb/aws"
+	"github.com/flaviamissi/go-elb/elb"
+	"github.com/flaviamissi/go-elb/elb/elbtest"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	server *elbtest.Server
+	client *elb.ELB
+	conn   *db.Storage
+	cName  string
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	var err error
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_elb_tests")
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	s.server, err = elbtest.NewServer()
+	c.Assert(err, gocheck.IsNil)
+	config.Set("juju:elb-endpoint", s.server.URL())
+	region := aws.SAEast
+	region.ELBEndpoint = s.server.URL()
+	s.client = elb.New(aws.Auth{AccessKey: "some", SecretKey: "thing"}, region)
+	s.cName = "router_elb_tests"
+	config.Set("juju:elb-collection", s.cName)
+	config.Set("juju:elb-avail-zones", []interface{}{"my-zone-1a", "my-zone-1b"})
+	config.Set("aws:access-key-id", "access")
+	config.Set("aws:secret-access-key", "s3cr3t")
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Collection(s.cName).Database.DropDatabase()
+	s.server.Quit()
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("elb")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.FitsTypeOf, &elbRouter{})
+}
+
+func (s *S) TestGetCollection(c *gocheck.C) {
+	var r elbRouter
+	coll, err := r.collection()
+	c.Assert(err, gocheck.IsNil)
+	other := s.conn.Collection(s.cName)
+	c.Assert(coll.FullName, gocheck.Equals, other.FullName)
+}
+
+func (s *S) TestGetELBClient(c *gocheck.C) {
+	var r elbRouter
+	c.Assert(r.elb().ELBEndpoint, gocheck.Equals, s.server.URL())
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("tip")
+	resp, err := s.client.DescribeLoadBalancers("tip")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	listener := resp.LoadBalancerDescriptions[0].ListenerDescriptions[0].Listener
+	c.Assert(listener.InstancePort, gocheck.Equals, 80)
+	c.Assert(listener.LoadBalancerPort, gocheck.Equals, 80)
+	var lb loadBalancer
+	err = s.conn.Collection(s.cName).Find(bson.M{"name": "tip"}).One(&lb)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(lb.DNSName, gocheck.Equals, resp.LoadBalancerDescriptions[0].DNSName)
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("blue")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveBackend("blue")
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.client.DescribeLoadBalancers("blue")
+	c.Assert(err, gocheck.ErrorMatches, `^.*\(LoadBalancerNotFound\)$`)
+	n, err := s.conn.Collection(s.cName).Find(bson.M{"name": "blue"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddAndRemoveRoute(c *gocheck.C) {
+	id1 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id1)
+	id2 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id2)
+	var r elbRouter
+	err := r.AddBackend("fooled")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("fooled")
+	err = r.AddRoute("fooled", id1)
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("fooled", id2)
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("fooled", id1)
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers("fooled")
+	c.Assert(err, gocheck.IsNil)
+	instances := resp.LoadBalancerDescriptions[0].Instances
+	c.Assert(instances, gocheck.HasLen, 1)
+	c.Assert(instances[0].InstanceId, gocheck.Equals, id2)
+}
+
+func (s *S) TestELBRouterIsAMaintenanceRouter(c *gocheck.C) {
+	var _ router.MaintenanceRouter = &elbRouter{}
+}
+
+func (s *S) TestMaintenance(c *gocheck.C) {
+	id1 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id1)
+	id2 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id2)
+	var r elbRouter
+	err := r.AddBackend("closed")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("closed")
+	err = r.AddRoute("closed", id1)
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("closed", []byte("ignored"))
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers("closed")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+	err = r.AddRoute("closed", id2)
+	c.Assert(err, gocheck.IsNil)
+	resp, err = s.client.DescribeLoadBalancers("closed")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+	err = r.StopMaintenance("closed")
+	c.Assert(err, gocheck.IsNil)
+	resp, err = s.client.DescribeLoadBalancers("closed")
+	c.Assert(err, gocheck.IsNil)
+	instances := resp.LoadBalancerDescriptions[0].Instances
+	c.Assert(instances, gocheck.HasLen, 2)
+	lb, err := r.find("closed")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(lb.Maintenance, gocheck.Equals, false)
+	c.Assert(lb.Instances, gocheck.HasLen, 0)
+}
+
+func (s *S) TestRemoveRouteDuringMaintenance(c *gocheck.C) {
+	id := s.server.NewInstance()
+	defer s.server.RemoveInstance(id)
+	var r elbRouter
+	err := r.AddBackend("closed")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("closed")
+	err = r.AddRoute("closed", id)
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("closed", nil)
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("closed", id)
+	c.Assert(err, gocheck.IsNil)
+	err = r.StopMaintenance("closed")
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers("closed")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 0)
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	var r elbRouter
+	err := r.SetCName("myapp.com", "myapp")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("enough")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("enough")
+	resp, err := s.client.DescribeLoadBalancers("enough")
+	c.Assert(err, gocheck.IsNil)
+	addr, err := r.Addr("enough")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, resp.LoadBalancerDescriptions[0].DNSName)
+}
+
+func (s *S) TestAddrUnknownBackend(c *gocheck.C) {
+	var r elbRouter
+	addr, err := r.Addr("five")
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.NotNil)
+}
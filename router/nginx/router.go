@@ -0,0 +1,460 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nginx provides a router implementation that writes one nginx
+// virtual host per backend, reloading nginx after every change. Backends
+// without routes are written as comments, because nginx refuses to load an
+// empty upstream.
+//
+// It uses the following settings:
+//
+//   - nginx:domain: the domain of the apps, the address of a backend is
+//     <name>.<domain>;
+//   - nginx:routes-path: the directory where nginx virtual hosts are stored;
+//   - nginx:maintenance-path: the directory where the pages of backends in
+//     maintenance are stored, required only for custom maintenance pages;
+//   - nginx:logs-path: the directory where the access logs of the backends
+//     are written, required only for route statistics.
+package nginx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/fs"
+	"github.com/globocom/tsuru/router"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	router.Register("nginx", nginxRouter{})
+}
+
+var fsystem fs.Fs
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+// mut serializes the changes in the virtual hosts, which are read, changed
+// and written back.
+var mut sync.Mutex
+
+var (
+	serverRegexp      = regexp.MustCompile(`(?m)^\tserver (\S+?)(?: weight=(\d+))?;$`)
+	serverNameRegexp  = regexp.MustCompile(`(?m)^#?\tserver_name (.+);$`)
+	maintenanceRegexp = regexp.MustCompile(`(?m)^\t\treturn 503;$`)
+	pageRootRegexp    = regexp.MustCompile(`(?m)^\troot (\S+);$`)
+)
+
+// backend is the representation of an nginx virtual host.
+type backend struct {
+	name        string
+	cname       string
+	routes      []string
+	maintenance bool
+
+	// weights contains the weights of the routes that don't have the
+	// default weight (1).
+	weights map[string]int
+
+	// pageDir is the directory of the custom maintenance page, empty
+	// when the backend uses the default 503 page of nginx.
+	pageDir string
+}
+
+type nginxRouter struct{}
+
+func (nginxRouter) routesPath() (string, error) {
+	return config.GetString("nginx:routes-path")
+}
+
+func (r nginxRouter) Addr(name string) (string, error) {
+	domain, err := config.GetString("nginx:domain")
+	if err != nil {
+		return "", err
+	}
+	return name + "." + domain, nil
+}
+
+// read reads the backend from the virtual host file.
+func (r nginxRouter) read(name string) (*backend, error) {
+	routesPath, err := r.routesPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := filesystem().Open(path.Join(routesPath, name))
+	if err != nil {
+		return nil, errors.New("Backend not found")
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	b := backend{name: name, maintenance: maintenanceRegexp.Match(data)}
+	if m := pageRootRegexp.FindSubmatch(data); m != nil {
+		b.pageDir = string(m[1])
+	}
+	for _, m := range serverRegexp.FindAllStringSubmatch(string(data), -1) {
+		b.routes = append(b.routes, m[1])
+		if m[2] != "" {
+			if b.weights == nil {
+				b.weights = make(map[string]int)
+			}
+			b.weights[m[1]], _ = strconv.Atoi(m[2])
+		}
+	}
+	addr, err := r.Addr(name)
+	if err != nil {
+		return nil, err
+	}
+	if m := serverNameRegexp.FindStringSubmatch(string(data)); m != nil {
+		for _, n := range strings.Fields(m[1]) {
+			if n != addr {
+				b.cname = n
+			}
+		}
+	}
+	return &b, nil
+}
+
+// write writes the virtual host file and reloads nginx. The previous file is
+// restored when nginx rejects the new one.
+func (r nginxRouter) write(b *backend) error {
+	routesPath, err := r.routesPath()
+	if err != nil {
+		return err
+	}
+	addr, err := r.Addr(b.name)
+	if err != nil {
+		return err
+	}
+	serverName := addr
+	if b.cname != "" {
+		serverName += " " + b.cname
+	}
+	var servers string
+	for _, route := range b.routes {
+		if w, ok := b.weights[route]; ok && w != 1 {
+			servers += fmt.Sprintf("\tserver %s weight=%d;\n", route, w)
+		} else {
+			servers += fmt.Sprintf("\tserver %s;\n", route)
+		}
+	}
+	location := fmt.Sprintf("\tlocation / {\n\t\tproxy_pass http://%s_backend;\n\t}\n", b.name)
+	if b.maintenance {
+		location = "\tlocation / {\n\t\treturn 503;\n\t}\n"
+		if b.pageDir != "" {
+			page := "/" + b.name + ".html"
+			location = fmt.Sprintf("\troot %s;\n\terror_page 503 %s;\n\tlocation = %s {\n\t\tinternal;\n\t}\n",
+				b.pageDir, page, page) + location
+		}
+	}
+	var logFormat string
+	if logsPath, err := config.GetString("nginx:logs-path"); err == nil {
+		logFormat = fmt.Sprintf("log_format %s_stats '$msec $upstream_addr $status';\n\n", b.name)
+		location = fmt.Sprintf("\taccess_log %s %s_stats;\n", path.Join(logsPath, b.name+".log"), b.name) + location
+	}
+	var content string
+	switch {
+	case len(b.routes) > 0:
+		template := `%supstream %s_backend {
+%s}
+
+server {
+	listen 80;
+	server_name %s;
+%s}`
+		content = fmt.Sprintf(template, logFormat, b.name, servers, serverName, location)
+	case b.maintenance:
+		template := `%sserver {
+	listen 80;
+	server_name %s;
+%s}`
+		content = fmt.Sprintf(template, logFormat, serverName, location)
+	default:
+		content = fmt.Sprintf("# %s has no routes.\n#\tserver_name %s;\n", b.name, serverName)
+	}
+	file := path.Join(routesPath, b.name)
+	old, readErr := readFile(file)
+	if err = writeFile(file, []byte(content)); err != nil {
+		return err
+	}
+	if err = reload(); err != nil {
+		if readErr == nil {
+			writeFile(file, old)
+		} else {
+			filesystem().Remove(file)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r nginxRouter) AddBackend(name string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	if _, err := r.read(name); err == nil {
+		return errors.New("Backend already exists")
+	}
+	return r.write(&backend{name: name})
+}
+
+func (r nginxRouter) RemoveBackend(name string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	routesPath, err := r.routesPath()
+	if err != nil {
+		return err
+	}
+	err = filesystem().Remove(path.Join(routesPath, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return reload()
+}
+
+func (r nginxRouter) AddRoute(name, address string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	for _, route := range b.routes {
+		if route == address {
+			return nil
+		}
+	}
+	b.routes = append(b.routes, address)
+	return r.write(b)
+}
+
+func (r nginxRouter) RemoveRoute(name, address string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, 0, len(b.routes))
+	for _, route := range b.routes {
+		if route != address {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == len(b.routes) {
+		return errors.New("Route not found")
+	}
+	b.routes = routes
+	return r.write(b)
+}
+
+// SwitchRoutes replaces the routes of the backend, reloading nginx only
+// once.
+func (r nginxRouter) SwitchRoutes(name string, add, remove []string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, route := range remove {
+		removed[route] = true
+	}
+	routes := make([]string, 0, len(b.routes)+len(add))
+	for _, route := range b.routes {
+		if !removed[route] {
+			routes = append(routes, route)
+		}
+	}
+	for _, route := range add {
+		if !removed[route] {
+			routes = append(routes, route)
+		}
+	}
+	b.routes = routes
+	return r.write(b)
+}
+
+// SetRouteWeight sets the weight of the route in the upstream of the backend,
+// adding the route when it doesn't exist.
+func (r nginxRouter) SetRouteWeight(name, address string, weight int) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, route := range b.routes {
+		if route == address {
+			found = true
+			break
+		}
+	}
+	if !found {
+		b.routes = append(b.routes, address)
+	}
+	if b.weights == nil {
+		b.weights = make(map[string]int)
+	}
+	b.weights[address] = weight
+	return r.write(b)
+}
+
+// RouteStats reads the statistics of the routes of the backend from its
+// access log, in the directory defined by the nginx:logs-path setting. Each
+// line of the log contains the time of the request, the address of the
+// upstream server and the status of the response. Requests older than since,
+// and lines without time (written by older versions of tsuru), are skipped.
+func (r nginxRouter) RouteStats(name string, since time.Time) (map[string]router.RouteStats, error) {
+	b, err := r.read(name)
+	if err != nil {
+		return nil, err
+	}
+	logsPath, err := config.GetString("nginx:logs-path")
+	if err != nil {
+		return nil, err
+	}
+	routes := make(map[string]bool, len(b.routes))
+	for _, route := range b.routes {
+		routes[route] = true
+	}
+	start := float64(since.UnixNano()) / 1e9
+	stats := make(map[string]router.RouteStats)
+	file, err := filesystem().Open(path.Join(logsPath, name+".log"))
+	if err != nil {
+		return stats, nil
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		msec, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || msec < start {
+			continue
+		}
+		// When nginx tries more than one server, the last one answered
+		// the request.
+		addr := fields[len(fields)-2]
+		if !routes[addr] {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil || !routes[host] {
+				continue
+			}
+			addr = host
+		}
+		s := stats[addr]
+		s.Requests++
+		if strings.HasPrefix(fields[len(fields)-1], "5") {
+			s.Errors++
+		}
+		stats[addr] = s
+	}
+	return stats, scanner.Err()
+}
+
+func (r nginxRouter) SetCName(cname, name string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	b.cname = cname
+	return r.write(b)
+}
+
+// StartMaintenance makes nginx answer all requests to the backend with the
+// status 503. The custom page is stored in the directory defined by the
+// nginx:maintenance-path setting.
+func (r nginxRouter) StartMaintenance(name string, page []byte) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	if len(page) > 0 {
+		dir, err := config.GetString("nginx:maintenance-path")
+		if err != nil {
+			return err
+		}
+		if err = writeFile(path.Join(dir, name+".html"), page); err != nil {
+			return err
+		}
+		b.pageDir = dir
+	} else if b.pageDir != "" {
+		filesystem().Remove(path.Join(b.pageDir, name+".html"))
+		b.pageDir = ""
+	}
+	b.maintenance = true
+	return r.write(b)
+}
+
+// StopMaintenance makes nginx deliver requests to the routes of the backend
+// again, removing the custom maintenance page.
+func (r nginxRouter) StopMaintenance(name string) error {
+	mut.Lock()
+	defer mut.Unlock()
+	b, err := r.read(name)
+	if err != nil {
+		return err
+	}
+	if b.pageDir != "" {
+		filesystem().Remove(path.Join(b.pageDir, name+".html"))
+	}
+	b.maintenance = false
+	b.pageDir = ""
+	return r.write(b)
+}
+
+func readFile(name string) ([]byte, error) {
+	file, err := filesystem().Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+func writeFile(name string, data []byte) error {
+	flag := syscall.O_WRONLY | syscall.O_CREAT | syscall.O_TRUNC
+	file, err := filesystem().OpenFile(name, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(data)
+	return err
+}
+
+// reload checks the configuration of nginx and reloads it, so it reads the
+// new configuration without dropping connections.
+func reload() error {
+	if out, err := exec.Command("sudo", "nginx", "-t").CombinedOutput(); err != nil {
+		return fmt.Errorf("Invalid nginx configuration: %s", out)
+	}
+	return exec.Command("sudo", "service", "nginx", "reload").Run()
+}
@@ -0,0 +1,455 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"fmt"
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/router"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"sync"
+	stdtesting "testing"
+	"time"
+)
+
+func Test(t *stdtesting.T) { gocheck.TestingT(t) }
+
+type S struct {
+	rfs    *testing.RecordingFs
+	tmpdir string
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	config.Set("nginx:domain", "andrewzito.com")
+	config.Set("nginx:routes-path", "/etc/nginx/sites-enabled")
+}
+
+func (s *S) SetUpTest(c *gocheck.C) {
+	s.rfs = &testing.RecordingFs{}
+	fsystem = s.rfs
+	var err error
+	s.tmpdir, err = commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	fsystem = nil
+	commandmocker.Remove(s.tmpdir)
+}
+
+func (s *S) content(c *gocheck.C, name string) string {
+	file, err := s.rfs.Open("/etc/nginx/sites-enabled/" + name)
+	c.Assert(err, gocheck.IsNil)
+	data, err := ioutil.ReadAll(file)
+	c.Assert(err, gocheck.IsNil)
+	return string(data)
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.FitsTypeOf, nginxRouter{})
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	expected := "# name has no routes.\n#\tserver_name name.andrewzito.com;\n"
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	c.Assert(commandmocker.Parameters(s.tmpdir), gocheck.DeepEquals, []string{"nginx", "-t", "service", "nginx", "reload"})
+}
+
+func (s *S) TestAddBackendTwice(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddBackend("name")
+	c.Assert(err, gocheck.ErrorMatches, "Backend already exists")
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.rfs.HasAction("remove /etc/nginx/sites-enabled/name"), gocheck.Equals, true)
+}
+
+func (s *S) TestAddRoute(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name_backend {
+	server 10.10.10.10;
+	server 10.10.10.11;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name_backend;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+}
+
+func (s *S) TestAddRouteUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddRoute("unknown", "10.10.10.10")
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestRemoveRoute(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.routes, gocheck.DeepEquals, []string{"10.10.10.11"})
+	err = r.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.ErrorMatches, "Route not found")
+}
+
+func (s *S) TestRemoveLastRoute(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("name.com", "name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := "# name has no routes.\n#\tserver_name name.andrewzito.com name.com;\n"
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.routes, gocheck.HasLen, 0)
+	c.Assert(b.cname, gocheck.Equals, "name.com")
+}
+
+func (s *S) TestAddRouteWithInvalidConfiguration(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	before := s.content(c, "name")
+	commandmocker.Remove(s.tmpdir)
+	s.tmpdir, err = commandmocker.Error("sudo", "nginx: configuration file test failed", 1)
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.ErrorMatches, "Invalid nginx configuration: nginx: configuration file test failed")
+	c.Assert(s.content(c, "name"), gocheck.Equals, before)
+	c.Assert(commandmocker.Parameters(s.tmpdir), gocheck.DeepEquals, []string{"nginx", "-t"})
+}
+
+func (s *S) TestAddRouteConcurrently(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.AddRoute("name", fmt.Sprintf("10.10.10.%d", i))
+		}(i)
+	}
+	wg.Wait()
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.routes, gocheck.HasLen, 10)
+}
+
+func (s *S) TestNginxRouterIsASwitchRouter(c *gocheck.C) {
+	var _ router.SwitchRouter = nginxRouter{}
+}
+
+func (s *S) TestSwitchRoutes(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	commandmocker.Remove(s.tmpdir)
+	s.tmpdir, err = commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SwitchRoutes("name", []string{"10.10.10.12", "10.10.10.13"}, []string{"10.10.10.10", "10.10.10.11"})
+	c.Assert(err, gocheck.IsNil)
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.routes, gocheck.DeepEquals, []string{"10.10.10.12", "10.10.10.13"})
+	c.Assert(commandmocker.Parameters(s.tmpdir), gocheck.DeepEquals, []string{"nginx", "-t", "service", "nginx", "reload"})
+}
+
+func (s *S) TestSwitchRoutesUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.SwitchRoutes("unknown", []string{"10.10.10.10"}, nil)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestNginxRouterIsACanaryRouter(c *gocheck.C) {
+	var _ router.CanaryRouter = nginxRouter{}
+}
+
+func (s *S) TestSetRouteWeight(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetRouteWeight("name", "10.10.10.10", 9)
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetRouteWeight("name", "10.10.10.11", 1)
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name_backend {
+	server 10.10.10.10 weight=9;
+	server 10.10.10.11;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name_backend;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.routes, gocheck.DeepEquals, []string{"10.10.10.10", "10.10.10.11"})
+	c.Assert(b.weights, gocheck.DeepEquals, map[string]int{"10.10.10.10": 9})
+}
+
+func (s *S) TestSetRouteWeightUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.SetRouteWeight("unknown", "10.10.10.10", 2)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestAddRouteWithLogsPath(c *gocheck.C) {
+	config.Set("nginx:logs-path", "/var/log/nginx/tsuru")
+	defer config.Unset("nginx:logs-path")
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := `log_format name_stats '$msec $upstream_addr $status';
+
+upstream name_backend {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	access_log /var/log/nginx/tsuru/name.log name_stats;
+	location / {
+		proxy_pass http://name_backend;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+}
+
+func (s *S) TestRouteStats(c *gocheck.C) {
+	config.Set("nginx:logs-path", "/var/log/nginx/tsuru")
+	defer config.Unset("nginx:logs-path")
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	file, err := s.rfs.Create("/var/log/nginx/tsuru/name.log")
+	c.Assert(err, gocheck.IsNil)
+	_, err = file.Write([]byte(`10.10.10.10:80 200
+1381000000.500 10.10.10.10:80 200
+1381000100.000 10.10.10.10:80 200
+1381000100.250 10.10.10.10:80 502
+1381000101.000 10.10.10.11:80 200
+1381000102.000 10.10.10.12:80 200
+1381000103.000 - 404
+1381000104.000 10.10.10.10:80, 10.10.10.11:80 500
+`))
+	c.Assert(err, gocheck.IsNil)
+	stats, err := r.RouteStats("name", time.Unix(1381000100, 0))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]router.RouteStats{
+		"10.10.10.10": {Requests: 2, Errors: 1},
+		"10.10.10.11": {Requests: 2, Errors: 1},
+	}
+	c.Assert(stats, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRouteStatsWithoutLog(c *gocheck.C) {
+	config.Set("nginx:logs-path", "/var/log/nginx/tsuru")
+	defer config.Unset("nginx:logs-path")
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	stats, err := r.RouteStats("name", time.Now())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stats, gocheck.HasLen, 0)
+}
+
+func (s *S) TestRouteStatsWithoutLogsPath(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	_, err = r.RouteStats("name", time.Now())
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("name.com", "name")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name_backend {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com name.com;
+	location / {
+		proxy_pass http://name_backend;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.cname, gocheck.Equals, "name.com")
+}
+
+func (s *S) TestNginxRouterIsAMaintenanceRouter(c *gocheck.C) {
+	var _ router.MaintenanceRouter = nginxRouter{}
+}
+
+func (s *S) TestStartMaintenance(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("name", nil)
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name_backend {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		return 503;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+}
+
+func (s *S) TestStartMaintenanceWithPage(c *gocheck.C) {
+	config.Set("nginx:maintenance-path", "/var/lib/tsuru/maintenance")
+	defer config.Unset("nginx:maintenance-path")
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("name", []byte("<h1>Be right back</h1>"))
+	c.Assert(err, gocheck.IsNil)
+	expected := `server {
+	listen 80;
+	server_name name.andrewzito.com;
+	root /var/lib/tsuru/maintenance;
+	error_page 503 /name.html;
+	location = /name.html {
+		internal;
+	}
+	location / {
+		return 503;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	file, err := s.rfs.Open("/var/lib/tsuru/maintenance/name.html")
+	c.Assert(err, gocheck.IsNil)
+	page, err := ioutil.ReadAll(file)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(page), gocheck.Equals, "<h1>Be right back</h1>")
+	b, err := r.read("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.maintenance, gocheck.Equals, true)
+	c.Assert(b.pageDir, gocheck.Equals, "/var/lib/tsuru/maintenance")
+}
+
+func (s *S) TestStartMaintenanceWithPageWithoutMaintenancePath(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("name", []byte("<h1>Be right back</h1>"))
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestStopMaintenance(c *gocheck.C) {
+	config.Set("nginx:maintenance-path", "/var/lib/tsuru/maintenance")
+	defer config.Unset("nginx:maintenance-path")
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.StartMaintenance("name", []byte("<h1>Be right back</h1>"))
+	c.Assert(err, gocheck.IsNil)
+	err = r.StopMaintenance("name")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name_backend {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name_backend;
+	}
+}`
+	c.Assert(s.content(c, "name"), gocheck.Equals, expected)
+	c.Assert(s.rfs.HasAction("remove /var/lib/tsuru/maintenance/name.html"), gocheck.Equals, true)
+}
+
+func (s *S) TestStartMaintenanceUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.StartMaintenance("unknown", nil)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	var r nginxRouter
+	addr, err := r.Addr("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "name.andrewzito.com")
+}
@@ -0,0 +1,149 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package router provides interfaces that need to be satisfied in order to
+// implement a new router on tsuru.
+//
+// A router is responsible for delivering requests to the units of an app.
+// Each app is a backend in the router, and each unit of the app is a route in
+// that backend.
+package router
+
+import (
+	"fmt"
+	"time"
+)
+
+// Router is the basic interface of this package. It provides methods for
+// managing backends and routes.
+//
+// Tsuru comes with three routers: nginx, elb and fake (an in-memory router,
+// for testing purposes). One can add other routers by satisfying this
+// interface and registering it using the function Register.
+type Router interface {
+	// AddBackend creates a new backend, named after the app.
+	AddBackend(name string) error
+
+	// RemoveBackend removes the backend and all its routes.
+	RemoveBackend(name string) error
+
+	// AddRoute adds a new route to the backend. The meaning of the address
+	// depends on the router: it may be an IP, a host:port pair or an
+	// instance id.
+	AddRoute(name, address string) error
+
+	// RemoveRoute removes the route identified by the given address from
+	// the backend.
+	RemoveRoute(name, address string) error
+
+	// SetCName makes the router deliver requests to the given cname to the
+	// backend.
+	SetCName(cname, name string) error
+
+	// Addr returns the address of the backend, as seen by clients of the
+	// app. It will probably be a DNS name.
+	Addr(name string) (string, error)
+}
+
+// MaintenanceRouter is a router that is able to put backends in maintenance,
+// answering all requests to the backend with a static page and the status 503,
+// instead of delivering them to the routes.
+//
+// Implementing this interface is optional. Routes added or removed while the
+// backend is in maintenance must be used when the maintenance ends.
+type MaintenanceRouter interface {
+	// StartMaintenance puts the backend in maintenance. The page is the
+	// content (HTML) served to the clients; an empty page means the
+	// default 503 page of the router.
+	StartMaintenance(name string, page []byte) error
+
+	// StopMaintenance makes the router deliver requests to the routes of
+	// the backend again.
+	StopMaintenance(name string) error
+}
+
+// SwitchRouter is a router that is able to replace routes of a backend in a
+// single operation, so clients never see a partial set of routes.
+//
+// Implementing this interface is optional. When the router is not a
+// SwitchRouter, routes are added and removed one by one.
+type SwitchRouter interface {
+	// SwitchRoutes adds the routes in add to the backend and removes the
+	// routes in remove from it.
+	SwitchRoutes(name string, add, remove []string) error
+}
+
+// Switch adds the routes in add to the backend and removes the routes in
+// remove from it. When the router is a SwitchRouter, the routes are switched
+// in a single operation. Otherwise, all new routes are added before the old
+// ones are removed, so the backend always has routes.
+func Switch(r Router, name string, add, remove []string) error {
+	if sr, ok := r.(SwitchRouter); ok {
+		return sr.SwitchRoutes(name, add, remove)
+	}
+	for _, address := range add {
+		if err := r.AddRoute(name, address); err != nil {
+			return err
+		}
+	}
+	for _, address := range remove {
+		if err := r.RemoveRoute(name, address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WeightRouter is a router that is able to deliver to each route of a backend
+// a share of the requests proportional to the weight of the route.
+//
+// Implementing this interface is optional. Routes of routers that are not
+// WeightRouters receive the same share of the requests.
+type WeightRouter interface {
+	// SetRouteWeight sets the weight of the route, adding it to the
+	// backend when it doesn't exist. Routes have weight 1 by default.
+	SetRouteWeight(name, address string, weight int) error
+}
+
+// RouteStats contains the number of requests delivered to a route, and how
+// many of them failed (answered with a 5xx status).
+type RouteStats struct {
+	Requests int
+	Errors   int
+}
+
+// StatsRouter is a router that keeps statistics of the requests delivered to
+// each route, usually read from its access logs.
+//
+// Implementing this interface is optional.
+type StatsRouter interface {
+	// RouteStats returns the statistics of the routes of the backend,
+	// keyed by address, counting only the requests delivered after the
+	// given time. Routes that didn't receive requests may be missing.
+	RouteStats(name string, since time.Time) (map[string]RouteStats, error)
+}
+
+// CanaryRouter is a router that is able to split the requests of a backend
+// between its routes and report how they're doing, as required by canary
+// releases.
+type CanaryRouter interface {
+	WeightRouter
+	StatsRouter
+}
+
+var routers = make(map[string]Router)
+
+// Register registers a new router in the Router registry.
+func Register(name string, r Router) {
+	routers[name] = r
+}
+
+// Get gets the named router from the registry.
+func Get(name string) (Router, error) {
+	r, ok := routers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown router: %q.", name)
+	}
+	return r, nil
+}
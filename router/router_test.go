@@ -0,0 +1,79 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+type nopRouter struct{}
+
+func (nopRouter) AddBackend(name string) error           { return nil }
+func (nopRouter) RemoveBackend(name string) error        { return nil }
+func (nopRouter) AddRoute(name, address string) error    { return nil }
+func (nopRouter) RemoveRoute(name, address string) error { return nil }
+func (nopRouter) SetCName(cname, name string) error      { return nil }
+func (nopRouter) Addr(name string) (string, error)       { return "", nil }
+
+func (s *S) TestRegisterAndGet(c *gocheck.C) {
+	var r nopRouter
+	Register("nop", r)
+	got, err := Get("nop")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.Equals, r)
+}
+
+func (s *S) TestGetUnknownRouter(c *gocheck.C) {
+	r, err := Get("unknown-router")
+	c.Assert(r, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Unknown router: "unknown-router".`)
+}
+
+// recordingRouter records the operations on routes.
+type recordingRouter struct {
+	nopRouter
+	actions []string
+}
+
+func (r *recordingRouter) AddRoute(name, address string) error {
+	r.actions = append(r.actions, "add "+address)
+	return nil
+}
+
+func (r *recordingRouter) RemoveRoute(name, address string) error {
+	r.actions = append(r.actions, "remove "+address)
+	return nil
+}
+
+type switchRouter struct {
+	recordingRouter
+}
+
+func (r *switchRouter) SwitchRoutes(name string, add, remove []string) error {
+	r.actions = append(r.actions, "switch")
+	return nil
+}
+
+func (s *S) TestSwitch(c *gocheck.C) {
+	var r recordingRouter
+	err := Switch(&r, "myapp", []string{"10.10.10.12", "10.10.10.13"}, []string{"10.10.10.10"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r.actions, gocheck.DeepEquals, []string{"add 10.10.10.12", "add 10.10.10.13", "remove 10.10.10.10"})
+}
+
+func (s *S) TestSwitchWithSwitchRouter(c *gocheck.C) {
+	var r switchRouter
+	err := Switch(&r, "myapp", []string{"10.10.10.12"}, []string{"10.10.10.10"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r.actions, gocheck.DeepEquals, []string{"switch"})
+}
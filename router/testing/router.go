@@ -0,0 +1,267 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testing provides an in-memory implementation of the router.Router
+// interface, registered as "fake".
+package testing
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/router"
+	"sync"
+	"time"
+)
+
+var FakeRouter = fakeRouter{
+	backends:    make(map[string][]string),
+	cnames:      make(map[string]string),
+	maintenance: make(map[string][]byte),
+	weights:     make(map[string]map[string]int),
+	stats:       make(map[string]map[string]router.RouteStats),
+}
+
+func init() {
+	router.Register("fake", &FakeRouter)
+}
+
+type fakeRouter struct {
+	backends    map[string][]string
+	cnames      map[string]string
+	maintenance map[string][]byte
+	weights     map[string]map[string]int
+	stats       map[string]map[string]router.RouteStats
+	mutex       sync.Mutex
+}
+
+// HasBackend indicates whether the given backend exists in the router.
+func (r *fakeRouter) HasBackend(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.backends[name]
+	return ok
+}
+
+// HasRoute indicates whether the backend has a route to the given address.
+func (r *fakeRouter) HasRoute(name, address string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, a := range r.backends[name] {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Routes returns all routes of the given backend.
+func (r *fakeRouter) Routes(name string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.backends[name]...)
+}
+
+// CName returns the cname of the given backend.
+func (r *fakeRouter) CName(name string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cnames[name]
+}
+
+// InMaintenance indicates whether the given backend is in maintenance, and
+// returns its maintenance page.
+func (r *fakeRouter) InMaintenance(name string) (bool, []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	page, ok := r.maintenance[name]
+	return ok, page
+}
+
+// Weight returns the weight of the route to the given address.
+func (r *fakeRouter) Weight(name, address string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if w, ok := r.weights[name][address]; ok {
+		return w
+	}
+	return 1
+}
+
+// SetStats defines the statistics of the route to the given address,
+// returned by RouteStats.
+func (r *fakeRouter) SetStats(name, address string, stats router.RouteStats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stats[name] == nil {
+		r.stats[name] = make(map[string]router.RouteStats)
+	}
+	r.stats[name][address] = stats
+}
+
+// Reset removes all backends from the router.
+func (r *fakeRouter) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backends = make(map[string][]string)
+	r.cnames = make(map[string]string)
+	r.maintenance = make(map[string][]byte)
+	r.weights = make(map[string]map[string]int)
+	r.stats = make(map[string]map[string]router.RouteStats)
+}
+
+func (r *fakeRouter) AddBackend(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; ok {
+		return errors.New("Backend already exists")
+	}
+	r.backends[name] = nil
+	return nil
+}
+
+func (r *fakeRouter) RemoveBackend(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return errors.New("Backend not found")
+	}
+	delete(r.backends, name)
+	delete(r.cnames, name)
+	delete(r.maintenance, name)
+	delete(r.weights, name)
+	delete(r.stats, name)
+	return nil
+}
+
+func (r *fakeRouter) AddRoute(name, address string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return errors.New("Backend not found")
+	}
+	r.backends[name] = append(routes, address)
+	return nil
+}
+
+func (r *fakeRouter) RemoveRoute(name, address string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return errors.New("Backend not found")
+	}
+	index := -1
+	for i, a := range routes {
+		if a == address {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return errors.New("Route not found")
+	}
+	routes[index] = routes[len(routes)-1]
+	r.backends[name] = routes[:len(routes)-1]
+	delete(r.weights[name], address)
+	return nil
+}
+
+func (r *fakeRouter) SwitchRoutes(name string, add, remove []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return errors.New("Backend not found")
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, a := range remove {
+		removed[a] = true
+	}
+	var result []string
+	for _, a := range append(routes, add...) {
+		if !removed[a] {
+			result = append(result, a)
+		}
+	}
+	r.backends[name] = result
+	return nil
+}
+
+func (r *fakeRouter) SetRouteWeight(name, address string, weight int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return errors.New("Backend not found")
+	}
+	found := false
+	for _, a := range routes {
+		if a == address {
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.backends[name] = append(routes, address)
+	}
+	if r.weights[name] == nil {
+		r.weights[name] = make(map[string]int)
+	}
+	r.weights[name][address] = weight
+	return nil
+}
+
+// RouteStats returns the statistics defined by SetStats. The fake router
+// doesn't know when requests were delivered, so since is ignored.
+func (r *fakeRouter) RouteStats(name string, since time.Time) (map[string]router.RouteStats, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return nil, errors.New("Backend not found")
+	}
+	stats := make(map[string]router.RouteStats, len(r.stats[name]))
+	for address, s := range r.stats[name] {
+		stats[address] = s
+	}
+	return stats, nil
+}
+
+func (r *fakeRouter) SetCName(cname, name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return errors.New("Backend not found")
+	}
+	r.cnames[name] = cname
+	return nil
+}
+
+func (r *fakeRouter) StartMaintenance(name string, page []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return errors.New("Backend not found")
+	}
+	r.maintenance[name] = page
+	return nil
+}
+
+func (r *fakeRouter) StopMaintenance(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return errors.New("Backend not found")
+	}
+	delete(r.maintenance, name)
+	return nil
+}
+
+func (r *fakeRouter) Addr(name string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return "", errors.New("Backend not found")
+	}
+	return name + ".fakerouter.com", nil
+}
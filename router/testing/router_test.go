@@ -0,0 +1,136 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"github.com/globocom/tsuru/router"
+	"launchpad.net/gocheck"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	FakeRouter.Reset()
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("fake")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, &FakeRouter)
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	err := FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasBackend("myapp"), gocheck.Equals, true)
+	err = FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.ErrorMatches, "Backend already exists")
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	FakeRouter.AddBackend("myapp")
+	err := FakeRouter.RemoveBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
+	err = FakeRouter.RemoveBackend("myapp")
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestAddAndRemoveRoute(c *gocheck.C) {
+	FakeRouter.AddBackend("myapp")
+	err := FakeRouter.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.AddRoute("myapp", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasRoute("myapp", "10.10.10.10"), gocheck.Equals, true)
+	err = FakeRouter.RemoveRoute("myapp", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasRoute("myapp", "10.10.10.10"), gocheck.Equals, false)
+	c.Assert(FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{"10.10.10.11"})
+	err = FakeRouter.RemoveRoute("myapp", "10.10.10.10")
+	c.Assert(err, gocheck.ErrorMatches, "Route not found")
+}
+
+func (s *S) TestAddRouteUnknownBackend(c *gocheck.C) {
+	err := FakeRouter.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	FakeRouter.AddBackend("myapp")
+	err := FakeRouter.SetCName("myapp.com", "myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.CName("myapp"), gocheck.Equals, "myapp.com")
+}
+
+func (s *S) TestMaintenance(c *gocheck.C) {
+	var _ router.MaintenanceRouter = &FakeRouter
+	FakeRouter.AddBackend("myapp")
+	err := FakeRouter.StartMaintenance("myapp", []byte("closed"))
+	c.Assert(err, gocheck.IsNil)
+	ok, page := FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(string(page), gocheck.Equals, "closed")
+	err = FakeRouter.StopMaintenance("myapp")
+	c.Assert(err, gocheck.IsNil)
+	ok, _ = FakeRouter.InMaintenance("myapp")
+	c.Assert(ok, gocheck.Equals, false)
+	err = FakeRouter.StartMaintenance("other", nil)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestSwitchRoutes(c *gocheck.C) {
+	var _ router.SwitchRouter = &FakeRouter
+	FakeRouter.AddBackend("myapp")
+	FakeRouter.AddRoute("myapp", "10.10.10.10")
+	FakeRouter.AddRoute("myapp", "10.10.10.11")
+	err := FakeRouter.SwitchRoutes("myapp", []string{"10.10.10.12"}, []string{"10.10.10.10"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{"10.10.10.11", "10.10.10.12"})
+	err = FakeRouter.SwitchRoutes("other", nil, nil)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestSetRouteWeight(c *gocheck.C) {
+	var _ router.CanaryRouter = &FakeRouter
+	FakeRouter.AddBackend("myapp")
+	FakeRouter.AddRoute("myapp", "10.10.10.10")
+	c.Assert(FakeRouter.Weight("myapp", "10.10.10.10"), gocheck.Equals, 1)
+	err := FakeRouter.SetRouteWeight("myapp", "10.10.10.10", 9)
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.SetRouteWeight("myapp", "10.10.10.11", 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.Weight("myapp", "10.10.10.10"), gocheck.Equals, 9)
+	c.Assert(FakeRouter.Routes("myapp"), gocheck.DeepEquals, []string{"10.10.10.10", "10.10.10.11"})
+	FakeRouter.RemoveRoute("myapp", "10.10.10.10")
+	c.Assert(FakeRouter.Weight("myapp", "10.10.10.10"), gocheck.Equals, 1)
+	err = FakeRouter.SetRouteWeight("other", "10.10.10.10", 2)
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestRouteStats(c *gocheck.C) {
+	FakeRouter.AddBackend("myapp")
+	FakeRouter.SetStats("myapp", "10.10.10.10", router.RouteStats{Requests: 10, Errors: 2})
+	stats, err := FakeRouter.RouteStats("myapp", time.Now())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stats, gocheck.DeepEquals, map[string]router.RouteStats{"10.10.10.10": {Requests: 10, Errors: 2}})
+	_, err = FakeRouter.RouteStats("other", time.Now())
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	FakeRouter.AddBackend("myapp")
+	addr, err := FakeRouter.Addr("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "myapp.fakerouter.com")
+	_, err = FakeRouter.Addr("other")
+	c.Assert(err, gocheck.ErrorMatches, "Backend not found")
+}
@@ -0,0 +1,65 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/provision"
+	"sync"
+)
+
+func init() {
+	autoscale.Register("fake", &FakeMetricsSource{})
+}
+
+// FakeMetricsSource is a fake implementation of autoscale.Source, returning
+// the metrics set with SetMetrics.
+type FakeMetricsSource struct {
+	mut     sync.Mutex
+	metrics map[string]autoscale.Metrics
+	failure error
+}
+
+func NewFakeMetricsSource() *FakeMetricsSource {
+	return &FakeMetricsSource{metrics: make(map[string]autoscale.Metrics)}
+}
+
+// SetMetrics sets the metrics returned for the app with the given name.
+func (s *FakeMetricsSource) SetMetrics(appName string, m autoscale.Metrics) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.metrics == nil {
+		s.metrics = make(map[string]autoscale.Metrics)
+	}
+	s.metrics[appName] = m
+}
+
+// PrepareFailure makes the next call to Metrics return the given error.
+func (s *FakeMetricsSource) PrepareFailure(err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.failure = err
+}
+
+// Provides returns true for all metrics.
+func (s *FakeMetricsSource) Provides(metric string) bool {
+	return true
+}
+
+func (s *FakeMetricsSource) Metrics(app provision.App) (*autoscale.Metrics, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.failure != nil {
+		err := s.failure
+		s.failure = nil
+		return nil, err
+	}
+	m, ok := s.metrics[app.GetName()]
+	if !ok {
+		return nil, errors.New("No metrics for the app " + app.GetName() + ".")
+	}
+	return &m, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/autoscale"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestFakeMetricsSourceIsRegistered(c *gocheck.C) {
+	src, err := autoscale.Get("fake")
+	c.Assert(err, gocheck.IsNil)
+	_, ok := src.(*FakeMetricsSource)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestFakeMetricsSourceMetrics(c *gocheck.C) {
+	app := NewFakeApp("red-sector", "rush", 1)
+	src := NewFakeMetricsSource()
+	src.SetMetrics(app.GetName(), autoscale.Metrics{CPU: 80})
+	m, err := src.Metrics(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*m, gocheck.DeepEquals, autoscale.Metrics{CPU: 80})
+}
+
+func (s *S) TestFakeMetricsSourceMetricsUnknownApp(c *gocheck.C) {
+	app := NewFakeApp("red-sector", "rush", 1)
+	src := NewFakeMetricsSource()
+	_, err := src.Metrics(app)
+	c.Assert(err, gocheck.ErrorMatches, "No metrics for the app red-sector.")
+}
+
+func (s *S) TestFakeMetricsSourcePrepareFailure(c *gocheck.C) {
+	app := NewFakeApp("red-sector", "rush", 1)
+	src := NewFakeMetricsSource()
+	src.SetMetrics(app.GetName(), autoscale.Metrics{CPU: 80})
+	src.PrepareFailure(errors.New("metrics unavailable"))
+	_, err := src.Metrics(app)
+	c.Assert(err, gocheck.ErrorMatches, "metrics unavailable")
+	_, err = src.Metrics(app)
+	c.Assert(err, gocheck.IsNil)
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/globocom/tsuru/provision"
 	"io"
+	"io/ioutil"
 	"strconv"
 	"sync"
 	"time"
@@ -20,11 +21,12 @@ func init() {
 
 // Fake implementation for provision.Unit.
 type FakeUnit struct {
-	Name       string
-	Ip         string
-	InstanceId string
-	Machine    int
-	Status     provision.Status
+	Name        string
+	Ip          string
+	InstanceId  string
+	Machine     int
+	Status      provision.Status
+	ProcessType string
 }
 
 func (u *FakeUnit) GetName() string {
@@ -47,6 +49,13 @@ func (u *FakeUnit) GetIp() string {
 	return u.Ip
 }
 
+func (u *FakeUnit) GetProcessType() string {
+	if u.ProcessType == "" {
+		return provision.WebProcess
+	}
+	return u.ProcessType
+}
+
 // Fake implementation for provision.App.
 type FakeApp struct {
 	name      string
@@ -101,6 +110,10 @@ type Cmd struct {
 	Cmd  string
 	Args []string
 	App  provision.App
+	Unit string
+
+	// Input is the data sent to the standard input of the command.
+	Input []byte
 }
 
 type failure struct {
@@ -119,7 +132,15 @@ type FakeProvisioner struct {
 	cmdMut   sync.Mutex
 	unitMut  sync.Mutex
 	restarts map[string]int
+	unitRest map[string][]string
+	disabled map[string]bool
+	switches map[string][2][]string
+	weights  map[string]map[string]int
+	stats    map[string]map[string]provision.UnitStats
+	metrics  []provision.UnitMetrics
 	restMut  sync.Mutex
+	pages    map[string][]byte
+	pageMut  sync.Mutex
 }
 
 func NewFakeProvisioner() *FakeProvisioner {
@@ -128,6 +149,12 @@ func NewFakeProvisioner() *FakeProvisioner {
 	p.failures = make(chan failure, 8)
 	p.units = make(map[string][]provision.Unit)
 	p.restarts = make(map[string]int)
+	p.unitRest = make(map[string][]string)
+	p.disabled = make(map[string]bool)
+	p.switches = make(map[string][2][]string)
+	p.weights = make(map[string]map[string]int)
+	p.stats = make(map[string]map[string]provision.UnitStats)
+	p.pages = make(map[string][]byte)
 	p.unitLen = 0
 	return &p
 }
@@ -200,8 +227,16 @@ func (p *FakeProvisioner) Reset() {
 
 	p.restMut.Lock()
 	p.restarts = make(map[string]int)
+	p.switches = make(map[string][2][]string)
+	p.weights = make(map[string]map[string]int)
+	p.stats = make(map[string]map[string]provision.UnitStats)
+	p.metrics = nil
 	p.restMut.Unlock()
 
+	p.pageMut.Lock()
+	p.pages = make(map[string][]byte)
+	p.pageMut.Unlock()
+
 	for {
 		select {
 		case <-p.outputs:
@@ -250,6 +285,107 @@ func (p *FakeProvisioner) Restart(app provision.App) error {
 	return nil
 }
 
+// RestartedUnits returns the names of the units of the app restarted with
+// RestartUnit, in the order they were restarted.
+func (p *FakeProvisioner) RestartedUnits(app provision.App) []string {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	return p.unitRest[app.GetName()]
+}
+
+// Disabled indicates whether the given unit was disabled with DisableUnit,
+// and not enabled again.
+func (p *FakeProvisioner) Disabled(unit provision.AppUnit) bool {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	return p.disabled[unit.GetName()]
+}
+
+func (p *FakeProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	if err := p.getError("RestartUnit"); err != nil {
+		return err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	p.unitRest[app.GetName()] = append(p.unitRest[app.GetName()], unit.GetName())
+	return nil
+}
+
+func (p *FakeProvisioner) DisableUnit(app provision.App, unit provision.AppUnit) error {
+	if err := p.getError("DisableUnit"); err != nil {
+		return err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	p.disabled[unit.GetName()] = true
+	return nil
+}
+
+func (p *FakeProvisioner) EnableUnit(app provision.App, unit provision.AppUnit) error {
+	if err := p.getError("EnableUnit"); err != nil {
+		return err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	delete(p.disabled, unit.GetName())
+	return nil
+}
+
+// Stop changes the status of all units of the app to stopped.
+func (p *FakeProvisioner) Stop(app provision.App) error {
+	if err := p.getError("Stop"); err != nil {
+		return err
+	}
+	p.setStatus(app, provision.StatusStopped)
+	return nil
+}
+
+// Start changes the status of all units of the app to started.
+func (p *FakeProvisioner) Start(app provision.App) error {
+	if err := p.getError("Start"); err != nil {
+		return err
+	}
+	p.setStatus(app, provision.StatusStarted)
+	return nil
+}
+
+func (p *FakeProvisioner) setStatus(app provision.App, status provision.Status) {
+	p.unitMut.Lock()
+	defer p.unitMut.Unlock()
+	for i := range p.units[app.GetName()] {
+		p.units[app.GetName()][i].Status = status
+	}
+}
+
+// InMaintenance indicates whether the app is in maintenance, and returns its
+// maintenance page.
+func (p *FakeProvisioner) InMaintenance(app provision.App) (bool, []byte) {
+	p.pageMut.Lock()
+	defer p.pageMut.Unlock()
+	page, ok := p.pages[app.GetName()]
+	return ok, page
+}
+
+func (p *FakeProvisioner) StartMaintenance(app provision.App, page []byte) error {
+	if err := p.getError("StartMaintenance"); err != nil {
+		return err
+	}
+	p.pageMut.Lock()
+	defer p.pageMut.Unlock()
+	p.pages[app.GetName()] = page
+	return nil
+}
+
+func (p *FakeProvisioner) StopMaintenance(app provision.App) error {
+	if err := p.getError("StopMaintenance"); err != nil {
+		return err
+	}
+	p.pageMut.Lock()
+	defer p.pageMut.Unlock()
+	delete(p.pages, app.GetName())
+	return nil
+}
+
 func (p *FakeProvisioner) Destroy(app provision.App) error {
 	if err := p.getError("Destroy"); err != nil {
 		return err
@@ -266,6 +402,10 @@ func (p *FakeProvisioner) Destroy(app provision.App) error {
 	p.unitMut.Unlock()
 	p.restMut.Lock()
 	delete(p.restarts, app.GetName())
+	delete(p.unitRest, app.GetName())
+	delete(p.switches, app.GetName())
+	delete(p.weights, app.GetName())
+	delete(p.stats, app.GetName())
 	p.restMut.Unlock()
 	return nil
 }
@@ -274,6 +414,139 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	if err := p.getError("AddUnits"); err != nil {
 		return nil, err
 	}
+	return p.addUnits(app, n, "")
+}
+
+func (p *FakeProvisioner) AddProcessUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if err := p.getError("AddProcessUnits"); err != nil {
+		return nil, err
+	}
+	return p.addUnits(app, n, process)
+}
+
+// AddStandbyUnits adds started units to the app, like AddProcessUnits. The
+// standby units listen on the loopback address, so their health check can be
+// served by a local server. Failures prepared for the method AddStandbyUnits
+// are returned.
+func (p *FakeProvisioner) AddStandbyUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if err := p.getError("AddStandbyUnits"); err != nil {
+		return nil, err
+	}
+	units, err := p.addUnits(app, n, process)
+	if err != nil {
+		return nil, err
+	}
+	p.unitMut.Lock()
+	defer p.unitMut.Unlock()
+	for i := range units {
+		units[i].Ip = "127.0.0.1"
+	}
+	return units, nil
+}
+
+// SwitchUnits records the names of the standby and old units, returned by
+// Switched.
+func (p *FakeProvisioner) SwitchUnits(app provision.App, standby, old []provision.AppUnit) error {
+	if err := p.getError("SwitchUnits"); err != nil {
+		return err
+	}
+	var names [2][]string
+	for _, u := range standby {
+		names[0] = append(names[0], u.GetName())
+	}
+	for _, u := range old {
+		names[1] = append(names[1], u.GetName())
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	p.switches[app.GetName()] = names
+	return nil
+}
+
+// Switched returns the names of the standby and old units of the last call
+// to SwitchUnits for the app.
+func (p *FakeProvisioner) Switched(app provision.App) (standby, old []string) {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	names := p.switches[app.GetName()]
+	return names[0], names[1]
+}
+
+// SetUnitsWeight records the weight of the units, returned by Weight.
+func (p *FakeProvisioner) SetUnitsWeight(app provision.App, units []provision.AppUnit, weight int) error {
+	if err := p.getError("SetUnitsWeight"); err != nil {
+		return err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	weights := p.weights[app.GetName()]
+	if weights == nil {
+		weights = make(map[string]int)
+		p.weights[app.GetName()] = weights
+	}
+	for _, u := range units {
+		weights[u.GetName()] = weight
+	}
+	return nil
+}
+
+// Weight returns the weight of the given unit of the app, as set by
+// SetUnitsWeight. The default weight is 1.
+func (p *FakeProvisioner) Weight(app provision.App, unitName string) int {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	if w, ok := p.weights[app.GetName()][unitName]; ok {
+		return w
+	}
+	return 1
+}
+
+// SetUnitStats defines the statistics of the given unit of the app, returned
+// by UnitsStats.
+func (p *FakeProvisioner) SetUnitStats(app provision.App, unitName string, stats provision.UnitStats) {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	if p.stats[app.GetName()] == nil {
+		p.stats[app.GetName()] = make(map[string]provision.UnitStats)
+	}
+	p.stats[app.GetName()][unitName] = stats
+}
+
+// UnitsStats returns the statistics of the given units, as defined by
+// SetUnitStats. The time is ignored.
+func (p *FakeProvisioner) UnitsStats(app provision.App, units []provision.AppUnit, since time.Time) (map[string]provision.UnitStats, error) {
+	if err := p.getError("UnitsStats"); err != nil {
+		return nil, err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	stats := make(map[string]provision.UnitStats, len(units))
+	for _, u := range units {
+		stats[u.GetName()] = p.stats[app.GetName()][u.GetName()]
+	}
+	return stats, nil
+}
+
+// SetMetrics defines the samples returned by CollectMetrics.
+func (p *FakeProvisioner) SetMetrics(metrics ...provision.UnitMetrics) {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	p.metrics = metrics
+}
+
+// CollectMetrics returns the samples defined by SetMetrics.
+func (p *FakeProvisioner) CollectMetrics() ([]provision.UnitMetrics, error) {
+	if err := p.getError("CollectMetrics"); err != nil {
+		return nil, err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	metrics := make([]provision.UnitMetrics, len(p.metrics))
+	copy(metrics, p.metrics)
+	return metrics, nil
+}
+
+func (p *FakeProvisioner) addUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
 	if n == 0 {
 		return nil, errors.New("Cannot add 0 units.")
 	}
@@ -288,13 +561,14 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	length := uint(len(p.units[name]))
 	for i := uint(0); i < n; i++ {
 		unit := provision.Unit{
-			Name:       fmt.Sprintf("%s/%d", name, p.unitLen),
-			AppName:    name,
-			Type:       framework,
-			Status:     provision.StatusStarted,
-			InstanceId: fmt.Sprintf("i-08%d", length+i),
-			Ip:         fmt.Sprintf("10.10.10.%d", length+i),
-			Machine:    int(length + i),
+			Name:        fmt.Sprintf("%s/%d", name, p.unitLen),
+			AppName:     name,
+			Type:        framework,
+			ProcessType: process,
+			Status:      provision.StatusStarted,
+			InstanceId:  fmt.Sprintf("i-08%d", length+i),
+			Ip:          fmt.Sprintf("10.10.10.%d", length+i),
+			Machine:     int(length + i),
 		}
 		p.units[name] = append(p.units[name], unit)
 		p.unitLen++
@@ -371,6 +645,64 @@ func (p *FakeProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 	return err
 }
 
+// ExecuteCommandOnUnit records the command, writing the prepared output (if
+// any) to stdout. Failures prepared for the method ExecuteCommandOnUnit are
+// returned.
+func (p *FakeProvisioner) ExecuteCommandOnUnit(stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return p.executeOnUnit("ExecuteCommandOnUnit", nil, stdout, app, unit, cmd, args...)
+}
+
+// ExecuteCommandOnUnitWithInput records the command and its input, writing
+// the prepared output (if any) to stdout. Failures prepared for the method
+// ExecuteCommandOnUnitWithInput are returned.
+func (p *FakeProvisioner) ExecuteCommandOnUnitWithInput(stdin io.Reader, stdout, stderr io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	return p.executeOnUnit("ExecuteCommandOnUnitWithInput", stdin, stdout, app, unit, cmd, args...)
+}
+
+func (p *FakeProvisioner) executeOnUnit(method string, stdin io.Reader, stdout io.Writer, app provision.App, unit provision.AppUnit, cmd string, args ...string) error {
+	command := Cmd{
+		Cmd:  cmd,
+		Args: args,
+		App:  app,
+		Unit: unit.GetName(),
+	}
+	if stdin != nil {
+		command.Input, _ = ioutil.ReadAll(stdin)
+	}
+	p.cmdMut.Lock()
+	p.cmds = append(p.cmds, command)
+	p.cmdMut.Unlock()
+	select {
+	case output := <-p.outputs:
+		stdout.Write(output)
+	case <-time.After(1e6):
+	}
+	return p.getError(method)
+}
+
+// Shell records the command line of the shell, writes the prepared output
+// (if any) to the output of the shell and then echoes the input of the shell
+// until it's closed. Failures prepared for the method Shell are returned.
+func (p *FakeProvisioner) Shell(opts provision.ShellOptions) error {
+	command := Cmd{
+		Cmd:  opts.Cmd,
+		App:  opts.App,
+		Unit: opts.Unit.GetName(),
+	}
+	p.cmdMut.Lock()
+	p.cmds = append(p.cmds, command)
+	p.cmdMut.Unlock()
+	select {
+	case output := <-p.outputs:
+		opts.Stdout.Write(output)
+	case <-time.After(1e6):
+	}
+	if opts.Stdin != nil {
+		io.Copy(opts.Stdout, opts.Stdin)
+	}
+	return p.getError("Shell")
+}
+
 func (p *FakeProvisioner) CollectStatus() ([]provision.Unit, error) {
 	if err := p.getError("CollectStatus"); err != nil {
 		return nil, err
@@ -397,3 +729,111 @@ func (p *FakeProvisioner) Addr(app provision.App) (string, error) {
 	}
 	return fmt.Sprintf("%s.fake-lb.tsuru.io", app.GetName()), nil
 }
+
+// FakeDeployer is a FakeProvisioner that also implements provision.Deployer,
+// recording deploys instead of running commands in the units.
+type FakeDeployer struct {
+	*FakeProvisioner
+	deploys  map[string]int
+	versions map[string][]string
+	depMut   sync.Mutex
+}
+
+func NewFakeDeployer() *FakeDeployer {
+	return &FakeDeployer{
+		FakeProvisioner: NewFakeProvisioner(),
+		deploys:         make(map[string]int),
+		versions:        make(map[string][]string),
+	}
+}
+
+// Deploys returns the number of calls to Deploy for the given app.
+func (d *FakeDeployer) Deploys(app provision.App) int {
+	d.depMut.Lock()
+	defer d.depMut.Unlock()
+	return d.deploys[app.GetName()]
+}
+
+// Versions returns the versions deployed in the given app, in order.
+func (d *FakeDeployer) Versions(app provision.App) []string {
+	d.depMut.Lock()
+	defer d.depMut.Unlock()
+	return d.versions[app.GetName()]
+}
+
+func (d *FakeDeployer) Reset() {
+	d.depMut.Lock()
+	d.deploys = make(map[string]int)
+	d.versions = make(map[string][]string)
+	d.depMut.Unlock()
+	d.FakeProvisioner.Reset()
+}
+
+func (d *FakeDeployer) Deploy(app provision.App, version string, w io.Writer) error {
+	if err := d.getError("Deploy"); err != nil {
+		return err
+	}
+	d.depMut.Lock()
+	d.deploys[app.GetName()]++
+	d.versions[app.GetName()] = append(d.versions[app.GetName()], version)
+	d.depMut.Unlock()
+	_, err := fmt.Fprintf(w, "Deploying %s\n", app.GetName())
+	return err
+}
+
+// FakeUploader is a FakeProvisioner that also implements provision.Uploader,
+// storing the uploaded archives instead of extracting them in the units.
+type FakeUploader struct {
+	*FakeProvisioner
+	archives map[string][][]byte
+	paths    map[string][]string
+	upMut    sync.Mutex
+}
+
+func NewFakeUploader() *FakeUploader {
+	return &FakeUploader{
+		FakeProvisioner: NewFakeProvisioner(),
+		archives:        make(map[string][][]byte),
+		paths:           make(map[string][]string),
+	}
+}
+
+// Archives returns the content of the archives uploaded to the given app, in
+// order.
+func (u *FakeUploader) Archives(app provision.App) [][]byte {
+	u.upMut.Lock()
+	defer u.upMut.Unlock()
+	return u.archives[app.GetName()]
+}
+
+// Paths returns the paths where archives were extracted in the given app, in
+// order.
+func (u *FakeUploader) Paths(app provision.App) []string {
+	u.upMut.Lock()
+	defer u.upMut.Unlock()
+	return u.paths[app.GetName()]
+}
+
+func (u *FakeUploader) Reset() {
+	u.upMut.Lock()
+	u.archives = make(map[string][][]byte)
+	u.paths = make(map[string][]string)
+	u.upMut.Unlock()
+	u.FakeProvisioner.Reset()
+}
+
+func (u *FakeUploader) Upload(app provision.App, archive io.Reader, path string, w io.Writer) error {
+	if err := u.getError("Upload"); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	u.upMut.Lock()
+	u.archives[app.GetName()] = append(u.archives[app.GetName()], content)
+	u.paths[app.GetName()] = append(u.paths[app.GetName()], path)
+	u.upMut.Unlock()
+	_, err = fmt.Fprintf(w, "Uploading %s\n", app.GetName())
+	return err
+}
@@ -9,7 +9,9 @@ import (
 	"errors"
 	"github.com/globocom/tsuru/provision"
 	"launchpad.net/gocheck"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test(t *testing.T) {
@@ -20,6 +22,13 @@ type S struct{}
 
 var _ = gocheck.Suite(&S{})
 
+func (s *S) TestFakeUnitGetProcessType(c *gocheck.C) {
+	u := FakeUnit{Name: "red-sector/0"}
+	c.Assert(u.GetProcessType(), gocheck.Equals, provision.WebProcess)
+	u.ProcessType = "worker"
+	c.Assert(u.GetProcessType(), gocheck.Equals, "worker")
+}
+
 func (s *S) TestFindApp(c *gocheck.C) {
 	app := NewFakeApp("red-sector", "rush", 1)
 	p := NewFakeProvisioner()
@@ -61,8 +70,8 @@ func (s *S) TestGetCmds(c *gocheck.C) {
 
 func (s *S) TestGetUnits(c *gocheck.C) {
 	list := []provision.Unit{
-		{"chain-lighting/0", "chain-lighting", "django", "i-0801", 1, "10.10.10.10", provision.StatusStarted},
-		{"chain-lighting/1", "chain-lighting", "django", "i-0802", 2, "10.10.10.15", provision.StatusStarted},
+		{"chain-lighting/0", "chain-lighting", "django", "", "i-0801", 1, "10.10.10.10", provision.StatusStarted},
+		{"chain-lighting/1", "chain-lighting", "django", "", "i-0802", 2, "10.10.10.15", provision.StatusStarted},
 	}
 	app := NewFakeApp("chain-lighting", "rush", 1)
 	p := NewFakeProvisioner()
@@ -144,6 +153,80 @@ func (s *S) TestRestartWithPreparedFailure(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, "Failed to restart.")
 }
 
+func (s *S) TestRestartUnit(c *gocheck.C) {
+	app := NewFakeApp("kid-gloves", "rush", 2)
+	p := NewFakeProvisioner()
+	units := app.ProvisionUnits()
+	c.Assert(p.RestartUnit(app, units[1]), gocheck.IsNil)
+	c.Assert(p.RestartUnit(app, units[0]), gocheck.IsNil)
+	c.Assert(p.RestartedUnits(app), gocheck.DeepEquals, []string{units[1].GetName(), units[0].GetName()})
+	c.Assert(p.Restarts(app), gocheck.Equals, 0)
+}
+
+func (s *S) TestRestartUnitWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("fairy-tale", "shaman", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("RestartUnit", errors.New("Failed to restart."))
+	err := p.RestartUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to restart.")
+	c.Assert(p.RestartedUnits(app), gocheck.HasLen, 0)
+}
+
+func (s *S) TestDisableAndEnableUnit(c *gocheck.C) {
+	app := NewFakeApp("kid-gloves", "rush", 1)
+	p := NewFakeProvisioner()
+	unit := app.ProvisionUnits()[0]
+	c.Assert(p.Disabled(unit), gocheck.Equals, false)
+	c.Assert(p.DisableUnit(app, unit), gocheck.IsNil)
+	c.Assert(p.Disabled(unit), gocheck.Equals, true)
+	c.Assert(p.EnableUnit(app, unit), gocheck.IsNil)
+	c.Assert(p.Disabled(unit), gocheck.Equals, false)
+}
+
+func (s *S) TestStopAndStart(c *gocheck.C) {
+	app := NewFakeApp("kid-gloves", "rush", 1)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	err := p.Stop(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.GetUnits(app)[0].Status, gocheck.Equals, provision.StatusStopped)
+	err = p.Start(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.GetUnits(app)[0].Status, gocheck.Equals, provision.StatusStarted)
+}
+
+func (s *S) TestStopWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("fairy-tale", "shaman", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("Stop", errors.New("Failed to stop."))
+	err := p.Stop(app)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to stop.")
+}
+
+func (s *S) TestMaintenance(c *gocheck.C) {
+	app := NewFakeApp("kid-gloves", "rush", 1)
+	p := NewFakeProvisioner()
+	err := p.StartMaintenance(app, []byte("closed"))
+	c.Assert(err, gocheck.IsNil)
+	ok, page := p.InMaintenance(app)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(string(page), gocheck.Equals, "closed")
+	err = p.StopMaintenance(app)
+	c.Assert(err, gocheck.IsNil)
+	ok, _ = p.InMaintenance(app)
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestStartMaintenanceWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("fairy-tale", "shaman", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("StartMaintenance", errors.New("Failed to start maintenance."))
+	err := p.StartMaintenance(app, nil)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to start maintenance.$")
+}
+
 func (s *S) TestDestroy(c *gocheck.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
@@ -210,6 +293,135 @@ func (s *S) TestAddUnitsFailure(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add more units.")
 }
 
+func (s *S) TestAddProcessUnits(c *gocheck.C) {
+	app := NewFakeApp("mystic-rhythms", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	units, err := p.AddProcessUnits(app, 2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.units["mystic-rhythms"], gocheck.HasLen, 3)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.ProcessType, gocheck.Equals, "worker")
+	}
+}
+
+func (s *S) TestAddProcessUnitsFailure(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.PrepareFailure("AddProcessUnits", errors.New("Cannot add more units."))
+	units, err := p.AddProcessUnits(nil, 10, "worker")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "Cannot add more units.")
+}
+
+func (s *S) TestFakeProvisionerIsAProcessProvisioner(c *gocheck.C) {
+	var _ provision.ProcessProvisioner = NewFakeProvisioner()
+}
+
+func (s *S) TestFakeProvisionerIsABlueGreenProvisioner(c *gocheck.C) {
+	var _ provision.BlueGreenProvisioner = NewFakeProvisioner()
+}
+
+func (s *S) TestAddStandbyUnits(c *gocheck.C) {
+	app := NewFakeApp("vital-signs", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	units, err := p.AddStandbyUnits(app, 2, "web")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	c.Assert(p.units["vital-signs"], gocheck.HasLen, 3)
+	c.Assert(units[0].Status, gocheck.Equals, provision.StatusStarted)
+	c.Assert(p.units["vital-signs"][2].Ip, gocheck.Equals, "127.0.0.1")
+}
+
+func (s *S) TestAddStandbyUnitsFailure(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.PrepareFailure("AddStandbyUnits", errors.New("Cannot add more units."))
+	units, err := p.AddStandbyUnits(nil, 1, "web")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "Cannot add more units.")
+}
+
+func (s *S) TestSwitchUnits(c *gocheck.C) {
+	app := NewFakeApp("red-barchetta", "rush", 3)
+	p := NewFakeProvisioner()
+	units := app.ProvisionUnits()
+	err := p.SwitchUnits(app, units[1:], units[:1])
+	c.Assert(err, gocheck.IsNil)
+	standby, old := p.Switched(app)
+	c.Assert(standby, gocheck.DeepEquals, []string{units[1].GetName(), units[2].GetName()})
+	c.Assert(old, gocheck.DeepEquals, []string{units[0].GetName()})
+}
+
+func (s *S) TestSwitchUnitsWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("red-barchetta", "rush", 2)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("SwitchUnits", errors.New("Failed to switch."))
+	units := app.ProvisionUnits()
+	err := p.SwitchUnits(app, units[1:], units[:1])
+	c.Assert(err, gocheck.ErrorMatches, "Failed to switch.")
+	standby, _ := p.Switched(app)
+	c.Assert(standby, gocheck.IsNil)
+}
+
+func (s *S) TestSetUnitsWeight(c *gocheck.C) {
+	app := NewFakeApp("red-barchetta", "rush", 3)
+	p := NewFakeProvisioner()
+	units := app.ProvisionUnits()
+	err := p.SetUnitsWeight(app, units[1:], 5)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.Weight(app, units[0].GetName()), gocheck.Equals, 1)
+	c.Assert(p.Weight(app, units[1].GetName()), gocheck.Equals, 5)
+	c.Assert(p.Weight(app, units[2].GetName()), gocheck.Equals, 5)
+}
+
+func (s *S) TestSetUnitsWeightWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("red-barchetta", "rush", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("SetUnitsWeight", errors.New("Failed to set weight."))
+	units := app.ProvisionUnits()
+	err := p.SetUnitsWeight(app, units, 5)
+	c.Assert(err, gocheck.ErrorMatches, "Failed to set weight.")
+	c.Assert(p.Weight(app, units[0].GetName()), gocheck.Equals, 1)
+}
+
+func (s *S) TestUnitsStats(c *gocheck.C) {
+	app := NewFakeApp("red-barchetta", "rush", 2)
+	p := NewFakeProvisioner()
+	units := app.ProvisionUnits()
+	p.SetUnitStats(app, units[0].GetName(), provision.UnitStats{Requests: 10, Errors: 1})
+	stats, err := p.UnitsStats(app, units, time.Now())
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]provision.UnitStats{
+		units[0].GetName(): {Requests: 10, Errors: 1},
+		units[1].GetName(): {},
+	}
+	c.Assert(stats, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCollectMetrics(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	metrics, err := p.CollectMetrics()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(metrics, gocheck.HasLen, 0)
+	sample := provision.UnitMetrics{AppName: "tom-sawyer", Unit: "tom-sawyer/0", CPU: 12.5, Memory: 40, Disk: 10}
+	p.SetMetrics(sample)
+	metrics, err = p.CollectMetrics()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(metrics, gocheck.DeepEquals, []provision.UnitMetrics{sample})
+}
+
+func (s *S) TestCollectMetricsFailure(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.PrepareFailure("CollectMetrics", errors.New("cgroups not mounted"))
+	_, err := p.CollectMetrics()
+	c.Assert(err, gocheck.ErrorMatches, "cgroups not mounted")
+}
+
+func (s *S) TestFakeProvisionerIsAMetricsCollector(c *gocheck.C) {
+	var _ provision.MetricsCollector = &FakeProvisioner{}
+}
+
 func (s *S) TestRemoveUnit(c *gocheck.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
@@ -262,6 +474,95 @@ func (s *S) TestExecuteCommand(c *gocheck.C) {
 	c.Assert(buf.String(), gocheck.Equals, string(output))
 }
 
+func (s *S) TestFakeProvisionerIsAUnitCommandExecutor(c *gocheck.C) {
+	var _ provision.UnitCommandExecutor = &FakeProvisioner{}
+}
+
+func (s *S) TestExecuteCommandOnUnit(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("grand-designs", "rush", 2)
+	p := NewFakeProvisioner()
+	p.PrepareOutput([]byte("myoutput!"))
+	err := p.ExecuteCommandOnUnit(&buf, nil, app, app.ProvisionUnits()[1], "ls", "-l")
+	c.Assert(err, gocheck.IsNil)
+	cmds := p.GetCmds("ls", app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "grand-designs/1")
+	c.Assert(cmds[0].Args, gocheck.DeepEquals, []string{"-l"})
+	c.Assert(buf.String(), gocheck.Equals, "myoutput!")
+}
+
+func (s *S) TestExecuteCommandOnUnitFailure(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("grand-designs", "rush", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("ExecuteCommandOnUnit", &provision.ExitError{Status: 2})
+	err := p.ExecuteCommandOnUnit(&buf, nil, app, app.ProvisionUnits()[0], "ls")
+	c.Assert(err, gocheck.DeepEquals, &provision.ExitError{Status: 2})
+	c.Assert(buf.String(), gocheck.Equals, "")
+}
+
+func (s *S) TestFakeProvisionerIsAnInputCommandExecutor(c *gocheck.C) {
+	var _ provision.InputCommandExecutor = &FakeProvisioner{}
+}
+
+func (s *S) TestExecuteCommandOnUnitWithInput(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("grand-designs", "rush", 2)
+	p := NewFakeProvisioner()
+	p.PrepareOutput([]byte("done"))
+	err := p.ExecuteCommandOnUnitWithInput(strings.NewReader("archive"), &buf, nil, app, app.ProvisionUnits()[0], "tar", "-xzf", "-")
+	c.Assert(err, gocheck.IsNil)
+	cmds := p.GetCmds("tar", app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "grand-designs/0")
+	c.Assert(cmds[0].Args, gocheck.DeepEquals, []string{"-xzf", "-"})
+	c.Assert(string(cmds[0].Input), gocheck.Equals, "archive")
+	c.Assert(buf.String(), gocheck.Equals, "done")
+}
+
+func (s *S) TestExecuteCommandOnUnitWithInputFailure(c *gocheck.C) {
+	app := NewFakeApp("grand-designs", "rush", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("ExecuteCommandOnUnitWithInput", &provision.ExitError{Status: 2})
+	err := p.ExecuteCommandOnUnitWithInput(strings.NewReader(""), nil, nil, app, app.ProvisionUnits()[0], "tar")
+	c.Assert(err, gocheck.DeepEquals, &provision.ExitError{Status: 2})
+}
+
+func (s *S) TestFakeProvisionerIsAShellProvisioner(c *gocheck.C) {
+	var _ provision.ShellProvisioner = &FakeProvisioner{}
+}
+
+func (s *S) TestShell(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("grand-designs", "rush", 2)
+	p := NewFakeProvisioner()
+	p.PrepareOutput([]byte("$ "))
+	opts := provision.ShellOptions{
+		App:    app,
+		Unit:   app.ProvisionUnits()[1],
+		Cmd:    "bash -l",
+		Stdin:  strings.NewReader("ls\n"),
+		Stdout: &buf,
+	}
+	err := p.Shell(opts)
+	c.Assert(err, gocheck.IsNil)
+	cmds := p.GetCmds("bash -l", app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(cmds[0].Unit, gocheck.Equals, "grand-designs/1")
+	c.Assert(buf.String(), gocheck.Equals, "$ ls\n")
+}
+
+func (s *S) TestShellFailure(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("grand-designs", "rush", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("Shell", &provision.ExitError{Status: 130})
+	opts := provision.ShellOptions{App: app, Unit: app.ProvisionUnits()[0], Cmd: "bash -l", Stdout: &buf}
+	err := p.Shell(opts)
+	c.Assert(err, gocheck.DeepEquals, &provision.ExitError{Status: 130})
+}
+
 func (s *S) TestExecuteCommandFailureNoOutput(c *gocheck.C) {
 	app := NewFakeApp("manhattan-project", "rush", 1)
 	p := NewFakeProvisioner()
@@ -300,10 +601,10 @@ func (s *S) TestCollectStatus(c *gocheck.C) {
 		NewFakeApp("grand-designs", "rush", 1),
 	}
 	expected := []provision.Unit{
-		{"red-lenses/0", "red-lenses", "rush", "i-0801", 1, "10.10.10.1", "started"},
-		{"between-the-wheels/0", "between-the-wheels", "rush", "i-0802", 2, "10.10.10.2", "started"},
-		{"the-big-money/0", "the-big-money", "rush", "i-0803", 3, "10.10.10.3", "started"},
-		{"grand-designs/0", "grand-designs", "rush", "i-0804", 4, "10.10.10.4", "started"},
+		{"red-lenses/0", "red-lenses", "rush", "", "i-0801", 1, "10.10.10.1", "started"},
+		{"between-the-wheels/0", "between-the-wheels", "rush", "", "i-0802", 2, "10.10.10.2", "started"},
+		{"the-big-money/0", "the-big-money", "rush", "", "i-0803", 3, "10.10.10.3", "started"},
+		{"grand-designs/0", "grand-designs", "rush", "", "i-0804", 4, "10.10.10.4", "started"},
 	}
 	units, err := p.CollectStatus()
 	c.Assert(err, gocheck.IsNil)
@@ -341,3 +642,63 @@ func (s *S) TestAddrFailure(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot get addr of this app.")
 }
+
+func (s *S) TestFakeDeployerIsADeployer(c *gocheck.C) {
+	var p provision.Provisioner = NewFakeDeployer()
+	_, ok := p.(provision.Deployer)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestFakeDeployerDeploy(c *gocheck.C) {
+	app := NewFakeApp("soul", "rush", 1)
+	d := NewFakeDeployer()
+	var buf bytes.Buffer
+	err := d.Deploy(app, "a9b1e3f", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "Deploying soul\n")
+	c.Assert(d.Deploys(app), gocheck.Equals, 1)
+	c.Assert(d.Versions(app), gocheck.DeepEquals, []string{"a9b1e3f"})
+	d.Reset()
+	c.Assert(d.Deploys(app), gocheck.Equals, 0)
+	c.Assert(d.Versions(app), gocheck.IsNil)
+}
+
+func (s *S) TestFakeDeployerDeployWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("soul", "rush", 1)
+	d := NewFakeDeployer()
+	d.PrepareFailure("Deploy", errors.New("Failed to deploy."))
+	var buf bytes.Buffer
+	err := d.Deploy(app, "", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "Failed to deploy.")
+	c.Assert(d.Deploys(app), gocheck.Equals, 0)
+}
+
+func (s *S) TestFakeUploaderIsAnUploader(c *gocheck.C) {
+	var p provision.Provisioner = NewFakeUploader()
+	_, ok := p.(provision.Uploader)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestFakeUploaderUpload(c *gocheck.C) {
+	app := NewFakeApp("soul", "rush", 1)
+	u := NewFakeUploader()
+	var buf bytes.Buffer
+	err := u.Upload(app, strings.NewReader("some archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "Uploading soul\n")
+	c.Assert(u.Archives(app), gocheck.DeepEquals, [][]byte{[]byte("some archive")})
+	c.Assert(u.Paths(app), gocheck.DeepEquals, []string{"/home/application/current"})
+	u.Reset()
+	c.Assert(u.Archives(app), gocheck.IsNil)
+	c.Assert(u.Paths(app), gocheck.IsNil)
+}
+
+func (s *S) TestFakeUploaderUploadWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("soul", "rush", 1)
+	u := NewFakeUploader()
+	u.PrepareFailure("Upload", errors.New("Failed to upload."))
+	var buf bytes.Buffer
+	err := u.Upload(app, strings.NewReader("some archive"), "/home/application/current", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "Failed to upload.")
+	c.Assert(u.Archives(app), gocheck.HasLen, 0)
+}